@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// defaultAdminPrefix is the prefix of admin routes like `/__health` unless
+// `--admin-prefix` is given.
+const defaultAdminPrefix = "/__"
+
+// adminPrefix returns the prefix of admin routes, e.g. `/_apisprout/` when
+// the document's own paths start with `/__`. Other prefixes than the default
+// are directories, so `/_apisprout` is the same as `/_apisprout/`.
+func adminPrefix(config *viper.Viper) string {
+	prefix := config.GetString("admin-prefix")
+	if prefix == "" || prefix == defaultAdminPrefix {
+		return defaultAdminPrefix
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// adminPath returns the path of an admin route, e.g. `/__health`.
+func adminPath(config *viper.Viper, name string) string {
+	return adminPrefix(config) + name
+}
+
+// isAdminPath returns true if a path is one of the admin routes rather than
+// part of the document, unless they are disabled via `--disable-admin`.
+func isAdminPath(config *viper.Viper, path string) bool {
+	return !config.GetBool("disable-admin") && strings.HasPrefix(path, adminPrefix(config))
+}
+
+// adminLink returns the prefix of relative links from one admin page to
+// another, e.g. `__` for `__docs` or nothing for `/_apisprout/docs`.
+func adminLink(config *viper.Viper) string {
+	prefix := adminPrefix(config)
+	return prefix[strings.LastIndex(prefix, "/")+1:]
+}
+
+// adminRoot returns the relative link from an admin page to the root of the
+// API, e.g. `../` for `/_apisprout/docs`.
+func adminRoot(config *viper.Viper) string {
+	depth := strings.Count(adminPrefix(config), "/") - 1
+	if depth == 0 {
+		return "./"
+	}
+	return strings.Repeat("../", depth)
+}
+
+// protectAdmin requires `--admin-token` as a bearer token for admin requests
+// which change state, i.e. anything but reading.
+func (s *OpenAPIServer) protectAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !authorizeBearer(w, req, "admin", s.settings().GetString("admin-token")) {
+				return
+			}
+		}
+		handler(w, req)
+	}
+}
+
+// adminToggles are the settings which can be switched on and off from the
+// admin dashboard. They are read for each request, so changes apply right
+// away.
+var adminToggles = []string{
+	"validate-request", "validate-security", "validate-response",
+	"validate-response-strict", "strict-content-type", "reject-read-only",
+	"coerce-params", "no-example-fallback", "disable-cors",
+}
+
+// adminRecentRequests is how many of the most recent requests the dashboard
+// shows.
+const adminRecentRequests = 20
+
+// adminToggle is the current state of a setting shown on the dashboard.
+type adminToggle struct {
+	Name    string
+	Enabled bool
+}
+
+// adminOverride is an example override shown on the dashboard.
+type adminOverride struct {
+	*ExampleOverride
+	Encoded string
+}
+
+// adminPage is the data rendered by the dashboard template.
+type adminPage struct {
+	Link        string
+	CSRF        string
+	Title       string
+	Version     string
+	Description string
+	URI         string
+	ReadOnly    bool
+	Requests    []RecordedRequest
+	Coverage    *Coverage
+	Overrides   []adminOverride
+	Toggles     []adminToggle
+}
+
+// adminTemplate renders the dashboard. Links are relative, so it works the
+// same for APIs mounted under a prefix.
+var adminTemplate = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - API Sprout</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+code, pre { font-size: 90%; }
+pre { margin: 0; max-width: 40em; overflow: auto; }
+.missing { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} <small>{{.Version}}</small></h1>
+{{with .Description}}<p>{{.}}</p>{{end}}
+<p>Served from <code>{{.URI}}</code>. See also <a href="{{.Link}}docs">the docs</a>, <a href="{{.Link}}schema">the document</a>, <a href="{{.Link}}requests">requests</a>, <a href="{{.Link}}coverage">coverage</a>, <a href="{{.Link}}metrics">metrics</a>, <a href="{{.Link}}events">events</a> and <a href="{{.Link}}config">configuration</a>.</p>
+
+<h2>Settings</h2>
+<table>
+<tr><th>Setting</th><th>Enabled</th>{{if not .ReadOnly}}<th></th>{{end}}</tr>
+{{range .Toggles}}<tr>
+<td><code>{{.Name}}</code></td><td>{{.Enabled}}</td>
+{{if not $.ReadOnly}}<td><form method="post" action="{{$.Link}}admin"><input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="setting" value="{{.Name}}"><input type="hidden" name="value" value="{{not .Enabled}}"><button>{{if .Enabled}}Disable{{else}}Enable{{end}}</button></form></td>{{end}}
+</tr>{{end}}
+</table>
+
+<h2>Routes</h2>
+<table>
+<tr><th>Method</th><th>Path</th><th>Operation</th><th>Hits</th></tr>
+{{range .Coverage.Operations}}<tr><td>{{.Method}}</td><td><code>{{.Path}}</code></td><td>{{.OperationID}}</td><td>{{.Hits}}</td></tr>
+{{end}}</table>
+
+<h2>Coverage</h2>
+<p>{{.Coverage.Covered}} of {{.Coverage.Total}} operations called ({{.Coverage.Percent}}%).</p>
+{{if .Coverage.Uncovered}}<ul>{{range .Coverage.Uncovered}}<li class="missing">{{.Method}} <code>{{.Path}}</code> {{.OperationID}}</li>{{end}}</ul>{{end}}
+
+<h2>Recent Requests</h2>
+{{if .Requests}}<table>
+<tr><th>Time</th><th>Request</th><th>Operation</th><th>Status</th></tr>
+{{range .Requests}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.Method}} <code>{{.Path}}{{with .Query}}?{{.}}{{end}}</code></td><td>{{.OperationID}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>{{else}}<p>No requests yet.</p>{{end}}
+
+<h2>Example Overrides</h2>
+{{if .Overrides}}<table>
+<tr><th>Operation</th><th>Status</th><th>Media Type</th><th>Example</th></tr>
+{{range .Overrides}}<tr><td>{{.Operation}}</td><td>{{.Status}}</td><td>{{.MediaType}}</td><td><pre>{{.Encoded}}</pre></td></tr>
+{{end}}</table>{{else}}<p>No overrides, see <code>{{.Link}}examples</code>.</p>{{end}}
+</body>
+</html>
+`))
+
+// admin serves a dashboard with the loaded document, its routes with their
+// coverage, recent requests and overrides, so the mock can be operated
+// without memorizing flags and headers. Posting a `setting` and `value` form
+// switches one of the `adminToggles`.
+func (s *OpenAPIServer) admin(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if s.settings().GetBool("read-only") {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.toggleSetting(w, req)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	swagger := s.Swagger()
+	if swagger == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("loading"))
+		return
+	}
+
+	s.mu.RLock()
+	uri := s.uri
+	s.mu.RUnlock()
+
+	page := adminPage{
+		Link:        adminLink(s.settings()),
+		CSRF:        s.csrf,
+		Title:       swagger.Info.Title,
+		Version:     swagger.Info.Version,
+		Description: swagger.Info.Description,
+		URI:         uri,
+		ReadOnly:    s.settings().GetBool("read-only"),
+		Coverage:    s.Coverage(),
+		Overrides:   make([]adminOverride, 0),
+		Toggles:     make([]adminToggle, 0, len(adminToggles)),
+	}
+
+	// Show the newest requests first.
+	requests := s.Requests("")
+	for i := len(requests) - 1; i >= 0 && len(page.Requests) < adminRecentRequests; i-- {
+		page.Requests = append(page.Requests, requests[i])
+	}
+
+	for _, o := range s.listOverrides() {
+		encoded, _ := json.MarshalIndent(o.Example, "", "  ")
+		page.Overrides = append(page.Overrides, adminOverride{o, string(encoded)})
+	}
+
+	for _, name := range adminToggles {
+		page.Toggles = append(page.Toggles, adminToggle{name, s.settings().GetBool(name)})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := adminTemplate.Execute(w, page); err != nil {
+		log.Printf("ERROR: Unable to render admin page: %v", err)
+	}
+}
+
+// toggleSetting switches a setting from the dashboard's form and sends the
+// browser back to the dashboard. The form must include the dashboard's CSRF
+// token, so other sites can't switch settings via the browsers of users who
+// can reach the mock.
+func (s *OpenAPIServer) toggleSetting(w http.ResponseWriter, req *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(req.FormValue("csrf")), []byte(s.csrf)) != 1 {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("invalid CSRF token, reload the admin page"))
+		return
+	}
+
+	name := req.FormValue("setting")
+	value, err := strconv.ParseBool(req.FormValue("value"))
+	if err != nil || !isAdminToggle(name) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("unknown setting or value"))
+		return
+	}
+
+	setConfig(s.config, name, value)
+	log.Printf("⚙️  Applied %s = %v from the admin page", name, value)
+	s.recordConfigChange(name, value, "admin page")
+
+	// A relative location keeps any mount prefix.
+	w.Header().Set("Location", adminLink(s.settings())+"admin")
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// newCSRFToken returns a random token for the dashboard's forms.
+func newCSRFToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(token)
+}
+
+// isAdminToggle returns true if a setting can be switched from the dashboard.
+func isAdminToggle(name string) bool {
+	for _, toggle := range adminToggles {
+		if toggle == name {
+			return true
+		}
+	}
+	return false
+}
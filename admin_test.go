@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	const schema = `{
+		"info": {"title": "Widget API", "version": "1.2.3"},
+		"paths": {
+			"/items": {
+				"get": {"operationId": "listItems", "responses": {"200": {"description": "ok", "content": {"application/json": {"example": []}}}}},
+				"post": {"operationId": "createItem", "responses": {"201": {"description": "created"}}}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		readOnly bool
+		form     url.Values
+		csrf     bool
+		status   int
+		enabled  bool
+	}{
+		{"Enable", false, url.Values{"setting": {"validate-request"}, "value": {"true"}}, true, http.StatusSeeOther, true},
+		{"Unknown setting", false, url.Values{"setting": {"port"}, "value": {"true"}}, true, http.StatusBadRequest, false},
+		{"Invalid value", false, url.Values{"setting": {"validate-request"}, "value": {"maybe"}}, true, http.StatusBadRequest, false},
+		{"Missing CSRF token", false, url.Values{"setting": {"validate-request"}, "value": {"true"}}, false, http.StatusForbidden, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("history-size", 10)
+			config.Set("read-only", test.readOnly)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items?page=2", nil))
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest("GET", "/__admin", nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "text/html; charset=utf-8", resp.Header().Get("Content-Type"))
+
+			page := resp.Body.String()
+			assert.Contains(t, page, "<h1>Widget API <small>1.2.3</small></h1>")
+			assert.Contains(t, page, "GET <code>/items?page=2</code>")
+			assert.Contains(t, page, "1 of 2 operations called (50%)")
+			assert.Contains(t, page, `<li class="missing">POST <code>/items</code> createItem</li>`)
+			assert.Equal(t, !test.readOnly, strings.Contains(page, `<form method="post" action="__admin">`))
+
+			assert.Contains(t, page, `<input type="hidden" name="csrf" value="`+s.csrf+`">`)
+			if test.csrf {
+				test.form.Set("csrf", s.csrf)
+			}
+
+			req := httptest.NewRequest("POST", "/__admin", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resp = httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			assert.Equal(t, test.enabled, s.settings().GetBool("validate-request"))
+			if test.status == http.StatusSeeOther {
+				assert.Equal(t, "__admin", resp.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestAdminPrefix(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/__health": {"get": {"operationId": "getHealth", "responses": {"200": {"description": "ok", "content": {"application/json": {"example": {"up": true}}}}}}}
+		}
+	}`
+
+	tests := []struct {
+		name    string
+		prefix  string
+		disable bool
+		method  string
+		path    string
+		status  int
+		body    string
+	}{
+		{"Default", "", false, "GET", "/__health", http.StatusOK, ""},
+		{"Moved", "/_apisprout/", false, "GET", "/_apisprout/health", http.StatusOK, ""},
+		{"Moved frees path", "/_apisprout/", false, "GET", "/__health", http.StatusOK, `"up": true`},
+		{"Without slash", "_apisprout/", false, "GET", "/_apisprout/ready", http.StatusOK, ""},
+		{"Without trailing slash", "/_apisprout", false, "GET", "/_apisprout/ready", http.StatusOK, ""},
+		{"Moved docs", "/_apisprout/", false, "GET", "/_apisprout/docs", http.StatusOK, `fetch("docs/openapi.json")`},
+		{"Moved docs server", "/_apisprout/", false, "GET", "/_apisprout/redoc", http.StatusOK, `new URL("..\/", window.location.href)`},
+		{"Moved admin", "/_apisprout/", false, "GET", "/_apisprout/admin", http.StatusOK, `<a href="docs">`},
+		{"Disabled", "", true, "GET", "/__health", http.StatusOK, `"up": true`},
+		{"Disabled admin", "", true, "GET", "/__admin", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("admin-prefix", test.prefix)
+			config.Set("disable-admin", test.disable)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest(test.method, test.path, nil))
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.body != "" {
+				assert.Contains(t, resp.Body.String(), test.body)
+			}
+		})
+	}
+}
+
+func TestAdminRoot(t *testing.T) {
+	tests := []struct {
+		prefix string
+		link   string
+		root   string
+	}{
+		{"", "__", "./"},
+		{"/__", "__", "./"},
+		{"/_apisprout/", "", "../"},
+		{"/_apisprout", "", "../"},
+		{"/_mock/admin/", "", "../../"},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.Set("admin-prefix", test.prefix)
+		assert.Equal(t, test.link, adminLink(config), test.prefix)
+		assert.Equal(t, test.root, adminRoot(config), test.prefix)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	config := viper.New()
+	config.Set("admin-token", "secret")
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(`{"paths": {}}`)))
+
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("GET", "/__requests", ""))
+	assert.Equal(t, http.StatusUnauthorized, do("DELETE", "/__requests", ""))
+	assert.Equal(t, http.StatusUnauthorized, do("DELETE", "/__requests", "wrong"))
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/__requests", "secret"))
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/__reload", ""))
+
+	// Either token is accepted for reloads.
+	config.Set("reload-token", "reload")
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/__examples", "reload"))
+	assert.NotEqual(t, http.StatusUnauthorized, do("POST", "/__reload", "reload"))
+	assert.NotEqual(t, http.StatusUnauthorized, do("POST", "/__reload", "secret"))
+}
+
+func TestMountServerAdminPrefix(t *testing.T) {
+	mounted := NewMountServer()
+	mounted.Mount("/users", NewOpenAPIServer(viper.New()))
+
+	get := func(path string) int {
+		resp := httptest.NewRecorder()
+		mounted.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("/__health"))
+
+	mounted.SetAdminPrefix("/_apisprout/")
+	assert.Equal(t, http.StatusNotFound, get("/__health"))
+	assert.Equal(t, http.StatusOK, get("/_apisprout/health"))
+
+	mounted.SetAdminPrefix("")
+	assert.Equal(t, http.StatusNotFound, get("/_apisprout/health"))
+}
@@ -2,19 +2,24 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -25,7 +30,6 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	yaml "gopkg.in/yaml.v2"
 )
 
 // GitSummary is filled in by `govvv` for version info.
@@ -46,24 +50,54 @@ var (
 	ErrMissingAuth = errors.New("Missing auth")
 
 	// ErrInvalidAuth is set when the authorization scheme doesn't correspond
-	// to the one required by the API description.
+	// to the one required by the API description, or its value is empty or
+	// malformed.
 	ErrInvalidAuth = errors.New("Invalid auth")
+
+	// ErrInvalidCredentials is set when basic auth credentials don't match
+	// any of the configured users.
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+
+	// ErrForbiddenToken is set when a bearer token is not one of the
+	// configured allowed tokens.
+	ErrForbiddenToken = errors.New("Token not allowed")
+
+	// ErrMissingAPIKey is set when the key of an `apiKey` security scheme is
+	// not present in the request.
+	ErrMissingAPIKey = errors.New("Missing API key")
+
+	// ErrInvalidAPIKey is set when an API key is not one of the configured
+	// valid keys.
+	ErrInvalidAPIKey = errors.New("Invalid API key")
 )
 
 var (
 	marshalJSONMatcher = regexp.MustCompile(`^application/(vnd\..+\+)?json$`)
 	marshalYAMLMatcher = regexp.MustCompile(`^(application|text)/(x-|vnd\..+\+)?yaml$`)
+	statusRangeMatcher = regexp.MustCompile(`^[1-5]XX$`)
+	statusListMatcher  = regexp.MustCompile(`(?i)\bstatus=((?:[1-5][0-9X]{2}\s*,\s*)+[1-5][0-9X]{2})`)
 )
 
+// RefreshableRouter holds the current router, which may be replaced while
+// requests are being served when the document is reloaded.
 type RefreshableRouter struct {
+	mu     sync.RWMutex
 	router *openapi3filter.Router
 }
 
+// Set replaces the current router.
 func (rr *RefreshableRouter) Set(router *openapi3filter.Router) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
 	rr.router = router
 }
 
+// Get returns the current router.
 func (rr *RefreshableRouter) Get() *openapi3filter.Router {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
 	return rr.router
 }
 
@@ -110,7 +144,8 @@ func (cn *ContentNegotiator) Match(mediatype string) bool {
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
+	// Executables created by `pack` run their own document and flags.
+	unpack()
 
 	// Load configuration from file(s) if provided.
 	viper.SetConfigName("config")
@@ -127,26 +162,198 @@ func main() {
 	// Build the root command. This is the application's entry point.
 	cmd := filepath.Base(os.Args[0])
 	root := &cobra.Command{
-		Use:     fmt.Sprintf("%s [flags] FILE", cmd),
+		Use:     fmt.Sprintf("%s [flags] FILE...", cmd),
 		Version: GitSummary,
-		Args:    cobra.MinimumNArgs(1),
+		Args:    cobra.ArbitraryArgs,
 		Run:     server,
-		Example: fmt.Sprintf("  # Basic usage\n  %s openapi.yaml\n\n  # Validate server name and use base path\n  %s --validate-server openapi.yaml\n\n  # Fetch API via HTTP with custom auth header\n  %s -H 'Authorization: abc123' http://example.com/openapi.yaml", cmd, cmd, cmd),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if err := applyProfiles(viper.GetViper()); err != nil {
+				log.Fatal(err)
+			}
+		},
+		Example: fmt.Sprintf("  # Basic usage\n  %s openapi.yaml\n\n  # Validate server name and use base path\n  %s --validate-server openapi.yaml\n\n  # Fetch API via HTTP with custom auth header\n  %s -H 'Authorization: abc123' http://example.com/openapi.yaml\n\n  # Serve several APIs under path prefixes\n  %s --mount /payments=payments.yaml --mount /users=users.yaml\n\n  # Serve two versions of an API\n  %s --api-version v1=old.yaml --api-version v2=new.yaml\n\n  # Serve every API in a directory\n  %s --watch specs/\n\n  # Read the API from stdin\n  cat openapi.yaml | %s -", cmd, cmd, cmd, cmd, cmd, cmd, cmd),
 	}
 
 	// Set up global options.
 	flags := root.PersistentFlags()
 
-	addParameter(flags, "port", "p", 8000, "HTTP port")
+	addParameter(flags, "quiet", "q", false, "Don't log a line per request, only errors and warnings")
+	addParameter(flags, "verbose", "v", counter(0), "Log debug details like the negotiated media type and chosen example, repeat for more, e.g. -vv")
+	addParameter(flags, "port", "p", 8000, "HTTP port, zero to pick a free port")
+	addParameter(flags, "instances", "", "", "Run several mock servers listed in this YAML or JSON file, each with its own spec, port and options")
+	addParameter(flags, "base-path", "", "", "Serve all routes, including the __ admin endpoints, under this path, e.g. /mock/petstore")
+	addParameter(flags, "virtual-hosts", "", false, "Route requests to the mounted document with a server matching their Host header, e.g. https://{tenant}.mock.local, before using path prefixes")
+	addParameter(flags, "strip-prefix", "", []string{}, "Remove this prefix from request paths before routing, e.g. /api added by a gateway, may be repeated")
+	addParameter(flags, "host", "", "", "Address of the interface to listen on, e.g. 127.0.0.1 to only allow local clients, defaults to all interfaces")
 	addParameter(flags, "validate-server", "s", false, "Check scheme/hostname/basepath against configured servers")
 	addParameter(flags, "validate-request", "", false, "Check request data structure")
+	addParameter(flags, "validate-security", "", false, "Check only the security requirements of requests")
+	addParameter(flags, "schema-format", "", "original", "Format of /__schema unless requested otherwise, either 'original' for the document as loaded, 'json' or 'yaml'")
+	addParameter(flags, "coverage-report", "", "", "Write a coverage report to this file on exit or SIGUSR1, JUnit XML for .xml files and JSON otherwise")
+	addParameter(flags, "coverage-format", "", "", "Format of the coverage report, either 'json' or 'junit', defaults to the file extension")
+	addParameter(flags, "fail-under", "", 0.0, "Exit with a non-zero code if less than this percentage of operations was called")
+	addParameter(flags, "docs-assets", "", defaultDocsAssets, "Base URL of the Swagger UI assets used by /__docs, e.g. a self-hosted copy")
+	addParameter(flags, "docs-renderer", "", "swagger-ui", "Renderer of the /__docs page, either 'swagger-ui' or 'redoc'")
+	addParameter(flags, "redoc-assets", "", defaultRedocAssets, "Base URL of the ReDoc script used by /__redoc, e.g. a self-hosted copy")
+	addParameter(flags, "history-size", "", 100, "Number of recent requests to keep for inspection at /__requests, zero to disable")
+	addParameter(flags, "warn-slow", "", time.Duration(0), "Log a warning with a timing breakdown for requests taking longer than this to handle, e.g. 500ms, zero to disable")
+	addParameter(flags, "dump", "", false, "Log the full request and the response served for each request, e.g. to debug validation failures")
+	addParameter(flags, "dump-max-size", "", 4096, "Maximum bytes of each request and response body to log, use with --dump")
+	addParameter(flags, "max-body-size", "", 0, "Reject request bodies larger than this many bytes with a 413, zero for no limit")
+	addParameter(flags, "validation-error-examples", "", false, "Serve the operation's own error response, e.g. its 400 or 422 example, when request validation fails")
+	addParameter(flags, "reject-read-only", "", false, "Reject request bodies containing readOnly properties, use with --validate-request")
+	addParameter(flags, "coerce-params", "", false, "Coerce query and path parameter values like ' 42 ' or 'yes' to their declared numeric or boolean types, use with --validate-request")
+	addParameter(flags, "strict-content-type", "", false, "Reject request bodies whose Content-Type is not declared for the operation with a 415")
+	addParameter(flags, "api-keys", "", "", "Comma-separated list of accepted API keys, use with --validate-request or --validate-security")
+	addParameter(flags, "basic-users", "", "", "Comma-separated list of user:pass accepted for basic auth, use with --validate-request or --validate-security")
+	addParameter(flags, "basic-htpasswd", "", "", "Path to an htpasswd file of users accepted for basic auth, use with --validate-request or --validate-security")
+	addParameter(flags, "auth-token", "", []string{}, "Bearer token accepted on protected operations, may be repeated, use with --validate-request or --validate-security")
+	addParameter(flags, "jwt-jwks", "", "", "URL or path of a JWKS used to verify bearer tokens, use with --validate-request or --validate-security")
+	addParameter(flags, "jwt-key", "", "", "Path to a PEM public key or HMAC secret used to verify bearer tokens, use with --validate-request or --validate-security")
+	addParameter(flags, "jwt-issuer", "", "", "Required issuer (iss) of verified bearer tokens")
+	addParameter(flags, "jwt-audience", "", "", "Required audience (aud) of verified bearer tokens")
+	addParameter(flags, "oidc-discovery", "", "", "URL or path of an OpenID Connect discovery document to use instead of the document's openIdConnectUrl")
+	addParameter(flags, "validate-response", "", false, "Check mocked responses against the document and log problems")
+	addParameter(flags, "validate-response-strict", "", false, "Respond with a 500 when a mocked response is invalid, use with --validate-response")
+	addParameter(flags, "reload-token", "", "", "Require this bearer token to reload the document via /__reload")
+	addParameter(flags, "admin-prefix", "", defaultAdminPrefix, "Prefix of admin routes like /__health and /__reload, e.g. /_apisprout/ if the document has paths starting with /__")
+	addParameter(flags, "disable-admin", "", false, "Disable all admin routes, so every path is mocked")
+	addParameter(flags, "admin-token", "", "", "Require this bearer token for admin requests which change state, e.g. reloads and example overrides")
+	addParameter(flags, "startup-retries", "", 0, "Retry loading documents this many times at startup, e.g. while a remote document isn't available yet")
+	addParameter(flags, "startup-timeout", "", time.Duration(0), "Keep retrying to load documents at startup for this long, reporting loading via /__health meanwhile")
 	addParameter(flags, "watch", "w", false, "Reload when input file changes")
+	addParameter(flags, "profile", "", []string{}, "Apply a named profile of settings from the config file, e.g. strict, may be repeated")
+	addParameter(flags, "watch-config", "", false, "Apply changes to settings like validation and CORS in the config file without restarting")
+	addParameter(flags, "merge", "", false, "Merge all given documents, which each describe part of the same API, into one API")
+	addParameter(flags, "mount", "", []string{}, "Serve a document under a path prefix, e.g. /users=users.yaml, may be repeated")
+	addParameter(flags, "api-version", "", []string{}, "Serve a version of the API under its name, e.g. v1=old.yaml, may be repeated")
 	addParameter(flags, "disable-cors", "", false, "Disable CORS headers")
-	addParameter(flags, "header", "H", "", "Add a custom header when fetching API")
+	addParameter(flags, "cors-origins", "", []string{}, "Only allow these origins, which may be globs like https://*.example.com, may be repeated, defaults to any origin")
+	addParameter(flags, "cors-methods", "", []string{}, "Methods allowed by pre-flight requests, may be repeated, defaults to the requested method")
+	addParameter(flags, "cors-headers", "", []string{}, "Headers allowed by pre-flight requests, may be repeated, defaults to the requested headers")
+	addParameter(flags, "cors-expose-headers", "", []string{}, "Response headers which browsers may expose to scripts, may be repeated")
+	addParameter(flags, "cors-max-age", "", time.Duration(0), "How long browsers may cache pre-flight responses, e.g. 10m, zero to not send Access-Control-Max-Age")
+	addParameter(flags, "cors-allow-private-network", "", true, "Allow public pages to call the mock on a private network, e.g. localhost, use --cors-allow-private-network=false to disallow")
+	addParameter(flags, "cors-allow-credentials", "", true, "Allow credentials to be sent when an origin is given, use --cors-allow-credentials=false to disallow")
+	addParameter(flags, "read-only", "", false, "Disable admin routes and reject requests other than GET/HEAD")
+	addParameter(flags, "header", "H", stringArray{}, "Add a custom header like 'Name: value' when fetching API, may be repeated")
+	addParameter(flags, "fetch-basic", "", "", "Basic auth user:pass sent when fetching API")
+	addParameter(flags, "fetch-bearer", "", "", "Bearer token sent when fetching API")
+	addParameter(flags, "fetch-oauth", "", "", "OAuth2 client credentials as token_url,client_id,client_secret used to get a token when fetching API")
+	addParameter(flags, "fetch-proxy", "", "", "Proxy URL used when fetching API instead of HTTP_PROXY/HTTPS_PROXY")
+	addParameter(flags, "fetch-insecure-skip-verify", "", false, "Don't verify the TLS certificate when fetching API")
+	addParameter(flags, "cache-dir", "", defaultCacheDir(), "Directory where fetched remote documents are cached, empty to disable caching")
+	addParameter(flags, "offline", "", false, "Only use cached copies of remote documents instead of fetching them")
+	addParameter(flags, "no-external-refs", "", false, "Don't resolve references to other files or URLs")
+	addParameter(flags, "ref-allow", "", []string{}, "Only resolve references to these URL prefixes, hosts like *.example.com or local directories, may be repeated")
+	addParameter(flags, "ref-timeout", "", 30*time.Second, "Timeout for fetching each referenced URL")
+	addParameter(flags, "archive-root", "", "", "Path of the root document within a zip or tar.gz bundle, found automatically by default")
+	addParameter(flags, "include-tags", "", []string{}, "Only serve operations with one of these tags, may be repeated")
+	addParameter(flags, "include-operations", "", []string{}, "Only serve operations with one of these operation IDs, may be repeated")
+	addParameter(flags, "exclude-paths", "", []string{}, "Don't serve paths matching these patterns, e.g. /admin/**, may be repeated")
+	addParameter(flags, "lenient", "", false, "Fix or drop values of the wrong type in slightly invalid documents instead of failing to load them")
 	addParameter(flags, "add-server", "", "", "Add a new valid server URL, use with --validate-server")
+	addParameter(flags, "server-index", "", -1, "Route relative to the base path of the document's server at this index, e.g. 0 for the first one")
+	addParameter(flags, "server-url", "", "", "Route relative to the base path of this server URL, e.g. https://api.example.com/v1")
 	addParameter(flags, "https", "", false, "Use HTTPS instead of HTTP")
 	addParameter(flags, "public-key", "", "", "Public key for HTTPS, use with --https")
 	addParameter(flags, "private-key", "", "", "Private key for HTTPS, use with --https")
+	addParameter(flags, "http3", "", false, "Experimental: also serve HTTP/3 over QUIC on the same UDP port, use with --https, requires a build with the http3 tag")
+	addParameter(flags, "disable-keep-alives", "", false, "Close connections after each request")
+	addParameter(flags, "idle-timeout", "", time.Duration(0), "Close idle keep-alive connections after this long, zero for no limit")
+	addParameter(flags, "max-concurrent", "", 0, "Maximum requests handled at the same time, beyond which 503 is returned, zero for no limit")
+	addParameter(flags, "max-idle-conns", "", 100, "Maximum idle connections kept open when fetching remote documents")
+	addParameter(flags, "stream", "", false, "Stream JSON responses in chunks instead of buffering them")
+	addParameter(flags, "stream-chunk-size", "", 32*1024, "Bytes to write before flushing each chunk, use with --stream")
+	addParameter(flags, "stream-delay", "", time.Duration(0), "Delay between streamed chunks, use with --stream")
+	addParameter(flags, "message-interval", "", time.Second, "Interval between messages pushed to subscribers of AsyncAPI channels via WebSockets or server-sent events")
+	addParameter(flags, "response-header", "", stringArray{}, "Add a header like 'X-Env: mock' to every response, may be repeated")
+	addParameter(flags, "no-example-status", "", http.StatusTeapot, "HTTP status sent when no example is available")
+	addParameter(flags, "no-example-body", "", "No example available.", "Response body sent when no example is available")
+	addParameter(flags, "no-example-fallback", "", false, "Generate a response from any available schema when no example matches the request")
+	addParameter(flags, "retry-after", "", 1, "Seconds sent in the Retry-After header of 429 and 503 responses, zero to disable")
+	addParameter(flags, "disable-compression", "", false, "Disable gzip/deflate compression of responses")
+	addParameter(flags, "log-push-url", "", "", "Push structured access logs to this Loki or OpenSearch bulk API URL")
+	addParameter(flags, "log-push-format", "", "loki", "Format of pushed logs, either 'loki' or 'opensearch'")
+	addParameter(flags, "log-push-interval", "", time.Second, "How often to push logs, use with --log-push-url")
+	addParameter(flags, "notify-url", "", "", "POST a JSON event to this URL, e.g. a Slack webhook, whenever the document is reloaded or fails to reload")
+	addParameter(flags, "statsd-addr", "", "", "Send per-operation request counts and timings to this StatsD host:port over UDP")
+	addParameter(flags, "statsd-prefix", "", "apisprout.", "Prefix of StatsD metric names, use with --statsd-addr")
+	addParameter(flags, "statsd-format", "", "statsd", "Format of StatsD metrics, either 'statsd' or 'datadog' for DogStatsD tags")
+	addParameter(flags, "s3-region", "", "", "Region of S3 buckets, defaults to AWS_REGION or us-east-1")
+	addParameter(flags, "s3-endpoint", "", "", "Custom S3 endpoint using path-style URLs, e.g. for MinIO or LocalStack")
+	addParameter(flags, "poll", "", time.Duration(0), "Check documents for changes at this interval and reload them, e.g. from a URL or S3, zero to disable")
+	addParameter(flags, "registry", "", "", "Load the document from an API registry, e.g. swaggerhub:owner/api/version")
+	addParameter(flags, "swaggerhub-api-key", "", "", "API key used to fetch private definitions from SwaggerHub")
+	addParameter(flags, "swaggerhub-url", "", "https://api.swaggerhub.com", "Base URL of the SwaggerHub registry API, e.g. for on-premise installs")
+	addParameter(flags, "upstream-ca", "", "", "CA certificate used to verify remote API documents")
+	addParameter(flags, "upstream-cert", "", "", "Client certificate presented when fetching remote API documents")
+	addParameter(flags, "upstream-key", "", "", "Client private key, use with --upstream-cert")
+
+	root.AddCommand(&cobra.Command{
+		Use:   "stats FILE",
+		Short: "Show statistics about how well an API description can be mocked",
+		Args:  cobra.ExactArgs(1),
+		Run:   stats,
+	})
+
+	root.AddCommand(&cobra.Command{
+		Use:   "routes FILE",
+		Short: "Show the operations the mock server answers and which are missing examples",
+		Args:  cobra.ExactArgs(1),
+		Run:   routes,
+	})
+
+	exampleCmd := &cobra.Command{
+		Use:   "example FILE",
+		Short: "Print the example response of an operation without starting a server",
+		Args:  cobra.ExactArgs(1),
+		Run:   example,
+	}
+	addParameter(exampleCmd.Flags(), "operation", "", "", "Operation ID, or method and path like 'GET /pets/{id}'")
+	addParameter(exampleCmd.Flags(), "status", "", "", "Response status, e.g. 200 or 4XX, defaults to the first successful one")
+	addParameter(exampleCmd.Flags(), "media", "", "", "Response media type, e.g. application/json")
+	addParameter(exampleCmd.Flags(), "example", "", "", "Name of the example to print when there are several")
+	root.AddCommand(exampleCmd)
+
+	root.AddCommand(&cobra.Command{
+		Use:   "lint FILE",
+		Short: "Check that examples still match their schema enums",
+		Args:  cobra.ExactArgs(1),
+		Run:   lint,
+	})
+
+	root.AddCommand(&cobra.Command{
+		Use:   "validate FILE",
+		Short: "Check that an API description can be loaded and its examples match their schemas",
+		Args:  cobra.ExactArgs(1),
+		Run:   validate,
+	})
+
+	bundleCmd := &cobra.Command{
+		Use:   "bundle FILE",
+		Short: "Write a self-contained copy of an API description with all external references resolved",
+		Args:  cobra.ExactArgs(1),
+		Run:   bundle,
+	}
+	addParameter(bundleCmd.Flags(), "output", "o", "", "File to write, defaults to stdout")
+	root.AddCommand(bundleCmd)
+
+	root.AddCommand(&cobra.Command{
+		Use:   "pack FILE OUTPUT [-- FLAGS...]",
+		Short: "Write a standalone executable which serves a bundled copy of an API description",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   pack,
+	})
+
+	conformCmd := &cobra.Command{
+		Use:   "conform FILE",
+		Short: "Check that a server's responses conform to an API description",
+		Args:  cobra.ExactArgs(1),
+		Run:   conform,
+	}
+	addParameter(conformCmd.Flags(), "target", "", "", "Base URL of the server to check")
+	root.AddCommand(conformCmd)
 
 	// Run the app!
 	root.Execute()
@@ -161,16 +368,74 @@ func addParameter(flags *pflag.FlagSet, name, short string, def interface{}, des
 		flags.BoolP(name, short, v, desc)
 	case int:
 		flags.IntP(name, short, v, desc)
+	case float64:
+		flags.Float64P(name, short, v, desc)
 	case string:
 		flags.StringP(name, short, v, desc)
+	case time.Duration:
+		flags.DurationP(name, short, v, desc)
+	case []string:
+		flags.StringSliceP(name, short, v, desc)
+	case stringArray:
+		flags.StringArrayP(name, short, v, desc)
+	case counter:
+		flags.CountP(name, short, desc)
 	}
 	viper.BindPFlag(name, flags.Lookup(name))
 }
 
+// stringArray is the default of repeatable parameters whose values may
+// contain commas, like headers, so they aren't split like `[]string` ones.
+type stringArray []string
+
+// counter is the default of parameters which count how often they are
+// given, like `-vv`.
+type counter int
+
+// getStringArray returns the values of a repeatable parameter added with a
+// `stringArray` default, which viper only knows as the flag's CSV string.
+func getStringArray(config *viper.Viper, name string) []string {
+	switch v := config.Get(name).(type) {
+	case stringArray:
+		return v
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprintf("%v", item))
+		}
+		return values
+	case string:
+		if v == "" {
+			return nil
+		}
+		if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+			values, err := csv.NewReader(strings.NewReader(v[1 : len(v)-1])).Read()
+			if err == nil {
+				return values
+			}
+		}
+		return []string{v}
+	}
+	return nil
+}
+
+// parseHeader parses a header given as `Name: value`. Only the first colon
+// separates the name, so values like URLs may contain colons.
+func parseHeader(value string) (string, string, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("Header format is invalid, expected 'Name: value' but got '%s'", value)
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
 // getTypedExample will return an example from a given media type, if such an
 // example exists. If multiple examples are given, then one is selected at
 // random unless an "example" item exists in the Prefer header
-func getTypedExample(mt *openapi3.MediaType, prefer map[string]string) (interface{}, error) {
+func getTypedExample(ctx context.Context, mt *openapi3.MediaType, prefer map[string]string, rnd *rand.Rand) (interface{}, error) {
 	if mt.Example != nil {
 		return mt.Example, nil
 	}
@@ -181,6 +446,7 @@ func getTypedExample(mt *openapi3.MediaType, prefer map[string]string) (interfac
 		if mapContainsKey(prefer, "example") {
 			preferredExample = prefer["example"]
 			if _, ok := mt.Examples[preferredExample]; ok {
+				recordExampleName(ctx, preferredExample)
 				return mt.Examples[preferredExample].Value.Value, nil
 			}
 		}
@@ -192,63 +458,196 @@ func getTypedExample(mt *openapi3.MediaType, prefer map[string]string) (interfac
 		}
 
 		if len(keys) > 0 {
-			selected := keys[rand.Intn(len(keys))]
+			selected := keys[rnd.Intn(len(keys))]
+			recordExampleName(ctx, selected)
 			return mt.Examples[selected].Value.Value, nil
 		}
 	}
 
 	if mt.Schema != nil {
-		return OpenAPIExample(ModeResponse, mt.Schema.Value)
+		return OpenAPIExampleContext(ctx, ModeResponse, mt.Schema.Value)
 	}
 	// TODO: generate data from JSON schema, if no examples available?
 
 	return nil, ErrNoExample
 }
 
+// isStatusRange returns true if the given response key is a status code
+// range like `4XX`.
+func isStatusRange(key string) bool {
+	return statusRangeMatcher.MatchString(strings.ToUpper(key))
+}
+
+// responseStatus picks a concrete HTTP status code for a response key. Exact
+// codes are used as-is. Ranges like `4XX` and the `default` response use the
+// preferred status from the client if one was given, otherwise ranges resolve
+// to the first code in the range and `default` is treated as a 200.
+func responseStatus(key, preferred string) int {
+	if status, err := strconv.Atoi(key); err == nil {
+		return status
+	}
+
+	if status, err := strconv.Atoi(preferred); err == nil {
+		return status
+	}
+
+	if isStatusRange(preferred) {
+		key = preferred
+	}
+
+	if isStatusRange(key) {
+		return int(key[0]-'0') * 100
+	}
+
+	return http.StatusOK
+}
+
+// sortedResponseKeys returns the response keys of an operation ordered by
+// successful (200-299 status code) before the `2XX` range and `default`,
+// followed by all other responses.
+func sortedResponseKeys(responses openapi3.Responses) []string {
+	success := make([]string, 0)
+	other := make([]string, 0)
+	for s := range responses {
+		if status, err := strconv.Atoi(s); err == nil && status >= 200 && status < 300 {
+			success = append(success, s)
+			continue
+		}
+		other = append(other, s)
+	}
+
+	sort.Strings(success)
+	sort.Strings(other)
+
+	fallback := make([]string, 0)
+	for _, s := range other {
+		if strings.ToUpper(s) == "2XX" {
+			success = append(success, s)
+		} else if s == "default" {
+			fallback = append(fallback, s)
+		}
+	}
+	for _, s := range other {
+		if strings.ToUpper(s) != "2XX" && s != "default" {
+			fallback = append(fallback, s)
+		}
+	}
+
+	return append(success, fallback...)
+}
+
+// matchResponseKey finds the response key for a preferred status. An exact
+// code match wins, followed by its range (e.g. `404` matches `4XX`) and
+// finally `default`. A preferred range like `4XX` also matches the lowest
+// exact code within that range. Returns an empty string if nothing matches.
+func matchResponseKey(responses openapi3.Responses, preferred string) string {
+	if key := matchDeclaredResponseKey(responses, preferred); key != "" {
+		return key
+	}
+
+	if responses["default"] != nil {
+		return "default"
+	}
+
+	return ""
+}
+
+// matchDeclaredResponseKey is like `matchResponseKey` but does not fall back
+// to the `default` response.
+func matchDeclaredResponseKey(responses openapi3.Responses, preferred string) string {
+	if responses[preferred] != nil {
+		return preferred
+	}
+
+	if _, err := strconv.Atoi(preferred); err == nil && len(preferred) == 3 {
+		for key := range responses {
+			if isStatusRange(key) && key[0] == preferred[0] {
+				return key
+			}
+		}
+	} else if isStatusRange(preferred) {
+		for _, key := range sortedResponseKeys(responses) {
+			if _, err := strconv.Atoi(key); err == nil && key[0] == preferred[0] {
+				return key
+			}
+			if strings.EqualFold(key, preferred) {
+				return key
+			}
+		}
+	}
+
+	return ""
+}
+
+// matchPreferredStatus finds the response key for a preferred status, which
+// may be a comma-separated list like `404,400,500`. The first status which the
+// operation declares is used, falling back to `default` if none are. Returns
+// the matching key and the preferred status it was matched with, or empty
+// strings if nothing matches.
+func matchPreferredStatus(responses openapi3.Responses, preferred string) (string, string) {
+	statuses := strings.Split(preferred, ",")
+	for i := range statuses {
+		statuses[i] = strings.TrimSpace(statuses[i])
+	}
+
+	for _, status := range statuses {
+		if key := matchDeclaredResponseKey(responses, status); key != "" {
+			return key, status
+		}
+	}
+
+	if responses["default"] != nil {
+		return "default", statuses[0]
+	}
+
+	return "", ""
+}
+
 // getExample tries to return an example for a given operation.
 // Using the Prefer http header, the consumer can specify the type of response they want.
-func getExample(negotiator *ContentNegotiator, prefer map[string]string, op *openapi3.Operation) (int, string, map[string]*openapi3.HeaderRef, interface{}, error) {
+func getExample(ctx context.Context, negotiator *ContentNegotiator, prefer map[string]string, op *openapi3.Operation, rnd *rand.Rand) (int, string, map[string]*openapi3.HeaderRef, interface{}, error) {
 	var responses []string
 	var blankHeaders = make(map[string]*openapi3.HeaderRef)
 
+	preferred := ""
+
 	if !mapContainsKey(prefer, "status") {
-		// First, make a list of responses ordered by successful (200-299 status code)
-		// before other types.
-		success := make([]string, 0)
-		other := make([]string, 0)
-		for s := range op.Responses {
-			if status, err := strconv.Atoi(s); err == nil && status >= 200 && status < 300 {
-				success = append(success, s)
-				continue
-			}
-			other = append(other, s)
-		}
-		responses = append(success, other...)
-	} else if op.Responses[prefer["status"]] != nil {
-		responses = []string{prefer["status"]}
-	} else if op.Responses["default"] != nil {
-		responses = []string{"default"}
+		responses = sortedResponseKeys(op.Responses)
+	} else if key, status := matchPreferredStatus(op.Responses, prefer["status"]); key != "" {
+		responses = []string{key}
+		preferred = status
 	} else {
-		return 0, "", blankHeaders, nil, ErrNoExample
+		return 0, "", blankHeaders, nil, &ExampleError{
+			OperationID: op.OperationID,
+			Status:      prefer["status"],
+			Err:         ErrNoExample,
+		}
+	}
+
+	exampleErr := &ExampleError{
+		OperationID: op.OperationID,
+		Status:      prefer["status"],
+		Err:         ErrNoExample,
 	}
 
 	// Now try to find the first example we can and return it!
 	for _, s := range responses {
 		response := op.Responses[s]
-		status, err := strconv.Atoi(s)
-		if err != nil {
-			// If we are using the default with prefer, we can use its status
-			// code:
-			status, err = strconv.Atoi(prefer["status"])
-		}
-		if err != nil {
-			// Otherwise, treat default and other named statuses as 200.
-			status = http.StatusOK
-		}
+		status := responseStatus(s, preferred)
 
 		if response.Value.Content == nil {
 			// This is a valid response but has no body defined.
-			return status, "", blankHeaders, "", nil
+			return status, "", response.Value.Headers, "", nil
+		}
+
+		responsePrefer := prefer
+		if name, ok := extensionString(response.Value.ExtensionProps, ExtExample); ok && !mapContainsKey(prefer, "example") {
+			// Use the response's default example unless the client asked
+			// for a specific one.
+			responsePrefer = map[string]string{"example": name}
+			for k, v := range prefer {
+				responsePrefer[k] = v
+			}
 		}
 
 		for mt, content := range response.Value.Content {
@@ -257,21 +656,26 @@ func getExample(negotiator *ContentNegotiator, prefer map[string]string, op *ope
 				continue
 			}
 
-			example, err := getTypedExample(content, prefer)
+			example, err := getTypedExample(ctx, content, responsePrefer, rnd)
 			if err == nil {
 				return status, mt, response.Value.Headers, example, nil
 			}
 
-			fmt.Printf("Error getting example: %v\n", err)
+			if ctx.Err() != nil {
+				return 0, "", blankHeaders, nil, ctx.Err()
+			}
+
+			exampleErr.MediaType = mt
+			exampleErr.Err = err
 		}
 	}
 
-	return 0, "", blankHeaders, nil, ErrNoExample
+	return 0, "", blankHeaders, nil, exampleErr
 }
 
 // addLocalServers will ensure that requests to localhost are always allowed
 // even if not specified in the OpenAPI document.
-func addLocalServers(swagger *openapi3.Swagger) error {
+func addLocalServers(swagger *openapi3.Swagger, port int) error {
 	seen := make(map[string]bool)
 	for _, s := range swagger.Servers {
 		seen[s.URL] = true
@@ -286,7 +690,7 @@ func addLocalServers(swagger *openapi3.Swagger) error {
 
 		if u.Hostname() != "localhost" {
 			u.Scheme = "http"
-			u.Host = fmt.Sprintf("localhost:%d", viper.GetInt("port"))
+			u.Host = fmt.Sprintf("localhost:%d", port)
 
 			ls := &openapi3.Server{
 				URL:         u.String(),
@@ -308,8 +712,42 @@ func addLocalServers(swagger *openapi3.Swagger) error {
 	return nil
 }
 
+// serverBasePath returns the path of the server selected via `--server-url`
+// or `--server-index`, which routing is relative to, or an empty string if
+// none was selected. Variables use their default values, e.g. `/{version}`
+// with a default of `v2` becomes `/v2`.
+func serverBasePath(config *viper.Viper, swagger *openapi3.Swagger) (string, error) {
+	server := &openapi3.Server{URL: config.GetString("server-url")}
+	if server.URL == "" {
+		index := config.GetInt("server-index")
+		if !config.IsSet("server-index") || index < 0 {
+			return "", nil
+		}
+		if index >= len(swagger.Servers) {
+			return "", fmt.Errorf("Invalid --server-index %d, the document has %d servers", index, len(swagger.Servers))
+		}
+		server = swagger.Servers[index]
+	}
+
+	resolved := server.URL
+	for name, variable := range server.Variables {
+		if variable != nil {
+			if value, ok := variable.Default.(string); ok {
+				resolved = strings.Replace(resolved, "{"+name+"}", value, -1)
+			}
+		}
+	}
+
+	u, err := url.Parse(resolved)
+	if err != nil {
+		return "", fmt.Errorf("Invalid server URL '%s': %v", server.URL, err)
+	}
+
+	return cleanPrefix(u.Path), nil
+}
+
 // Load the OpenAPI document and create the router.
-func load(uri string, data []byte) (swagger *openapi3.Swagger, router *openapi3filter.Router, err error) {
+func load(config *viper.Viper, uri string, data []byte) (swagger *openapi3.Swagger, router *openapi3filter.Router, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			swagger = nil
@@ -322,8 +760,34 @@ func load(uri string, data []byte) (swagger *openapi3.Swagger, router *openapi3f
 		}
 	}()
 
-	loader := openapi3.NewSwaggerLoader()
-	loader.IsExternalRefsAllowed = true
+	if isArchive(data) {
+		if uri, data, err = openArchive(config, data); err != nil {
+			return
+		}
+	}
+
+	if isPostmanCollection(data) {
+		if data, err = convertPostman(data); err != nil {
+			return
+		}
+	}
+
+	if isAsyncAPI(data) {
+		if data, err = convertAsyncAPI(data); err != nil {
+			return
+		}
+	}
+
+	if config.GetBool("lenient") {
+		var warnings []string
+		data, warnings, err = lenientDocument(data)
+		for _, w := range warnings {
+			log.Printf("WARNING: %s", w)
+		}
+		if err != nil {
+			return
+		}
+	}
 
 	var u *url.URL
 	u, err = url.Parse(uri)
@@ -331,22 +795,50 @@ func load(uri string, data []byte) (swagger *openapi3.Swagger, router *openapi3f
 		return
 	}
 
+	loader := openapi3.NewSwaggerLoader()
+	loader.IsExternalRefsAllowed = !config.GetBool("no-external-refs")
+	loader.LoadSwaggerFromURIFunc = func(loader *openapi3.SwaggerLoader, location *url.URL) (*openapi3.Swagger, error) {
+		data, err := fetchRef(config, u, location)
+		if err != nil {
+			return nil, err
+		}
+		return loader.LoadSwaggerFromDataWithPath(data, location)
+	}
+
 	swagger, err = loader.LoadSwaggerFromDataWithPath(data, u)
 	if err != nil {
 		return
 	}
 
-	if !viper.GetBool("validate-server") {
-		// Clear the server list so no validation happens. Note: this has a side
-		// effect of no longer parsing any server-declared parameters.
-		swagger.Servers = make([]*openapi3.Server, 0)
+	if err = filterOperations(config, swagger); err != nil {
+		return
+	}
+
+	routed := swagger
+	if !config.GetBool("validate-server") {
+		// Clear the router's server list so no validation happens, while the
+		// document keeps its servers, e.g. for virtual hosts. Note: this has a
+		// side effect of no longer parsing any server-declared parameters.
+		copied := *swagger
+		copied.Servers = make([]*openapi3.Server, 0)
+		routed = &copied
+
+		// Routing can still be relative to the base path of a chosen server,
+		// which matches requests without a scheme or host.
+		var base string
+		if base, err = serverBasePath(config, swagger); err != nil {
+			return
+		}
+		if base != "" {
+			copied.Servers = append(copied.Servers, &openapi3.Server{URL: base})
+		}
 	} else {
 		// Special-case localhost to always be allowed for local testing.
-		if err = addLocalServers(swagger); err != nil {
+		if err = addLocalServers(swagger, config.GetInt("port")); err != nil {
 			return
 		}
 
-		if cs := viper.GetString("add-server"); cs != "" {
+		if cs := config.GetString("add-server"); cs != "" {
 			swagger.Servers = append(swagger.Servers, &openapi3.Server{
 				URL:         cs,
 				Description: "Custom server from command line param",
@@ -356,11 +848,75 @@ func load(uri string, data []byte) (swagger *openapi3.Swagger, router *openapi3f
 	}
 
 	// Create a new router using the OpenAPI document's declared paths.
-	router = openapi3filter.NewRouter().WithSwagger(swagger)
+	defer hideOpenIDConnect(swagger)()
+	router = openapi3filter.NewRouter().WithSwagger(routed)
 
 	return
 }
 
+// hasDeclaredExample returns true if the schema has an explicit example,
+// default or enum value rather than one that must be generated.
+func hasDeclaredExample(schema *openapi3.SchemaRef) bool {
+	if schema == nil || schema.Value == nil {
+		return false
+	}
+
+	_, ok := getSchemaExample(schema.Value)
+	return ok
+}
+
+// locationHeader generates a `Location` header value for a newly created
+// resource. When the document describes an item path below the requested
+// collection, e.g. `/pets/{petId}` for `POST /pets`, the item URL is built
+// using an ID from the response example (or the path parameter's schema).
+// Following REST conventions, `POST` requests otherwise get a generated ID
+// appended while other methods point at the requested URL itself.
+func locationHeader(route *openapi3filter.Route, req *http.Request, example interface{}) string {
+	base := strings.TrimSuffix(req.URL.Path, "/")
+	param := ""
+	var item *openapi3.PathItem
+
+	if route.Swagger != nil {
+		prefix := strings.TrimSuffix(route.Path, "/") + "/{"
+		for path, pathItem := range route.Swagger.Paths {
+			if strings.HasPrefix(path, prefix) && strings.HasSuffix(path, "}") && !strings.Contains(path[len(prefix):], "/") {
+				param = path[len(prefix) : len(path)-1]
+				item = pathItem
+				break
+			}
+		}
+	}
+
+	if item == nil && req.Method != http.MethodPost {
+		return req.URL.Path
+	}
+
+	id := "1"
+	if item != nil {
+		params := append(openapi3.Parameters{}, item.Parameters...)
+		for _, op := range item.Operations() {
+			params = append(params, op.Parameters...)
+		}
+
+		if p := params.GetByInAndName(openapi3.ParameterInPath, param); p != nil && p.Schema != nil && p.Schema.Value != nil {
+			if v, err := OpenAPIExample(ModeResponse, p.Schema.Value); err == nil {
+				id = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+
+	if body, ok := example.(map[string]interface{}); ok {
+		for _, key := range []string{"id", param} {
+			if v, ok := body[key]; ok && key != "" && v != nil {
+				id = fmt.Sprintf("%v", v)
+				break
+			}
+		}
+	}
+
+	return base + "/" + url.PathEscape(id)
+}
+
 // parsePreferHeader takes the value of a prefer header and splits it out into key value pairs
 //
 // HTTP Prefer header specification examples:
@@ -378,6 +934,10 @@ func parsePreferHeader(value string) map[string]string {
 		// In the event that something is quoted, we want to pull those items out of the string
 		// and save them for later, so they don't conflict with other splitting logic.
 
+		// A list of statuses like `status=404,400` is treated as if it were
+		// quoted, so the commas don't split it into separate preferences.
+		value = statusListMatcher.ReplaceAllString(value, `status="$1"`)
+
 		quotedRegex := regexp.MustCompile(`"[^"]*"`)
 		splitRegex := regexp.MustCompile(`(,|;| )`)
 		wilcardRegex := regexp.MustCompile(`%%([0-9]+)%%`)
@@ -421,342 +981,530 @@ func mapContainsKey(dict map[string]string, key string) bool {
 	return false
 }
 
-var handler = func(rr *RefreshableRouter) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if !viper.GetBool("disable-cors") {
-			corsOrigin := req.Header.Get("Origin")
-			if corsOrigin == "" {
-				corsOrigin = "*"
-			}
-			w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
+// isRemote returns true if a document isn't a local file, e.g. a URL, an S3
+// object or a registry reference.
+func isRemote(uri string) bool {
+	for _, prefix := range []string{"http://", "https://", "s3://", "git+", "oci://", "k8s://"} {
+		if strings.HasPrefix(uri, prefix) {
+			return true
+		}
+	}
 
-			if corsOrigin != "*" {
-				// Allow credentials to be sent if an origin has  been specified.
-				// This is done *outside* of an OPTIONS request since it might be
-				// required for a non-preflighted GET/POST request.
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
-			}
+	r, _ := registryFor(uri)
+	return r != nil
+}
 
-			// Handle pre-flight OPTIONS request
-			if (*req).Method == "OPTIONS" {
-				corsMethod := req.Header.Get("Access-Control-Request-Method")
-				if corsMethod == "" {
-					corsMethod = "POST, GET, OPTIONS, PUT, DELETE"
-				}
+// fetch returns the raw API description document, loading it from an HTTP
+// URL, S3, a git repository, an OCI or API registry, a Kubernetes ConfigMap
+// or Secret, stdin or a local file
+// depending on the passed in value. Remote documents other than Kubernetes
+// ones are cached on disk and the cached copy is used when the source is
+// unreachable.
+func fetch(config *viper.Viper, uri string) ([]byte, error) {
+	if uri == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
 
-				corsHeaders := req.Header.Get("Access-Control-Request-Headers")
-				if corsHeaders == "" {
-					corsHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization"
-				}
+	if !isRemote(uri) {
+		return ioutil.ReadFile(uri)
+	}
 
-				w.Header().Set("Access-Control-Allow-Methods", corsMethod)
-				w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
-				return
-			}
+	if strings.HasPrefix(uri, "k8s://") {
+		// Secrets hold credentials, so they are never written to the cache.
+		if config.GetBool("offline") {
+			return nil, fmt.Errorf("Unable to fetch %s while offline, Kubernetes documents are not cached", uri)
 		}
+		return fetchKube(config, uri)
+	}
 
-		info := fmt.Sprintf("%s %v", req.Method, req.URL)
-
-		// Set up the request, handling potential proxy headers
-		req.URL.Host = req.Host
-		fHost := req.Header.Get("X-Forwarded-Host")
-		if fHost != "" {
-			req.URL.Host = fHost
+	return fetchCached(config, uri, func() ([]byte, error) {
+		if strings.HasPrefix(uri, "s3://") {
+			return fetchS3(config, uri)
 		}
 
-		req.URL.Scheme = "http"
-		if req.Header.Get("X-Forwarded-Proto") == "https" ||
-			req.Header.Get("X-Forwarded-Scheme") == "https" ||
-			strings.Contains(req.Header.Get("Forwarded"), "proto=https") {
-			req.URL.Scheme = "https"
+		if strings.HasPrefix(uri, "git+") {
+			return fetchGit(uri)
 		}
 
-		if viper.GetBool("validate-server") {
-			// Use the scheme/host in the log message since we are validating it.
-			info = fmt.Sprintf("%s %v", req.Method, req.URL)
+		if strings.HasPrefix(uri, "oci://") {
+			return fetchOCI(config, uri)
 		}
 
-		route, pathParams, err := rr.Get().FindRoute(req.Method, req.URL)
-		if err != nil {
-			log.Printf("ERROR: %s => %v", info, err)
-			w.WriteHeader(http.StatusNotFound)
-			return
+		if r, ref := registryFor(uri); r != nil {
+			return r.Fetch(config, ref)
 		}
 
-		if viper.GetBool("validate-request") {
-			err = openapi3filter.ValidateRequest(nil, &openapi3filter.RequestValidationInput{
-				Request:    req,
-				Route:      route,
-				PathParams: pathParams,
-				Options: &openapi3filter.Options{
-					AuthenticationFunc: func(c context.Context, input *openapi3filter.AuthenticationInput) error {
-						// TODO: support more schemes
-						sec := input.SecurityScheme
-						if sec.Type == "http" {
-							// Prefixes for each scheme.
-							prefixes := map[string]string{
-								"bearer": "BEARER ",
-								"basic":  "BASIC ",
-							}
-							if prefix, ok := prefixes[sec.Scheme]; ok {
-								auth := req.Header.Get("Authorization")
-								// If the auth is missing
-								if len(auth) == 0 {
-									return ErrMissingAuth
-								}
-								// If the auth doesn't have a value or doesn't start with the case insensitive prefix
-								if len(auth) <= len(prefix) || !strings.HasPrefix(strings.ToUpper(auth), prefix) {
-									return ErrInvalidAuth
-								}
-							}
-						}
-						return nil
-					},
-				},
-			})
+		return fetchHTTP(config, uri, true, 0)
+	})
+}
+
+// fetchRef returns the document of an external reference found in the
+// document at base, if allowed by the configured reference policy.
+// Credentials are only sent to the host of the document itself.
+func fetchRef(config *viper.Viper, base, location *url.URL) ([]byte, error) {
+	if err := checkRef(config, location); err != nil {
+		return nil, err
+	}
+
+	if location.Scheme == "http" || location.Scheme == "https" {
+		uri := location.String()
+		return fetchCached(config, uri, func() ([]byte, error) {
+			return fetchHTTP(config, uri, location.Host == base.Host, config.GetDuration("ref-timeout"))
+		})
+	}
+
+	if location.Scheme != "" || location.Host != "" || location.RawQuery != "" {
+		return nil, fmt.Errorf("Unsupported URI: '%s'", location.String())
+	}
+
+	return ioutil.ReadFile(location.Path)
+}
+
+// fetchHTTP gets a document from an HTTP URL, optionally sending the custom
+// headers and credentials given via `--header` and `--fetch-*`. A timeout of
+// zero means no timeout.
+func fetchHTTP(config *viper.Viper, uri string, credentials bool, timeout time.Duration) ([]byte, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := fetchClient(config)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = timeout
+
+	if credentials {
+		for _, header := range getStringArray(config, "header") {
+			name, value, err := parseHeader(header)
 			if err != nil {
-				log.Printf("ERROR: %s => %v", info, err)
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(fmt.Sprintf("%v", err)))
-				return
+				return nil, err
 			}
+			req.Header.Add(name, value)
 		}
 
-		var negotiator *ContentNegotiator
-		if accept := req.Header.Get("Accept"); accept != "" {
-			negotiator = NewContentNegotiator(accept)
-			if accept != "*/*" {
-				info = fmt.Sprintf("%s (Accept %s)", info, accept)
-			}
+		if err := fetchAuthorize(config, client, req); err != nil {
+			return nil, err
 		}
+	}
 
-		prefer := parsePreferHeader(req.Header.Get("Prefer"))
-
-		status, mediatype, headers, example, err := getExample(negotiator, prefer, route.Operation)
-		if err != nil {
-			log.Printf("%s => Missing example", info)
-			w.WriteHeader(http.StatusTeapot)
-			w.Write([]byte("No example available."))
-			return
-		}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		id := route.Operation.OperationID
-		if id == "" {
-			id = route.Operation.Summary
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("Unable to fetch %s: %s", uri, resp.Status)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, unreachableError{err}
 		}
+		return nil, err
+	}
 
-		log.Printf("%s (%s) => %d (%s)", info, id, status, mediatype)
-
-		var encoded []byte
+	return ioutil.ReadAll(resp.Body)
+}
 
-		if s, ok := example.(string); ok {
-			encoded = []byte(s)
-		} else if _, ok := example.([]byte); ok {
-			encoded = example.([]byte)
-		} else {
-			if marshalJSONMatcher.MatchString(mediatype) {
-				encoded, err = json.MarshalIndent(example, "", "  ")
-			} else if marshalYAMLMatcher.MatchString(mediatype) {
-				encoded, err = yaml.Marshal(example)
-			} else {
-				log.Printf("Cannot marshal as '%s'!", mediatype)
-				err = ErrCannotMarshal
-			}
+// fetchClient returns the HTTP client used to fetch remote documents. A
+// custom CA and client certificate may be configured for servers which
+// require mutual TLS, such as internal APIs, as well as a proxy.
+func fetchClient(config *viper.Viper) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
 
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte("Unable to marshal response"))
-				return
-			}
+	if ca := config.GetString("upstream-ca"); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
 		}
 
-		for name, header := range headers {
-			if header.Value != nil {
-				example := name
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", ca)
+		}
+		tlsConfig.RootCAs = pool
+	}
 
-				if header.Value.Schema != nil && header.Value.Schema.Value != nil {
-					if v, err := OpenAPIExample(ModeResponse, header.Value.Schema.Value); err == nil {
-						if vs, ok := v.(string); ok {
-							example = vs
-						} else {
-							fmt.Printf("Could not convert example value '%v' to string", v)
-						}
-					}
-				}
+	cert, key := config.GetString("upstream-cert"), config.GetString("upstream-key")
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, errors.New("Both --upstream-cert and --upstream-key are required")
+		}
 
-				w.Header().Set(name, example)
-			}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
 		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	tlsConfig.InsecureSkipVerify = config.GetBool("fetch-insecure-skip-verify")
 
-		if mediatype != "" {
-			w.Header().Set("Content-Type", mediatype)
+	// Proxies come from HTTP_PROXY, HTTPS_PROXY and NO_PROXY unless one is
+	// given explicitly, which is then used for every request.
+	proxy := http.ProxyFromEnvironment
+	if p := config.GetString("fetch-proxy"); p != "" {
+		u, err := url.Parse(p)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("Invalid --fetch-proxy '%s', expected a URL like http://proxy:3128", p)
 		}
+		proxy = http.ProxyURL(u)
+	}
 
-		w.WriteHeader(status)
-		w.Write(encoded)
-	})
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:             proxy,
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: config.GetBool("disable-keep-alives"),
+			MaxIdleConns:      config.GetInt("max-idle-conns"),
+			IdleConnTimeout:   config.GetDuration("idle-timeout"),
+		},
+	}, nil
 }
 
 // server loads an OpenAPI file and runs a mock server using the paths and
 // examples defined in the file.
 func server(cmd *cobra.Command, args []string) {
-	var swagger *openapi3.Swagger
-	rr := NewRefreshableRouter()
-
-	uri := args[0]
-
-	var err error
-	var data []byte
-	dataType := strings.Trim(strings.ToLower(filepath.Ext(uri)), ".")
+	if _, err := basicUsers(viper.GetString("basic-users"), viper.GetString("basic-htpasswd")); err != nil {
+		log.Fatalf("Unable to load basic auth users: %v", err)
+	}
 
-	// Load either from an HTTP URL or from a local file depending on the passed
-	// in value.
-	if strings.HasPrefix(uri, "http") {
-		req, err := http.NewRequest("GET", uri, nil)
+	if uri := viper.GetString("instances"); uri != "" {
+		if viper.GetBool("watch-config") {
+			watchConfig(viper.GetViper(), nil)
+		}
+		instances, err := loadInstances(viper.GetViper(), uri)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if customHeader := viper.GetString("header"); customHeader != "" {
-			header := strings.Split(customHeader, ":")
-			if len(header) != 2 {
-				log.Fatal("Header format is invalid.")
+		if _, err := startInstances(context.Background(), viper.GetViper(), instances); err != nil {
+			log.Fatal(err)
+		}
+		select {}
+	}
+
+	if ref := viper.GetString("registry"); ref != "" {
+		if r, _ := registryFor(ref); r == nil {
+			log.Fatalf("Unknown registry in '%s', expected e.g. swaggerhub:owner/api/version", ref)
+		}
+		args = append(args, ref)
+	}
+
+	merge := viper.GetBool("merge")
+	// Versions are mounted under their name, e.g. `v1=old.yaml` at `/v1`.
+	mountFlags := append(viper.GetStringSlice("mount"), viper.GetStringSlice("api-version")...)
+	mounts, sources, err := serverMounts(args, mountFlags, merge)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mounted := NewMountServer()
+	mounted.SetBasePath(viper.GetString("base-path"))
+	mounted.SetVirtualHosts(viper.GetBool("virtual-hosts"))
+	if viper.GetBool("disable-admin") {
+		mounted.SetAdminPrefix("")
+	} else {
+		mounted.SetAdminPrefix(adminPrefix(viper.GetViper()))
+	}
+	handleCoverageSignals(viper.GetViper(), mounted)
+
+	if viper.GetBool("watch-config") {
+		watchConfig(viper.GetViper(), mounted.recordConfigChange)
+	}
+	var handler http.Handler = mounted
+
+	// Bind right away so the actual port is known when using `--port 0`,
+	// e.g. to show it in messages and to validate servers against it.
+	ln, err := net.Listen("tcp", listenAddress(viper.GetViper()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	viper.Set("port", ln.Addr().(*net.TCPAddr).Port)
+
+	listen := func(handler http.Handler) {
+		srv := newHTTPServer(viper.GetViper(), ln.Addr().String(), handler)
+
+		// Let tools which start the server find out where it's listening.
+		fmt.Printf("APISPROUT_PORT=%d\n", viper.GetInt("port"))
+
+		var err error
+		if viper.GetBool("http3") {
+			if !viper.GetBool("https") {
+				log.Fatal("--http3 requires --https")
+			}
+			srv.Handler, err = serveHTTP3(ln.Addr().String(), viper.GetString("public-key"), viper.GetString("private-key"), srv.Handler)
+			if err != nil {
+				log.Fatal(err)
 			}
-			req.Header.Add(strings.TrimSpace(header[0]), strings.TrimSpace(header[1]))
 		}
-		client := &http.Client{}
-		resp, err := client.Do(req)
+
+		if viper.GetBool("https") {
+			err = srv.ServeTLS(ln, viper.GetString("public-key"),
+				viper.GetString("private-key"))
+		} else {
+			err = srv.Serve(ln)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
+	}
 
-		data, err = ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
+	// When waiting for documents to become available, e.g. a remote document
+	// served by another container which is still starting, start listening
+	// right away so `/__health` can report that we're still loading.
+	wait := viper.GetInt("startup-retries") > 0 || viper.GetDuration("startup-timeout") > 0
+	if wait {
+		mounted.SetLoading(true)
+		go listen(mounted)
+	}
+
+	// Files being watched and where they are mounted.
+	watched := make(map[string]Mount)
+
+	var watcher *fsnotify.Watcher
+	if viper.GetBool("watch") {
+		// Set up a new filesystem watcher and reload the router every time
+		// a file has changed on disk.
+		watcher, err = fsnotify.NewWatcher()
 		if err != nil {
 			log.Fatal(err)
 		}
+		defer watcher.Close()
 
-		if viper.GetBool("watch") {
-			log.Fatal("Watching a URL is not supported.")
+		for _, source := range sources {
+			watcher.Add(source.Dir)
 		}
-	} else {
-		data, err = ioutil.ReadFile(uri)
+	}
+
+	for _, mount := range mounts {
+		uris := []string{mount.URI}
+		if mount.Merge != nil {
+			uris, _, _ = documentFiles(mount.Merge)
+		}
+
+		if watcher != nil {
+			for _, uri := range uris {
+				if strings.HasPrefix(uri, "k8s://") {
+					// Kubernetes sources are always watched below.
+					continue
+				}
+				if isRemote(uri) {
+					log.Fatal("Watching a URL is not supported, use --poll instead.")
+				}
+				if uri == "-" {
+					log.Fatal("Watching stdin is not supported.")
+				}
+				watched[filepath.Clean(uri)] = mount
+				watcher.Add(uri)
+			}
+		}
+
+		var s *OpenAPIServer
+		err := withStartupRetries(viper.GetViper(), func() error {
+			var err error
+			s, err = serveDocument(mounted, mount)
+			return err
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		if viper.GetBool("watch") {
-			// Set up a new filesystem watcher and reload the router every time
-			// the file has changed on disk.
-			watcher, err := fsnotify.NewWatcher()
-			if err != nil {
-				log.Fatal(err)
+		if interval := viper.GetDuration("poll"); interval > 0 {
+			go s.Poll(context.Background(), interval)
+		}
+
+		for _, uri := range uris {
+			if strings.HasPrefix(uri, "k8s://") {
+				go watchKube(context.Background(), uri, func() {
+					if err := s.pollOnce(); err != nil {
+						log.Printf("ERROR: Unable to reload OpenAPI document: %s", err)
+					}
+				})
 			}
-			defer watcher.Close()
-
-			go func() {
-				// Since waiting for events or errors is blocking, we do this in a
-				// goroutine. It loops forever here but will exit when the process
-				// is finished, e.g. when you `ctrl+c` to exit.
-				for {
-					select {
-					case event, ok := <-watcher.Events:
-						if !ok {
-							return
+		}
+
+		if len(mounts) == 1 && mount.Prefix == "" && len(sources) == 0 && viper.GetString("base-path") == "" {
+			handler = s
+		}
+	}
+	mounted.SetLoading(false)
+
+	if watcher != nil {
+		// fromSource returns true if a file is part of a watched directory
+		// or glob pattern.
+		fromSource := func(name string) bool {
+			for _, source := range sources {
+				if source.Match(name) {
+					return true
+				}
+			}
+			return false
+		}
+
+		go func() {
+			// Since waiting for events or errors is blocking, we do this in a
+			// goroutine. It loops forever here but will exit when the process
+			// is finished, e.g. when you `ctrl+c` to exit.
+			for {
+				select {
+				case event, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+
+					name := filepath.Clean(event.Name)
+					mount, known := watched[name]
+					switch {
+					case known && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && fromSource(name):
+						fmt.Printf("🍂 Removing %s\n", event.Name)
+						delete(watched, name)
+						if mount.Merge != nil {
+							reloadServer(mounted.Server(mount.Prefix))
+						} else {
+							mounted.Unmount(mount.Prefix)
 						}
-						if event.Op&fsnotify.Write == fsnotify.Write {
-							fmt.Printf("🌙 Reloading %s\n", uri)
-							data, err = ioutil.ReadFile(uri)
-							if err != nil {
-								log.Fatal(err)
-							}
-
-							if s, r, err := load(uri, data); err == nil {
-								swagger = s
-								rr.Set(r)
-							} else {
-								log.Printf("ERROR: Unable to load OpenAPI document: %s", err)
-							}
+					case known && event.Op&fsnotify.Write == fsnotify.Write:
+						fmt.Printf("🌙 Reloading %s\n", event.Name)
+						reloadServer(mounted.Server(mount.Prefix))
+					case !known && merge && event.Op&(fsnotify.Create|fsnotify.Write) != 0 && fromSource(name):
+						// New documents are merged into the API served at the
+						// root, which is always the merged one.
+						fmt.Printf("🌙 Merging %s\n", event.Name)
+						watched[name] = Mount{URI: name, Merge: args}
+						reloadServer(mounted.Server(""))
+					case !known && event.Op&(fsnotify.Create|fsnotify.Write) != 0 && fromSource(name):
+						mount := mountForFile(name)
+						if mounted.Server(mount.Prefix) != nil {
+							log.Printf("ERROR: Unable to mount %s, %s is already in use", name, mount.Prefix)
+							continue
 						}
-					case err, ok := <-watcher.Errors:
-						if !ok {
-							return
+						// Documents which can't be loaded yet, e.g. because
+						// they are still being written, are retried on the
+						// next change.
+						if _, err := serveDocument(mounted, mount); err != nil {
+							log.Printf("ERROR: Unable to load OpenAPI document: %s", err)
+							continue
 						}
-						fmt.Println("error:", err)
+						watched[name] = mount
+					}
+				case err, ok := <-watcher.Errors:
+					if !ok {
+						return
 					}
+					log.Printf("ERROR: Unable to watch files: %s", err)
 				}
-			}()
-
-			watcher.Add(uri)
-		}
+			}
+		}()
 	}
 
-	swagger, router, err := load(uri, data)
-	if err != nil {
-		log.Fatal(err)
+	if wait {
+		// Already listening, so serve until the process exits.
+		select {}
 	}
 
-	rr.Set(router)
+	listen(handler)
+}
+
+// listenAddress returns the address to listen on, which is every interface
+// unless `--host` is given, e.g. `127.0.0.1` to only allow local clients.
+func listenAddress(config *viper.Viper) string {
+	return net.JoinHostPort(config.GetString("host"), strconv.Itoa(config.GetInt("port")))
+}
 
-	if strings.HasPrefix(uri, "http") {
-		http.HandleFunc("/__reload", func(w http.ResponseWriter, r *http.Request) {
-			resp, err := http.Get(uri)
-			if err != nil {
-				log.Printf("ERROR: %v", err)
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("error while reloading"))
-				return
-			}
+// startupBackoff is the delay before retrying to load a document at startup,
+// which doubles after each attempt up to maxStartupBackoff.
+var (
+	startupBackoff    = 500 * time.Millisecond
+	maxStartupBackoff = 30 * time.Second
+)
 
-			data, err = ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				log.Printf("ERROR: %v", err)
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("error while parsing"))
-				return
-			}
+// withStartupRetries calls a function until it succeeds, backing off between
+// attempts, for at most `--startup-retries` retries and within
+// `--startup-timeout`. Without either, the function is only called once.
+func withStartupRetries(config *viper.Viper, fn func() error) error {
+	retries := config.GetInt("startup-retries")
+	timeout := config.GetDuration("startup-timeout")
+
+	start := time.Now()
+	delay := startupBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || (retries <= 0 && timeout <= 0) || (retries > 0 && attempt > retries) {
+			return err
+		}
 
-			if s, r, err := load(uri, data); err == nil {
-				swagger = s
-				rr.Set(r)
+		wait := delay
+		if timeout > 0 {
+			remaining := timeout - time.Since(start)
+			if remaining <= 0 {
+				return err
+			}
+			if wait > remaining {
+				wait = remaining
 			}
+		}
 
-			w.WriteHeader(200)
-			w.Write([]byte("reloaded"))
-			log.Printf("Reloaded from %s", uri)
-		})
+		log.Printf("ERROR: %v, retrying in %v", err, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+
+		delay *= 2
+		if delay > maxStartupBackoff {
+			delay = maxStartupBackoff
+		}
 	}
+}
 
-	// Add a health check route which returns 200
-	http.HandleFunc("/__health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		log.Printf("Health check")
-	})
+// reloadServer reloads the document of a server after it has changed on
+// disk, logging any errors.
+func reloadServer(s *OpenAPIServer) {
+	if s == nil {
+		return
+	}
 
-	// Another custom handler to return the exact swagger document given to us
-	http.HandleFunc("/__schema", func(w http.ResponseWriter, req *http.Request) {
-		if !viper.GetBool("disable-cors") {
-			corsOrigin := req.Header.Get("Origin")
-			if corsOrigin == "" {
-				corsOrigin = "*"
-			}
-			w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
+	if err := s.Reload(); err != nil {
+		log.Printf("ERROR: Unable to reload OpenAPI document: %s", err)
+	}
+}
+
+// serveDocument loads a document and mounts it under its prefix.
+func serveDocument(mounted *MountServer, mount Mount) (*OpenAPIServer, error) {
+	s := NewOpenAPIServer(viper.GetViper())
+
+	if mount.Merge != nil {
+		if err := s.LoadMerged(mount.Merge); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := fetch(viper.GetViper(), mount.URI)
+		if err != nil {
+			return nil, err
 		}
 
-		w.Header().Set("Content-Type", fmt.Sprintf("application/%v; charset=utf-8", dataType))
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, string(data))
-	})
+		if err := s.Load(mount.URI, data); err != nil {
+			return nil, err
+		}
+	}
 
-	// Register our custom HTTP handler that will use the router to find
-	// the appropriate OpenAPI operation and try to return an example.
-	http.Handle("/", handler(rr))
+	swagger := s.Swagger()
 
-	format := "🌱 Sprouting %s on port %d"
+	format := "🌱 Sprouting %s on %s"
 	if viper.GetBool("https") {
-		format = "🌱 Securely sprouting %s on port %d"
+		format = "🌱 Securely sprouting %s on %s"
+	}
+	where := fmt.Sprintf("port %d", viper.GetInt("port"))
+	if host := viper.GetString("host"); host != "" {
+		where = listenAddress(viper.GetViper())
+	}
+	fmt.Printf(format, swagger.Info.Title, where)
+	at := cleanPrefix(viper.GetString("base-path")) + mount.Prefix
+	if !viper.GetBool("validate-server") {
+		// Any error was already returned while loading the document.
+		base, _ := serverBasePath(viper.GetViper(), swagger)
+		at += base
+	}
+	if at != "" {
+		fmt.Printf(" at %s", at)
 	}
-	fmt.Printf(format, swagger.Info.Title, viper.GetInt("port"))
 
 	if viper.GetBool("validate-server") && len(swagger.Servers) != 0 {
 		fmt.Printf(" with valid servers:\n")
@@ -767,14 +1515,62 @@ func server(cmd *cobra.Command, args []string) {
 		fmt.Printf("\n")
 	}
 
-	port := fmt.Sprintf(":%d", viper.GetInt("port"))
-	if viper.GetBool("https") {
-		err = http.ListenAndServeTLS(port, viper.GetString("public-key"),
-			viper.GetString("private-key"), nil)
+	mounted.Mount(mount.Prefix, s)
+
+	return s, nil
+}
+
+// serverMounts returns the documents to serve given the commandline
+// arguments and `--mount` values. A single file is served at the root, while
+// several files, or the documents found in directories and glob patterns,
+// are each served under their file name, e.g. `users.yaml` at `/users`. When
+// merging, all of the documents are instead merged into one API served at the
+// root. The directories and patterns are returned so they can be watched for
+// new documents.
+func serverMounts(args []string, mountFlags []string, merge bool) ([]Mount, []*documentSource, error) {
+	files, sources, err := documentFiles(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mounts := make([]Mount, 0, len(files)+len(mountFlags))
+	if merge && len(args) > 0 {
+		uri := ""
+		if len(files) > 0 {
+			uri = files[0]
+		}
+		mounts = append(mounts, Mount{URI: uri, Merge: args})
+	} else if len(args) == 1 && len(sources) == 0 {
+		mounts = append(mounts, Mount{URI: files[0]})
 	} else {
-		err = http.ListenAndServe(port, nil)
+		for _, file := range files {
+			mounts = append(mounts, mountForFile(file))
+		}
 	}
-	if err != nil {
-		log.Fatal(err)
+
+	for _, value := range mountFlags {
+		mount, err := parseMount(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		mounts = append(mounts, mount)
+	}
+
+	if len(mounts) == 0 && len(sources) == 0 {
+		return nil, nil, errors.New("No API description given, pass a FILE or use --mount")
 	}
+
+	seen := make(map[string]string)
+	for _, mount := range mounts {
+		if other, ok := seen[mount.Prefix]; ok {
+			prefix := mount.Prefix
+			if prefix == "" {
+				prefix = "/"
+			}
+			return nil, nil, fmt.Errorf("Both %s and %s are mounted at %s", other, mount.URI, prefix)
+		}
+		seen[mount.Prefix] = mount.URI
+	}
+
+	return mounts, sources, nil
 }
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -56,7 +63,6 @@ var localServerTests = []struct {
 }
 
 func TestAddLocalServers(t *testing.T) {
-	viper.SetDefault("port", 8000)
 	for _, tt := range localServerTests {
 		t.Run(tt.name, func(t *testing.T) {
 			servers := make([]*openapi3.Server, len(tt.in))
@@ -70,7 +76,7 @@ func TestAddLocalServers(t *testing.T) {
 				Servers: servers,
 			}
 
-			err := addLocalServers(s)
+			err := addLocalServers(s, 8000)
 			if len(tt.in) > 0 && len(tt.out) == 0 {
 				assert.Error(t, err)
 				return
@@ -87,6 +93,57 @@ func TestAddLocalServers(t *testing.T) {
 	}
 }
 
+func TestServerBasePath(t *testing.T) {
+	const schema = `{
+		"servers": [
+			{"url": "https://api.example.com/v1"},
+			{"url": "https://{region}.example.com/{version}/", "variables": {
+				"region": {"default": "us"},
+				"version": {"default": "v2"}
+			}}
+		],
+		"paths": {"/items": {"get": {"responses": {"200": {"description": "ok"}}}}}
+	}`
+
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		path    string
+		found   bool
+		err     bool
+	}{
+		{"default", nil, "/items", true, false},
+		{"default-prefixed", nil, "/v1/items", false, false},
+		{"index", map[string]interface{}{"server-index": 0}, "/v1/items", true, false},
+		{"index-unprefixed", map[string]interface{}{"server-index": 0}, "/items", false, false},
+		{"index-variables", map[string]interface{}{"server-index": 1}, "/v2/items", true, false},
+		{"index-invalid", map[string]interface{}{"server-index": 2}, "", false, true},
+		{"url", map[string]interface{}{"server-url": "https://staging.example.com/beta"}, "/beta/items", true, false},
+		{"url-over-index", map[string]interface{}{"server-index": 0, "server-url": "/beta"}, "/beta/items", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for k, v := range test.options {
+				config.Set(k, v)
+			}
+
+			swagger, router, err := load(config, "file:///swagger.json", []byte(schema))
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, swagger.Servers, 2)
+
+			u, _ := url.Parse(test.path)
+			_, _, err = router.FindRoute(http.MethodGet, u)
+			assert.Equal(t, test.found, err == nil)
+		})
+	}
+}
+
 func TestParsePreferHeader(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -146,6 +203,14 @@ func TestParsePreferHeader(t *testing.T) {
 				"example": "complete",
 			},
 		},
+		{
+			name:   "Status List",
+			header: "status=404,400, 500; example=complete",
+			want: map[string]string{
+				"status":  "404,400, 500",
+				"example": "complete",
+			},
+		},
 		{
 			name:   "Mixed Pairs",
 			header: "example=complete; foo, status=\"200\",",
@@ -235,20 +300,444 @@ func TestMediaTypes(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.MediaType, func(t *testing.T) {
-			_, router, err := load("file:///swagger.json", []byte(fmt.Sprintf(schema, test.MediaType)))
+			s := NewOpenAPIServer(nil)
+			err := s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, test.MediaType)))
 			require.NoError(t, err)
-			require.NotNil(t, router)
-
-			rr := NewRefreshableRouter()
-			rr.Set(router)
 
 			req, err := http.NewRequest("GET", "/test", nil)
 			require.NoError(t, err)
 
 			resp := httptest.NewRecorder()
-			handler(rr).ServeHTTP(resp, req)
+			s.ServeHTTP(resp, req)
 
 			assert.Equal(t, test.StatusCode, resp.Code)
 		})
 	}
 }
+
+func TestResponseKeys(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"summary": "Test",
+					"responses": {
+						%s
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name      string
+		responses string
+		prefer    string
+		status    int
+	}{
+		{
+			name:      "Success before range",
+			responses: `"2XX": {"description": "ok"}, "201": {"description": "created"}`,
+			status:    http.StatusCreated,
+		},
+		{
+			name:      "Success range",
+			responses: `"2XX": {"description": "ok"}, "404": {"description": "missing"}`,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Default",
+			responses: `"default": {"description": "ok"}`,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Prefer exact",
+			responses: `"200": {"description": "ok"}, "404": {"description": "missing"}, "4XX": {"description": "error"}`,
+			prefer:    "status=404",
+			status:    http.StatusNotFound,
+		},
+		{
+			name:      "Prefer within range",
+			responses: `"200": {"description": "ok"}, "4XX": {"description": "error"}`,
+			prefer:    "status=409",
+			status:    http.StatusConflict,
+		},
+		{
+			name:      "Prefer range",
+			responses: `"200": {"description": "ok"}, "5XX": {"description": "error"}`,
+			prefer:    "status=5XX",
+			status:    http.StatusInternalServerError,
+		},
+		{
+			name:      "Prefer range matches exact",
+			responses: `"200": {"description": "ok"}, "503": {"description": "error"}`,
+			prefer:    "status=5XX",
+			status:    http.StatusServiceUnavailable,
+		},
+		{
+			name:      "Prefer default",
+			responses: `"200": {"description": "ok"}, "default": {"description": "error"}`,
+			prefer:    "status=500",
+			status:    http.StatusInternalServerError,
+		},
+		{
+			name:      "Prefer list",
+			responses: `"200": {"description": "ok"}, "400": {"description": "bad"}, "500": {"description": "error"}`,
+			prefer:    "status=404,400,500",
+			status:    http.StatusBadRequest,
+		},
+		{
+			name:      "Prefer list before default",
+			responses: `"200": {"description": "ok"}, "500": {"description": "error"}, "default": {"description": "error"}`,
+			prefer:    "status=404, 500",
+			status:    http.StatusInternalServerError,
+		},
+		{
+			name:      "Prefer list default",
+			responses: `"200": {"description": "ok"}, "default": {"description": "error"}`,
+			prefer:    "status=404,400",
+			status:    http.StatusNotFound,
+		},
+		{
+			name:      "Prefer list missing",
+			responses: `"200": {"description": "ok"}`,
+			prefer:    "status=404,400",
+			status:    http.StatusTeapot,
+		},
+		{
+			name:      "Prefer missing",
+			responses: `"200": {"description": "ok"}`,
+			prefer:    "status=500",
+			status:    http.StatusTeapot,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewOpenAPIServer(nil)
+			err := s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, test.responses)))
+			require.NoError(t, err)
+
+			req, err := http.NewRequest("GET", "/test", nil)
+			require.NoError(t, err)
+			if test.prefer != "" {
+				req.Header.Set("Prefer", test.prefer)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+func TestLocationHeader(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/pets": {
+				"post": {
+					"responses": {
+						"201": {
+							"description": "Created",
+							"content": {
+								"application/json": {
+									"example": %s
+								}
+							}
+						}
+					}
+				}
+			},
+			"/pets/{petId}": {
+				"parameters": [
+					{"name": "petId", "in": "path", "required": true, "schema": {"type": "integer", "example": 42}}
+				],
+				"put": {
+					"responses": {
+						"201": {
+							"description": "Created",
+							"headers": {
+								"Location": {"schema": {"type": "string", "example": "/pets/custom"}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		example  string
+		location string
+	}{
+		{"ID from example", "POST", "/pets", `{"id": 123}`, "/pets/123"},
+		{"ID from parameter", "POST", "/pets", `{"name": "Fluffy"}`, "/pets/42"},
+		{"Declared header", "PUT", "/pets/1", `{}`, "/pets/custom"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewOpenAPIServer(nil)
+			err := s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, test.example)))
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(test.method, test.path, nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusCreated, resp.Code)
+			assert.Equal(t, test.location, resp.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHeadRequest(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"headers": {
+								"X-Test": {"schema": {"type": "string", "example": "value"}}
+							},
+							"content": {
+								"application/json": {
+									"example": {"hello": "world"}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	s := NewOpenAPIServer(nil)
+	err := s.Load("file:///swagger.json", []byte(schema))
+	require.NoError(t, err)
+
+	get := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/test", nil)
+	require.NoError(t, err)
+	s.ServeHTTP(get, req)
+
+	head := httptest.NewRecorder()
+	req, err = http.NewRequest("HEAD", "/test", nil)
+	require.NoError(t, err)
+	s.ServeHTTP(head, req)
+
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, "value", head.Header().Get("X-Test"))
+	assert.Equal(t, "application/json", head.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprintf("%d", get.Body.Len()), head.Header().Get("Content-Length"))
+	assert.Empty(t, head.Body.String())
+}
+
+func TestFetchUpstreamCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "apisprout")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0600)
+	require.NoError(t, err)
+
+	// Without the CA the self-signed certificate is rejected.
+	_, err = fetch(viper.New(), srv.URL)
+	assert.Error(t, err)
+
+	config := viper.New()
+	config.Set("upstream-ca", ca)
+	data, err := fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+
+	config.Set("upstream-cert", ca)
+	_, err = fetch(config, srv.URL)
+	assert.Error(t, err)
+}
+
+func TestFetchInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer srv.Close()
+
+	config := viper.New()
+	_, err := fetch(config, srv.URL)
+	assert.Error(t, err)
+
+	config.Set("fetch-insecure-skip-verify", true)
+	data, err := fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+}
+
+func TestFetchProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer proxy.Close()
+
+	config := viper.New()
+	config.Set("fetch-proxy", proxy.URL)
+	data, err := fetch(config, "http://specs.example.com/openapi.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+	assert.Equal(t, "http://specs.example.com/openapi.json", proxied)
+
+	config.Set("fetch-proxy", "not a proxy")
+	_, err = fetch(config, "http://specs.example.com/openapi.json")
+	assert.Error(t, err)
+}
+
+func TestFetchHeaders(t *testing.T) {
+	var received http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer srv.Close()
+
+	config := viper.New()
+	config.Set("header", stringArray{"Authorization: Bearer abc", "X-Callback: http://example.com:8080/a,b"})
+	_, err := fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer abc", received.Get("Authorization"))
+	assert.Equal(t, "http://example.com:8080/a,b", received.Get("X-Callback"))
+
+	// Values of repeated flags reach viper as a single CSV string.
+	config.Set("header", `[X-One: 1,"X-Two: a,b"]`)
+	assert.Equal(t, []string{"X-One: 1", "X-Two: a,b"}, getStringArray(config, "header"))
+
+	config.Set("header", "invalid")
+	_, err = fetch(config, srv.URL)
+	assert.Error(t, err)
+}
+
+func TestFetchStdin(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		contentType string
+	}{
+		{"YAML", "paths:\n  /test:\n    get:\n      responses:\n        '204':\n          description: ok\n", "application/yaml; charset=utf-8"},
+		{"JSON", `{"paths": {"/test": {"get": {"responses": {"204": {"description": "ok"}}}}}}`, "application/json; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			require.NoError(t, err)
+
+			stdin := os.Stdin
+			os.Stdin = r
+			defer func() { os.Stdin = stdin }()
+
+			w.Write([]byte(test.doc))
+			w.Close()
+
+			config := viper.New()
+			data, err := fetch(config, "-")
+			require.NoError(t, err)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("-", data))
+
+			req, _ := http.NewRequest("GET", "/test", nil)
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusNoContent, resp.Code)
+
+			req, _ = http.NewRequest("GET", "/__schema", nil)
+			resp = httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+			assert.Equal(t, test.contentType, resp.Header().Get("Content-Type"))
+
+			assert.Error(t, s.Reload())
+		})
+	}
+}
+
+func TestWithStartupRetries(t *testing.T) {
+	backoff := startupBackoff
+	startupBackoff = time.Millisecond
+	defer func() { startupBackoff = backoff }()
+
+	tests := []struct {
+		name     string
+		retries  int
+		timeout  time.Duration
+		failures int
+		calls    int
+		err      bool
+	}{
+		{"NoRetries", 0, 0, 1, 1, true},
+		{"Retries", 3, 0, 2, 3, false},
+		{"TooManyFailures", 2, 0, 5, 3, true},
+		{"Timeout", 0, time.Second, 4, 5, false},
+		{"TimeoutExceeded", 0, 20 * time.Millisecond, 1000, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("startup-retries", test.retries)
+			config.Set("startup-timeout", test.timeout)
+
+			calls := 0
+			err := withStartupRetries(config, func() error {
+				calls++
+				if calls <= test.failures {
+					return errors.New("unavailable")
+				}
+				return nil
+			})
+
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if test.calls > 0 {
+				assert.Equal(t, test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		host    string
+		address string
+	}{
+		{"", ":8000"},
+		{"127.0.0.1", "127.0.0.1:8000"},
+		{"::1", "[::1]:8000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			config := viper.New()
+			config.Set("port", 8000)
+			config.Set("host", test.host)
+			assert.Equal(t, test.address, listenAddress(config))
+		})
+	}
+}
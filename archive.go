@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// isArchive returns true if the data is a zip or gzipped tar archive.
+func isArchive(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte{0x1f, 0x8b})
+}
+
+// openArchive extracts a zip or `.tar.gz` bundle of documents into a
+// temporary directory and returns the path and contents of its root
+// document, so that relative references to the other files in the bundle
+// resolve. The root is given via `--archive-root` or is the least nested
+// OpenAPI document in the bundle. Bundles with the same contents share a
+// directory, so reloading doesn't extract them again.
+func openArchive(config *viper.Viper, data []byte) (string, []byte, error) {
+	sum := sha256.Sum256(data)
+	parent := filepath.Join(os.TempDir(), "apisprout-archive")
+	dir := filepath.Join(parent, hex.EncodeToString(sum[:8]))
+
+	if _, err := os.Stat(dir); err != nil {
+		if err := os.MkdirAll(parent, 0700); err != nil {
+			return "", nil, err
+		}
+
+		tmp, err := ioutil.TempDir(parent, "extract")
+		if err != nil {
+			return "", nil, err
+		}
+		defer os.RemoveAll(tmp)
+
+		if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+			err = extractTarGz(data, tmp)
+		} else {
+			err = extractZip(data, tmp)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		// Another load may have extracted the same bundle in the meantime.
+		if err := os.Rename(tmp, dir); err != nil {
+			if _, statErr := os.Stat(dir); statErr != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	root, err := archiveRoot(dir, config.GetString("archive-root"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	content, err := ioutil.ReadFile(root)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return root, content, nil
+}
+
+// archivePath returns where an archive entry is extracted to, refusing
+// entries which would be written outside of the directory.
+func archivePath(dir, name string) (string, error) {
+	name = strings.Replace(name, `\`, "/", -1)
+	clean := path.Clean("/" + name)
+	if clean != "/"+strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/") {
+		return "", fmt.Errorf("Invalid file name '%s' in archive", name)
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// writeArchiveFile writes a single extracted file.
+func writeArchiveFile(dir, name string, r io.Reader) error {
+	dest, err := archivePath(dir, name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// extractZip extracts the regular files of a zip archive.
+func extractZip(data []byte, dir string) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range r.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(dir, file.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTarGz extracts the regular files of a gzipped tar archive.
+func extractTarGz(data []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		if err := writeArchiveFile(dir, header.Name, r); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveRoot finds the root document of an extracted bundle. Without an
+// explicit root, the OpenAPI documents closest to the top of the bundle are
+// candidates, preferring ones named like `openapi.yaml`.
+func archiveRoot(dir, root string) (string, error) {
+	if root != "" {
+		p, err := archivePath(dir, root)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(p); err != nil {
+			return "", fmt.Errorf("Root document '%s' not found in archive", root)
+		}
+		return p, nil
+	}
+
+	var candidates []string
+	depth := -1
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		doc, err := parseDocument(data)
+		if err != nil {
+			return nil
+		}
+		obj := asObject(doc)
+		if obj["openapi"] == nil && obj["swagger"] == nil {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, p)
+		d := strings.Count(filepath.ToSlash(rel), "/")
+		switch {
+		case depth == -1 || d < depth:
+			depth = d
+			candidates = []string{rel}
+		case d == depth:
+			candidates = append(candidates, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(candidates) > 1 {
+		preferred := make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			if strings.HasPrefix(strings.ToLower(filepath.Base(c)), "openapi.") {
+				preferred = append(preferred, c)
+			}
+		}
+		if len(preferred) > 0 {
+			candidates = preferred
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("No OpenAPI document found in archive")
+	case 1:
+		return filepath.Join(dir, candidates[0]), nil
+	}
+
+	sort.Strings(candidates)
+	return "", fmt.Errorf("Several root documents found in archive (%s), choose one via --archive-root", strings.Join(candidates, ", "))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archiveRootDoc = `
+openapi: 3.0.0
+info:
+  title: Archived
+  version: "1.0"
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: "../schemas/user.yaml#/components/schemas/User"
+`
+
+const archiveUserDoc = `
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        name:
+          type: string
+          example: Alice
+`
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func tarGzArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestLoadArchive(t *testing.T) {
+	files := map[string]string{
+		"api-1.0/specs/openapi.yaml": archiveRootDoc,
+		"api-1.0/schemas/user.yaml":  archiveUserDoc,
+		"api-1.0/README.md":          "# API",
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Zip", zipArchive(t, files)},
+		{"TarGz", tarGzArchive(t, files)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.True(t, isArchive(test.data))
+
+			swagger, _, err := load(viper.New(), "api.bundle", test.data)
+			require.NoError(t, err)
+			assert.Equal(t, "Archived", swagger.Info.Title)
+
+			schema := swagger.Paths["/users"].Get.Responses["200"].Value.Content["application/json"].Schema.Value
+			assert.Equal(t, "Alice", schema.Properties["name"].Value.Example)
+		})
+	}
+}
+
+func TestArchiveRoot(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		root  string
+		found string
+		err   bool
+	}{
+		{"Shallowest", map[string]string{"openapi.yaml": archiveRootDoc, "v2/openapi.yaml": archiveRootDoc}, "", "openapi.yaml", false},
+		{"Preferred", map[string]string{"users.yaml": archiveRootDoc, "openapi.json": `{"openapi": "3.0.0"}`}, "", "openapi.json", false},
+		{"Ambiguous", map[string]string{"users.yaml": archiveRootDoc, "pets.yaml": archiveRootDoc}, "", "", true},
+		{"Explicit", map[string]string{"users.yaml": archiveRootDoc, "pets.yaml": archiveRootDoc}, "pets.yaml", "pets.yaml", false},
+		{"Explicit missing", map[string]string{"users.yaml": archiveRootDoc}, "pets.yaml", "", true},
+		{"None", map[string]string{"user.yaml": archiveUserDoc}, "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "archive")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			for name, content := range test.files {
+				require.NoError(t, writeArchiveFile(dir, name, bytes.NewReader([]byte(content))))
+			}
+
+			root, err := archiveRoot(dir, test.root)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(dir, test.found), root)
+		})
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		err  bool
+	}{
+		{"specs/openapi.yaml", false},
+		{"./openapi.yaml", false},
+		{"../openapi.yaml", true},
+		{"specs/../../openapi.yaml", true},
+		{"/etc/passwd", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := archivePath("/tmp/bundle", test.name)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// extAsyncAPIChannel marks operations converted from AsyncAPI channels which
+// can stream messages to subscribers.
+const extAsyncAPIChannel = "x-asyncapi-channel"
+
+// extAsyncAPIMessages describes the messages of a converted channel
+// operation, so each can be pushed to subscribers in turn.
+const extAsyncAPIMessages = "x-asyncapi-messages"
+
+// asyncAPIParameter matches `{name}` parameters in channel names.
+var asyncAPIParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+// isAsyncAPI returns true if a document is an AsyncAPI document rather than
+// an OpenAPI document.
+func isAsyncAPI(data []byte) bool {
+	if !bytes.Contains(data, []byte("asyncapi")) {
+		return false
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return false
+	}
+
+	_, ok := asObject(doc)["asyncapi"].(string)
+	return ok
+}
+
+// asyncAPIConverter holds the document being converted so references can be
+// resolved.
+type asyncAPIConverter struct {
+	doc         map[string]interface{}
+	contentType string
+}
+
+// convertAsyncAPI builds an OpenAPI document from an AsyncAPI 2.x document.
+// Each channel becomes a path, where `subscribe` operations become a `GET`
+// returning the channel's messages, which can also be streamed via
+// WebSockets or server-sent events, and `publish` operations become a `POST`
+// accepting a message.
+func convertAsyncAPI(data []byte) ([]byte, error) {
+	parsed, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := asObject(parsed)
+
+	version, _ := doc["asyncapi"].(string)
+	if !strings.HasPrefix(version, "2.") {
+		return nil, fmt.Errorf("Unsupported AsyncAPI version '%s', only 2.x documents are supported", version)
+	}
+
+	c := &asyncAPIConverter{doc: doc, contentType: "application/json"}
+	if ct, ok := doc["defaultContentType"].(string); ok && ct != "" {
+		c.contentType = ct
+	}
+
+	info := map[string]interface{}{"title": "AsyncAPI", "version": "1.0.0"}
+	for key, value := range asObject(doc["info"]) {
+		switch key {
+		case "title", "description":
+			if s, ok := value.(string); ok && s != "" {
+				info[key] = s
+			}
+		case "version":
+			if value != nil {
+				info[key] = fmt.Sprintf("%v", value)
+			}
+		}
+	}
+
+	paths := make(map[string]interface{})
+	channels := asObject(doc["channels"])
+	for _, name := range sortedKeys(channels) {
+		channel, err := c.resolve(channels[name])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to convert channel '%s': %v", name, err)
+		}
+
+		item := make(map[string]interface{})
+
+		params, err := c.parameters(name, asObject(channel["parameters"]))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to convert channel '%s': %v", name, err)
+		}
+		if len(params) > 0 {
+			item["parameters"] = params
+		}
+
+		if sub := asObject(channel["subscribe"]); sub != nil {
+			op, err := c.operation(sub)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to convert channel '%s': %v", name, err)
+			}
+			op[extAsyncAPIChannel] = name
+			op["responses"] = map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "A message sent to subscribers of the channel",
+					"content":     op["content"],
+				},
+			}
+			delete(op, "content")
+			item["get"] = op
+		}
+
+		if pub := asObject(channel["publish"]); pub != nil {
+			op, err := c.operation(pub)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to convert channel '%s': %v", name, err)
+			}
+			delete(op, extAsyncAPIMessages)
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  op["content"],
+			}
+			op["responses"] = map[string]interface{}{
+				"202": map[string]interface{}{
+					"description": "The message was accepted",
+				},
+			}
+			delete(op, "content")
+			item["post"] = op
+		}
+
+		paths["/"+strings.TrimPrefix(name, "/")] = item
+	}
+
+	result := map[string]interface{}{
+		"openapi": "3.0.0",
+		"info":    info,
+		"paths":   paths,
+	}
+
+	// Payloads may reference schemas, which live in the same place as in an
+	// OpenAPI document.
+	if schemas := asObject(asObject(doc["components"])["schemas"]); schemas != nil {
+		result["components"] = map[string]interface{}{"schemas": schemas}
+	}
+
+	return json.Marshal(result)
+}
+
+// resolve follows local references like `#/components/messages/User`.
+func (c *asyncAPIConverter) resolve(value interface{}) (map[string]interface{}, error) {
+	for i := 0; i < 10; i++ {
+		obj := asObject(value)
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return obj, nil
+		}
+
+		if !strings.HasPrefix(ref, "#") {
+			return nil, fmt.Errorf("External reference '%s' is not supported", ref)
+		}
+
+		resolved, err := resolvePointer(c.doc, ref[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to resolve reference '%s': %v", ref, err)
+		}
+		value = resolved
+	}
+
+	return nil, fmt.Errorf("Too many nested references")
+}
+
+// parameters converts channel parameters into path parameters. Parameters
+// which are used in the channel name but not described are strings.
+func (c *asyncAPIConverter) parameters(channel string, params map[string]interface{}) ([]interface{}, error) {
+	result := make([]interface{}, 0)
+
+	for _, m := range asyncAPIParameter.FindAllStringSubmatch(channel, -1) {
+		name := m[1]
+
+		param := map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		}
+
+		if value, ok := params[name]; ok {
+			p, err := c.resolve(value)
+			if err != nil {
+				return nil, err
+			}
+			if p["schema"] != nil {
+				param["schema"] = p["schema"]
+			}
+			if d, ok := p["description"].(string); ok {
+				param["description"] = d
+			}
+		}
+
+		result = append(result, param)
+	}
+
+	return result, nil
+}
+
+// operation converts the common parts of a channel operation, returning the
+// messages as OpenAPI `content`.
+func (c *asyncAPIConverter) operation(op map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for _, key := range []string{"operationId", "summary", "description"} {
+		if s, ok := op[key].(string); ok && s != "" {
+			result[key] = s
+		}
+	}
+
+	tags := make([]string, 0)
+	for _, t := range asArray(op["tags"]) {
+		if name, ok := asObject(t)["name"].(string); ok {
+			tags = append(tags, name)
+		}
+	}
+	if len(tags) > 0 {
+		result["tags"] = tags
+	}
+
+	message, err := c.resolve(op["message"])
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []map[string]interface{}{message}
+	if oneOf, ok := message["oneOf"].([]interface{}); ok {
+		messages = make([]map[string]interface{}, 0, len(oneOf))
+		for _, m := range oneOf {
+			resolved, err := c.resolve(m)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, resolved)
+		}
+	}
+
+	content := make(map[string]interface{})
+	payloads := make(map[string][]interface{})
+	described := make([]interface{}, 0, len(messages))
+	for i, m := range messages {
+		if m == nil {
+			continue
+		}
+
+		ct, _ := m["contentType"].(string)
+		if ct == "" {
+			ct = c.contentType
+		}
+
+		mt := asObject(content[ct])
+		if mt == nil {
+			mt = map[string]interface{}{"examples": map[string]interface{}{}}
+			content[ct] = mt
+		}
+
+		payload := m["payload"]
+		if payload == nil {
+			payload = map[string]interface{}{}
+		}
+
+		name := fmt.Sprintf("message%d", i+1)
+		for _, key := range []string{"name", "messageId", "title"} {
+			if s, ok := m[key].(string); ok && s != "" {
+				name = s
+				break
+			}
+		}
+
+		exampleNames := make([]interface{}, 0)
+		examples := asObject(mt["examples"])
+		for j, e := range asArray(m["examples"]) {
+			example := asObject(e)
+			if _, ok := example["payload"]; !ok {
+				continue
+			}
+
+			exampleName := name
+			if n, ok := example["name"].(string); ok && n != "" {
+				exampleName = n
+			} else if j > 0 {
+				exampleName = fmt.Sprintf("%s%d", name, j+1)
+			}
+
+			examples[exampleName] = map[string]interface{}{"value": example["payload"]}
+			exampleNames = append(exampleNames, exampleName)
+		}
+
+		described = append(described, map[string]interface{}{
+			"name":        name,
+			"contentType": ct,
+			"index":       len(payloads[ct]),
+			"examples":    exampleNames,
+		})
+		payloads[ct] = append(payloads[ct], payload)
+	}
+
+	for ct, mt := range content {
+		if len(asObject(asObject(mt)["examples"])) == 0 {
+			delete(asObject(mt), "examples")
+		}
+
+		if len(payloads[ct]) == 1 {
+			asObject(mt)["schema"] = payloads[ct][0]
+		} else {
+			asObject(mt)["schema"] = map[string]interface{}{"oneOf": payloads[ct]}
+		}
+	}
+
+	result[extAsyncAPIMessages] = described
+	result["content"] = content
+
+	return result, nil
+}
+
+// asArray returns a generic JSON value as an array, or nil if it isn't one.
+func asArray(value interface{}) []interface{} {
+	a, _ := value.([]interface{})
+	return a
+}
+
+// channelMessage is a message pushed to subscribers of a channel.
+type channelMessage struct {
+	Name    string
+	Payload []byte
+}
+
+// channelMessages returns the messages of a channel in the order they are
+// declared, using each message's examples or generating one from its schema.
+func channelMessages(ctx context.Context, op *openapi3.Operation) ([]channelMessage, error) {
+	response := op.Responses.Get(http.StatusOK)
+	if response == nil || response.Value == nil {
+		return nil, fmt.Errorf("No messages found")
+	}
+
+	value, _ := extensionValue(op.ExtensionProps, extAsyncAPIMessages)
+
+	messages := make([]channelMessage, 0)
+	for _, item := range asArray(value) {
+		described := asObject(item)
+		name, _ := described["name"].(string)
+		ct, _ := described["contentType"].(string)
+		index, _ := described["index"].(float64)
+
+		mt := response.Value.Content[ct]
+		if mt == nil {
+			continue
+		}
+
+		examples := asArray(described["examples"])
+		for _, e := range examples {
+			exampleName, _ := e.(string)
+			if ex := mt.Examples[exampleName]; ex != nil && ex.Value != nil {
+				encoded, err := encodeMessage(ex.Value.Value)
+				if err != nil {
+					return nil, err
+				}
+				messages = append(messages, channelMessage{Name: name, Payload: encoded})
+			}
+		}
+
+		if len(examples) > 0 || mt.Schema == nil || mt.Schema.Value == nil {
+			continue
+		}
+
+		schema := mt.Schema
+		if len(schema.Value.OneOf) > int(index) && len(schema.Value.OneOf) > 1 {
+			schema = schema.Value.OneOf[int(index)]
+		}
+		if schema == nil || schema.Value == nil {
+			continue
+		}
+
+		example, err := OpenAPIExampleContext(ctx, ModeResponse, schema.Value)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := encodeMessage(example)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, channelMessage{Name: name, Payload: encoded})
+	}
+
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("No messages found")
+	}
+
+	return messages, nil
+}
+
+// encodeMessage returns the payload of a message, sending strings as they
+// are and anything else as JSON.
+func encodeMessage(value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+// isEventStream returns true if the client asks for server-sent events.
+func isEventStream(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+}
+
+// streamChannel pushes a channel's messages to a subscriber via a WebSocket
+// or server-sent events, one every `--message-interval`, cycling through
+// the available messages until the client goes away.
+func (s *OpenAPIServer) streamChannel(w http.ResponseWriter, req *http.Request, route *openapi3filter.Route, info string, rl *requestLogger) {
+	messages, err := channelMessages(req.Context(), route.Operation)
+	if err != nil {
+		rl.logf(logNormal, "%s => Missing example: %v", info, err)
+		s.noExample(w)
+		return
+	}
+
+	interval := s.settings().GetDuration("message-interval")
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	id := route.Operation.OperationID
+	if id == "" {
+		id = route.Operation.Summary
+	}
+
+	if isWebSocketUpgrade(req) {
+		conn, err := upgradeWebSocket(w, req)
+		if err != nil {
+			rl.printf("ERROR: %s => %v", info, err)
+			return
+		}
+		defer conn.Close()
+
+		rl.logf(logNormal, "%s (%s) => %d (websocket)", info, id, http.StatusSwitchingProtocols)
+		s.streamWebSocket(conn, route, info, rl, messages, interval)
+		return
+	}
+
+	rl.logf(logNormal, "%s (%s) => %d (text/event-stream)", info, id, http.StatusOK)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	for i := 0; ; i++ {
+		m := messages[i%len(messages)]
+
+		fmt.Fprintf(w, "id: %d\nevent: %s\n", i+1, m.Name)
+		for _, line := range strings.Split(string(m.Payload), "\n") {
+			fmt.Fprintf(w, "data: %s\n", line)
+		}
+		fmt.Fprint(w, "\n")
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// streamWebSocket pushes messages to a WebSocket client while validating
+// any messages it publishes against the channel's `publish` operation.
+// Invalid messages are answered with an error message.
+func (s *OpenAPIServer) streamWebSocket(conn *wsConn, route *openapi3filter.Route, info string, rl *requestLogger, messages []channelMessage, interval time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := validatePublished(route.PathItem, data); err != nil {
+				rl.printf("ERROR: %s => Published message is invalid: %v", info, err)
+				reply, _ := json.Marshal(map[string]string{"error": err.Error()})
+				if err := conn.WriteText(reply); err != nil {
+					return
+				}
+				continue
+			}
+
+			rl.logf(logNormal, "%s => Published message accepted", info)
+		}
+	}()
+
+	for i := 0; ; i++ {
+		if err := conn.WriteText(messages[i%len(messages)].Payload); err != nil {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// validatePublished checks a message sent by a client against the schema of
+// the channel's `publish` operation.
+func validatePublished(item *openapi3.PathItem, data []byte) error {
+	if item == nil || item.Post == nil || item.Post.RequestBody == nil || item.Post.RequestBody.Value == nil {
+		return fmt.Errorf("The channel doesn't accept published messages")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		// Non-JSON messages are compared as plain strings.
+		value = string(data)
+	}
+
+	var lastErr error
+	for _, mt := range item.Post.RequestBody.Value.Content {
+		if mt.Schema == nil || mt.Schema.Value == nil {
+			return nil
+		}
+
+		err := mt.Schema.Value.VisitJSON(value)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+
+	return lastErr
+}
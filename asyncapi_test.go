@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const asyncAPIDoc = `
+asyncapi: 2.6.0
+info:
+  title: Chat
+  version: 1.0.0
+channels:
+  rooms/{roomId}/messages:
+    parameters:
+      roomId:
+        description: The room
+        schema:
+          type: integer
+    subscribe:
+      operationId: receiveMessages
+      message:
+        oneOf:
+          - $ref: "#/components/messages/Chat"
+          - $ref: "#/components/messages/Joined"
+    publish:
+      operationId: sendMessage
+      message:
+        $ref: "#/components/messages/Chat"
+components:
+  messages:
+    Chat:
+      name: chat
+      payload:
+        $ref: "#/components/schemas/Chat"
+      examples:
+        - payload:
+            text: Hello
+    Joined:
+      name: joined
+      payload:
+        type: object
+        properties:
+          user:
+            type: string
+            example: alice
+  schemas:
+    Chat:
+      type: object
+      required: [text]
+      properties:
+        text:
+          type: string
+`
+
+func TestIsAsyncAPI(t *testing.T) {
+	assert.True(t, isAsyncAPI([]byte(asyncAPIDoc)))
+	assert.True(t, isAsyncAPI([]byte(`{"asyncapi": "2.0.0"}`)))
+	assert.False(t, isAsyncAPI([]byte(`openapi: 3.0.0`)))
+	assert.False(t, isAsyncAPI([]byte(`{"info": {"title": "asyncapi"}}`)))
+}
+
+func TestConvertAsyncAPI(t *testing.T) {
+	swagger, _, err := load(viper.New(), "asyncapi.yaml", []byte(asyncAPIDoc))
+	require.NoError(t, err)
+	assert.Equal(t, "Chat", swagger.Info.Title)
+
+	item := swagger.Paths["/rooms/{roomId}/messages"]
+	require.NotNil(t, item)
+	require.Len(t, item.Parameters, 1)
+	assert.Equal(t, "integer", item.Parameters[0].Value.Schema.Value.Type)
+
+	require.NotNil(t, item.Get)
+	assert.Equal(t, "receiveMessages", item.Get.OperationID)
+	mt := item.Get.Responses["200"].Value.Content["application/json"]
+	assert.Len(t, mt.Schema.Value.OneOf, 2)
+	assert.Contains(t, mt.Examples, "chat")
+
+	require.NotNil(t, item.Post)
+	assert.Equal(t, "sendMessage", item.Post.OperationID)
+	assert.NotNil(t, item.Post.RequestBody.Value.Content["application/json"].Schema.Value)
+
+	_, err = convertAsyncAPI([]byte(`{"asyncapi": "3.0.0"}`))
+	assert.Error(t, err)
+}
+
+func TestServeAsyncAPI(t *testing.T) {
+	config := viper.New()
+	config.Set("validate-request", true)
+	config.Set("message-interval", 10*time.Millisecond)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("asyncapi.yaml", []byte(asyncAPIDoc)))
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	t.Run("Example", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/rooms/1/messages")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"/rooms/1/messages", "application/json", strings.NewReader(`{"text": "Hi"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		resp, err = http.Post(srv.URL+"/rooms/1/messages", "application/json", strings.NewReader(`{}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("ServerSentEvents", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", srv.URL+"/rooms/1/messages", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		r := bufio.NewReader(resp.Body)
+		lines := make([]string, 0)
+		for len(lines) < 8 {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			lines = append(lines, strings.TrimSpace(line))
+		}
+		assert.Equal(t, []string{"id: 1", "event: chat", `data: {"text":"Hello"}`, "", "id: 2", "event: joined", `data: {"user":"alice"}`, ""}, lines)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		key := "dGhlIHNhbXBsZSBub25jZQ=="
+		_, err = conn.Write([]byte("GET /rooms/1/messages HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+		require.NoError(t, err)
+
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+		_, opcode, payload, err := readWSFrame(r, false)
+		require.NoError(t, err)
+		assert.Equal(t, wsText, opcode)
+		assert.Equal(t, `{"text":"Hello"}`, string(payload))
+
+		// Invalid published messages are answered with an error.
+		require.NoError(t, writeWSFrame(conn, wsText, []byte(`{"text": 5}`), true))
+		for {
+			_, opcode, payload, err = readWSFrame(r, false)
+			require.NoError(t, err)
+
+			var reply map[string]interface{}
+			require.NoError(t, json.Unmarshal(payload, &reply))
+			if reply["error"] != nil {
+				break
+			}
+		}
+
+		require.NoError(t, writeWSFrame(conn, wsClose, nil, true))
+	})
+
+	t.Run("WebSocket unmasked", func(t *testing.T) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = conn.Write([]byte("GET /rooms/1/messages HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+		require.NoError(t, err)
+
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		// Clients must mask their frames, so the server closes the
+		// connection with a protocol error.
+		require.NoError(t, writeWSFrame(conn, wsText, []byte(`{"text": "Hi"}`), false))
+		for {
+			_, opcode, payload, err := readWSFrame(r, false)
+			require.NoError(t, err)
+			if opcode == wsClose {
+				assert.Equal(t, wsCloseProtocol, payload)
+				break
+			}
+		}
+
+		// No second close frame follows.
+		_, _, _, err = readWSFrame(r, false)
+		assert.Equal(t, io.EOF, err)
+	})
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// securityRequirements returns the security requirements which apply to an
+// operation. Operations may override the document's global requirements,
+// including with an empty list (`security: []`) to make auth optional.
+func securityRequirements(route *openapi3filter.Route) openapi3.SecurityRequirements {
+	if route.Operation.Security != nil {
+		return *route.Operation.Security
+	}
+
+	if route.Swagger != nil {
+		return route.Swagger.Security
+	}
+
+	return nil
+}
+
+// withoutSecurity returns a copy of the route with the operation's security
+// requirements removed, so that the request validator only checks parameters
+// and the body. Security is checked separately by `validateSecurity`.
+func withoutSecurity(route *openapi3filter.Route) *openapi3filter.Route {
+	op := *route.Operation
+	op.Security = nil
+
+	if op.Parameters == nil {
+		// The validator skips the path item's parameters unless the operation
+		// has a list of its own.
+		op.Parameters = openapi3.Parameters{}
+	}
+
+	r := *route
+	r.Operation = &op
+
+	return &r
+}
+
+// hideOpenIDConnect works around the router rejecting documents which use
+// `openIdConnect` security schemes by presenting them as bearer schemes while
+// the document is validated. Call the returned function to restore them.
+func hideOpenIDConnect(swagger *openapi3.Swagger) func() {
+	hidden := make([]*openapi3.SecurityScheme, 0)
+	for _, ref := range swagger.Components.SecuritySchemes {
+		if ref != nil && ref.Value != nil && ref.Value.Type == "openIdConnect" {
+			ref.Value.Type = "http"
+			ref.Value.Scheme = "bearer"
+			hidden = append(hidden, ref.Value)
+		}
+	}
+
+	return func() {
+		for _, sec := range hidden {
+			sec.Type = "openIdConnect"
+			sec.Scheme = ""
+		}
+	}
+}
+
+// validateSecurity checks a request against a list of alternative security
+// requirements. Only one alternative needs to pass, but all schemes listed
+// within that alternative must be satisfied.
+func validateSecurity(c context.Context, input *openapi3filter.RequestValidationInput, srs openapi3.SecurityRequirements, auth func(context.Context, *openapi3filter.AuthenticationInput) error) error {
+	if len(srs) == 0 {
+		return nil
+	}
+
+	var schemes map[string]*openapi3.SecuritySchemeRef
+	if input.Route.Swagger != nil {
+		schemes = input.Route.Swagger.Components.SecuritySchemes
+	}
+
+	errs := make([]error, len(srs))
+	for i, sr := range srs {
+		// Ensure deterministic order.
+		names := make([]string, 0, len(sr))
+		for name := range sr {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			ref := schemes[name]
+			if ref == nil || ref.Value == nil {
+				errs[i] = fmt.Errorf("Security scheme '%s' is not declared", name)
+				break
+			}
+
+			if err := auth(c, &openapi3filter.AuthenticationInput{
+				RequestValidationInput: input,
+				SecuritySchemeName:     name,
+				SecurityScheme:         ref.Value,
+				Scopes:                 sr[name],
+			}); err != nil {
+				errs[i] = err
+				break
+			}
+		}
+
+		if errs[i] == nil {
+			return nil
+		}
+	}
+
+	return &openapi3filter.SecurityRequirementsError{
+		SecurityRequirements: srs,
+		Errors:               errs,
+	}
+}
+
+// authenticate checks the request against a single security scheme.
+func authenticate(c context.Context, input *openapi3filter.AuthenticationInput) error {
+	// TODO: support more schemes
+	sec := input.SecurityScheme
+	if sec.Type == "http" && (strings.EqualFold(sec.Scheme, "bearer") || strings.EqualFold(sec.Scheme, "basic")) {
+		_, err := credentials(input.RequestValidationInput.Request, sec.Scheme)
+		return err
+	}
+	return nil
+}
+
+// credentials returns the value sent in the `Authorization` header for an
+// HTTP `bearer` or `basic` scheme: either the token or the decoded
+// `user:pass`. The scheme name is case insensitive. Missing, empty or
+// malformed values result in a `*CredentialsError`.
+func credentials(req *http.Request, scheme string) (string, error) {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return "", &CredentialsError{Scheme: scheme, Err: ErrMissingAuth}
+	}
+
+	invalid := &CredentialsError{Scheme: scheme, Err: ErrInvalidAuth}
+
+	prefix := scheme + " "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", invalid
+	}
+
+	value := strings.TrimSpace(auth[len(prefix):])
+	if value == "" {
+		return "", invalid
+	}
+
+	if strings.EqualFold(scheme, "basic") {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || !strings.Contains(string(decoded), ":") {
+			return "", invalid
+		}
+		value = string(decoded)
+	}
+
+	return value, nil
+}
+
+// authenticateAPIKey checks that the request includes the key of an `apiKey`
+// security scheme in the declared header, query parameter or cookie. If a
+// list of valid keys is given, then the key must be one of them.
+func authenticateAPIKey(input *openapi3filter.AuthenticationInput, keys []string) error {
+	req := input.RequestValidationInput.Request
+	sec := input.SecurityScheme
+
+	key := ""
+	switch sec.In {
+	case "header":
+		key = req.Header.Get(sec.Name)
+	case "query":
+		key = req.URL.Query().Get(sec.Name)
+	case "cookie":
+		if cookie, err := req.Cookie(sec.Name); err == nil {
+			key = cookie.Value
+		}
+	}
+
+	if key == "" {
+		return ErrMissingAPIKey
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return nil
+		}
+	}
+
+	return ErrInvalidAPIKey
+}
+
+// isUnauthorized returns true if the request failed security validation due
+// to missing or invalid credentials which should result in a 401, like an
+// unknown API key, an expired token or no `Authorization` header at all.
+func isUnauthorized(err error) bool {
+	secErr, ok := err.(*openapi3filter.SecurityRequirementsError)
+	if !ok {
+		return false
+	}
+
+	for _, e := range secErr.Errors {
+		switch e.(type) {
+		case *TokenError, *CredentialsError:
+			return true
+		}
+		if e == ErrMissingAPIKey || e == ErrInvalidAPIKey || e == ErrInvalidCredentials {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticateBearer checks the token in the `Authorization` header. Tokens
+// in the allowlist are always accepted, otherwise the token is verified as a
+// JWT if a verifier is given.
+func authenticateBearer(input *openapi3filter.AuthenticationInput, tokens []string, verifier *jwtVerifier) error {
+	token, err := credentials(input.RequestValidationInput.Request, "bearer")
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	if verifier != nil {
+		return verifier.Verify(token)
+	}
+
+	return ErrForbiddenToken
+}
+
+// isForbidden returns true if the request sent credentials which are valid
+// but not allowed, which should result in a 403.
+func isForbidden(err error) bool {
+	secErr, ok := err.(*openapi3filter.SecurityRequirementsError)
+	if !ok {
+		return false
+	}
+
+	for _, e := range secErr.Errors {
+		if e == ErrForbiddenToken {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authChallenges returns the `WWW-Authenticate` challenges to send when a
+// request failed security validation. Each scheme is only challenged once.
+func authChallenges(err error) []string {
+	challenges := make([]string, 0)
+
+	secErr, ok := err.(*openapi3filter.SecurityRequirementsError)
+	if !ok {
+		return challenges
+	}
+
+	basic, bearer := false, false
+	for _, e := range secErr.Errors {
+		switch e := e.(type) {
+		case *TokenError:
+			bearer = true
+		case *CredentialsError:
+			if strings.EqualFold(e.Scheme, "basic") {
+				basic = true
+			} else {
+				bearer = true
+			}
+		default:
+			if e == ErrInvalidCredentials {
+				basic = true
+			}
+		}
+	}
+
+	if basic {
+		challenges = append(challenges, `Basic realm="apisprout", charset="UTF-8"`)
+	}
+	if bearer {
+		challenges = append(challenges, `Bearer realm="apisprout"`)
+	}
+
+	return challenges
+}
+
+// authenticateBasic verifies the username and password sent using HTTP basic
+// auth against a set of known users.
+func authenticateBasic(input *openapi3filter.AuthenticationInput, users map[string]string) error {
+	creds, err := credentials(input.RequestValidationInput.Request, "basic")
+	if err != nil {
+		return err
+	}
+	i := strings.IndexByte(creds, ':')
+	user, pass := creds[:i], creds[i+1:]
+
+	stored, ok := users[user]
+	if !ok || !checkPassword(stored, pass) {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// checkPassword compares a password with a stored one, which is either plain
+// text or an htpasswd `{SHA}` hash.
+func checkPassword(stored, pass string) bool {
+	if strings.HasPrefix(stored, "{SHA}") {
+		sum := sha1.Sum([]byte(pass))
+		pass = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1
+}
+
+// basicUsers returns the users accepted for HTTP basic auth, given as a
+// comma-separated list of `user:pass` pairs and/or an htpasswd file. Returns
+// nil if no users are configured.
+func basicUsers(list, htpasswd string) (map[string]string, error) {
+	if list == "" && htpasswd == "" {
+		return nil, nil
+	}
+
+	users := make(map[string]string)
+
+	if list != "" {
+		for _, entry := range strings.Split(list, ",") {
+			parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("Invalid user '%s', expected user:pass", entry)
+			}
+			users[parts[0]] = parts[1]
+		}
+	}
+
+	if htpasswd != "" {
+		data, err := ioutil.ReadFile(htpasswd)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("Invalid htpasswd line '%s'", line)
+			}
+
+			if strings.HasPrefix(parts[1], "$") {
+				return nil, fmt.Errorf("Unsupported hash for htpasswd user '%s', use plain text or SHA", parts[0])
+			}
+
+			users[parts[0]] = parts[1]
+		}
+	}
+
+	return users, nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const securitySchema = `{
+	"components": {
+		"securitySchemes": {
+			"bearer": {"type": "http", "scheme": "bearer"},
+			"basic": {"type": "http", "scheme": "basic"}
+		}
+	},
+	"security": [{"bearer": []}],
+	"paths": {
+		"/global": {
+			"get": {"responses": {"204": {"description": "ok"}}}
+		},
+		"/optional": {
+			"get": {"security": [], "responses": {"204": {"description": "ok"}}}
+		},
+		"/basic": {
+			"get": {"security": [{"basic": []}], "responses": {"204": {"description": "ok"}}}
+		},
+		"/both": {
+			"get": {"security": [{"basic": [], "bearer": []}], "responses": {"204": {"description": "ok"}}}
+		},
+		"/either": {
+			"get": {"security": [{"basic": []}, {"bearer": []}], "responses": {"204": {"description": "ok"}}}
+		}
+	}
+}`
+
+func TestSecurityRequirements(t *testing.T) {
+	config := viper.New()
+	config.Set("validate-request", true)
+
+	s := NewOpenAPIServer(config)
+	err := s.Load("file:///swagger.json", []byte(securitySchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		path   string
+		auth   string
+		status int
+	}{
+		{"Global missing", "/global", "", http.StatusUnauthorized},
+		{"Global valid", "/global", "Bearer abc123", http.StatusNoContent},
+		{"Optional", "/optional", "", http.StatusNoContent},
+		{"Override missing", "/basic", "", http.StatusUnauthorized},
+		{"Override wrong scheme", "/basic", "Bearer abc123", http.StatusUnauthorized},
+		{"Global empty token", "/global", "Bearer  ", http.StatusUnauthorized},
+		{"Override valid", "/basic", "Basic dXNlcjpwYXNz", http.StatusNoContent},
+		{"Override malformed", "/basic", "Basic abc123", http.StatusUnauthorized},
+		{"Override empty", "/basic", "Basic ", http.StatusUnauthorized},
+		{"All schemes required", "/both", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"Either scheme basic", "/either", "Basic dXNlcjpwYXNz", http.StatusNoContent},
+		{"Either scheme bearer", "/either", "Bearer abc123", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+const apiKeySchema = `{
+	"components": {
+		"securitySchemes": {
+			"header": {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			"query": {"type": "apiKey", "in": "query", "name": "api_key"},
+			"cookie": {"type": "apiKey", "in": "cookie", "name": "session"}
+		}
+	},
+	"paths": {
+		"/header": {
+			"get": {"security": [{"header": []}], "responses": {"204": {"description": "ok"}}}
+		},
+		"/query": {
+			"get": {"security": [{"query": []}], "responses": {"204": {"description": "ok"}}}
+		},
+		"/cookie": {
+			"get": {"security": [{"cookie": []}], "responses": {"204": {"description": "ok"}}}
+		}
+	}
+}`
+
+func TestAPIKeySecurity(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   string
+		path   string
+		header string
+		cookie string
+		status int
+	}{
+		{"Header missing", "", "/header", "", "", http.StatusUnauthorized},
+		{"Header present", "", "/header", "abc123", "", http.StatusNoContent},
+		{"Query missing", "", "/query", "", "", http.StatusUnauthorized},
+		{"Query present", "", "/query?api_key=abc123", "", "", http.StatusNoContent},
+		{"Cookie missing", "", "/cookie", "", "", http.StatusUnauthorized},
+		{"Cookie present", "", "/cookie", "", "abc123", http.StatusNoContent},
+		{"Key accepted", "abc123, def456", "/header", "def456", "", http.StatusNoContent},
+		{"Key rejected", "abc123, def456", "/header", "bad", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("validate-request", true)
+			config.Set("api-keys", test.keys)
+
+			s := NewOpenAPIServer(config)
+			err := s.Load("file:///swagger.json", []byte(apiKeySchema))
+			require.NoError(t, err)
+
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+			if test.header != "" {
+				req.Header.Set("X-API-Key", test.header)
+			}
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "session", Value: test.cookie})
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+func TestBasicUsers(t *testing.T) {
+	f, err := ioutil.TempFile("", "htpasswd")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	// The second user's password is "secret".
+	f.WriteString("# Users\nplain:pass\nhashed:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	f.Close()
+
+	config := viper.New()
+	config.Set("validate-request", true)
+	config.Set("basic-users", "alice:wonderland, bob:builder")
+	config.Set("basic-htpasswd", f.Name())
+
+	s := NewOpenAPIServer(config)
+	err = s.Load("file:///swagger.json", []byte(securitySchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		user   string
+		pass   string
+		status int
+	}{
+		{"Missing", "", "", http.StatusUnauthorized},
+		{"Valid list user", "bob", "builder", http.StatusNoContent},
+		{"Wrong password", "alice", "builder", http.StatusUnauthorized},
+		{"Unknown user", "eve", "wonderland", http.StatusUnauthorized},
+		{"Valid plain htpasswd user", "plain", "pass", http.StatusNoContent},
+		{"Valid hashed htpasswd user", "hashed", "secret", http.StatusNoContent},
+		{"Wrong hashed password", "hashed", "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/basic", nil)
+			require.NoError(t, err)
+			if test.user != "" {
+				req.SetBasicAuth(test.user, test.pass)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.status == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="apisprout", charset="UTF-8"`, resp.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestBasicUsersInvalid(t *testing.T) {
+	_, err := basicUsers("nopassword", "")
+	assert.Error(t, err)
+
+	f, err := ioutil.TempFile("", "htpasswd")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("user:$2y$05$abcdefghijklmnopqrstuu\n")
+	f.Close()
+
+	_, err = basicUsers("", f.Name())
+	assert.Error(t, err)
+
+	// Unsupported users must not let anyone in.
+	config := viper.New()
+	config.Set("validate-security", true)
+	config.Set("basic-htpasswd", f.Name())
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(securitySchema)))
+
+	for _, user := range []string{"user", "mallory"} {
+		req := httptest.NewRequest("GET", "/basic", nil)
+		req.SetBasicAuth(user, "whatever")
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, user)
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	config := viper.New()
+	config.Set("validate-request", true)
+	config.Set("auth-token", []string{"abc123", "def456"})
+
+	s := NewOpenAPIServer(config)
+	err := s.Load("file:///swagger.json", []byte(securitySchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"Missing", "", http.StatusUnauthorized},
+		{"Empty", "Bearer ", http.StatusUnauthorized},
+		{"Allowed", "Bearer abc123", http.StatusNoContent},
+		{"Allowed lowercase scheme", "bearer def456", http.StatusNoContent},
+		{"Not allowed", "Bearer xyz789", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/global", nil)
+			require.NoError(t, err)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+func TestValidateSecurityOnly(t *testing.T) {
+	const schema = `{
+		"components": {
+			"securitySchemes": {
+				"bearer": {"type": "http", "scheme": "bearer"}
+			}
+		},
+		"security": [{"bearer": []}],
+		"paths": {
+			"/test": {
+				"get": {
+					"parameters": [
+						{"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 10}}
+					],
+					"responses": {"204": {"description": "ok"}}
+				}
+			}
+		}
+	}`
+
+	config := viper.New()
+	config.Set("validate-security", true)
+	config.Set("auth-token", []string{"abc123"})
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+	tests := []struct {
+		name   string
+		path   string
+		auth   string
+		status int
+	}{
+		{"Missing auth", "/test", "", http.StatusUnauthorized},
+		{"Forbidden", "/test", "Bearer xyz", http.StatusForbidden},
+		{"Valid", "/test", "Bearer abc123", http.StatusNoContent},
+		{"Invalid parameter ignored", "/test?limit=50", "Bearer abc123", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.status == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="apisprout"`, resp.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	t.Run("Missing credentials without tokens", func(t *testing.T) {
+		// Without configured tokens any bearer token is accepted, but one
+		// must still be sent.
+		config := viper.New()
+		config.Set("validate-security", true)
+
+		s := NewOpenAPIServer(config)
+		require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+		for auth, status := range map[string]int{
+			"":             http.StatusUnauthorized,
+			"Basic abc123": http.StatusUnauthorized,
+			"Bearer xyz":   http.StatusNoContent,
+		} {
+			req := httptest.NewRequest("GET", "/test", nil)
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, status, resp.Code, auth)
+			if status == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="apisprout"`, resp.Header().Get("WWW-Authenticate"), auth)
+			}
+		}
+	})
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// componentPointer matches JSON pointers to reusable components, like
+// `/components/schemas/User`.
+var componentPointer = regexp.MustCompile(`^/components/([^/]+)/([^/]+)$`)
+
+// bundler resolves the external references of a document into a single
+// self-contained document. Referenced components are relocated into the
+// document's own components, while anything else is inlined.
+type bundler struct {
+	config *viper.Viper
+	root   *url.URL
+	doc    map[string]interface{}
+
+	// Parsed external documents by URL.
+	docs map[string]interface{}
+
+	// Local references of relocated components by their original location.
+	names map[string]string
+
+	// References being inlined, to detect cycles.
+	inlining map[string]bool
+}
+
+// bundleDocument resolves all external references of a document, fetching
+// referenced files and URLs the same way they are when serving, and returns
+// the self-contained result.
+func bundleDocument(config *viper.Viper, uri string, data []byte) (map[string]interface{}, error) {
+	if isArchive(data) {
+		root, content, err := openArchive(config, data)
+		if err != nil {
+			return nil, err
+		}
+		uri, data = root, content
+	}
+
+	if isPostmanCollection(data) {
+		converted, err := convertPostman(data)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+
+	root, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if root.Scheme == "" && root.Host == "" {
+		root.Path = path.Clean(root.Path)
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundler{
+		config:   config,
+		root:     root,
+		doc:      asObject(doc),
+		docs:     make(map[string]interface{}),
+		names:    make(map[string]string),
+		inlining: make(map[string]bool),
+	}
+	if b.doc == nil {
+		return nil, fmt.Errorf("Document %s is not an object", uri)
+	}
+
+	if _, err := b.walk(b.doc, root); err != nil {
+		return nil, err
+	}
+
+	return b.doc, nil
+}
+
+// parseDocument parses a JSON or YAML document into generic values.
+func parseDocument(data []byte) (interface{}, error) {
+	converted, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(converted, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// walk resolves the references within a value found in the document at
+// `location`, returning the value to use in its place.
+func (b *bundler) walk(value interface{}, location *url.URL) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			return b.resolve(v, ref, location)
+		}
+
+		for key, item := range v {
+			resolved, err := b.walk(item, location)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := b.walk(item, location)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+
+	return value, nil
+}
+
+// resolve returns the replacement for a reference object found in the
+// document at `location`.
+func (b *bundler) resolve(obj map[string]interface{}, ref string, location *url.URL) (interface{}, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid reference '%s': %v", ref, err)
+	}
+	fragment := u.Fragment
+	u.Fragment = ""
+
+	target := location
+	if u.String() != "" {
+		target = resolveRefURL(location, u)
+	}
+
+	if target.String() == b.root.String() {
+		if location.String() == b.root.String() {
+			// Local references of the document itself stay as they are.
+			return obj, nil
+		}
+		return map[string]interface{}{"$ref": "#" + fragment}, nil
+	}
+
+	key := target.String() + "#" + fragment
+	if local, ok := b.names[key]; ok {
+		return map[string]interface{}{"$ref": local}, nil
+	}
+
+	doc, err := b.load(target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to resolve reference '%s': %v", ref, err)
+	}
+
+	value, err := resolvePointer(doc, fragment)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to resolve reference '%s': %v", ref, err)
+	}
+
+	if m := componentPointer.FindStringSubmatch(fragment); m != nil {
+		kind, name := m[1], unescapePointer(m[2])
+		section := objectField(objectField(b.doc, "components"), kind)
+
+		// Avoid clashing with components of the same name from elsewhere.
+		unique := name
+		for i := 2; section[unique] != nil; i++ {
+			unique = fmt.Sprintf("%s%d", name, i)
+		}
+
+		local := "#/components/" + kind + "/" + escapePointer(unique)
+		b.names[key] = local
+
+		// Register the component before resolving its own references, so
+		// that recursive references point back to it.
+		section[unique] = map[string]interface{}{}
+		resolved, err := b.walk(deepCopy(value), target)
+		if err != nil {
+			return nil, err
+		}
+		section[unique] = resolved
+
+		return map[string]interface{}{"$ref": local}, nil
+	}
+
+	if b.inlining[key] {
+		return nil, fmt.Errorf("Unable to inline circular reference '%s'", ref)
+	}
+	b.inlining[key] = true
+	defer delete(b.inlining, key)
+
+	return b.walk(deepCopy(value), target)
+}
+
+// load returns a parsed external document.
+func (b *bundler) load(location *url.URL) (interface{}, error) {
+	if doc, ok := b.docs[location.String()]; ok {
+		return doc, nil
+	}
+
+	data, err := fetchRef(b.config, b.root, location)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	b.docs[location.String()] = doc
+
+	return doc, nil
+}
+
+// resolveRefURL returns the location of a reference relative to the
+// document containing it.
+func resolveRefURL(base, ref *url.URL) *url.URL {
+	if ref.Scheme != "" || ref.Host != "" {
+		return ref
+	}
+
+	if base.Scheme != "" || base.Host != "" {
+		return base.ResolveReference(ref)
+	}
+
+	resolved := *base
+	resolved.RawQuery = ref.RawQuery
+	if strings.HasPrefix(ref.Path, "/") {
+		resolved.Path = ref.Path
+	} else {
+		resolved.Path = path.Join(path.Dir(base.Path), ref.Path)
+	}
+
+	return &resolved
+}
+
+// resolvePointer returns the value at a JSON pointer within a document.
+func resolvePointer(doc interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer '%s'", pointer)
+	}
+
+	value := doc
+	for _, part := range strings.Split(pointer[1:], "/") {
+		part = unescapePointer(part)
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			item, ok := v[part]
+			if !ok {
+				return nil, fmt.Errorf("'%s' not found", pointer)
+			}
+			value = item
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("'%s' not found", pointer)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("'%s' not found", pointer)
+		}
+	}
+
+	return value, nil
+}
+
+// unescapePointer unescapes a single JSON pointer key.
+func unescapePointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~1", "/", -1), "~0", "~", -1)
+}
+
+// deepCopy copies a generic JSON value.
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// bundle writes a self-contained copy of a document with all of its external
+// references resolved.
+func bundle(cmd *cobra.Command, args []string) {
+	uri := args[0]
+	output := viper.GetString("output")
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	doc, err := bundleDocument(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	format := strings.ToLower(filepath.Ext(output))
+	if format == "" {
+		format = strings.ToLower(filepath.Ext(uri))
+	}
+
+	var result []byte
+	switch format {
+	case ".yaml", ".yml":
+		result, err = yaml.Marshal(doc)
+	default:
+		result, err = json.MarshalIndent(doc, "", "  ")
+		result = append(result, '\n')
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Make sure the result is usable before writing it.
+	if _, _, err := load(viper.GetViper(), uri, result); err != nil {
+		log.Fatalf("Unable to load bundled document: %v", err)
+	}
+
+	if output == "" {
+		os.Stdout.Write(result)
+		return
+	}
+
+	if err := ioutil.WriteFile(output, result, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
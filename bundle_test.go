@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bundleRoot = `
+openapi: 3.0.0
+info:
+  title: Bundle
+  version: "1.0"
+paths:
+  /users/{id}:
+    parameters:
+      - $ref: "params/common.yaml#/components/parameters/Id"
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: "schemas/users.yaml#/components/schemas/User"
+              examples:
+                fido:
+                  $ref: "%s/examples/user.json"
+components:
+  schemas:
+    Address:
+      type: string
+`
+
+const bundleUsers = `
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        address:
+          $ref: "#/components/schemas/Address"
+        friends:
+          type: array
+          items:
+            $ref: "#/components/schemas/User"
+    Address:
+      type: object
+      properties:
+        city:
+          type: string
+`
+
+const bundleParams = `
+components:
+  parameters:
+    Id:
+      name: id
+      in: path
+      required: true
+      schema:
+        $ref: "../schemas/users.yaml#/components/schemas/Address"
+`
+
+func TestBundleDocument(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value": {"address": {"city": "Seattle"}}}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"openapi.yaml":       fmt.Sprintf(bundleRoot, srv.URL),
+		"schemas/users.yaml": bundleUsers,
+		"params/common.yaml": bundleParams,
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	config := viper.New()
+	config.Set("cache-dir", dir)
+
+	uri := filepath.Join(dir, "openapi.yaml")
+	data, err := ioutil.ReadFile(uri)
+	require.NoError(t, err)
+
+	doc, err := bundleDocument(config, uri, data)
+	require.NoError(t, err)
+
+	components := asObject(doc["components"])
+	schemas := asObject(components["schemas"])
+
+	// The existing Address schema is kept, the referenced one is renamed.
+	assert.Equal(t, map[string]interface{}{"type": "string"}, schemas["Address"])
+	assert.Equal(t, "object", asObject(schemas["Address2"])["type"])
+
+	user := asObject(schemas["User"])
+	properties := asObject(user["properties"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/Address2"}, properties["address"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/User"}, asObject(properties["friends"])["items"])
+
+	id := asObject(asObject(components["parameters"])["Id"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/Address2"}, id["schema"])
+
+	// References to whole documents are inlined.
+	item := asObject(asObject(doc["paths"])["/users/{id}"])
+	mt := asObject(asObject(asObject(asObject(asObject(asObject(item["get"])["responses"])["200"])["content"])["application/json"]))
+	assert.Equal(t, map[string]interface{}{"value": map[string]interface{}{"address": map[string]interface{}{"city": "Seattle"}}}, asObject(mt["examples"])["fido"])
+
+	// The result no longer depends on the referenced files.
+	bundled, err := json.Marshal(doc)
+	require.NoError(t, err)
+	srv.Close()
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "schemas")))
+
+	swagger, _, err := load(viper.New(), uri, bundled)
+	require.NoError(t, err)
+	assert.NotNil(t, swagger.Paths["/users/{id}"].Get.Responses["200"].Value.Content["application/json"].Schema.Value)
+}
+
+func TestBundleDocumentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"Missing file", `{"components": {"schemas": {"A": {"$ref": "missing.yaml#/components/schemas/A"}}}}`},
+		{"Missing pointer", `{"components": {"schemas": {"A": {"$ref": "testdata/example/recursive_ok.yml#/components/schemas/Missing"}}}}`},
+		{"Not an object", `[]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := bundleDocument(viper.New(), "openapi.json", []byte(test.doc))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// defaultCacheDir returns the default of `--cache-dir`, the user's cache
+// directory, or an empty string if there is none.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "apisprout")
+}
+
+// fetchCached fetches a remote document and stores a copy of it in the
+// cache. If the document can't be fetched, e.g. because its host is down,
+// then the cached copy is used instead. With `--offline` only the cached
+// copy is used.
+func fetchCached(config *viper.Viper, uri string, fetchRemote func() ([]byte, error)) ([]byte, error) {
+	dir := config.GetString("cache-dir")
+
+	path := ""
+	if dir != "" {
+		sum := sha256.Sum256([]byte(uri))
+		path = filepath.Join(dir, hex.EncodeToString(sum[:]))
+	}
+
+	if config.GetBool("offline") {
+		if path != "" {
+			if data, err := ioutil.ReadFile(path); err == nil {
+				return data, nil
+			}
+		}
+		return nil, fmt.Errorf("Unable to fetch %s while offline, it is not cached", uri)
+	}
+
+	data, err := fetchRemote()
+	if err != nil {
+		if path != "" && isUnreachable(err) {
+			if cached, cacheErr := ioutil.ReadFile(path); cacheErr == nil {
+				log.Printf("ERROR: Unable to fetch %s, using cached copy: %v", uri, err)
+				return cached, nil
+			}
+		}
+		return nil, err
+	}
+
+	if path != "" {
+		if err := writeCacheFile(dir, path, data); err != nil {
+			log.Printf("ERROR: Unable to cache %s: %v", uri, err)
+		}
+	}
+
+	return data, nil
+}
+
+// unreachableError marks an error fetching a document which is caused by its
+// source being unreachable or temporarily unavailable, rather than e.g. by
+// invalid options, so that a cached copy may be used instead.
+type unreachableError struct {
+	error
+}
+
+// isUnreachable returns true if an error was caused by the source of a
+// document being unreachable. Certificate errors are not, as the cached copy
+// must not hide e.g. a missing `--upstream-ca`.
+func isUnreachable(err error) bool {
+	switch e := err.(type) {
+	case unreachableError:
+		return true
+	case *url.Error:
+		return e.Op != "parse" && !isTLSError(e.Err)
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+// isTLSError returns true if an error was caused by the TLS handshake or an
+// invalid certificate.
+func isTLSError(err error) bool {
+	switch err.(type) {
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError, x509.SystemRootsError, tls.RecordHeaderError:
+		return true
+	}
+
+	msg := err.Error()
+	return strings.HasPrefix(msg, "tls: ") || strings.HasPrefix(msg, "x509: ")
+}
+
+// writeCacheFile writes a cached document, replacing the previous copy
+// atomically so readers never see a partial document.
+func writeCacheFile(dir, path string, data []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".fetch-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apisprout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer srv.Close()
+
+	config := viper.New()
+	config.Set("cache-dir", dir)
+
+	// Nothing is cached yet.
+	config.Set("offline", true)
+	_, err = fetch(config, srv.URL)
+	assert.Error(t, err)
+
+	config.Set("offline", false)
+	data, err := fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+
+	// Temporary server errors use the cached copy, but others don't.
+	status = http.StatusServiceUnavailable
+	data, err = fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+
+	status = http.StatusNotFound
+	_, err = fetch(config, srv.URL)
+	assert.Error(t, err)
+
+	config.Set("offline", true)
+	data, err = fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+
+	// Unreachable hosts use the cached copy.
+	config.Set("offline", false)
+	srv.Close()
+	data, err = fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+}
+
+func TestLoadCachedRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apisprout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"components": {"schemas": {"Item": {"type": "string", "example": "remote"}}}}`))
+	}))
+	defer srv.Close()
+
+	doc := []byte(`{
+		"openapi": "3.0.0",
+		"info": {"title": "Refs", "version": "1.0"},
+		"paths": {
+			"/item": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {"application/json": {"schema": {"$ref": "` + srv.URL + `/schemas.json#/components/schemas/Item"}}}
+						}
+					}
+				}
+			}
+		}
+	}`)
+
+	config := viper.New()
+	config.Set("cache-dir", dir)
+	config.Set("fetch-bearer", "secret")
+
+	swagger, _, err := load(config, "https://specs.example.com/openapi.json", doc)
+	require.NoError(t, err)
+	assert.Equal(t, "remote", swagger.Paths["/item"].Get.Responses["200"].Value.Content["application/json"].Schema.Value.Example)
+
+	// Credentials for the document aren't sent to other hosts.
+	assert.Equal(t, "", auth)
+
+	config.Set("offline", true)
+	srv.Close()
+	_, _, err = load(config, "https://specs.example.com/openapi.json", doc)
+	require.NoError(t, err)
+}
+
+func TestFetchCachedCertificateError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apisprout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer srv.Close()
+
+	config := viper.New()
+	config.Set("cache-dir", dir)
+	config.Set("fetch-insecure-skip-verify", true)
+	_, err = fetch(config, srv.URL)
+	require.NoError(t, err)
+
+	// An untrusted certificate is an error, not an unreachable host.
+	config.Set("fetch-insecure-skip-verify", false)
+	_, err = fetch(config, srv.URL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// supportedEncodings lists the content codings which responses may be
+// compressed with, in order of preference.
+var supportedEncodings = []string{"br", "gzip", "deflate"}
+
+// negotiateEncoding picks the best supported content coding based on the
+// request's `Accept-Encoding` header. An empty string means the response
+// should not be compressed. Codings listed explicitly take precedence over
+// the `*` wildcard, so e.g. `gzip;q=0, *` never picks `gzip`.
+func negotiateEncoding(accept string) string {
+	explicit := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			explicit[name] = q
+		}
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, encoding := range supportedEncodings {
+		q, ok := explicit[encoding]
+		if !ok {
+			q = wildcard
+		}
+
+		// Ties go to whichever encoding is preferred by us, which is the one
+		// seen first.
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compress encodes the data using the given content coding.
+func compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch encoding {
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		// HTTP's deflate is the zlib format, not raw deflate.
+		w = zlib.NewWriter(&buf)
+	default:
+		return data, nil
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, deflate, br;q=0.5", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.1, deflate;q=0.5", "deflate"},
+		{"GZIP", "gzip"},
+		{"br;q=0, gzip;q=0, *", "deflate"},
+		{"br;q=0, gzip;q=0, deflate;q=0, *", ""},
+		{"*;q=0", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.accept, func(t *testing.T) {
+			assert.Equal(t, test.expected, negotiateEncoding(test.accept))
+		})
+	}
+}
+
+func TestCompressedResponse(t *testing.T) {
+	const doc = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {"example": {"hello": "world"}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	t.Run("Enabled", func(t *testing.T) {
+		s := NewOpenAPIServer(viper.New())
+		require.NoError(t, s.Load("file:///swagger.json", []byte(doc)))
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+
+		assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header().Get("Vary"))
+
+		r, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"hello": "world"}`, string(body))
+	})
+
+	t.Run("Brotli", func(t *testing.T) {
+		s := NewOpenAPIServer(viper.New())
+		require.NoError(t, s.Load("file:///swagger.json", []byte(doc)))
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+
+		assert.Equal(t, "br", resp.Header().Get("Content-Encoding"))
+
+		body, err := ioutil.ReadAll(brotli.NewReader(resp.Body))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"hello": "world"}`, string(body))
+	})
+
+	t.Run("Deflate", func(t *testing.T) {
+		s := NewOpenAPIServer(viper.New())
+		require.NoError(t, s.Load("file:///swagger.json", []byte(doc)))
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Accept-Encoding", "deflate")
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+
+		assert.Equal(t, "deflate", resp.Header().Get("Content-Encoding"))
+
+		r, err := zlib.NewReader(resp.Body)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"hello": "world"}`, string(body))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		config := viper.New()
+		config.Set("disable-compression", true)
+		s := NewOpenAPIServer(config)
+		require.NoError(t, s.Load("file:///swagger.json", []byte(doc)))
+
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+
+		assert.Empty(t, resp.Header().Get("Content-Encoding"))
+		assert.JSONEq(t, `{"hello": "world"}`, resp.Body.String())
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadableSettings are read for each request, so changing them in the
+// config file while running with `--watch-config` applies right away.
+var reloadableSettings = []string{
+	"validate-request", "validate-security", "validate-response", "validate-response-strict",
+	"validation-error-examples", "strict-content-type", "reject-read-only", "coerce-params",
+	"max-body-size", "no-example-status", "no-example-body", "no-example-fallback",
+	"retry-after", "stream", "stream-chunk-size", "stream-delay", "message-interval",
+	"disable-compression", "disable-cors", "cors-origins", "cors-methods", "cors-headers",
+	"cors-expose-headers", "cors-max-age", "cors-allow-credentials", "cors-allow-private-network",
+	"quiet", "verbose", "auth-token", "api-keys", "reload-token", "admin-token",
+}
+
+// isReloadable returns true if a setting can be changed while running.
+func isReloadable(key string) bool {
+	for _, name := range reloadableSettings {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// liveConfig is a configuration which changes while running. Viper is not
+// safe for concurrent use, so requests read immutable snapshots of it which
+// are swapped atomically instead of the configuration itself.
+type liveConfig struct {
+	snapshot atomic.Value
+
+	// overrides were changed while running, e.g. from the admin dashboard,
+	// and take precedence over the config file.
+	overrides map[string]interface{}
+}
+
+var (
+	// liveConfigs maps configurations which change while running to their
+	// `*liveConfig`.
+	liveConfigs sync.Map
+
+	// liveConfigsMu serializes taking new snapshots.
+	liveConfigsMu sync.Mutex
+)
+
+// currentConfig returns the configuration to read while running: the latest
+// snapshot of it if it changes while running, or else the configuration
+// itself.
+func currentConfig(config *viper.Viper) *viper.Viper {
+	if live, ok := liveConfigs.Load(config); ok {
+		return live.(*liveConfig).snapshot.Load().(*viper.Viper)
+	}
+	return config
+}
+
+// copyConfig returns a copy of the settings in effect, e.g. merged from
+// flags, the environment and the config file.
+func copyConfig(config *viper.Viper) *viper.Viper {
+	copied := viper.New()
+	for _, key := range config.AllKeys() {
+		copied.Set(key, config.Get(key))
+	}
+	copied.SetConfigFile(config.ConfigFileUsed())
+	return copied
+}
+
+// liveConfigFor returns the live configuration of a configuration, starting
+// with a snapshot of its current settings. Must be called with
+// `liveConfigsMu` held.
+func liveConfigFor(config *viper.Viper) *liveConfig {
+	if live, ok := liveConfigs.Load(config); ok {
+		return live.(*liveConfig)
+	}
+
+	live := &liveConfig{overrides: make(map[string]interface{})}
+	live.snapshot.Store(copyConfig(config))
+	liveConfigs.Store(config, live)
+	return live
+}
+
+// refreshConfig takes a new snapshot of a configuration after it changed,
+// which requests read from then on. It must not be called concurrently with
+// changes to the configuration itself.
+func refreshConfig(config *viper.Viper) {
+	liveConfigsMu.Lock()
+	defer liveConfigsMu.Unlock()
+
+	live := liveConfigFor(config)
+	snapshot := copyConfig(config)
+	for key, value := range live.overrides {
+		snapshot.Set(key, value)
+	}
+	live.snapshot.Store(snapshot)
+}
+
+// setConfig changes a setting while running without changing the
+// configuration itself, which may be read or reloaded concurrently.
+func setConfig(config *viper.Viper, key string, value interface{}) {
+	liveConfigsMu.Lock()
+	defer liveConfigsMu.Unlock()
+
+	live := liveConfigFor(config)
+	live.overrides[key] = value
+	snapshot := copyConfig(live.snapshot.Load().(*viper.Viper))
+	snapshot.Set(key, value)
+	live.snapshot.Store(snapshot)
+}
+
+// settings returns the configuration to read while handling a request, see
+// `currentConfig`.
+func (s *OpenAPIServer) settings() *viper.Viper {
+	return currentConfig(s.config)
+}
+
+// changedSettings returns the names of the settings which differ between
+// two sets of settings, sorted by name.
+func changedSettings(previous, current map[string]interface{}) []string {
+	changed := make([]string, 0)
+
+	for key, value := range current {
+		if !reflect.DeepEqual(previous[key], value) {
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+// watchConfig applies changes to the config file while running. Settings
+// which are only read at startup, like the port, are reported as needing a
+// restart instead. Note that flags and environment variables still take
+// precedence over the config file. If given, `changed` is called for each
+// applied setting. From then on the configuration must only be read via
+// `currentConfig`, as it is changed in the background.
+func watchConfig(config *viper.Viper, changed func(key string, value interface{})) {
+	if config.ConfigFileUsed() == "" {
+		log.Printf("WARNING: No config file found to watch, see --watch-config")
+		return
+	}
+
+	refreshConfig(config)
+
+	previous := config.AllSettings()
+	config.OnConfigChange(func(event fsnotify.Event) {
+		if err := applyProfiles(config); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+
+		refreshConfig(config)
+
+		current := config.AllSettings()
+		for _, key := range changedSettings(previous, current) {
+			if key == "profiles" {
+				// Changed profiles were applied above.
+				continue
+			}
+
+			if isReloadable(key) {
+				// Secrets are redacted like in `/__config`.
+				fmt.Printf("⚙️  Applied %s = %v\n", key, configValue(key, current[key]))
+				if changed != nil {
+					changed(key, current[key])
+				}
+			} else {
+				log.Printf("WARNING: Changing %s requires a restart", key)
+			}
+		}
+		previous = current
+	})
+	config.WatchConfig()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedSettings(t *testing.T) {
+	previous := map[string]interface{}{"port": 8000, "validate-request": false, "cors-origins": []interface{}{"a"}, "removed": true}
+	current := map[string]interface{}{"port": 8000, "validate-request": true, "cors-origins": []interface{}{"a", "b"}, "added": 1}
+
+	assert.Equal(t, []string{"added", "cors-origins", "removed", "validate-request"}, changedSettings(previous, current))
+	assert.True(t, isReloadable("validate-request"))
+	assert.False(t, isReloadable("port"))
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("validate-request: false\n"), 0644))
+
+	config := viper.New()
+	config.SetConfigFile(path)
+	require.NoError(t, config.ReadInConfig())
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(`{"paths": {"/test": {"get": {"responses": {"204": {"description": "ok"}}}}}}`)))
+
+	watchConfig(config, nil)
+
+	// Requests keep reading settings while the config file is reloaded.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				req, _ := http.NewRequest("GET", "/test", nil)
+				s.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}
+	}()
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("validate-request: true\n"), 0644))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !currentConfig(config).GetBool("validate-request") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, currentConfig(config).GetBool("validate-request"))
+}
+
+func TestWatchConfigRedacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("auth-token: old-secret\n"), 0644))
+
+	config := viper.New()
+	config.SetConfigFile(path)
+	require.NoError(t, config.ReadInConfig())
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+
+	applied := make(chan struct{}, 1)
+	watchConfig(config, func(key string, value interface{}) {
+		select {
+		case applied <- struct{}{}:
+		default:
+		}
+	})
+	require.NoError(t, ioutil.WriteFile(path, []byte("auth-token: new-secret\n"), 0644))
+
+	select {
+	case <-applied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not applied")
+	}
+	os.Stdout = stdout
+	w.Close()
+
+	output, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "Applied auth-token = "+redacted)
+	assert.NotContains(t, string(output), "new-secret")
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConformanceResult describes the outcome of calling a single operation on a
+// target server.
+type ConformanceResult struct {
+	Operation string
+	Status    int
+	Err       error
+}
+
+// Passed returns true if the target's response conforms to the document.
+func (r *ConformanceResult) Passed() bool {
+	return r.Err == nil
+}
+
+// checkConformance calls every operation of the document on the target server
+// using generated requests, and validates each response against the document.
+func checkConformance(ctx context.Context, client *http.Client, swagger *openapi3.Swagger, target string) []*ConformanceResult {
+	// Use a fixed seed so the requests are stable between runs.
+	rnd := rand.New(rand.NewSource(1))
+	results := make([]*ConformanceResult, 0)
+
+	paths := make([]string, 0, len(swagger.Paths))
+	for path := range swagger.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := swagger.Paths[path]
+
+		methods := make([]string, 0)
+		for method := range item.Operations() {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			op := item.GetOperation(method)
+			result := &ConformanceResult{
+				Operation: fmt.Sprintf("%s %s", strings.ToUpper(method), path),
+			}
+			results = append(results, result)
+
+			req, err := conformanceRequest(ctx, target, method, path, item, op, rnd)
+			if err != nil {
+				result.Err = err
+				continue
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				result.Err = err
+				continue
+			}
+
+			result.Status = resp.StatusCode
+			result.Err = validateConformance(ctx, swagger, req, resp, path, item, op)
+			resp.Body.Close()
+		}
+	}
+
+	return results
+}
+
+// conformanceRequest generates a request for an operation using examples of
+// its parameters and request body.
+func conformanceRequest(ctx context.Context, target, method, path string, item *openapi3.PathItem, op *openapi3.Operation, rnd *rand.Rand) (*http.Request, error) {
+	params := make(map[string]*openapi3.Parameter)
+	for _, list := range []openapi3.Parameters{item.Parameters, op.Parameters} {
+		for _, p := range list {
+			if p.Value != nil {
+				params[p.Value.In+" "+p.Value.Name] = p.Value
+			}
+		}
+	}
+
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range params {
+		value := parameterExample(p)
+
+		switch p.In {
+		case openapi3.ParameterInPath:
+			path = strings.Replace(path, "{"+p.Name+"}", url.PathEscape(value), -1)
+		case openapi3.ParameterInQuery:
+			if p.Required {
+				query.Set(p.Name, value)
+			}
+		case openapi3.ParameterInHeader:
+			if p.Required {
+				header.Set(p.Name, value)
+			}
+		}
+	}
+
+	var body io.Reader
+	if op.RequestBody != nil && op.RequestBody.Value != nil && len(op.RequestBody.Value.Content) > 0 {
+		mediatype, encoded, err := requestBodyExample(ctx, op.RequestBody.Value, rnd)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Content-Type", mediatype)
+		body = bytes.NewReader(encoded)
+	}
+
+	u := strings.TrimRight(target, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// parameterExample returns an example value for a parameter as a string.
+func parameterExample(p *openapi3.Parameter) string {
+	if p.Example != nil {
+		return fmt.Sprint(p.Example)
+	}
+
+	if p.Schema != nil && p.Schema.Value != nil {
+		if ex, err := OpenAPIExample(ModeRequest, p.Schema.Value); err == nil {
+			switch v := ex.(type) {
+			case string, int, float64, bool:
+				return fmt.Sprint(v)
+			}
+		}
+	}
+
+	return "1"
+}
+
+// requestBodyExample picks a media type for the request body, preferring
+// JSON, and returns an encoded example for it.
+func requestBodyExample(ctx context.Context, body *openapi3.RequestBody, rnd *rand.Rand) (string, []byte, error) {
+	types := make([]string, 0, len(body.Content))
+	for mt := range body.Content {
+		types = append(types, mt)
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		ji, jj := marshalJSONMatcher.MatchString(types[i]), marshalJSONMatcher.MatchString(types[j])
+		if ji != jj {
+			return ji
+		}
+		return types[i] < types[j]
+	})
+
+	mediatype := types[0]
+	mt := body.Content[mediatype]
+
+	var example interface{}
+	var err error
+	if mt.Example != nil || len(mt.Examples) > 0 {
+		example, err = getTypedExample(ctx, mt, map[string]string{}, rnd)
+	} else if mt.Schema != nil && mt.Schema.Value != nil {
+		example, err = OpenAPIExampleContext(ctx, ModeRequest, mt.Schema.Value)
+	} else {
+		err = ErrNoExample
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("can't get example for request body: %v", err)
+	}
+
+	var encoded []byte
+	switch v := example.(type) {
+	case string:
+		encoded = []byte(v)
+	case []byte:
+		encoded = v
+	default:
+		if marshalYAMLMatcher.MatchString(mediatype) {
+			encoded, err = yaml.Marshal(example)
+		} else {
+			encoded, err = json.Marshal(example)
+		}
+	}
+
+	return mediatype, encoded, err
+}
+
+// validateConformance checks a response against the operation it was for.
+// Undocumented statuses are treated as failures.
+func validateConformance(ctx context.Context, swagger *openapi3.Swagger, req *http.Request, resp *http.Response, path string, item *openapi3.PathItem, op *openapi3.Operation) error {
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request: req,
+			Route: &openapi3filter.Route{
+				Swagger:   swagger,
+				Path:      path,
+				PathItem:  item,
+				Method:    req.Method,
+				Operation: op,
+			},
+		},
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   resp.Body,
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+		},
+	}
+
+	err := openapi3filter.ValidateResponse(ctx, input)
+	if respErr, ok := err.(*openapi3filter.ResponseError); ok {
+		// Avoid dumping the entire schema and value into the report.
+		if schemaErr, ok := respErr.Err.(*openapi3.SchemaError); ok {
+			return fmt.Errorf("%s: %s", respErr.Reason, describeSchemaError(schemaErr, nil))
+		}
+	}
+
+	return err
+}
+
+// conform calls every operation in an OpenAPI file on a target server and
+// reports whether its responses conform to the document.
+func conform(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	target := viper.GetString("target")
+	if target == "" {
+		log.Fatal("A target URL is required, use --target")
+	}
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	swagger, _, err := load(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	results := checkConformance(context.Background(), http.DefaultClient, swagger, target)
+
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Printf("✅ %s => %d\n", r.Operation, r.Status)
+		} else {
+			failed++
+			if r.Status != 0 {
+				fmt.Printf("❌ %s => %d: %v\n", r.Operation, r.Status, r.Err)
+			} else {
+				fmt.Printf("❌ %s: %v\n", r.Operation, r.Err)
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", len(results)-failed, failed)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const conformSchema = `{
+	"paths": {
+		"/pets": {
+			"post": {
+				"requestBody": {
+					"required": true,
+					"content": {
+						"application/json": {
+							"schema": {
+								"type": "object",
+								"required": ["name"],
+								"properties": {"name": {"type": "string"}}
+							}
+						}
+					}
+				},
+				"responses": {
+					"201": {
+						"description": "created",
+						"content": {
+							"application/json": {
+								"schema": {
+									"type": "object",
+									"required": ["id"],
+									"properties": {"id": {"type": "integer"}}
+								}
+							}
+						}
+					}
+				}
+			}
+		},
+		"/pets/{petId}": {
+			"get": {
+				"parameters": [
+					{"name": "petId", "in": "path", "required": true, "schema": {"type": "integer", "example": 5}},
+					{"name": "fields", "in": "query", "required": true, "schema": {"type": "string"}}
+				],
+				"responses": {
+					"200": {
+						"description": "ok",
+						"content": {
+							"application/json": {
+								"schema": {
+									"type": "object",
+									"required": ["id"],
+									"properties": {"id": {"type": "integer"}}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}`
+
+func TestCheckConformance(t *testing.T) {
+	swagger, _, err := load(viper.New(), "file:///swagger.json", []byte(conformSchema))
+	require.NoError(t, err)
+
+	t.Run("Conforming", func(t *testing.T) {
+		config := viper.New()
+		config.Set("validate-request", true)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		target, err := StartTestServer(ctx, config, "file:///swagger.json", []byte(conformSchema))
+		require.NoError(t, err)
+
+		results := checkConformance(ctx, http.DefaultClient, swagger, target)
+		require.Len(t, results, 2)
+
+		assert.Equal(t, "POST /pets", results[0].Operation)
+		assert.Equal(t, http.StatusCreated, results[0].Status)
+		assert.True(t, results[0].Passed(), "%v", results[0].Err)
+
+		assert.Equal(t, "GET /pets/{petId}", results[1].Operation)
+		assert.Equal(t, http.StatusOK, results[1].Status)
+		assert.True(t, results[1].Passed(), "%v", results[1].Err)
+	})
+
+	t.Run("Not conforming", func(t *testing.T) {
+		requested := make([]string, 0)
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.String())
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"id": 1}`))
+				return
+			}
+			w.Write([]byte(`{"id": "five"}`))
+		}))
+		defer target.Close()
+
+		results := checkConformance(context.Background(), http.DefaultClient, swagger, target.URL)
+		require.Len(t, results, 2)
+
+		assert.Equal(t, []string{"/pets", "/pets/5?fields=string"}, requested)
+
+		assert.False(t, results[0].Passed())
+		assert.Contains(t, results[0].Err.Error(), "status is not supported")
+
+		assert.False(t, results[1].Passed())
+		assert.Contains(t, results[1].Err.Error(), `Error at "/id"`)
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+	"github.com/spf13/viper"
+)
+
+// Defaults sent in pre-flight responses when the client doesn't ask for
+// specific methods or headers and none are configured.
+const (
+	defaultCORSMethods = "POST, GET, OPTIONS, PUT, DELETE"
+	defaultCORSHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization"
+)
+
+// applyCORS sets the CORS headers of a response. By default any origin is
+// allowed along with whatever methods and headers a pre-flight request asks
+// for. Use `--cors-origins`, `--cors-methods` and `--cors-headers` to restrict
+// them. Returns true if the request was a pre-flight request which has been
+// answered.
+func applyCORS(config *viper.Viper, w http.ResponseWriter, req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	allowed := "*"
+	if origin != "" {
+		if !corsOriginAllowed(config.GetStringSlice("cors-origins"), origin) {
+			// Leaving out the headers makes browsers reject the response.
+			return req.Method == http.MethodOptions
+		}
+		allowed = origin
+		w.Header().Add("Vary", "Origin")
+	}
+	w.Header().Set("Access-Control-Allow-Origin", allowed)
+
+	credentials := !config.IsSet("cors-allow-credentials") || config.GetBool("cors-allow-credentials")
+	if allowed != "*" && credentials {
+		// Allow credentials to be sent if an origin has been specified.
+		// This is done *outside* of an OPTIONS request since it might be
+		// required for a non-preflighted GET/POST request.
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if expose := joinValues(config.GetStringSlice("cors-expose-headers")); expose != "" {
+		w.Header().Set("Access-Control-Expose-Headers", expose)
+	}
+
+	// Handle pre-flight OPTIONS request
+	if req.Method != http.MethodOptions {
+		return false
+	}
+
+	methods := joinValues(config.GetStringSlice("cors-methods"))
+	if methods == "" {
+		methods = req.Header.Get("Access-Control-Request-Method")
+	}
+	if methods == "" {
+		methods = defaultCORSMethods
+	}
+
+	headers := joinValues(config.GetStringSlice("cors-headers"))
+	if headers == "" {
+		headers = req.Header.Get("Access-Control-Request-Headers")
+	}
+	if headers == "" {
+		headers = defaultCORSHeaders
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	w.Header().Set("Access-Control-Allow-Headers", headers)
+
+	// Browsers ask before public pages may call mocks on a private network,
+	// e.g. localhost, see https://wicg.github.io/private-network-access/.
+	privateNetwork := !config.IsSet("cors-allow-private-network") || config.GetBool("cors-allow-private-network")
+	if privateNetwork && strings.EqualFold(req.Header.Get("Access-Control-Request-Private-Network"), "true") {
+		w.Header().Set("Access-Control-Allow-Private-Network", "true")
+	}
+
+	if maxAge := config.GetDuration("cors-max-age"); maxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge/time.Second)))
+	}
+
+	return true
+}
+
+// corsOriginAllowed returns true if an origin matches one of the allowed
+// origins, which may be globs like `https://*.example.com`. Any origin is
+// allowed if none are given.
+func corsOriginAllowed(origins []string, origin string) bool {
+	empty := true
+	for _, pattern := range origins {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		empty = false
+
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if g.Match(origin) {
+			return true
+		}
+	}
+
+	return empty
+}
+
+// joinValues joins the non-empty values of a list parameter into a comma
+// separated header value.
+func joinValues(values []string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyCORS(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    map[string]interface{}
+		method    string
+		headers   map[string]string
+		preflight bool
+		expected  map[string]string
+	}{
+		{
+			name:     "Any origin",
+			method:   "GET",
+			expected: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:     "Reflect origin",
+			method:   "GET",
+			headers:  map[string]string{"Origin": "https://app.example.com"},
+			expected: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Credentials": "true", "Vary": "Origin"},
+		},
+		{
+			name:     "Allowed origin",
+			config:   map[string]interface{}{"cors-origins": []string{"https://*.example.com"}},
+			method:   "GET",
+			headers:  map[string]string{"Origin": "https://app.example.com"},
+			expected: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com"},
+		},
+		{
+			name:     "Disallowed origin",
+			config:   map[string]interface{}{"cors-origins": []string{"https://*.example.com"}},
+			method:   "GET",
+			headers:  map[string]string{"Origin": "https://evil.com"},
+			expected: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:     "No credentials",
+			config:   map[string]interface{}{"cors-allow-credentials": false},
+			method:   "GET",
+			headers:  map[string]string{"Origin": "https://app.example.com"},
+			expected: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:     "Expose headers",
+			config:   map[string]interface{}{"cors-expose-headers": []string{"X-Total", "ETag"}},
+			method:   "GET",
+			expected: map[string]string{"Access-Control-Expose-Headers": "X-Total, ETag"},
+		},
+		{
+			name:      "Preflight defaults",
+			method:    "OPTIONS",
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Methods": defaultCORSMethods, "Access-Control-Allow-Headers": defaultCORSHeaders, "Access-Control-Max-Age": ""},
+		},
+		{
+			name:      "Preflight reflected",
+			method:    "OPTIONS",
+			headers:   map[string]string{"Access-Control-Request-Method": "PATCH", "Access-Control-Request-Headers": "X-Foo"},
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Methods": "PATCH", "Access-Control-Allow-Headers": "X-Foo"},
+		},
+		{
+			name: "Preflight configured",
+			config: map[string]interface{}{
+				"cors-methods": []string{"GET", "POST"},
+				"cors-headers": []string{"Content-Type"},
+				"cors-max-age": 10 * time.Minute,
+			},
+			method:    "OPTIONS",
+			headers:   map[string]string{"Access-Control-Request-Method": "PATCH", "Access-Control-Request-Headers": "X-Foo"},
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Methods": "GET, POST", "Access-Control-Allow-Headers": "Content-Type", "Access-Control-Max-Age": "600"},
+		},
+		{
+			name:      "Private network",
+			method:    "OPTIONS",
+			headers:   map[string]string{"Access-Control-Request-Private-Network": "true"},
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Private-Network": "true"},
+		},
+		{
+			name:      "Private network disallowed",
+			config:    map[string]interface{}{"cors-allow-private-network": false},
+			method:    "OPTIONS",
+			headers:   map[string]string{"Access-Control-Request-Private-Network": "true"},
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Private-Network": ""},
+		},
+		{
+			name:      "Private network not requested",
+			method:    "OPTIONS",
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Private-Network": ""},
+		},
+		{
+			name:      "Preflight disallowed origin",
+			config:    map[string]interface{}{"cors-origins": []string{"https://app.example.com"}},
+			method:    "OPTIONS",
+			headers:   map[string]string{"Origin": "https://evil.com"},
+			preflight: true,
+			expected:  map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for k, v := range test.config {
+				config.Set(k, v)
+			}
+
+			req := httptest.NewRequest(test.method, "/test", nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			resp := httptest.NewRecorder()
+			assert.Equal(t, test.preflight, applyCORS(config, resp, req))
+
+			for k, v := range test.expected {
+				assert.Equal(t, v, resp.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestCORSServer(t *testing.T) {
+	config := viper.New()
+	config.Set("cors-origins", []string{"https://app.example.com"})
+
+	s := NewOpenAPIServer(config)
+	assert.NoError(t, s.Load("file:///swagger.json", []byte(`{"paths": {}}`)))
+
+	req := httptest.NewRequest(http.MethodOptions, "/test", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "https://app.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+}
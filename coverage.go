@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OperationCoverage is the number of requests an operation has received.
+type OperationCoverage struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operation_id,omitempty"`
+	Hits        int    `json:"hits"`
+}
+
+// Coverage describes how much of the document has been exercised since
+// startup, e.g. by a suite of integration tests.
+type Coverage struct {
+	Total      int                 `json:"total"`
+	Covered    int                 `json:"covered"`
+	Percent    float64             `json:"percent"`
+	Operations []OperationCoverage `json:"operations"`
+	Uncovered  []OperationCoverage `json:"uncovered"`
+}
+
+// operationHits counts requests per operation, keyed by method and path
+// template so operations without an ID are counted as well.
+type operationHits struct {
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func newOperationHits() *operationHits {
+	return &operationHits{hits: make(map[string]int)}
+}
+
+// Hit records a request routed to an operation.
+func (h *operationHits) Hit(method, path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hits[strings.ToUpper(method)+" "+path]++
+}
+
+// Get returns the number of requests routed to an operation.
+func (h *operationHits) Get(method, path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hits[strings.ToUpper(method)+" "+path]
+}
+
+// Reset forgets all recorded requests.
+func (h *operationHits) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hits = make(map[string]int)
+}
+
+// Coverage returns the hit count of each operation of the loaded document,
+// sorted by path and method, along with the operations never called.
+func (s *OpenAPIServer) Coverage() *Coverage {
+	coverage := &Coverage{
+		Operations: make([]OperationCoverage, 0),
+		Uncovered:  make([]OperationCoverage, 0),
+	}
+
+	swagger := s.Swagger()
+	if swagger == nil {
+		return coverage
+	}
+
+	for path, item := range swagger.Paths {
+		for method, op := range item.Operations() {
+			coverage.Operations = append(coverage.Operations, OperationCoverage{
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				OperationID: op.OperationID,
+				Hits:        s.hits.Get(method, path),
+			})
+		}
+	}
+
+	sort.Slice(coverage.Operations, func(i, j int) bool {
+		a, b := coverage.Operations[i], coverage.Operations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return methodIndex(a.Method) < methodIndex(b.Method)
+	})
+
+	for _, op := range coverage.Operations {
+		if op.Hits > 0 {
+			coverage.Covered++
+		} else {
+			coverage.Uncovered = append(coverage.Uncovered, op)
+		}
+	}
+
+	coverage.Total = len(coverage.Operations)
+	if coverage.Total > 0 {
+		coverage.Percent = math.Round(float64(coverage.Covered)/float64(coverage.Total)*1000) / 10
+	}
+
+	return coverage
+}
+
+// coverage returns the operation coverage as JSON. A `DELETE` resets it,
+// e.g. before running another test suite.
+func (s *OpenAPIServer) coverage(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+		encoded, _ := json.MarshalIndent(s.Coverage(), "", "  ")
+		w.Write(encoded)
+	case http.MethodDelete:
+		if s.settings().GetBool("read-only") {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.hits.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
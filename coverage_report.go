@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+// Coverage returns the coverage of every mounted server by prefix.
+func (m *MountServer) Coverage() map[string]*Coverage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]*Coverage, len(m.servers))
+	for prefix, s := range m.servers {
+		result[prefix] = s.Coverage()
+	}
+	return result
+}
+
+// totalCoverage returns the percentage of operations called across all of
+// the APIs.
+func totalCoverage(coverages map[string]*Coverage) float64 {
+	total, covered := 0, 0
+	for _, c := range coverages {
+		total += c.Total
+		covered += c.Covered
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(covered)/float64(total)*1000) / 10
+}
+
+// sortedCoveragePrefixes returns the prefixes of the APIs in order.
+func sortedCoveragePrefixes(coverages map[string]*Coverage) []string {
+	prefixes := make([]string, 0, len(coverages))
+	for prefix := range coverages {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// coverageSummary describes how many operations of each API were called and
+// lists the ones which never were.
+func coverageSummary(coverages map[string]*Coverage) string {
+	var buf bytes.Buffer
+
+	for _, prefix := range sortedCoveragePrefixes(coverages) {
+		c := coverages[prefix]
+		name := ""
+		if prefix != "" {
+			name = " of " + prefix
+		}
+		fmt.Fprintf(&buf, "📊 Coverage%s: %d of %d operations called (%v%%)\n", name, c.Covered, c.Total, c.Percent)
+		for _, op := range c.Uncovered {
+			fmt.Fprintf(&buf, "• Never called: %s %s\n", op.Method, op.Path)
+		}
+	}
+
+	return buf.String()
+}
+
+// junitTestSuites is a JUnit XML report where each API is a test suite and
+// each operation a test case, failing if it was never called.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// coverageReport encodes the coverage of each API as `json` or `junit`.
+func coverageReport(coverages map[string]*Coverage, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(coverages, "", "  ")
+	case "junit":
+		report := junitTestSuites{}
+		for _, prefix := range sortedCoveragePrefixes(coverages) {
+			c := coverages[prefix]
+			name := prefix
+			if name == "" {
+				name = "/"
+			}
+
+			suite := junitTestSuite{Name: name, Tests: c.Total, Failures: c.Total - c.Covered}
+			for _, op := range c.Operations {
+				tc := junitTestCase{ClassName: name, Name: op.Method + " " + op.Path}
+				if op.OperationID != "" {
+					tc.Name += " (" + op.OperationID + ")"
+				}
+				if op.Hits == 0 {
+					tc.Failure = &junitFailure{Message: "Operation was never called"}
+				}
+				suite.Cases = append(suite.Cases, tc)
+			}
+
+			report.Tests += suite.Tests
+			report.Failures += suite.Failures
+			report.Suites = append(report.Suites, suite)
+		}
+
+		encoded, err := xml.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), encoded...), nil
+	}
+
+	return nil, fmt.Errorf("Unknown coverage format '%s', expected json or junit", format)
+}
+
+// writeCoverageReport writes the report to `--coverage-report`, if given.
+// The format comes from `--coverage-format` or the file's extension.
+func writeCoverageReport(config *viper.Viper, coverages map[string]*Coverage) error {
+	path := config.GetString("coverage-report")
+	if path == "" {
+		return nil
+	}
+
+	format := config.GetString("coverage-format")
+	if format == "" {
+		format = "json"
+		if strings.ToLower(filepath.Ext(path)) == ".xml" {
+			format = "junit"
+		}
+	}
+
+	data, err := coverageReport(coverages, format)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// coverageExitCode returns a non-zero exit code if the total coverage is
+// below `--fail-under`.
+func coverageExitCode(config *viper.Viper, coverages map[string]*Coverage) int {
+	minimum := config.GetFloat64("fail-under")
+	if minimum > 0 && totalCoverage(coverages) < minimum {
+		return 1
+	}
+	return 0
+}
+
+// reportCoverage prints the coverage summary and writes the report.
+func reportCoverage(config *viper.Viper, coverages map[string]*Coverage) {
+	fmt.Print(coverageSummary(coverages))
+	if err := writeCoverageReport(config, coverages); err != nil {
+		log.Printf("ERROR: Unable to write coverage report: %v", err)
+	}
+}
+
+// handleCoverageSignals reports coverage when the process is asked to exit,
+// e.g. by CI once contract tests have finished, and exits with a non-zero
+// code if coverage is below `--fail-under`. A `SIGUSR1` reports coverage
+// without exiting.
+func handleCoverageSignals(config *viper.Viper, mounted *MountServer) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, reportSignals...)...)
+
+	go func() {
+		for sig := range signals {
+			coverages := mounted.Coverage()
+			reportCoverage(config, coverages)
+
+			if sig == os.Interrupt || sig == syscall.SIGTERM {
+				code := coverageExitCode(config, coverages)
+				if code != 0 {
+					log.Printf("ERROR: Coverage of %v%% is below --fail-under %v%%", totalCoverage(coverages), config.GetFloat64("fail-under"))
+				}
+				os.Exit(code)
+			}
+		}
+	}()
+}
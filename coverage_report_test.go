@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverageReport(t *testing.T) {
+	users := NewOpenAPIServer(viper.New())
+	require.NoError(t, users.Load("file:///users.json", []byte(`{"paths": {
+		"/users": {
+			"get": {"operationId": "listUsers", "responses": {"200": {"description": "ok"}}},
+			"post": {"responses": {"201": {"description": "created"}}}
+		}
+	}}`)))
+
+	mounted := NewMountServer()
+	mounted.Mount("/users", users)
+	users.hits.Hit("GET", "/users")
+
+	coverages := mounted.Coverage()
+	assert.Equal(t, 50.0, totalCoverage(coverages))
+
+	summary := coverageSummary(coverages)
+	assert.Contains(t, summary, "Coverage of /users: 1 of 2 operations called (50%)")
+	assert.Contains(t, summary, "Never called: POST /users")
+
+	dir, err := ioutil.TempDir("", "coverage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name     string
+		file     string
+		format   string
+		contains string
+	}{
+		{"JSON", "coverage.json", "", `"covered": 1`},
+		{"JUnit from extension", "coverage.xml", "", `<testcase classname="/users" name="POST /users">`},
+		{"JUnit from flag", "report.out", "junit", `<testsuite name="/users" tests="2" failures="1">`},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("coverage-report", filepath.Join(dir, tt.file))
+			config.Set("coverage-format", tt.format)
+			require.NoError(t, writeCoverageReport(config, coverages))
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, tt.file))
+			require.NoError(t, err)
+			assert.Contains(t, string(data), tt.contains)
+		})
+	}
+
+	config := viper.New()
+	config.Set("coverage-report", filepath.Join(dir, "coverage.json"))
+	config.Set("coverage-format", "csv")
+	assert.Error(t, writeCoverageReport(config, coverages))
+
+	data, err := coverageReport(coverages, "json")
+	require.NoError(t, err)
+	var decoded map[string]*Coverage
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, 2, decoded["/users"].Total)
+
+	config = viper.New()
+	assert.Equal(t, 0, coverageExitCode(config, coverages))
+	config.Set("fail-under", 80.0)
+	assert.Equal(t, 1, coverageExitCode(config, coverages))
+	config.Set("fail-under", 50.0)
+	assert.Equal(t, 0, coverageExitCode(config, coverages))
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reportSignals print the coverage summary without exiting.
+var reportSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// reportSignals print the coverage summary without exiting. Windows has no
+// user-defined signals, so the summary is only printed on exit.
+var reportSignals = []os.Signal{}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverage(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items": {
+				"get": {"operationId": "listItems", "responses": {"200": {"description": "ok"}}},
+				"post": {"operationId": "createItem", "responses": {"201": {"description": "created"}}}
+			},
+			"/items/{id}": {
+				"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+				"get": {"responses": {"200": {"description": "ok"}}}
+			}
+		}
+	}`
+
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, httptest.NewRequest(method, path, nil))
+		return resp
+	}
+
+	serve("GET", "/items")
+	serve("HEAD", "/items")
+	serve("GET", "/items/1")
+	serve("GET", "/items/2")
+	serve("GET", "/missing")
+
+	resp := serve("GET", "/__coverage")
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var coverage Coverage
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &coverage))
+
+	assert.Equal(t, 3, coverage.Total)
+	assert.Equal(t, 2, coverage.Covered)
+	assert.Equal(t, 66.7, coverage.Percent)
+	assert.Equal(t, []OperationCoverage{
+		{Method: "GET", Path: "/items", OperationID: "listItems", Hits: 2},
+		{Method: "POST", Path: "/items", OperationID: "createItem", Hits: 0},
+		{Method: "GET", Path: "/items/{id}", Hits: 2},
+	}, coverage.Operations)
+	assert.Equal(t, []OperationCoverage{
+		{Method: "POST", Path: "/items", OperationID: "createItem", Hits: 0},
+	}, coverage.Uncovered)
+
+	assert.Equal(t, http.StatusNoContent, serve("DELETE", "/__coverage").Code)
+	assert.Equal(t, 0, s.Coverage().Covered)
+	assert.Len(t, s.Coverage().Uncovered, 3)
+}
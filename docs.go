@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// defaultDocsAssets is where the Swagger UI assets are loaded from unless
+// `--docs-assets` is given.
+const defaultDocsAssets = "https://unpkg.com/swagger-ui-dist@5"
+
+// defaultRedocAssets is where the ReDoc script is loaded from unless
+// `--redoc-assets` is given.
+const defaultRedocAssets = "https://cdn.redoc.ly/redoc/latest/bundles"
+
+// docsTemplate renders Swagger UI for the loaded document. The document is
+// fetched as JSON and its servers replaced with the mock itself, so "try it
+// out" calls are answered by the mock. Links are relative, so it works the
+// same for APIs mounted under a prefix.
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - API Sprout</title>
+<link rel="stylesheet" href="{{.Assets}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}/swagger-ui-bundle.js"></script>
+<script>
+fetch("{{.Link}}docs/openapi.json").then(function (resp) {
+	return resp.json();
+}).then(function (spec) {
+	spec.servers = [{url: new URL("{{.Root}}", window.location.href).href, description: "API Sprout mock"}];
+	SwaggerUIBundle({spec: spec, dom_id: "#swagger-ui", tryItOutEnabled: true});
+});
+</script>
+</body>
+</html>
+`))
+
+// redocTemplate renders the loaded document using ReDoc, with the servers
+// replaced by the mock the same way as for Swagger UI.
+var redocTemplate = template.Must(template.New("redoc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - API Sprout</title>
+</head>
+<body>
+<div id="redoc"></div>
+<script src="{{.Assets}}/redoc.standalone.js"></script>
+<script>
+fetch("{{.Link}}docs/openapi.json").then(function (resp) {
+	return resp.json();
+}).then(function (spec) {
+	spec.servers = [{url: new URL("{{.Root}}", window.location.href).href, description: "API Sprout mock"}];
+	Redoc.init(spec, {}, document.getElementById("redoc"));
+});
+</script>
+</body>
+</html>
+`))
+
+// docs serves interactive API documentation using Swagger UI, so the mock
+// doubles as a documentation portal. The Swagger UI assets are loaded from
+// `--docs-assets`, which can point to a self-hosted copy. With
+// `--docs-renderer redoc`, ReDoc is used instead.
+func (s *OpenAPIServer) docs(w http.ResponseWriter, req *http.Request) {
+	if s.settings().GetString("docs-renderer") == "redoc" {
+		s.redoc(w, req)
+		return
+	}
+
+	s.renderDocs(w, docsTemplate, s.settings().GetString("docs-assets"), defaultDocsAssets)
+}
+
+// redoc serves reference documentation using ReDoc, which some teams
+// standardize on. The script is loaded from `--redoc-assets`.
+func (s *OpenAPIServer) redoc(w http.ResponseWriter, req *http.Request) {
+	s.renderDocs(w, redocTemplate, s.settings().GetString("redoc-assets"), defaultRedocAssets)
+}
+
+// renderDocs renders a documentation page using assets from the given base
+// URL, or the default one if empty.
+func (s *OpenAPIServer) renderDocs(w http.ResponseWriter, tmpl *template.Template, assets, defaultAssets string) {
+	swagger := s.Swagger()
+	if swagger == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("loading"))
+		return
+	}
+
+	if assets == "" {
+		assets = defaultAssets
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := tmpl.Execute(w, map[string]string{
+		"Title":  swagger.Info.Title,
+		"Assets": strings.TrimSuffix(assets, "/"),
+		"Link":   adminLink(s.settings()),
+		"Root":   adminRoot(s.settings()),
+	})
+	if err != nil {
+		log.Printf("ERROR: Unable to render docs page: %v", err)
+	}
+}
+
+// docsDocument serves the parsed document as JSON for the docs page, which
+// also works for YAML documents and bundles.
+func (s *OpenAPIServer) docsDocument(w http.ResponseWriter, req *http.Request) {
+	swagger := s.Swagger()
+	if swagger == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("loading"))
+		return
+	}
+
+	encoded, err := json.Marshal(swagger)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(encoded)
+}
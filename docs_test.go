@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocs(t *testing.T) {
+	const schema = `
+info:
+  title: Widget API
+  version: "1.0"
+servers:
+  - url: https://api.example.com
+paths:
+  /items:
+    get:
+      responses:
+        "200":
+          description: ok
+`
+
+	tests := []struct {
+		name   string
+		assets string
+		css    string
+	}{
+		{"Default", "", defaultDocsAssets + "/swagger-ui.css"},
+		{"Self-hosted", "https://cdn.example.com/swagger-ui/", "https://cdn.example.com/swagger-ui/swagger-ui.css"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("docs-assets", test.assets)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("openapi.yaml", []byte(schema)))
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest("GET", "/__docs", nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Contains(t, resp.Body.String(), "<title>Widget API - API Sprout</title>")
+			assert.Contains(t, resp.Body.String(), `href="`+test.css+`"`)
+			assert.Contains(t, resp.Body.String(), `fetch("__docs/openapi.json")`)
+
+			resp = httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest("GET", "/__docs/openapi.json", nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+			var doc map[string]interface{}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &doc))
+			assert.Contains(t, doc["paths"], "/items")
+		})
+	}
+}
+
+func TestRedoc(t *testing.T) {
+	tests := []struct {
+		name     string
+		renderer string
+		path     string
+		redoc    bool
+	}{
+		{"Redoc", "", "/__redoc", true},
+		{"Docs", "", "/__docs", false},
+		{"Docs with Swagger UI", "swagger-ui", "/__docs", false},
+		{"Docs with Redoc", "redoc", "/__docs", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("docs-renderer", test.renderer)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(`{"info": {"title": "Widget API"}, "paths": {}}`)))
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest("GET", test.path, nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			assert.Equal(t, test.redoc, strings.Contains(resp.Body.String(), `src="`+defaultRedocAssets+`/redoc.standalone.js"`))
+			assert.Equal(t, !test.redoc, strings.Contains(resp.Body.String(), "swagger-ui-bundle.js"))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// dumpWriter records the response served to a client for `--dump`, keeping
+// at most `limit` bytes of the body.
+type dumpWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	limit  int
+	size   int
+}
+
+func (w *dumpWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *dumpWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if remaining := w.limit - w.body.Len(); remaining > 0 {
+		if len(data) < remaining {
+			remaining = len(data)
+		}
+		w.body.Write(data[:remaining])
+	}
+	w.size += len(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush allows streamed responses to be flushed through the wrapper.
+func (w *dumpWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack allows WebSocket connections to be upgraded through the wrapper.
+func (w *dumpWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Response writer can't be hijacked")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// String returns the status line, headers and body of the response.
+func (w *dumpWriter) String() string {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\n", status, http.StatusText(status))
+	writeDumpHeaders(&buf, w.Header())
+	writeDumpBody(&buf, w.body.Bytes(), w.size)
+	return buf.String()
+}
+
+// dumpRequest returns the request line, headers and up to `limit` bytes of
+// the body of a request. The body is left intact for the handler.
+func dumpRequest(req *http.Request, limit int) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s %s\n", req.Method, req.URL.RequestURI(), req.Proto)
+	fmt.Fprintf(&buf, "Host: %s\n", req.Host)
+	writeDumpHeaders(&buf, req.Header)
+
+	body, size := peekBody(req, limit)
+	writeDumpBody(&buf, body, size)
+
+	return buf.String()
+}
+
+// peekBody returns up to `limit` bytes of a request body, leaving the body
+// intact for the handler. The size is more than the limit if the body was
+// truncated.
+func peekBody(req *http.Request, limit int) ([]byte, int) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, 0
+	}
+
+	// Read one more byte than returned to find out whether it's truncated,
+	// then put everything read back in front of the rest of the body.
+	body, _ := ioutil.ReadAll(io.LimitReader(req.Body, int64(limit)+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+
+	size := len(body)
+	if size > limit {
+		body = body[:limit]
+	}
+	return body, size
+}
+
+// writeDumpHeaders writes headers in alphabetical order.
+func writeDumpHeaders(buf *bytes.Buffer, header http.Header) {
+	for _, name := range sortedHeaderNames(header) {
+		for _, value := range header[name] {
+			fmt.Fprintf(buf, "%s: %s\n", name, value)
+		}
+	}
+}
+
+// writeDumpBody writes a body after a blank line, noting if it was cut off.
+func writeDumpBody(buf *bytes.Buffer, body []byte, size int) {
+	if size == 0 {
+		return
+	}
+
+	buf.WriteString("\n")
+	buf.Write(body)
+	if size > len(body) {
+		fmt.Fprintf(buf, "\n... (truncated after %d bytes)", len(body))
+	}
+	buf.WriteString("\n")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDump(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items": {
+				"post": {
+					"requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["name"]}}}},
+					"responses": {"200": {"description": "ok", "content": {"application/json": {"example": {"id": 1, "name": "widget"}}}}}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		dump     bool
+		limit    int
+		body     string
+		status   int
+		logged   []string
+		unlogged []string
+	}{
+		{"Disabled", false, 0, `{"name": "widget"}`, http.StatusOK, nil, []string{"--- Request ---"}},
+		{"Served", true, 1024, `{"name": "widget"}`, http.StatusOK, []string{
+			"Dump of POST /items",
+			"--- Request ---\nPOST /items?debug=1 HTTP/1.1\nHost: example.com\nContent-Type: application/json\nX-Test: one\n\n{\"name\": \"widget\"}\n",
+			"--- Response ---\nHTTP/1.1 200 OK\n",
+			"Content-Type: application/json\n",
+			"\"name\": \"widget\"",
+		}, nil},
+		{"Invalid", true, 1024, `{"other": true}`, http.StatusBadRequest, []string{
+			"{\"other\": true}",
+			"HTTP/1.1 400 Bad Request\n",
+			"Content-Type: application/problem+json\n",
+		}, nil},
+		{"Truncated", true, 5, `{"name": "widget"}`, http.StatusOK, []string{
+			"\n\n{\"nam\n... (truncated after 5 bytes)\n--- Response ---",
+			"\n\n{\n  \"\n... (truncated after 5 bytes)\n",
+		}, []string{"widget"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			config := viper.New()
+			config.Set("validate-request", true)
+			config.Set("dump", test.dump)
+			config.Set("dump-max-size", test.limit)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req := httptest.NewRequest("POST", "/items?debug=1", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Test", "one")
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			// The handler still sees the whole body.
+			assert.Equal(t, test.status, resp.Code)
+
+			for _, expected := range test.logged {
+				assert.Contains(t, buf.String(), expected)
+			}
+			for _, unexpected := range test.unlogged {
+				assert.NotContains(t, buf.String(), unexpected)
+			}
+		})
+	}
+}
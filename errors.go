@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExampleError is returned when no example can be served for an operation.
+// The cause is available via `errors.Cause` and is usually `ErrNoExample` or
+// an `*ExampleGenerationError` describing why generation failed.
+type ExampleError struct {
+	// OperationID is the ID of the operation, which may be empty.
+	OperationID string
+
+	// Status is the preferred status requested by the client, if any.
+	Status string
+
+	// MediaType is the last media type that was tried, if any.
+	MediaType string
+
+	Err error
+}
+
+func (e *ExampleError) Error() string {
+	parts := make([]string, 0, 3)
+	if e.OperationID != "" {
+		parts = append(parts, "operation "+e.OperationID)
+	}
+	if e.Status != "" {
+		parts = append(parts, "status "+e.Status)
+	}
+	if e.MediaType != "" {
+		parts = append(parts, e.MediaType)
+	}
+
+	if len(parts) == 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(parts, ", "))
+}
+
+// Cause returns the underlying error, for use with `errors.Cause`.
+func (e *ExampleError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *ExampleError) Unwrap() error {
+	return e.Err
+}
+
+// ExampleGenerationError is returned when an example can't be generated for
+// part of a schema. The pointer is a JSON pointer to the value within the
+// generated example, e.g. `/items/0/name`.
+type ExampleGenerationError struct {
+	Pointer string
+	Err     error
+}
+
+func (e *ExampleGenerationError) Error() string {
+	return fmt.Sprintf("can't get example for '%s': %v", e.Pointer, e.Err)
+}
+
+// Cause returns the underlying error, for use with `errors.Cause`.
+func (e *ExampleGenerationError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *ExampleGenerationError) Unwrap() error {
+	return e.Err
+}
+
+// escapePointer escapes a key for use in a JSON pointer as described in
+// RFC 6901.
+func escapePointer(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+// wrapGenerationError adds a key to the JSON pointer of a generation error,
+// creating one if needed.
+func wrapGenerationError(err error, key string) error {
+	key = escapePointer(key)
+
+	if e, ok := err.(*ExampleGenerationError); ok {
+		return &ExampleGenerationError{
+			Pointer: "/" + key + e.Pointer,
+			Err:     e.Err,
+		}
+	}
+
+	return &ExampleGenerationError{
+		Pointer: "/" + key,
+		Err:     err,
+	}
+}
+
+// TokenError is returned when a bearer token is missing or fails verification,
+// e.g. because its signature is invalid or it has expired.
+type TokenError struct {
+	Reason string
+}
+
+func (e *TokenError) Error() string {
+	return "Invalid token: " + e.Reason
+}
+
+// CredentialsError is returned when the `Authorization` header required by
+// an HTTP security scheme is missing or malformed. Err is either
+// `ErrMissingAuth` or `ErrInvalidAuth`.
+type CredentialsError struct {
+	Scheme string
+	Err    error
+}
+
+func (e *CredentialsError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error.
+func (e *CredentialsError) Cause() error {
+	return e.Err
+}
+
+// PartError is returned when a single part of a `multipart/form-data` request
+// body is invalid.
+type PartError struct {
+	Name   string
+	Reason string
+}
+
+func (e *PartError) Error() string {
+	return fmt.Sprintf("part '%s': %s", e.Name, e.Reason)
+}
+
+// ReadOnlyError is returned when a request body contains values for
+// properties marked as `readOnly`. Each pointer is a JSON pointer to one of
+// the values.
+type ReadOnlyError struct {
+	Pointers []string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return "Read-only properties must not be sent: " + strings.Join(e.Pointers, ", ")
+}
+
+// MergeConflict is a part of an API description declared differently by
+// several of the documents being merged. The pointer is a JSON pointer to
+// the conflicting value, e.g. `/paths/~1users/get`.
+type MergeConflict struct {
+	Pointer string
+	URIs    []string
+}
+
+// MergeError is returned when documents can't be merged because they
+// declare the same operations or components.
+type MergeError struct {
+	Conflicts []MergeConflict
+}
+
+func (e *MergeError) Error() string {
+	lines := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		lines = append(lines, fmt.Sprintf("'%s' is declared by %s", c.Pointer, strings.Join(c.URIs, " and ")))
+	}
+
+	return "Unable to merge documents: " + strings.Join(lines, "; ")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExampleGenerationError(t *testing.T) {
+	schema := &openapi3.Schema{}
+	require.NoError(t, schema.UnmarshalJSON([]byte(`{
+		"type": "object",
+		"properties": {
+			"items": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"a/b": {}
+					}
+				}
+			}
+		}
+	}`)))
+
+	_, err := OpenAPIExample(ModeResponse, schema)
+	require.Error(t, err)
+
+	genErr, ok := err.(*ExampleGenerationError)
+	require.True(t, ok, "%T", err)
+	assert.Equal(t, "/items/0/a~1b", genErr.Pointer)
+	assert.Equal(t, ErrNoExample, errors.Cause(err))
+	assert.Equal(t, "can't get example for '/items/0/a~1b': No example found", err.Error())
+}
+
+func TestExampleError(t *testing.T) {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(`{
+		"paths": {
+			"/test": {
+				"get": {
+					"operationId": "getTest",
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"schema": {
+										"type": "object",
+										"properties": {"name": {}}
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	op := swagger.Paths["/test"].Get
+
+	t.Run("Missing status", func(t *testing.T) {
+		_, _, _, _, err := getExample(context.Background(), nil, map[string]string{"status": "404"}, op, nil)
+
+		exErr, ok := err.(*ExampleError)
+		require.True(t, ok, "%T", err)
+		assert.Equal(t, "getTest", exErr.OperationID)
+		assert.Equal(t, "404", exErr.Status)
+		assert.Equal(t, ErrNoExample, errors.Cause(err))
+		assert.Equal(t, "No example found (operation getTest, status 404)", err.Error())
+	})
+
+	t.Run("Generation failed", func(t *testing.T) {
+		_, _, _, _, err := getExample(context.Background(), nil, map[string]string{}, op, nil)
+
+		exErr, ok := err.(*ExampleError)
+		require.True(t, ok, "%T", err)
+		assert.Equal(t, "application/json", exErr.MediaType)
+
+		genErr, ok := exErr.Err.(*ExampleGenerationError)
+		require.True(t, ok, "%T", exErr.Err)
+		assert.Equal(t, "/name", genErr.Pointer)
+		assert.Equal(t, ErrNoExample, errors.Cause(err))
+	})
+}
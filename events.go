@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxEvents is the number of events kept, after which the oldest ones are
+// dropped.
+const maxEvents = 1000
+
+// Event is a significant change to the mock, like a reload or a changed
+// setting, kept so operators of long-lived environments can reconstruct
+// what changed when.
+type Event struct {
+	Time    time.Time              `json:"time"`
+	Type    string                 `json:"type"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// eventLog is the timeline of events from oldest to newest.
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Add appends an event, dropping the oldest one when the log is full.
+func (l *eventLog) Add(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) >= maxEvents {
+		l.events = append(l.events[:0:0], l.events[len(l.events)-maxEvents+1:]...)
+	}
+	l.events = append(l.events, event)
+}
+
+// List returns the events from oldest to newest, optionally only those of
+// the given type and after the given time.
+func (l *eventLog) List(kind string, since time.Time) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Event, 0, len(l.events))
+	for _, event := range l.events {
+		if kind != "" && event.Type != kind {
+			continue
+		}
+		if !since.IsZero() && !event.Time.After(since) {
+			continue
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+// Events returns the recorded events from oldest to newest, optionally only
+// those of the given type, e.g. `reload`.
+func (s *OpenAPIServer) Events(kind string) []Event {
+	return s.events.List(kind, time.Time{})
+}
+
+// recordEvent adds an event to the timeline and logs it as a JSON line, so
+// log aggregators can pick it up too.
+func (s *OpenAPIServer) recordEvent(kind string, details map[string]interface{}, format string, args ...interface{}) {
+	event := Event{
+		Time:    time.Now().UTC(),
+		Type:    kind,
+		Message: fmt.Sprintf(format, args...),
+		Details: details,
+	}
+	s.events.Add(event)
+
+	encoded, _ := json.Marshal(event)
+	s.logf(logNormal, "📋 Event %s", encoded)
+}
+
+// recordConfigChange records a setting changed while running. Secrets are
+// redacted like in `/__config`.
+func (s *OpenAPIServer) recordConfigChange(key string, value interface{}, source string) {
+	s.recordEvent("config_change", map[string]interface{}{
+		"setting": key,
+		"value":   configValue(key, value),
+		"source":  source,
+	}, "Changed %s from the %s", key, source)
+}
+
+// recordConfigChange records a setting changed in the config file for every
+// mounted API.
+func (m *MountServer) recordConfigChange(key string, value interface{}) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, s := range m.servers {
+		s.recordConfigChange(key, value, "config file")
+	}
+}
+
+// eventsHandler lists the events as JSON, optionally filtered via
+// `?type=reload` and `?since=2006-01-02T15:04:05Z`.
+func (s *OpenAPIServer) eventsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid since, expected a time like 2006-01-02T15:04:05Z"))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoded, _ := json.MarshalIndent(s.events.List(query.Get("type"), since), "", "  ")
+	w.Write(encoded)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	const schema = `{"paths": {
+		"/items": {"get": {"operationId": "listItems", "responses": {"200": {"description": "ok", "content": {"application/json": {"example": []}}}}}}
+	}}`
+
+	f, err := ioutil.TempFile("", "events*.json")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(schema), 0644))
+
+	config := viper.New()
+	config.Set("quiet", true)
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load(f.Name(), []byte(schema)))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if method == http.MethodPost {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+		return resp
+	}
+
+	require.Equal(t, http.StatusOK, do("PUT", "/__examples?operation=listItems", `[{"id": 1}]`).Code)
+	require.Equal(t, http.StatusNoContent, do("DELETE", "/__examples?operation=listItems", "").Code)
+	require.Equal(t, http.StatusSeeOther, do("POST", "/__admin", url.Values{"csrf": {s.csrf}, "setting": {"validate-request"}, "value": {"true"}}.Encode()).Code)
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"paths": `), 0644))
+	require.Error(t, s.Reload())
+
+	s.recordConfigChange("auth-token", []string{"secret"}, "config file")
+
+	types := make([]string, 0)
+	for _, event := range s.Events("") {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{"startup", "load", "override_set", "override_removed", "config_change", "reload_failed", "config_change"}, types)
+
+	resp := do("GET", "/__events?type=config_change", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "secret")
+
+	var events []Event
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &events))
+	require.Len(t, events, 2)
+	assert.Equal(t, "validate-request", events[0].Details["setting"])
+	assert.Equal(t, "admin page", events[0].Details["source"])
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	resp = do("GET", "/__events?since="+future, "")
+	assert.JSONEq(t, `[]`, resp.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/__events?since=yesterday", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do("DELETE", "/__events", "").Code)
+}
+
+func TestEventLogLimit(t *testing.T) {
+	l := &eventLog{}
+	for i := 0; i < maxEvents+5; i++ {
+		l.Add(Event{Type: "test", Message: string(rune('a' + i%26))})
+	}
+
+	events := l.List("", time.Time{})
+	assert.Len(t, events, maxEvents)
+	assert.Equal(t, string(rune('a'+5)), events[0].Message)
+}
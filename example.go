@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/getkin/kin-openapi/openapi3"
 )
@@ -108,7 +108,13 @@ type cachedSchema struct {
 	out     interface{}
 }
 
-func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Schema]*cachedSchema) (out interface{}, err error) {
+func openAPIExample(ctx context.Context, mode Mode, schema *openapi3.Schema, cache map[*openapi3.Schema]*cachedSchema) (out interface{}, err error) {
+	// Give up early if the caller is no longer interested, e.g. because the
+	// client has disconnected.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if ex, ok := getSchemaExample(schema); ok {
 		return ex, nil
 	}
@@ -136,7 +142,7 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 		var err error
 
 		for _, candidate := range schema.OneOf {
-			ex, err = openAPIExample(mode, candidate.Value, cache)
+			ex, err = openAPIExample(ctx, mode, candidate.Value, cache)
 			if err == nil {
 				break
 			}
@@ -149,7 +155,7 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 		var err error
 
 		for _, candidate := range schema.AnyOf {
-			ex, err = openAPIExample(mode, candidate.Value, cache)
+			ex, err = openAPIExample(ctx, mode, candidate.Value, cache)
 			if err == nil {
 				break
 			}
@@ -161,7 +167,7 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 		example := map[string]interface{}{}
 
 		for _, allOf := range schema.AllOf {
-			candidate, err := openAPIExample(mode, allOf.Value, cache)
+			candidate, err := openAPIExample(ctx, mode, allOf.Value, cache)
 			if err != nil {
 				return nil, err
 			}
@@ -238,9 +244,12 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 		example := []interface{}{}
 
 		if schema.Items != nil && schema.Items.Value != nil {
-			ex, err := openAPIExample(mode, schema.Items.Value, cache)
+			ex, err := openAPIExample(ctx, mode, schema.Items.Value, cache)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			if err != nil {
-				return nil, fmt.Errorf("can't get example for array item: %+v", err)
+				return nil, wrapGenerationError(err, "0")
 			}
 
 			example = append(example, ex)
@@ -259,13 +268,16 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 				continue
 			}
 
-			ex, err := openAPIExample(mode, v.Value, cache)
+			ex, err := openAPIExample(ctx, mode, v.Value, cache)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			if err == ErrRecursive {
 				if isRequired(schema, k) {
-					return nil, fmt.Errorf("can't get example for '%s': %+v", k, err)
+					return nil, wrapGenerationError(err, k)
 				}
 			} else if err != nil {
-				return nil, fmt.Errorf("can't get example for '%s': %+v", k, err)
+				return nil, wrapGenerationError(err, k)
 			} else {
 				example[k] = ex
 			}
@@ -275,11 +287,11 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 			addl := schema.AdditionalProperties.Value
 
 			if !excludeFromMode(mode, addl) {
-				ex, err := openAPIExample(mode, addl, cache)
+				ex, err := openAPIExample(ctx, mode, addl, cache)
 				if err == ErrRecursive {
 					// We just won't add this if it's recursive.
 				} else if err != nil {
-					return nil, fmt.Errorf("can't get example for additional properties: %+v", err)
+					return nil, wrapGenerationError(err, "additionalPropertyName")
 				} else {
 					example["additionalPropertyName"] = ex
 				}
@@ -296,5 +308,11 @@ func openAPIExample(mode Mode, schema *openapi3.Schema, cache map[*openapi3.Sche
 // object, which is an extended subset of JSON Schema.
 // https://github.com/OAI/OpenAPI-Specification/blob/master/versions/3.0.1.md#schemaObject
 func OpenAPIExample(mode Mode, schema *openapi3.Schema) (interface{}, error) {
-	return openAPIExample(mode, schema, make(map[*openapi3.Schema]*cachedSchema))
+	return OpenAPIExampleContext(context.Background(), mode, schema)
+}
+
+// OpenAPIExampleContext is like `OpenAPIExample` but stops generating and
+// returns the context's error once the context is done.
+func OpenAPIExampleContext(ctx context.Context, mode Mode, schema *openapi3.Schema) (interface{}, error) {
+	return openAPIExample(ctx, mode, schema, make(map[*openapi3.Schema]*cachedSchema))
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -574,3 +575,20 @@ func TestRecursiveSchema(t *testing.T) {
 		})
 	}
 }
+
+func TestGenExampleCancelled(t *testing.T) {
+	schema := &openapi3.Schema{}
+	require.NoError(t, schema.UnmarshalJSON([]byte(`{
+		"type": "object",
+		"properties": {
+			"items": {"type": "array", "items": {"type": "string"}}
+		}
+	}`)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	example, err := OpenAPIExampleContext(ctx, ModeResponse, schema)
+	assert.Nil(t, example)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Vendor extensions which can be used in a document to change the default
+// behavior of the mock server.
+const (
+	// ExtStatus sets the default response status of an operation.
+	ExtStatus = "x-apisprout-status"
+
+	// ExtDelay delays the response of an operation or response. The value is
+	// either a number of milliseconds or a duration string like `1.5s`.
+	ExtDelay = "x-apisprout-delay"
+
+	// ExtExample selects the default named example of an operation or
+	// response.
+	ExtExample = "x-apisprout-example"
+
+	// ExtHeaders adds static headers like `X-Env: mock` to every response of
+	// an operation.
+	ExtHeaders = "x-apisprout-headers"
+)
+
+// extensionValue decodes the value of a vendor extension if present.
+func extensionValue(props openapi3.ExtensionProps, name string) (interface{}, bool) {
+	raw, ok := props.Extensions[name]
+	if !ok {
+		return nil, false
+	}
+
+	if msg, ok := raw.(json.RawMessage); ok {
+		var value interface{}
+		if err := json.Unmarshal(msg, &value); err != nil {
+			return nil, false
+		}
+		return value, true
+	}
+
+	return raw, true
+}
+
+// extensionString returns the value of a vendor extension as a string,
+// converting numbers like a status code of `404` as needed.
+func extensionString(props openapi3.ExtensionProps, name string) (string, bool) {
+	value, ok := extensionValue(props, name)
+	if !ok {
+		return "", false
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+
+	return "", false
+}
+
+// extensionDelay returns the value of a delay vendor extension.
+func extensionDelay(props openapi3.ExtensionProps) (time.Duration, error) {
+	value, ok := extensionValue(props, ExtDelay)
+	if !ok {
+		return 0, nil
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	case string:
+		return time.ParseDuration(v)
+	}
+
+	return 0, fmt.Errorf("Invalid %s value '%v'", ExtDelay, value)
+}
+
+// applyExtensionDefaults fills in preferences the client didn't give using
+// the operation's vendor extensions.
+func applyExtensionDefaults(op *openapi3.Operation, prefer map[string]string) {
+	if !mapContainsKey(prefer, "status") {
+		if status, ok := extensionString(op.ExtensionProps, ExtStatus); ok {
+			prefer["status"] = status
+		}
+	}
+
+	if !mapContainsKey(prefer, "example") {
+		if example, ok := extensionString(op.ExtensionProps, ExtExample); ok {
+			prefer["example"] = example
+		}
+	}
+}
+
+// extensionHeaders returns the static response headers of an operation.
+func extensionHeaders(props openapi3.ExtensionProps) map[string]string {
+	value, ok := extensionValue(props, ExtHeaders)
+	if !ok {
+		return nil
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	headers := make(map[string]string, len(obj))
+	for name, v := range obj {
+		switch v.(type) {
+		case string, float64, bool:
+			headers[name] = fmt.Sprint(v)
+		}
+	}
+
+	return headers
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVendorExtensions(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					%s
+					"responses": {
+						"200": {
+							%s
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"examples": {
+										"first": {"value": "first"},
+										"second": {"value": "second"}
+									}
+								}
+							}
+						},
+						"404": {
+							"description": "missing",
+							"content": {
+								"application/json": {"example": "missing"}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name      string
+		operation string
+		response  string
+		prefer    string
+		status    int
+		body      string
+		delay     time.Duration
+	}{
+		{
+			name:      "Status",
+			operation: `"x-apisprout-status": 404,`,
+			status:    http.StatusNotFound,
+			body:      "missing",
+		},
+		{
+			name:      "Status overridden",
+			operation: `"x-apisprout-status": "404", "x-apisprout-example": "first",`,
+			prefer:    "status=200",
+			status:    http.StatusOK,
+			body:      "first",
+		},
+		{
+			name:      "Operation example",
+			operation: `"x-apisprout-example": "second",`,
+			status:    http.StatusOK,
+			body:      "second",
+		},
+		{
+			name:     "Response example",
+			response: `"x-apisprout-example": "second",`,
+			status:   http.StatusOK,
+			body:     "second",
+		},
+		{
+			name:     "Example overridden",
+			response: `"x-apisprout-example": "second",`,
+			prefer:   "example=first",
+			status:   http.StatusOK,
+			body:     "first",
+		},
+		{
+			name:      "Operation delay",
+			operation: `"x-apisprout-delay": 50, "x-apisprout-example": "first",`,
+			status:    http.StatusOK,
+			body:      "first",
+			delay:     50 * time.Millisecond,
+		},
+		{
+			name:      "Response delay",
+			operation: `"x-apisprout-delay": 1000, "x-apisprout-example": "first",`,
+			response:  `"x-apisprout-delay": "50ms",`,
+			status:    http.StatusOK,
+			body:      "first",
+			delay:     50 * time.Millisecond,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewOpenAPIServer(viper.New())
+			err := s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, test.operation, test.response)))
+			require.NoError(t, err)
+
+			req, err := http.NewRequest("GET", "/test", nil)
+			require.NoError(t, err)
+			if test.prefer != "" {
+				req.Header.Set("Prefer", test.prefer)
+			}
+
+			start := time.Now()
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+			elapsed := time.Since(start)
+
+			assert.Equal(t, test.status, resp.Code)
+			assert.Equal(t, test.body, resp.Body.String())
+			assert.True(t, elapsed >= test.delay, "expected a delay of at least %v, got %v", test.delay, elapsed)
+			if test.delay > 0 {
+				assert.True(t, elapsed < 10*test.delay, "expected a delay of about %v, got %v", test.delay, elapsed)
+			}
+		})
+	}
+}
+
+func TestStaticHeaders(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"x-apisprout-headers": {"X-Env": "operation", "X-Version": 2},
+					"responses": {
+						"200": {
+							"description": "ok",
+							"headers": {"X-Trace": {"schema": {"type": "string", "example": "document"}}},
+							"content": {"text/plain": {"example": "ok"}}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	config := viper.New()
+	config.Set("response-header", stringArray{"X-Env: mock", "X-Trace: static", "Cache-Control: no-store", "invalid"})
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+	tests := []struct {
+		path     string
+		expected map[string]string
+	}{
+		{"/test", map[string]string{"X-Env": "operation", "X-Version": "2", "X-Trace": "static", "Cache-Control": "no-store"}},
+		{"/missing", map[string]string{"X-Env": "mock", "X-Version": "", "Cache-Control": "no-store"}},
+		{"/__health", map[string]string{"X-Env": "mock"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest("GET", test.path, nil))
+
+			for name, value := range test.expected {
+				assert.Equal(t, value, resp.Header().Get(name), name)
+			}
+		})
+	}
+}
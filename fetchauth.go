@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// oauthTokenCache holds client credentials tokens until shortly before they
+// expire, so polling doesn't request a new token on every fetch.
+var oauthTokenCache = struct {
+	sync.Mutex
+	tokens map[string]*oauthToken
+}{tokens: make(map[string]*oauthToken)}
+
+// oauthToken is an access token from an OAuth2 token endpoint.
+type oauthToken struct {
+	AccessToken string
+	Expires     time.Time
+}
+
+// fetchAuthorize adds the credentials configured via `--fetch-basic`,
+// `--fetch-bearer` or `--fetch-oauth` to a request for a remote document.
+func fetchAuthorize(config *viper.Viper, client *http.Client, req *http.Request) error {
+	basic := config.GetString("fetch-basic")
+	bearer := config.GetString("fetch-bearer")
+	oauth := config.GetString("fetch-oauth")
+
+	count := 0
+	for _, v := range []string{basic, bearer, oauth} {
+		if v != "" {
+			count++
+		}
+	}
+	if count > 1 {
+		return errors.New("Only one of --fetch-basic, --fetch-bearer and --fetch-oauth may be used")
+	}
+
+	switch {
+	case basic != "":
+		parts := strings.SplitN(basic, ":", 2)
+		if len(parts) != 2 {
+			return errors.New("Invalid --fetch-basic, expected user:pass")
+		}
+		req.SetBasicAuth(parts[0], parts[1])
+	case bearer != "":
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	case oauth != "":
+		parts := strings.SplitN(oauth, ",", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return errors.New("Invalid --fetch-oauth, expected token_url,client_id,client_secret")
+		}
+
+		token, err := cachedOAuthToken(client, parts[0], parts[1], parts[2])
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+
+	return nil
+}
+
+// cachedOAuthToken returns a cached token if it is still valid, otherwise
+// requests a new one.
+func cachedOAuthToken(client *http.Client, tokenURL, clientID, clientSecret string) (*oauthToken, error) {
+	oauthTokenCache.Lock()
+	defer oauthTokenCache.Unlock()
+
+	key := tokenURL + "\x00" + clientID + "\x00" + clientSecret
+	if t := oauthTokenCache.tokens[key]; t != nil && time.Now().Add(time.Minute).Before(t.Expires) {
+		return t, nil
+	}
+
+	token, err := clientCredentialsToken(client, tokenURL, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(oauthTokenCache.tokens, key)
+	if !token.Expires.IsZero() {
+		oauthTokenCache.tokens[key] = token
+	}
+
+	return token, nil
+}
+
+// clientCredentialsToken requests a token using the OAuth2 client
+// credentials grant, sending the client's credentials via basic auth.
+func clientCredentialsToken(client *http.Client, tokenURL, clientID, clientSecret string) (*oauthToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("Unable to get OAuth2 token: %s", resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		if result.Error != "" {
+			return nil, fmt.Errorf("Unable to get OAuth2 token: %s", strings.TrimSpace(result.Error+" "+result.ErrorDescription))
+		}
+		return nil, fmt.Errorf("Unable to get OAuth2 token: %s", resp.Status)
+	}
+
+	token := &oauthToken{AccessToken: result.AccessToken}
+	if result.ExpiresIn > 0 {
+		token.Expires = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
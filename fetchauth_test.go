@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchAuthorize(t *testing.T) {
+	tokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			id, secret, _ := r.BasicAuth()
+			if r.FormValue("grant_type") != "client_credentials" || id != "client" || secret != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "invalid_client"}`))
+				return
+			}
+			tokens++
+			w.Write([]byte(`{"access_token": "oauth-token", "token_type": "Bearer", "expires_in": 3600}`))
+			return
+		}
+
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		config map[string]string
+		auth   string
+		err    bool
+	}{
+		{"None", map[string]string{}, "", false},
+		{"Basic", map[string]string{"fetch-basic": "user:pa:ss"}, "Basic dXNlcjpwYTpzcw==", false},
+		{"BasicInvalid", map[string]string{"fetch-basic": "user"}, "", true},
+		{"Bearer", map[string]string{"fetch-bearer": "abc"}, "Bearer abc", false},
+		{"OAuth", map[string]string{"fetch-oauth": srv.URL + "/token,client,s3cret"}, "Bearer oauth-token", false},
+		{"OAuthInvalidClient", map[string]string{"fetch-oauth": srv.URL + "/token,client,wrong"}, "", true},
+		{"OAuthInvalid", map[string]string{"fetch-oauth": srv.URL + "/token"}, "", true},
+		{"Several", map[string]string{"fetch-basic": "user:pass", "fetch-bearer": "abc"}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for k, v := range test.config {
+				config.Set(k, v)
+			}
+
+			data, err := fetch(config, srv.URL)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.auth, string(data))
+		})
+	}
+
+	// The OAuth token is reused until it expires.
+	config := viper.New()
+	config.Set("fetch-oauth", srv.URL+"/token,client,s3cret")
+	_, err := fetch(config, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tokens)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gobwas/glob"
+	"github.com/spf13/viper"
+)
+
+// filterOperations removes operations which weren't selected, so only part of
+// a large document is served. When `--include-tags` or `--include-operations`
+// are given, operations must have one of the tags or operation IDs. Paths
+// matching `--exclude-paths`, e.g. `/admin/**`, are always removed.
+func filterOperations(config *viper.Viper, swagger *openapi3.Swagger) error {
+	tags := make(map[string]bool)
+	for _, tag := range config.GetStringSlice("include-tags") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags[tag] = true
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, id := range config.GetStringSlice("include-operations") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+
+	excluded := make([]glob.Glob, 0)
+	for _, pattern := range config.GetStringSlice("exclude-paths") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return fmt.Errorf("Invalid --exclude-paths pattern '%s': %v", pattern, err)
+		}
+		excluded = append(excluded, g)
+	}
+
+	if len(tags) == 0 && len(ids) == 0 && len(excluded) == 0 {
+		return nil
+	}
+
+	for path, item := range swagger.Paths {
+		if matchesAny(excluded, path) {
+			delete(swagger.Paths, path)
+			continue
+		}
+
+		if len(tags) == 0 && len(ids) == 0 {
+			continue
+		}
+
+		for method, op := range item.Operations() {
+			if !operationIncluded(op, tags, ids) {
+				item.SetOperation(method, nil)
+			}
+		}
+
+		if len(item.Operations()) == 0 {
+			delete(swagger.Paths, path)
+		}
+	}
+
+	return nil
+}
+
+// matchesAny returns true if the value matches one of the patterns.
+func matchesAny(patterns []glob.Glob, value string) bool {
+	for _, g := range patterns {
+		if g.Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// operationIncluded returns true if an operation has one of the included
+// tags or operation IDs.
+func operationIncluded(op *openapi3.Operation, tags, ids map[string]bool) bool {
+	if ids[op.OperationID] {
+		return true
+	}
+
+	for _, tag := range op.Tags {
+		if tags[tag] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const filterDoc = `
+openapi: 3.0.0
+info:
+  title: Filter
+  version: "1.0"
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      tags: [users]
+      responses:
+        "204":
+          description: ok
+    post:
+      operationId: createUser
+      tags: [users, admin]
+      responses:
+        "204":
+          description: ok
+  /pets/{id}:
+    get:
+      operationId: getPet
+      tags: [pets]
+      responses:
+        "204":
+          description: ok
+  /admin/users/{id}:
+    delete:
+      operationId: deleteUser
+      tags: [admin]
+      responses:
+        "204":
+          description: ok
+`
+
+func TestFilterOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]interface{}
+		operations []string
+		err        bool
+	}{
+		{"None", map[string]interface{}{}, []string{"createUser", "deleteUser", "getPet", "listUsers"}, false},
+		{"Tags", map[string]interface{}{"include-tags": []string{"users"}}, []string{"createUser", "listUsers"}, false},
+		{"Operations", map[string]interface{}{"include-operations": []string{"getPet", "deleteUser"}}, []string{"deleteUser", "getPet"}, false},
+		{"Tags or operations", map[string]interface{}{"include-tags": []string{"pets"}, "include-operations": []string{"listUsers"}}, []string{"getPet", "listUsers"}, false},
+		{"Exclude", map[string]interface{}{"exclude-paths": []string{"/admin/**"}}, []string{"createUser", "getPet", "listUsers"}, false},
+		{"Exclude single segment", map[string]interface{}{"exclude-paths": []string{"/pets/*", "/admin/*"}}, []string{"createUser", "deleteUser", "listUsers"}, false},
+		{"Include and exclude", map[string]interface{}{"include-tags": []string{"admin"}, "exclude-paths": []string{"/admin/**"}}, []string{"createUser"}, false},
+		{"Everything", map[string]interface{}{"exclude-paths": []string{"/**"}}, []string{}, false},
+		{"Invalid pattern", map[string]interface{}{"exclude-paths": []string{"/[a"}}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for k, v := range test.config {
+				config.Set(k, v)
+			}
+
+			swagger, _, err := load(config, "openapi.yaml", []byte(filterDoc))
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			operations := make([]string, 0)
+			for _, item := range swagger.Paths {
+				for _, op := range item.Operations() {
+					operations = append(operations, op.OperationID)
+				}
+			}
+			sort.Strings(operations)
+			assert.Equal(t, test.operations, operations)
+		})
+	}
+}
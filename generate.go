@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// generateExample returns the response body the mock server would send for
+// an operation, optionally for a status, media type and named example. The
+// same example is returned every time, even if several are available.
+func generateExample(op *openapi3.Operation, status, media, name string) (int, string, []byte, error) {
+	var negotiator *ContentNegotiator
+	if media != "" {
+		negotiator = NewContentNegotiator(media)
+	}
+
+	prefer := make(map[string]string)
+	if status != "" {
+		prefer["status"] = status
+	}
+	if name != "" {
+		prefer["example"] = name
+	}
+	applyExtensionDefaults(op, prefer)
+
+	code, mediatype, _, example, err := getExample(context.Background(), negotiator, prefer, op, rand.New(rand.NewSource(1)))
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	encoded, err := encodeExample(mediatype, example)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	return code, mediatype, encoded, nil
+}
+
+// example loads an OpenAPI file and prints the example response of an
+// operation without starting a server, e.g. to create test fixtures.
+func example(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	ref := viper.GetString("operation")
+	if ref == "" {
+		log.Fatal("Missing --operation, e.g. an operation ID or 'GET /pets/{id}'")
+	}
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	swagger, _, err := load(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	op, _, _ := findOperation(swagger, ref)
+	if op == nil {
+		log.Fatalf("Operation '%s' not found, expected an operation ID or e.g. 'GET /pets/{id}'", ref)
+	}
+
+	_, _, encoded, err := generateExample(op, viper.GetString("status"), viper.GetString("media"), viper.GetString("example"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Stdout.Write(encoded)
+	if len(encoded) > 0 && encoded[len(encoded)-1] != '\n' {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateExample(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/pets/{id}": {
+				"get": {
+					"operationId": "getPet",
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"schema": {"type": "object", "properties": {"name": {"type": "string", "example": "Fluffy"}}}
+								},
+								"application/yaml": {
+									"examples": {
+										"cat": {"value": {"name": "Cat"}},
+										"dog": {"value": {"name": "Dog"}}
+									}
+								}
+							}
+						},
+						"404": {
+							"description": "missing",
+							"content": {"text/plain": {"example": "Not found"}}
+						}
+					}
+				},
+				"delete": {
+					"responses": {"204": {"description": "deleted"}}
+				}
+			}
+		}
+	}`
+
+	swagger, _, err := load(viper.New(), "file:///swagger.json", []byte(schema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		operation string
+		status    string
+		media     string
+		example   string
+		code      int
+		body      string
+		err       bool
+	}{
+		{"Generated", "getPet", "", "application/json", "", 200, "{\n  \"name\": \"Fluffy\"\n}", false},
+		{"Named", "getPet", "200", "application/yaml", "dog", 200, "name: Dog\n", false},
+		{"Status", "getPet", "404", "", "", 404, "Not found", false},
+		{"Method and path", "DELETE /pets/{id}", "", "", "", 204, "", false},
+		{"Missing status", "getPet", "500", "", "", 0, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op, _, _ := findOperation(swagger, test.operation)
+			require.NotNil(t, op)
+
+			code, _, body, err := generateExample(op, test.status, test.media, test.example)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.code, code)
+			assert.Equal(t, test.body, string(body))
+		})
+	}
+}
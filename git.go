@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// gitMu serializes git commands, since sources in the same repository share
+// a checkout.
+var gitMu sync.Mutex
+
+// gitSource is a file within a git repository, given as
+// `git+https://host/repo.git#branch:path/openapi.yaml`.
+type gitSource struct {
+	Repo string
+	Ref  string
+	Path string
+}
+
+// parseGitSource parses a `git+` URI. The ref defaults to the remote's
+// default branch.
+func parseGitSource(uri string) (*gitSource, error) {
+	repo := strings.TrimPrefix(uri, "git+")
+
+	parts := strings.SplitN(repo, "#", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid git source '%s', expected git+https://host/repo.git#branch:path", uri)
+	}
+
+	source := &gitSource{Repo: parts[0], Ref: "HEAD", Path: parts[1]}
+	if i := strings.Index(parts[1], ":"); i != -1 {
+		if i > 0 {
+			source.Ref = parts[1][:i]
+		}
+		source.Path = parts[1][i+1:]
+	}
+	source.Path = strings.TrimPrefix(source.Path, "/")
+
+	if source.Path == "" {
+		return nil, fmt.Errorf("Invalid git source '%s', expected git+https://host/repo.git#branch:path", uri)
+	}
+
+	// Values starting with a dash would be taken as options by git.
+	if strings.HasPrefix(source.Repo, "-") || strings.HasPrefix(source.Ref, "-") {
+		return nil, fmt.Errorf("Invalid git source '%s', the repository and ref must not start with '-'", uri)
+	}
+
+	return source, nil
+}
+
+// fetchGit shallowly fetches the latest commit of a branch into the user's
+// cache directory and reads a file from it. Fetching again only downloads new commits, which
+// makes it cheap to poll for changes. Authentication uses git's own
+// credential helpers and SSH keys.
+func fetchGit(uri string) ([]byte, error) {
+	source, err := parseGitSource(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	gitMu.Lock()
+	defer gitMu.Unlock()
+
+	// Checkouts live in the user's cache directory rather than the shared
+	// temporary directory, where other users could plant a repository.
+	cache := defaultCacheDir()
+	if cache == "" {
+		return nil, errors.New("Unable to find a cache directory for git checkouts")
+	}
+
+	sum := sha256.Sum256([]byte(source.Repo))
+	dir := filepath.Join(cache, "git", hex.EncodeToString(sum[:8]))
+
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		if _, err := git(dir, "init", "--quiet", "--bare"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := git(dir, "fetch", "--quiet", "--depth", "1", "--", source.Repo, source.Ref); err != nil {
+		return nil, unreachableError{err}
+	}
+
+	return git(dir, "show", "FETCH_HEAD:"+source.Path)
+}
+
+// git runs a git command in a directory, returning its output or an error
+// including what git printed.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGitSource(t *testing.T) {
+	tests := []struct {
+		uri    string
+		source *gitSource
+		err    bool
+	}{
+		{"git+https://example.com/api.git#main:specs/openapi.yaml", &gitSource{Repo: "https://example.com/api.git", Ref: "main", Path: "specs/openapi.yaml"}, false},
+		{"git+ssh://git@example.com/api.git#v1.2:/openapi.yaml", &gitSource{Repo: "ssh://git@example.com/api.git", Ref: "v1.2", Path: "openapi.yaml"}, false},
+		{"git+https://example.com/api.git#openapi.yaml", &gitSource{Repo: "https://example.com/api.git", Ref: "HEAD", Path: "openapi.yaml"}, false},
+		{"git+https://example.com/api.git", nil, true},
+		{"git+https://example.com/api.git#main:", nil, true},
+		{"git+--upload-pack=touch /tmp/pwned#main:openapi.yaml", nil, true},
+		{"git+https://example.com/api.git#--upload-pack=touch /tmp/pwned:openapi.yaml", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			source, err := parseGitSource(test.uri)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.source, source)
+		})
+	}
+}
+
+func TestFetchGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cache, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cache)
+
+	old, ok := os.LookupEnv("XDG_CACHE_HOME")
+	os.Setenv("XDG_CACHE_HOME", cache)
+	if ok {
+		defer os.Setenv("XDG_CACHE_HOME", old)
+	} else {
+		defer os.Unsetenv("XDG_CACHE_HOME")
+	}
+
+	commit := func(content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "specs"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "specs", "openapi.json"), []byte(content), 0644))
+		_, err := git(dir, "add", "-A")
+		require.NoError(t, err)
+		_, err = git(dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "Update")
+		require.NoError(t, err)
+	}
+
+	_, err = git(dir, "init", "--quiet")
+	require.NoError(t, err)
+	_, err = git(dir, "checkout", "--quiet", "-b", "docs")
+	require.NoError(t, err)
+	commit(`{"paths": {}}`)
+
+	uri := "git+file://" + dir + "#docs:specs/openapi.json"
+
+	data, err := fetch(viper.New(), uri)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {}}`, string(data))
+
+	// The checkout is kept in the user's cache directory.
+	matches, err := filepath.Glob(filepath.Join(defaultCacheDir(), "git", "*", "HEAD"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, matches)
+
+	// New commits are picked up when fetching again.
+	commit(`{"paths": {"/new": {}}}`)
+	data, err = fetch(viper.New(), uri)
+	require.NoError(t, err)
+	assert.Equal(t, `{"paths": {"/new": {}}}`, string(data))
+
+	_, err = fetch(viper.New(), "git+file://"+dir+"#docs:missing.yaml")
+	assert.Error(t, err)
+}
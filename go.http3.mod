@@ -0,0 +1,39 @@
+// Module file for builds with the `http3` tag, which need quic-go and a newer
+// Go than the default build. Use it via `-modfile=go.http3.mod -tags http3`
+// and keep its other requirements in sync with `go.mod`.
+module github.com/danielgtaylor/apisprout
+
+go 1.24
+
+require (
+	github.com/andybalholm/brotli v1.0.6
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/getkin/kin-openapi v0.2.0
+	github.com/ghodss/yaml v1.0.0
+	github.com/gobwas/glob v0.2.3
+	github.com/pkg/errors v0.8.1
+	github.com/quic-go/quic-go v0.59.0
+	github.com/spf13/cobra v0.0.4
+	github.com/spf13/pflag v1.0.3
+	github.com/spf13/viper v1.4.0
+	github.com/stretchr/testify v1.11.1
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/magiconair/properties v1.8.1 // indirect
+	github.com/mitchellh/mapstructure v1.1.2 // indirect
+	github.com/pelletier/go-toml v1.4.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	github.com/spf13/afero v1.2.2 // indirect
+	github.com/spf13/cast v1.3.0 // indirect
+	github.com/spf13/jwalterweatherman v1.1.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Readiness describes whether a server can answer requests, as reported by
+// `/__ready`. A server is ready once its document is loaded and stops being
+// ready when reloading it fails, e.g. after a broken change was watched.
+type Readiness struct {
+	Ready    bool                  `json:"ready"`
+	Status   string                `json:"status"`
+	Title    string                `json:"title,omitempty"`
+	Version  string                `json:"version,omitempty"`
+	LoadedAt *time.Time            `json:"loaded_at,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	APIs     map[string]*Readiness `json:"apis,omitempty"`
+}
+
+// isProbePath returns true for the health check routes, which are answered
+// even while busy or loading.
+func isProbePath(config *viper.Viper, path string) bool {
+	if config.GetBool("disable-admin") {
+		return false
+	}
+	return strings.HasSuffix(path, adminPath(config, "health")) || strings.HasSuffix(path, adminPath(config, "live")) || strings.HasSuffix(path, adminPath(config, "ready"))
+}
+
+// setLoadError records the result of loading the document. A failed reload
+// keeps serving the previous document but isn't ready anymore.
+func (s *OpenAPIServer) setLoadError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadErr = err
+}
+
+// Readiness returns whether the server is ready along with details about
+// the loaded document.
+func (s *OpenAPIServer) Readiness() *Readiness {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r := &Readiness{Status: "loading"}
+	if s.swagger != nil {
+		r.Ready = true
+		r.Status = "ready"
+		r.Title = s.swagger.Info.Title
+		r.Version = s.swagger.Info.Version
+	}
+
+	if !s.loadedAt.IsZero() {
+		loadedAt := s.loadedAt
+		r.LoadedAt = &loadedAt
+	}
+
+	if s.loadErr != nil {
+		r.Ready = false
+		r.Status = "failing"
+		r.Error = s.loadErr.Error()
+	}
+
+	return r
+}
+
+// live is a liveness check which returns 200 as long as the process runs.
+func (s *OpenAPIServer) live(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// ready is a readiness check which returns 200 once the document is loaded
+// and a 503 while loading or after a failed reload.
+func (s *OpenAPIServer) ready(w http.ResponseWriter, req *http.Request) {
+	writeReadiness(w, s.Readiness())
+}
+
+// writeReadiness sends a readiness report with a status code for probes.
+func writeReadiness(w http.ResponseWriter, r *Readiness) {
+	status := http.StatusOK
+	if !r.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	encoded, _ := json.MarshalIndent(r, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(encoded)
+}
+
+// readiness reports on every mounted server, which are only ready once all
+// of them are.
+func (m *MountServer) readiness() *Readiness {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r := &Readiness{Ready: !m.loading, Status: "ready", APIs: make(map[string]*Readiness)}
+	if m.loading {
+		r.Status = "loading"
+	}
+
+	for prefix, s := range m.servers {
+		api := s.Readiness()
+		r.APIs[prefix] = api
+		if !api.Ready {
+			r.Ready = false
+			r.Status = api.Status
+		}
+	}
+
+	return r
+}
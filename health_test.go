@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	const schema = `{"info": {"title": "Widget API", "version": "1.2.3"}, "paths": {}}`
+
+	f, err := ioutil.TempFile("", "ready*.json")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(schema), 0644))
+
+	s := NewOpenAPIServer(viper.New())
+
+	get := func(path string) (*httptest.ResponseRecorder, *Readiness) {
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+
+		var r Readiness
+		json.Unmarshal(resp.Body.Bytes(), &r)
+		return resp, &r
+	}
+
+	resp, r := get("/__ready")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "loading", r.Status)
+
+	require.NoError(t, s.Load(f.Name(), []byte(schema)))
+	resp, r = get("/__ready")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "ready", r.Status)
+	assert.Equal(t, "Widget API", r.Title)
+	assert.Equal(t, "1.2.3", r.Version)
+	assert.NotNil(t, r.LoadedAt)
+
+	// A broken document keeps being served, but isn't ready anymore.
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"paths": `), 0644))
+	assert.Error(t, s.Reload())
+	resp, r = get("/__ready")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "failing", r.Status)
+	assert.NotEmpty(t, r.Error)
+	assert.Equal(t, "Widget API", r.Title)
+
+	resp, _ = get("/__live")
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(schema), 0644))
+	require.NoError(t, s.Reload())
+	resp, _ = get("/__ready")
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestMountServerReadiness(t *testing.T) {
+	mounted := NewMountServer()
+	mounted.SetLoading(true)
+
+	get := func(path string) (*httptest.ResponseRecorder, *Readiness) {
+		resp := httptest.NewRecorder()
+		mounted.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+
+		var r Readiness
+		json.Unmarshal(resp.Body.Bytes(), &r)
+		return resp, &r
+	}
+
+	resp, r := get("/__ready")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "loading", r.Status)
+
+	resp, _ = get("/__live")
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	users := NewOpenAPIServer(viper.New())
+	require.NoError(t, users.Load("file:///users.json", []byte(`{"info": {"title": "Users"}, "paths": {}}`)))
+	mounted.Mount("/users", users)
+	mounted.Mount("/payments", NewOpenAPIServer(viper.New()))
+	mounted.SetLoading(false)
+
+	resp, r = get("/__ready")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "ready", r.APIs["/users"].Status)
+	assert.Equal(t, "loading", r.APIs["/payments"].Status)
+
+	resp, _ = get("/users/__ready")
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	mounted.Unmount("/payments")
+	resp, r = get("/__ready")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.True(t, r.Ready)
+}
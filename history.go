@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// historyBodyLimit is the maximum number of bytes of each request body kept
+// in the request history.
+const historyBodyLimit = 64 * 1024
+
+// RecordedRequest is a request received by the mock, kept so tests can check
+// what their application actually called.
+type RecordedRequest struct {
+	Time        time.Time   `json:"time"`
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	Query       string      `json:"query,omitempty"`
+	Headers     http.Header `json:"headers"`
+	Body        string      `json:"body,omitempty"`
+	Truncated   bool        `json:"truncated,omitempty"`
+	OperationID string      `json:"operation_id,omitempty"`
+	Status      int         `json:"status"`
+}
+
+// requestHistory is a ring buffer of the most recent requests.
+type requestHistory struct {
+	mu      sync.Mutex
+	entries []RecordedRequest
+	next    int
+	full    bool
+}
+
+func newRequestHistory(size int) *requestHistory {
+	if size <= 0 {
+		return nil
+	}
+
+	return &requestHistory{entries: make([]RecordedRequest, size)}
+}
+
+// Add records a request, replacing the oldest one when the buffer is full.
+func (h *requestHistory) Add(entry RecordedRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// List returns the recorded requests from oldest to newest, optionally only
+// those matching an operation ID.
+func (h *requestHistory) List(operationID string) []RecordedRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ordered := h.entries[:h.next]
+	if h.full {
+		ordered = append(append([]RecordedRequest{}, h.entries[h.next:]...), h.entries[:h.next]...)
+	}
+
+	result := make([]RecordedRequest, 0, len(ordered))
+	for _, entry := range ordered {
+		if operationID == "" || entry.OperationID == operationID {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Clear removes all recorded requests.
+func (h *requestHistory) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = make([]RecordedRequest, len(h.entries))
+	h.next = 0
+	h.full = false
+}
+
+// Requests returns the most recent requests from oldest to newest, see
+// `--history-size`. If an operation ID is given, only requests matched to
+// that operation are returned.
+func (s *OpenAPIServer) Requests(operationID string) []RecordedRequest {
+	if s.history == nil {
+		return []RecordedRequest{}
+	}
+	return s.history.List(operationID)
+}
+
+// secretHeaders are always redacted from the request history since it
+// can be read without credentials.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// credentialHeaders returns the canonical names of headers carrying
+// credentials, including those of the document's `apiKey` schemes.
+func (s *OpenAPIServer) credentialHeaders() map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range secretHeaders {
+		names[name] = true
+	}
+
+	if swagger := s.Swagger(); swagger != nil {
+		for _, scheme := range swagger.Components.SecuritySchemes {
+			if scheme != nil && scheme.Value != nil && scheme.Value.Type == "apiKey" && scheme.Value.In == "header" {
+				names[http.CanonicalHeaderKey(scheme.Value.Name)] = true
+			}
+		}
+	}
+
+	return names
+}
+
+// recordRequest starts recording a request, returning a function to call
+// with the matched operation and served status once it has been handled.
+// Administrative routes like `/__health` aren't recorded.
+func (s *OpenAPIServer) recordRequest(req *http.Request) func(operationID string, status int) {
+	if s.history == nil || isAdminPath(s.settings(), req.URL.Path) {
+		return func(string, int) {}
+	}
+
+	secret := s.credentialHeaders()
+	headers := make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		if secret[http.CanonicalHeaderKey(name)] {
+			hidden := make([]string, len(values))
+			for i := range values {
+				hidden[i] = redacted
+			}
+			headers[name] = hidden
+			continue
+		}
+		headers[name] = append([]string{}, values...)
+	}
+
+	body, size := peekBody(req, historyBodyLimit)
+	entry := RecordedRequest{
+		Time:      time.Now(),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Query:     req.URL.RawQuery,
+		Headers:   headers,
+		Body:      string(body),
+		Truncated: size > len(body),
+	}
+
+	return func(operationID string, status int) {
+		entry.OperationID = operationID
+		entry.Status = status
+		s.history.Add(entry)
+	}
+}
+
+// requests lists the recorded requests as JSON, optionally filtered via
+// `?operation=listItems`. A `DELETE` clears the history.
+func (s *OpenAPIServer) requests(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+		encoded, _ := json.MarshalIndent(s.Requests(req.URL.Query().Get("operation")), "", "  ")
+		w.Write(encoded)
+	case http.MethodDelete:
+		if s.settings().GetBool("read-only") {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if s.history != nil {
+			s.history.Clear()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
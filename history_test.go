@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestHistory(t *testing.T) {
+	h := newRequestHistory(3)
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		h.Add(RecordedRequest{Path: path, OperationID: "op" + path})
+	}
+
+	paths := func(entries []RecordedRequest) []string {
+		result := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			result = append(result, entry.Path)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"/b", "/c", "/d"}, paths(h.List("")))
+	assert.Equal(t, []string{"/c"}, paths(h.List("op/c")))
+
+	h.Clear()
+	assert.Empty(t, h.List(""))
+
+	assert.Nil(t, newRequestHistory(0))
+}
+
+func TestRequestsEndpoint(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items": {
+				"get": {"operationId": "listItems", "responses": {"200": {"description": "ok"}}},
+				"post": {"operationId": "createItem", "responses": {"201": {"description": "created"}}}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		size     int
+		readOnly bool
+		query    string
+		expected []string
+	}{
+		{"All", 10, false, "", []string{"listItems", "createItem", ""}},
+		{"Filtered", 10, false, "?operation=createItem", []string{"createItem"}},
+		{"Limited", 2, false, "", []string{"createItem", ""}},
+		{"Disabled", 0, false, "", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("history-size", test.size)
+			config.Set("read-only", test.readOnly)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, bytes.NewReader(body))
+				req.Header.Set("X-Test", "yes")
+				resp := httptest.NewRecorder()
+				s.ServeHTTP(resp, req)
+				return resp
+			}
+
+			serve("GET", "/items?page=2", nil)
+			serve("POST", "/items", []byte(`{"name": "widget"}`))
+			serve("GET", "/missing", nil)
+			serve("GET", "/__health", nil)
+
+			resp := serve("GET", "/__requests"+test.query, nil)
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			var recorded []RecordedRequest
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &recorded))
+
+			operations := make([]string, 0, len(recorded))
+			for _, entry := range recorded {
+				operations = append(operations, entry.OperationID)
+			}
+			assert.Equal(t, test.expected, operations)
+
+			for _, entry := range recorded {
+				assert.Equal(t, "yes", entry.Headers.Get("X-Test"))
+				switch entry.OperationID {
+				case "listItems":
+					assert.Equal(t, "page=2", entry.Query)
+					assert.Equal(t, http.StatusOK, entry.Status)
+				case "createItem":
+					assert.Equal(t, `{"name": "widget"}`, entry.Body)
+					assert.Equal(t, http.StatusCreated, entry.Status)
+				}
+				if entry.Path == "/missing" {
+					assert.Equal(t, http.StatusNotFound, entry.Status)
+				}
+			}
+
+			resp = serve("DELETE", "/__requests", nil)
+			if test.readOnly {
+				assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+				return
+			}
+			assert.Equal(t, http.StatusNoContent, resp.Code)
+			assert.Empty(t, s.Requests(""))
+		})
+	}
+}
+
+func TestRequestHistoryCredentials(t *testing.T) {
+	const schema = `{
+		"components": {"securitySchemes": {"key": {"type": "apiKey", "in": "header", "name": "x-api-key"}}},
+		"paths": {"/items": {"get": {"responses": {"200": {"description": "ok"}}}}}
+	}`
+
+	config := viper.New()
+	config.Set("history-size", 10)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Header.Set("Authorization", "Bearer USER-SECRET")
+	req.Header.Set("Proxy-Authorization", "Basic USER-SECRET")
+	req.Header.Set("Cookie", "session=USER-SECRET")
+	req.Header.Set("X-Api-Key", "USER-SECRET")
+	req.Header.Set("X-Test", "yes")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, httptest.NewRequest("GET", "/__requests", nil))
+	assert.NotContains(t, resp.Body.String(), "USER-SECRET")
+
+	recorded := s.Requests("")
+	require.Len(t, recorded, 1)
+	for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"} {
+		assert.Equal(t, redacted, recorded[0].Headers.Get(name), name)
+	}
+	assert.Equal(t, "yes", recorded[0].Headers.Get("X-Test"))
+}
@@ -0,0 +1,50 @@
+//go:build http3
+// +build http3
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// serveHTTP3 serves the handler over HTTP/3 on the UDP port of the same
+// address the TCP listener uses, see `--http3`. It returns the handler for
+// the TCP listener, which advertises the HTTP/3 endpoint via `Alt-Svc` so
+// clients can switch to it.
+func serveHTTP3(addr, certFile, keyFile string, handler http.Handler) (http.Handler, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	}
+
+	// Built here rather than via `SetQUICHeaders`, which only knows the port
+	// once the listener has started.
+	altSvc := fmt.Sprintf(`%s=":%d"; ma=2592000`, http3.NextProtoH3, conn.LocalAddr().(*net.UDPAddr).Port)
+
+	go func() {
+		if err := srv.Serve(conn); err != nil {
+			log.Printf("ERROR: HTTP/3 listener stopped: %v", err)
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Alt-Svc", altSvc)
+		handler.ServeHTTP(w, req)
+	}), nil
+}
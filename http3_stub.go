@@ -0,0 +1,16 @@
+//go:build !http3
+// +build !http3
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// serveHTTP3 is only available in builds with the `http3` tag, as it needs
+// a QUIC implementation.
+func serveHTTP3(addr, certFile, keyFile string, handler http.Handler) (http.Handler, error) {
+	return nil, errors.New("HTTP/3 is not supported by this build, rebuild with -modfile=go.http3.mod -tags http3")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/viper"
+)
+
+// Instance is one of several independent mock servers run by a single
+// process via `--instances`, each with its own document, port and options.
+type Instance struct {
+	// Spec is the document to serve, e.g. a file or URL.
+	Spec string `json:"spec"`
+
+	// Port to listen on, zero to pick a free port.
+	Port int `json:"port"`
+
+	// Options override the global configuration for this instance, using
+	// the same names as the commandline flags, e.g. `validate-request`.
+	Options map[string]interface{} `json:"options"`
+}
+
+// loadInstances reads the list of instances from a YAML or JSON file, where
+// each item has a `spec` and optionally a `port` and `options`.
+func loadInstances(config *viper.Viper, uri string) ([]Instance, error) {
+	data, err := fetch(config, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []Instance
+	if err := yaml.Unmarshal(data, &instances); err != nil {
+		return nil, fmt.Errorf("Unable to parse instances in %s: %v", uri, err)
+	}
+
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("No instances found in %s", uri)
+	}
+
+	ports := make(map[int]string)
+	for i, instance := range instances {
+		if instance.Spec == "" {
+			return nil, fmt.Errorf("Instance %d in %s has no spec", i+1, uri)
+		}
+
+		if other, ok := ports[instance.Port]; ok && instance.Port != 0 {
+			return nil, fmt.Errorf("Both %s and %s use port %d", other, instance.Spec, instance.Port)
+		}
+		ports[instance.Port] = instance.Spec
+	}
+
+	return instances, nil
+}
+
+// instanceConfig returns the configuration of an instance, which is the
+// global configuration with the instance's options and port applied.
+func instanceConfig(base *viper.Viper, instance Instance) *viper.Viper {
+	config := viper.New()
+	for key, value := range base.AllSettings() {
+		config.Set(key, value)
+	}
+
+	for key, value := range instance.Options {
+		config.Set(key, value)
+	}
+	config.Set("port", instance.Port)
+
+	return config
+}
+
+// startInstances loads and serves each instance in the background until the
+// context is done, returning the addresses they are listening on.
+func startInstances(ctx context.Context, base *viper.Viper, instances []Instance) ([]string, error) {
+	addrs := make([]string, 0, len(instances))
+
+	for _, instance := range instances {
+		config := instanceConfig(base, instance)
+
+		data, err := fetch(config, instance.Spec)
+		if err != nil {
+			return nil, err
+		}
+
+		s := NewOpenAPIServer(config)
+		if err := s.Load(instance.Spec, data); err != nil {
+			return nil, err
+		}
+
+		ln, err := net.Listen("tcp", listenAddress(config))
+		if err != nil {
+			return nil, err
+		}
+		config.Set("port", ln.Addr().(*net.TCPAddr).Port)
+
+		srv := newHTTPServer(config, ln.Addr().String(), s)
+		go func() {
+			var err error
+			if config.GetBool("https") {
+				err = srv.ServeTLS(ln, config.GetString("public-key"), config.GetString("private-key"))
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("ERROR: %v", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+
+		if interval := config.GetDuration("poll"); interval > 0 {
+			go s.Poll(ctx, interval)
+		}
+
+		fmt.Printf("🌱 Sprouting %s on port %d\n", s.Swagger().Info.Title, config.GetInt("port"))
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	return addrs, nil
+}
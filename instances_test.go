@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadInstances(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		count int
+		err   bool
+	}{
+		{"YAML", "- spec: a.yaml\n  port: 8001\n- spec: b.yaml\n  port: 8002\n", 2, false},
+		{"JSON", `[{"spec": "a.yaml", "options": {"validate-request": true}}]`, 1, false},
+		{"Free ports", "- spec: a.yaml\n- spec: b.yaml\n", 2, false},
+		{"Empty", "[]", 0, true},
+		{"Missing spec", "- port: 8001\n", 0, true},
+		{"Duplicate port", "- spec: a.yaml\n  port: 8001\n- spec: b.yaml\n  port: 8001\n", 0, true},
+		{"Invalid", "spec: a.yaml", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "instances")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "instances.yaml")
+			require.NoError(t, ioutil.WriteFile(path, []byte(test.data), 0644))
+
+			instances, err := loadInstances(viper.New(), path)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, instances, test.count)
+		})
+	}
+}
+
+func TestStartInstances(t *testing.T) {
+	const schema = `{"paths": {"/items": {"post": {"requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object"}}}}, "responses": {"200": {"description": "ok", "content": {"text/plain": {"example": "%s"}}}}}}}}`
+
+	dir, err := ioutil.TempDir("", "instances")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".json"), []byte(strings.Replace(schema, "%s", name, 1)), 0644))
+	}
+
+	base := viper.New()
+	base.Set("host", "127.0.0.1")
+
+	instances := []Instance{
+		{Spec: filepath.Join(dir, "a.json")},
+		{Spec: filepath.Join(dir, "b.json"), Options: map[string]interface{}{"validate-request": true}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addrs, err := startInstances(ctx, base, instances)
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	assert.NotEqual(t, addrs[0], addrs[1])
+
+	// Each instance serves its own document with its own options.
+	for i, expected := range []int{http.StatusOK, http.StatusBadRequest} {
+		resp, err := http.Post("http://"+addrs[i]+"/items", "application/json", strings.NewReader(""))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expected, resp.StatusCode)
+	}
+
+	// The global configuration is left alone.
+	assert.False(t, base.GetBool("validate-request"))
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// jwk is a single key used to verify token signatures. The key is either an
+// `*rsa.PublicKey`, an `*ecdsa.PublicKey` or a `[]byte` HMAC secret.
+type jwk struct {
+	ID  string
+	Key interface{}
+}
+
+// jwtVerifier checks the signature and claims of JSON Web Tokens. Keys are
+// loaded on first use and reloaded when a token uses an unknown key ID, so
+// that key rotation on the identity provider is picked up. See `loadKeys`.
+type jwtVerifier struct {
+	load     func() ([]jwk, error)
+	issuer   string
+	audience string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	keys    []jwk
+	loaded  time.Time
+	loadErr error
+	loading chan struct{}
+}
+
+// jwtRefreshInterval is the minimum time between two loads of a verifier's
+// keys.
+const jwtRefreshInterval = time.Minute
+
+// newJWTVerifier creates a verifier for bearer tokens from the configured
+// JWKS or static key. Returns nil if token verification is not enabled.
+func newJWTVerifier(config *viper.Viper) *jwtVerifier {
+	jwks := config.GetString("jwt-jwks")
+	key := config.GetString("jwt-key")
+
+	if jwks == "" && key == "" {
+		return nil
+	}
+
+	return &jwtVerifier{
+		load: func() ([]jwk, error) {
+			if jwks != "" {
+				data, err := fetchKeys(config, jwks)
+				if err != nil {
+					return nil, err
+				}
+				return parseJWKS(data)
+			}
+
+			data, err := fetchKeys(config, key)
+			if err != nil {
+				return nil, err
+			}
+			return parseJWTKey(data)
+		},
+		issuer:   config.GetString("jwt-issuer"),
+		audience: config.GetString("jwt-audience"),
+		now:      time.Now,
+	}
+}
+
+// fetchKeys loads keys from an HTTP URL or a local file. Unlike API
+// documents, keys belong to an identity provider, so the credentials given
+// via `--header` and `--fetch-*` are never sent and keys are neither cached
+// on disk nor served from a stale copy.
+func fetchKeys(config *viper.Viper, uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		return fetchHTTP(config, uri, false, config.GetDuration("ref-timeout"))
+	}
+
+	return ioutil.ReadFile(uri)
+}
+
+// newOIDCVerifier creates a verifier for tokens issued by an OpenID Connect
+// provider. The discovery document is used to find the provider's JWKS and
+// issuer, which tokens must match unless `--jwt-issuer` is set. Both are
+// fetched on first use, without credentials, see `fetchKeys`.
+func newOIDCVerifier(config *viper.Viper, discovery string) *jwtVerifier {
+	v := &jwtVerifier{
+		issuer:   config.GetString("jwt-issuer"),
+		audience: config.GetString("jwt-audience"),
+		now:      time.Now,
+	}
+
+	v.load = func() ([]jwk, error) {
+		data, err := fetchKeys(config, discovery)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("Invalid discovery document: %v", err)
+		}
+		if doc.JWKSURI == "" {
+			return nil, errors.New("Discovery document has no jwks_uri")
+		}
+		// The discovery document may come from the network, so it must not
+		// be able to point at local files.
+		if !strings.HasPrefix(doc.JWKSURI, "http://") && !strings.HasPrefix(doc.JWKSURI, "https://") {
+			return nil, fmt.Errorf("Unsupported jwks_uri '%s', expected an http(s) URL", doc.JWKSURI)
+		}
+
+		data, err = fetchKeys(config, doc.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.GetString("jwt-issuer") == "" {
+			v.mu.Lock()
+			v.issuer = doc.Issuer
+			v.mu.Unlock()
+		}
+
+		return parseJWKS(data)
+	}
+
+	return v
+}
+
+// parseJWKS parses a JSON Web Key Set. Keys which aren't used for signatures
+// or have an unsupported type are skipped.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("Invalid JWKS: %v", err)
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JWKS key '%s': %v", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JWKS key '%s': %v", k.Kid, err)
+			}
+			keys = append(keys, jwk{ID: k.Kid, Key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}})
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JWKS key '%s': %v", k.Kid, err)
+			}
+			y, err := base64.RawURLEncoding.DecodeString(k.Y)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JWKS key '%s': %v", k.Kid, err)
+			}
+			keys = append(keys, jwk{ID: k.Kid, Key: &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}})
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JWKS key '%s': %v", k.Kid, err)
+			}
+			keys = append(keys, jwk{ID: k.Kid, Key: secret})
+		}
+	}
+
+	return keys, nil
+}
+
+// parseJWTKey parses a static verification key, which is either a PEM encoded
+// public key or certificate, or otherwise a raw HMAC secret.
+func parseJWTKey(data []byte) ([]jwk, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return []jwk{{Key: bytes.TrimSpace(data)}}, nil
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid key: %v", err)
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return []jwk{{Key: key}}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported key type %T", key)
+}
+
+// Verify checks a token's signature and its `exp`, `nbf`, `iss` and `aud`
+// claims, returning a `*TokenError` describing why the token was rejected.
+func (v *jwtVerifier) Verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return &TokenError{Reason: "malformed token"}
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return &TokenError{Reason: "malformed header"}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return &TokenError{Reason: "malformed signature"}
+	}
+
+	keys, err := v.keysFor(header.Kid)
+	if err != nil {
+		return &TokenError{Reason: err.Error()}
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		err = verifyJWTSignature(header.Alg, k.Key, signed, sig)
+		if err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		if err == nil {
+			err = errors.New("no keys available")
+		}
+		return &TokenError{Reason: err.Error()}
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return &TokenError{Reason: "malformed claims"}
+	}
+
+	return v.checkClaims(claims)
+}
+
+// keysFor returns the keys which may have signed a token with the given key
+// ID, reloading the keys if the ID isn't known. Reloads happen at most once
+// per `jwtRefreshInterval`, so tokens with made up key IDs can't make every
+// request fetch keys from the identity provider.
+func (v *jwtVerifier) keysFor(kid string) ([]jwk, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		keys, err := v.loadKeys(attempt > 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load keys: %v", err)
+		}
+
+		if kid == "" {
+			return keys, nil
+		}
+
+		for _, k := range keys {
+			if k.ID == kid {
+				return []jwk{k}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key ID '%s'", kid)
+}
+
+// loadKeys returns the current keys, loading them if they haven't been yet
+// or if a refresh is requested and the last load is older than
+// `jwtRefreshInterval`. Failed loads are retried after the same interval.
+// Keys are loaded without holding the lock, and concurrent callers wait for
+// the load already in progress instead of starting another one.
+func (v *jwtVerifier) loadKeys(refresh bool) ([]jwk, error) {
+	v.mu.Lock()
+
+	if done := v.loading; done != nil {
+		v.mu.Unlock()
+		<-done
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.currentKeys()
+	}
+
+	if !v.loaded.IsZero() && ((v.keys != nil && !refresh) || v.now().Sub(v.loaded) < jwtRefreshInterval) {
+		defer v.mu.Unlock()
+		return v.currentKeys()
+	}
+
+	done := make(chan struct{})
+	v.loading = done
+	v.mu.Unlock()
+
+	keys, err := v.load()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.loading = nil
+	v.loaded = v.now()
+	v.loadErr = err
+	if err == nil {
+		v.keys = keys
+	}
+	close(done)
+
+	return v.currentKeys()
+}
+
+// currentKeys returns the last loaded keys, or the error of the last load if
+// there are none. Must be called with the lock held.
+func (v *jwtVerifier) currentKeys() ([]jwk, error) {
+	if v.keys == nil && v.loadErr != nil {
+		return nil, v.loadErr
+	}
+	return v.keys, nil
+}
+
+// checkClaims validates the registered claims of a token.
+func (v *jwtVerifier) checkClaims(claims map[string]interface{}) error {
+	now := float64(v.now().Unix())
+
+	v.mu.Lock()
+	issuer := v.issuer
+	v.mu.Unlock()
+
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return &TokenError{Reason: "token is expired"}
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return &TokenError{Reason: "token is not valid yet"}
+	}
+
+	if issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != issuer {
+			return &TokenError{Reason: fmt.Sprintf("unexpected issuer '%s'", iss)}
+		}
+	}
+
+	if v.audience != "" {
+		found := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			found = aud == v.audience
+		case []interface{}:
+			for _, a := range aud {
+				if a == v.audience {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return &TokenError{Reason: "token is not for this audience"}
+		}
+	}
+
+	return nil
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a token.
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// verifyJWTSignature checks a signature using the given algorithm. The key
+// type must match the algorithm, so e.g. a public key can never be used as
+// an HMAC secret.
+func verifyJWTSignature(alg string, key interface{}, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch {
+	case len(alg) != 5:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	case strings.HasSuffix(alg, "256"):
+		hash = crypto.SHA256
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(alg, "512"):
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	invalid := errors.New("invalid signature")
+
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		secret, ok := key.([]byte)
+		if !ok {
+			return invalid
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return invalid
+		}
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalid
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return invalid
+		}
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return invalid
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+
+	return nil
+}
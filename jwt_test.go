@@ -0,0 +1,404 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT creates a signed token for testing.
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	hash := crypto.SHA256
+	digest := hash.New()
+	digest.Write([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest.Sum(nil))
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kid": "rsa",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kid": "ec",
+				"kty": "EC",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+			},
+			{
+				"kid": "hmac",
+				"kty": "oct",
+				"k":   base64.RawURLEncoding.EncodeToString([]byte("secret")),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	keys, err := parseJWKS(jwks)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+
+	now := time.Unix(1000, 0)
+	v := &jwtVerifier{
+		load:     func() ([]jwk, error) { return keys, nil },
+		issuer:   "https://issuer.example.com",
+		audience: "api",
+		now:      func() time.Time { return now },
+	}
+
+	valid := map[string]interface{}{
+		"iss": "https://issuer.example.com",
+		"aud": []string{"other", "api"},
+		"exp": 2000,
+	}
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"RSA", signJWT(t, "RS256", "rsa", rsaKey, valid), ""},
+		{"ECDSA", signJWT(t, "ES256", "ec", ecKey, valid), ""},
+		{"HMAC", signJWT(t, "HS256", "hmac", []byte("secret"), valid), ""},
+		{"No key ID", signJWT(t, "RS256", "", rsaKey, valid), ""},
+		{"Wrong key", signJWT(t, "RS256", "rsa", otherKey, valid), "invalid signature"},
+		{"Wrong secret", signJWT(t, "HS256", "hmac", []byte("guess"), valid), "invalid signature"},
+		{"Key type mismatch", signJWT(t, "HS256", "rsa", []byte("secret"), valid), "invalid signature"},
+		{"Unknown key ID", signJWT(t, "RS256", "missing", rsaKey, valid), "unknown key ID 'missing'"},
+		{"None algorithm", signJWT(t, "none", "", nil, valid), "unsupported algorithm 'none'"},
+		{"Expired", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": 500})), "token is expired"},
+		{"Not yet valid", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": 1500})), "token is not valid yet"},
+		{"Wrong issuer", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "evil"})), "unexpected issuer 'evil'"},
+		{"Wrong audience", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})), "token is not for this audience"},
+		{"Malformed", "abc", "malformed token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := v.Verify(test.token)
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				require.IsType(t, &TokenError{}, err)
+				assert.Equal(t, test.err, err.(*TokenError).Reason)
+			}
+		})
+	}
+}
+
+func TestJWTKeyRefresh(t *testing.T) {
+	var mu sync.Mutex
+	loads := 0
+	keys := []jwk{{ID: "old", Key: []byte("old")}}
+	release := make(chan struct{})
+	close(release)
+
+	now := time.Unix(1000, 0)
+	v := &jwtVerifier{
+		load: func() ([]jwk, error) {
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			loads++
+			return keys, nil
+		},
+		now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+	}
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return loads
+	}
+
+	token := signJWT(t, "HS256", "new", []byte("new"), map[string]interface{}{})
+
+	assert.NoError(t, v.Verify(signJWT(t, "HS256", "old", []byte("old"), map[string]interface{}{})))
+	assert.Equal(t, 1, count())
+
+	// The key was rotated, but the keys were just loaded.
+	mu.Lock()
+	keys = []jwk{{ID: "new", Key: []byte("new")}}
+	mu.Unlock()
+	for i := 0; i < 3; i++ {
+		assert.Error(t, v.Verify(token))
+	}
+	assert.Equal(t, 1, count())
+
+	// Concurrent requests share a single reload.
+	mu.Lock()
+	now = now.Add(jwtRefreshInterval)
+	mu.Unlock()
+	release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, v.Verify(token))
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 2, count())
+
+	// Unknown key IDs don't trigger another reload right away.
+	assert.Error(t, v.Verify(signJWT(t, "HS256", "other", []byte("other"), map[string]interface{}{})))
+	assert.Equal(t, 2, count())
+}
+
+func TestJWTBearerSecurity(t *testing.T) {
+	f, err := ioutil.TempFile("", "jwt-key")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("secret\n")
+	f.Close()
+
+	config := viper.New()
+	config.Set("validate-request", true)
+	config.Set("jwt-key", f.Name())
+	config.Set("jwt-audience", "api")
+
+	s := NewOpenAPIServer(config)
+	err = s.Load("file:///swagger.json", []byte(securitySchema))
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"Missing", "", http.StatusUnauthorized},
+		{"Not a JWT", "Bearer abc123", http.StatusUnauthorized},
+		{"Valid", "Bearer " + signJWT(t, "HS256", "", []byte("secret"), map[string]interface{}{"aud": "api", "exp": exp}), http.StatusNoContent},
+		{"Wrong audience", "Bearer " + signJWT(t, "HS256", "", []byte("secret"), map[string]interface{}{"aud": "web", "exp": exp}), http.StatusUnauthorized},
+		{"Expired", "Bearer " + signJWT(t, "HS256", "", []byte("secret"), map[string]interface{}{"aud": "api", "exp": 1}), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/global", nil)
+			require.NoError(t, err)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+func TestOIDCSecurity(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":   ts.URL,
+				"jwks_uri": ts.URL + "/jwks",
+			})
+		case "/jwks":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{
+					{"kid": "1", "kty": "oct", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	doc := `{
+		"components": {
+			"securitySchemes": {
+				"oidc": {"type": "openIdConnect", "openIdConnectUrl": "` + ts.URL + `/.well-known/openid-configuration"}
+			}
+		},
+		"security": [{"oidc": []}],
+		"paths": {
+			"/test": {
+				"get": {"responses": {"204": {"description": "ok"}}}
+			}
+		}
+	}`
+
+	config := viper.New()
+	config.Set("validate-request", true)
+
+	s := NewOpenAPIServer(config)
+	err := s.Load("file:///swagger.json", []byte(doc))
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"Missing", "", http.StatusUnauthorized},
+		{"Valid", "Bearer " + signJWT(t, "HS256", "1", []byte("secret"), map[string]interface{}{"iss": ts.URL, "exp": exp}), http.StatusNoContent},
+		{"Wrong issuer", "Bearer " + signJWT(t, "HS256", "1", []byte("secret"), map[string]interface{}{"iss": "evil", "exp": exp}), http.StatusUnauthorized},
+		{"Wrong key", "Bearer " + signJWT(t, "HS256", "1", []byte("guess"), map[string]interface{}{"iss": ts.URL, "exp": exp}), http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/test", nil)
+			require.NoError(t, err)
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+func TestJWTJWKSWithoutCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apisprout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("Authorization"))
+		assert.Empty(t, req.Header.Get("X-Api-Key"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kid": "1", "kty": "oct", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+			},
+		})
+	}))
+	defer ts.Close()
+
+	config := viper.New()
+	config.Set("jwt-jwks", ts.URL)
+	config.Set("fetch-bearer", "abc123")
+	config.Set("header", stringArray{"X-Api-Key: abc123"})
+	config.Set("cache-dir", dir)
+
+	v := newJWTVerifier(config)
+	err = v.Verify(signJWT(t, "HS256", "1", []byte("secret"), map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()}))
+	require.NoError(t, err)
+
+	// Keys must not end up in the document cache.
+	cached, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, cached)
+}
+
+func TestOIDCDiscoveryWithoutCredentials(t *testing.T) {
+	f, err := ioutil.TempFile("", "jwks")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	json.NewEncoder(f).Encode(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "1", "kty": "oct", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+		},
+	})
+	f.Close()
+
+	jwksURI := f.Name()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": jwksURI})
+	}))
+	defer ts.Close()
+
+	config := viper.New()
+	config.Set("fetch-bearer", "abc123")
+
+	token := signJWT(t, "HS256", "1", []byte("secret"), map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()})
+
+	// The discovery document must not point at local files.
+	err = newOIDCVerifier(config, ts.URL).Verify(token)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unsupported jwks_uri")
+
+	jwksURI = "file://" + f.Name()
+	err = newOIDCVerifier(config, ts.URL).Verify(token)
+	require.Error(t, err)
+}
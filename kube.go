@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// kubeServiceAccountDir contains the token, CA certificate and namespace of
+// the pod's service account.
+var kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeSource is a key within a ConfigMap, given as
+// `k8s://namespace/configmap/key`, or within a Secret, given as
+// `k8s://namespace/secrets/name/key`.
+type kubeSource struct {
+	Namespace string
+	Resource  string
+	Name      string
+	Key       string
+}
+
+// parseKubeSource parses a `k8s://` URI.
+func parseKubeSource(uri string) (*kubeSource, error) {
+	parts := strings.Split(strings.TrimPrefix(uri, "k8s://"), "/")
+
+	source := &kubeSource{Resource: "configmaps"}
+	switch {
+	case len(parts) == 3:
+		source.Namespace, source.Name, source.Key = parts[0], parts[1], parts[2]
+	case len(parts) == 4 && (parts[1] == "configmaps" || parts[1] == "secrets"):
+		source.Namespace, source.Resource, source.Name, source.Key = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return nil, fmt.Errorf("Invalid Kubernetes source '%s', expected k8s://namespace/configmap/key or k8s://namespace/secrets/name/key", uri)
+	}
+
+	if source.Namespace == "" || source.Name == "" || source.Key == "" {
+		return nil, fmt.Errorf("Invalid Kubernetes source '%s', expected k8s://namespace/configmap/key or k8s://namespace/secrets/name/key", uri)
+	}
+
+	return source, nil
+}
+
+// kubeObject is the part of a ConfigMap or Secret which holds documents.
+// Secret values and a ConfigMap's binary data are base64 encoded.
+type kubeObject struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data       map[string]string `json:"data"`
+	BinaryData map[string]string `json:"binaryData"`
+}
+
+// value returns the decoded value of a key.
+func (o *kubeObject) value(source *kubeSource) ([]byte, error) {
+	if v, ok := o.Data[source.Key]; ok {
+		if source.Resource == "secrets" {
+			return base64.StdEncoding.DecodeString(v)
+		}
+		return []byte(v), nil
+	}
+
+	if v, ok := o.BinaryData[source.Key]; ok {
+		return base64.StdEncoding.DecodeString(v)
+	}
+
+	return nil, fmt.Errorf("Key '%s' not found in %s %s/%s", source.Key, source.Resource, source.Namespace, source.Name)
+}
+
+// kubeClient talks to the Kubernetes API server using the pod's service
+// account.
+type kubeClient struct {
+	host   string
+	client *http.Client
+}
+
+// inClusterKube returns a client using the in-cluster configuration.
+func inClusterKube() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("Kubernetes sources require in-cluster credentials, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	pem, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %s", filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	}
+
+	return &kubeClient{
+		host: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// get sends a request for a ConfigMap or Secret. The token is read for each
+// request since it is rotated by the kubelet.
+func (c *kubeClient) get(ctx context.Context, source *kubeSource, query url.Values) (*http.Response, error) {
+	token, err := ioutil.ReadFile(filepath.Join(kubeServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/api/v1/namespaces/%s/%s", url.PathEscape(source.Namespace), source.Resource)
+	if query == nil {
+		path += "/" + url.PathEscape(source.Name)
+	} else {
+		path += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", c.host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err := fmt.Errorf("Unable to get %s %s/%s: %s", source.Resource, source.Namespace, source.Name, resp.Status)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, unreachableError{err}
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// fetchKube reads a document from a key of a ConfigMap or Secret, e.g.
+// `k8s://default/apis/openapi.yaml`.
+func fetchKube(config *viper.Viper, uri string) ([]byte, error) {
+	source, err := parseKubeSource(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := inClusterKube()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.get(context.Background(), source, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var obj kubeObject
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	return obj.value(source)
+}
+
+// watchKube watches the ConfigMap or Secret of a `k8s://` source and calls
+// changed whenever it is modified, until the context is done. The watch is
+// restarted with a backoff when it fails or the server closes it.
+func watchKube(ctx context.Context, uri string, changed func()) {
+	source, err := parseKubeSource(uri)
+	if err != nil {
+		log.Printf("ERROR: Unable to watch %s: %s", uri, err)
+		return
+	}
+
+	version := ""
+	delay := startupBackoff
+	for {
+		client, err := inClusterKube()
+		if err == nil {
+			var received bool
+			version, received, err = client.watch(ctx, source, version, changed)
+			if received {
+				delay = startupBackoff
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: Unable to watch %s, retrying in %s: %s", uri, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxStartupBackoff {
+			delay = maxStartupBackoff
+		}
+	}
+}
+
+// watch streams the events of a single watch request, returning the last
+// seen resource version and whether any events were received.
+func (c *kubeClient) watch(ctx context.Context, source *kubeSource, version string, changed func()) (string, bool, error) {
+	query := url.Values{
+		"watch":          []string{"true"},
+		"fieldSelector":  []string{"metadata.name=" + source.Name},
+		"timeoutSeconds": []string{"300"},
+	}
+	if version != "" {
+		query.Set("resourceVersion", version)
+	}
+
+	resp, err := c.get(ctx, source, query)
+	if err != nil {
+		return version, false, err
+	}
+	defer resp.Body.Close()
+
+	received := false
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string     `json:"type"`
+			Object kubeObject `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return version, received, nil
+			}
+			if err == io.EOF {
+				// The server closed the watch after its timeout.
+				return version, received, nil
+			}
+			return version, received, err
+		}
+		received = true
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			if event.Object.Metadata.ResourceVersion != version {
+				version = event.Object.Metadata.ResourceVersion
+				changed()
+			}
+		case "ERROR":
+			// The resource version is too old, so start over.
+			return "", received, nil
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKubeSource(t *testing.T) {
+	tests := []struct {
+		uri    string
+		source *kubeSource
+		err    bool
+	}{
+		{"k8s://default/apis/openapi.yaml", &kubeSource{Namespace: "default", Resource: "configmaps", Name: "apis", Key: "openapi.yaml"}, false},
+		{"k8s://default/configmaps/apis/openapi.yaml", &kubeSource{Namespace: "default", Resource: "configmaps", Name: "apis", Key: "openapi.yaml"}, false},
+		{"k8s://default/secrets/apis/openapi.yaml", &kubeSource{Namespace: "default", Resource: "secrets", Name: "apis", Key: "openapi.yaml"}, false},
+		{"k8s://default/apis", nil, true},
+		{"k8s://default//openapi.yaml", nil, true},
+		{"k8s://default/pods/apis/openapi.yaml", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			source, err := parseKubeSource(test.uri)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.source, source)
+		})
+	}
+}
+
+// withKubeCluster points the in-cluster configuration at a test server.
+func withKubeCluster(t *testing.T, handler http.HandlerFunc) func() {
+	srv := httptest.NewTLSServer(handler)
+
+	dir, err := ioutil.TempDir("", "serviceaccount")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("secret-token\n"), 0600))
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0600))
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	original := kubeServiceAccountDir
+	kubeServiceAccountDir = dir
+	os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	os.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	return func() {
+		srv.Close()
+		os.RemoveAll(dir)
+		kubeServiceAccountDir = original
+		os.Unsetenv("KUBERNETES_SERVICE_HOST")
+		os.Unsetenv("KUBERNETES_SERVICE_PORT")
+	}
+}
+
+func TestFetchKube(t *testing.T) {
+	done := withKubeCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/namespaces/default/configmaps/apis":
+			w.Write([]byte(`{"metadata": {"resourceVersion": "1"}, "data": {"openapi.yaml": "openapi: 3.0.0"}, "binaryData": {"openapi.json": "eyJvcGVuYXBpIjogIjMuMC4wIn0="}}`))
+		case "/api/v1/namespaces/default/secrets/apis":
+			w.Write([]byte(`{"metadata": {"resourceVersion": "1"}, "data": {"openapi.yaml": "b3BlbmFwaTogMy4wLjA="}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer done()
+
+	tests := []struct {
+		uri  string
+		data string
+		err  bool
+	}{
+		{"k8s://default/apis/openapi.yaml", "openapi: 3.0.0", false},
+		{"k8s://default/apis/openapi.json", `{"openapi": "3.0.0"}`, false},
+		{"k8s://default/secrets/apis/openapi.yaml", "openapi: 3.0.0", false},
+		{"k8s://default/apis/missing.yaml", "", true},
+		{"k8s://other/apis/openapi.yaml", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			data, err := fetchKube(viper.New(), test.uri)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.data, string(data))
+		})
+	}
+}
+
+func TestFetchKubeOutsideCluster(t *testing.T) {
+	_, err := fetchKube(viper.New(), "k8s://default/apis/openapi.yaml")
+	assert.Error(t, err)
+}
+
+func TestFetchKubeUncached(t *testing.T) {
+	done := withKubeCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"metadata": {"resourceVersion": "1"}, "data": {"openapi.yaml": "b3BlbmFwaTogMy4wLjA="}}`))
+	})
+	defer done()
+
+	dir, err := ioutil.TempDir("", "apisprout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := viper.New()
+	config.Set("cache-dir", dir)
+
+	data, err := fetch(config, "k8s://default/secrets/apis/openapi.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "openapi: 3.0.0", string(data))
+
+	// Secrets must never be written to disk.
+	cached, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, cached)
+
+	config.Set("offline", true)
+	_, err = fetch(config, "k8s://default/secrets/apis/openapi.yaml")
+	assert.Error(t, err)
+}
+
+func TestWatchKube(t *testing.T) {
+	done := withKubeCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("watch"))
+		assert.Equal(t, "metadata.name=apis", r.URL.Query().Get("fieldSelector"))
+
+		if r.URL.Query().Get("resourceVersion") == "2" {
+			// Keep the watch open without further changes.
+			<-r.Context().Done()
+			return
+		}
+
+		for _, version := range []string{"1", "1", "2"} {
+			fmt.Fprintf(w, `{"type": "MODIFIED", "object": {"metadata": {"resourceVersion": "%s"}}}`+"\n", version)
+			w.(http.Flusher).Flush()
+		}
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	go watchKube(ctx, "k8s://default/apis/openapi.yaml", func() {
+		changes <- struct{}{}
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a change")
+		}
+	}
+
+	select {
+	case <-changes:
+		t.Fatal("Unexpected change for the same resource version")
+	case <-time.After(700 * time.Millisecond):
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	swaggerType = reflect.TypeOf(openapi3.Swagger{})
+	schemaType  = reflect.TypeOf(openapi3.Schema{})
+	schemaRef   = reflect.TypeOf(openapi3.SchemaRef{})
+)
+
+// lenientDocument fixes common mistakes in a document which would otherwise
+// prevent it from being loaded, returning the fixed document as JSON along
+// with a warning for each change. Values of the wrong type are coerced where
+// possible, e.g. `maxLength: "10"` or `version: 1`, and dropped otherwise,
+// e.g. `required: true` on a schema. OpenAPI 3.1 style `type: [string, null]`
+// and numeric `exclusiveMinimum` are converted to their OpenAPI 3.0 form.
+func lenientDocument(data []byte) ([]byte, []string, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := &lenient{warnings: make([]string, 0)}
+	fixed, ok := l.fix(doc, swaggerType, "")
+	if !ok {
+		return nil, l.warnings, fmt.Errorf("Document is not an object")
+	}
+
+	result, err := json.Marshal(fixed)
+	return result, l.warnings, err
+}
+
+// lenient walks a generic document alongside the Go types it is loaded
+// into, fixing values which don't fit.
+type lenient struct {
+	warnings []string
+}
+
+func (l *lenient) warn(pointer, format string, args ...interface{}) {
+	if pointer == "" {
+		pointer = "/"
+	}
+	l.warnings = append(l.warnings, fmt.Sprintf("%s: %s", pointer, fmt.Sprintf(format, args...)))
+}
+
+// fix returns the value coerced to fit a type, or false if it should be
+// dropped.
+func (l *lenient) fix(value interface{}, t reflect.Type, pointer string) (interface{}, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return value, true
+	case reflect.Struct:
+		return l.fixStruct(value, t, pointer)
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			l.warn(pointer, "expected an object, dropping %s", describe(value))
+			return nil, false
+		}
+		for _, key := range sortedKeys(obj) {
+			if fixed, ok := l.fix(obj[key], t.Elem(), pointer+"/"+escapePointer(key)); ok {
+				obj[key] = fixed
+			} else {
+				delete(obj, key)
+			}
+		}
+		return obj, true
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			switch value.(type) {
+			case string, map[string]interface{}:
+				l.warn(pointer, "expected an array, wrapping %s", describe(value))
+				list = []interface{}{value}
+			default:
+				l.warn(pointer, "expected an array, dropping %s", describe(value))
+				return nil, false
+			}
+		}
+		result := make([]interface{}, 0, len(list))
+		for i, item := range list {
+			if fixed, ok := l.fix(item, t.Elem(), fmt.Sprintf("%s/%d", pointer, i)); ok {
+				result = append(result, fixed)
+			}
+		}
+		return result, true
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case float64, bool:
+			l.warn(pointer, "expected a string, converting %s", describe(value))
+			return fmt.Sprintf("%v", v), true
+		}
+	case reflect.Bool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				l.warn(pointer, "expected a boolean, converting %s", describe(value))
+				return b, true
+			}
+		}
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int64, reflect.Uint64:
+		n, ok := value.(float64)
+		if !ok {
+			s, isString := value.(string)
+			if !isString {
+				break
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				break
+			}
+			l.warn(pointer, "expected a number, converting %s", describe(value))
+			n = parsed
+		}
+		if t.Kind() == reflect.Uint64 && n < 0 {
+			break
+		}
+		if t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64 && n != float64(int64(n)) {
+			break
+		}
+		return n, true
+	}
+
+	l.warn(pointer, "expected %s, dropping %s", kindName(t.Kind()), describe(value))
+	return nil, false
+}
+
+// fixStruct fixes the fields of an object. References like `SchemaRef` are
+// kept as they are if they contain a `$ref`, otherwise their value is fixed.
+func (l *lenient) fixStruct(value interface{}, t reflect.Type, pointer string) (interface{}, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		l.warn(pointer, "expected an object, dropping %s", describe(value))
+		return nil, false
+	}
+
+	if t.NumField() == 2 && t.Field(0).Name == "Ref" && t.Field(1).Name == "Value" {
+		if _, ok := obj["$ref"]; ok {
+			return obj, true
+		}
+		return l.fix(obj, t.Field(1).Type, pointer)
+	}
+
+	if t == schemaType {
+		l.fixSchema(obj, pointer)
+	}
+
+	fields := structFields(t)
+	for _, key := range sortedKeys(obj) {
+		p := pointer + "/" + escapePointer(key)
+
+		if strings.HasPrefix(key, "x-") {
+			continue
+		}
+
+		if t == schemaType && key == "additionalProperties" {
+			if _, ok := obj[key].(bool); ok {
+				continue
+			}
+			if fixed, ok := l.fix(obj[key], schemaRef, p); ok {
+				obj[key] = fixed
+			} else {
+				delete(obj, key)
+			}
+			continue
+		}
+
+		// Unknown keywords are ignored when loading, so they can stay.
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		if fixed, ok := l.fix(obj[key], field, p); ok {
+			obj[key] = fixed
+		} else {
+			delete(obj, key)
+		}
+	}
+
+	return obj, true
+}
+
+// fixSchema converts JSON Schema features from OpenAPI 3.1 which have an
+// equivalent in OpenAPI 3.0.
+func (l *lenient) fixSchema(obj map[string]interface{}, pointer string) {
+	if types, ok := obj["type"].([]interface{}); ok {
+		chosen := ""
+		for _, t := range types {
+			if s, ok := t.(string); ok {
+				if s == "null" {
+					obj["nullable"] = true
+				} else if chosen == "" {
+					chosen = s
+				}
+			}
+		}
+		l.warn(pointer+"/type", "expected a string, using '%s' from %s", chosen, describe(obj["type"]))
+		if chosen == "" {
+			delete(obj, "type")
+		} else {
+			obj["type"] = chosen
+		}
+	}
+
+	for key, limit := range map[string]string{"exclusiveMinimum": "minimum", "exclusiveMaximum": "maximum"} {
+		if n, ok := obj[key].(float64); ok {
+			l.warn(pointer+"/"+key, "expected a boolean, moving %v to %s", n, limit)
+			obj[limit] = n
+			obj[key] = true
+		}
+	}
+}
+
+// structFields returns the types of a struct's fields by their JSON name.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			tag = f.Tag.Get("multijson")
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// sortedKeys returns the keys of an object in order, so warnings are
+// reported in a stable order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// describe returns a short description of a generic JSON value for
+// warnings.
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// kindName returns the JSON name of a scalar kind for warnings.
+func kindName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Uint64:
+		return "a non-negative integer"
+	}
+	return "a number"
+}
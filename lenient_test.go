@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lenientDoc = `
+openapi: 3.0.0
+info:
+  title: Lenient
+  version: 1
+paths:
+  /items:
+    get:
+      tags: items
+      responses:
+        200:
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: object
+                required: true
+                x-internal: true
+                properties:
+                  name:
+                    type: [string, "null"]
+                    maxLength: "5"
+                    description: 5
+                  count:
+                    type: integer
+                    exclusiveMinimum: 0
+                    minLength: -1
+`
+
+func TestLenientDocument(t *testing.T) {
+	fixed, warnings, err := lenientDocument([]byte(lenientDoc))
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(fixed, &doc))
+
+	op := asObject(asObject(asObject(doc["paths"])["/items"])["get"])
+	schema := asObject(asObject(asObject(asObject(asObject(op["responses"])["200"])["content"])["application/json"])["schema"])
+	properties := asObject(schema["properties"])
+
+	tests := []struct {
+		name     string
+		actual   interface{}
+		expected interface{}
+	}{
+		{"Version", asObject(doc["info"])["version"], "1"},
+		{"Tags", op["tags"], []interface{}{"items"}},
+		{"Required", schema["required"], nil},
+		{"Extension", schema["x-internal"], true},
+		{"Type", asObject(properties["name"])["type"], "string"},
+		{"Nullable", asObject(properties["name"])["nullable"], true},
+		{"MaxLength", asObject(properties["name"])["maxLength"], 5.0},
+		{"Description", asObject(properties["name"])["description"], "5"},
+		{"Minimum", asObject(properties["count"])["minimum"], 0.0},
+		{"ExclusiveMinimum", asObject(properties["count"])["exclusiveMinimum"], true},
+		{"MinLength", asObject(properties["count"])["minLength"], nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.actual)
+		})
+	}
+
+	assert.Contains(t, warnings, "/info/version: expected a string, converting 1")
+	assert.Contains(t, warnings, "/paths/~1items/get/responses/200/content/application~1json/schema/required: expected an array, dropping true")
+	assert.Contains(t, warnings, "/paths/~1items/get/responses/200/content/application~1json/schema/properties/count/minLength: expected a non-negative integer, dropping -1")
+}
+
+func TestLoadLenient(t *testing.T) {
+	_, _, err := load(viper.New(), "openapi.yaml", []byte(lenientDoc))
+	assert.Error(t, err)
+
+	config := viper.New()
+	config.Set("lenient", true)
+	swagger, _, err := load(config, "openapi.yaml", []byte(lenientDoc))
+	require.NoError(t, err)
+	assert.Equal(t, "1", swagger.Info.Version)
+	assert.True(t, swagger.Paths["/items"].Get.Responses["200"].Value.Content["application/json"].Schema.Value.Properties["name"].Value.Nullable)
+}
+
+func TestLenientDocumentErrors(t *testing.T) {
+	_, _, err := lenientDocument([]byte(`[]`))
+	assert.Error(t, err)
+
+	_, _, err = lenientDocument([]byte(`{`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// limitConcurrency bounds the number of requests handled at the same time to
+// `--max-concurrent`, answering any above the limit right away with a `503`
+// rather than queueing them. This keeps e.g. a runaway load test combined with
+// delays or large generated responses from exhausting memory. Health checks
+// are never limited so a busy server isn't mistaken for a broken one.
+func limitConcurrency(config *viper.Viper, handler http.Handler) http.Handler {
+	max := config.GetInt("max-concurrent")
+	if max <= 0 {
+		return handler
+	}
+
+	slots := make(chan struct{}, max)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		current := currentConfig(config)
+		if isProbePath(current, req.URL.Path) {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			handler.ServeHTTP(w, req)
+		default:
+			if retryAfter := retryAfterSeconds(current); retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			}
+			http.Error(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// retryAfterSeconds returns the configured `Retry-After` value for `429` and
+// `503` responses, where zero means the header isn't sent.
+func retryAfterSeconds(config *viper.Viper) int {
+	if config.IsSet("retry-after") {
+		return config.GetInt("retry-after")
+	}
+	return 1
+}
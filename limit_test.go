@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        int
+		retryAfter interface{}
+		path       string
+		status     int
+		header     string
+	}{
+		{"Unlimited", 0, nil, "/test", http.StatusOK, ""},
+		{"Limited", 1, nil, "/test", http.StatusServiceUnavailable, "1"},
+		{"Custom retry", 1, 30, "/test", http.StatusServiceUnavailable, "30"},
+		{"No retry", 1, 0, "/test", http.StatusServiceUnavailable, ""},
+		{"Health", 1, nil, "/v1/__health", http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("max-concurrent", test.max)
+			if test.retryAfter != nil {
+				config.Set("retry-after", test.retryAfter)
+			}
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			handler := limitConcurrency(config, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/slow" {
+					close(started)
+					<-release
+				}
+			}))
+
+			// Keep one request in flight while sending another.
+			done := make(chan struct{})
+			go func() {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+				close(done)
+			}()
+			<-started
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("GET", test.path, nil))
+			assert.Equal(t, test.status, resp.Code)
+			assert.Equal(t, test.header, resp.Header().Get("Retry-After"))
+
+			close(release)
+			<-done
+
+			// Slots are freed once requests finish.
+			resp = httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("GET", test.path, nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+		})
+	}
+}
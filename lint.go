@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// LintIssue describes a problem found with an example in the document.
+type LintIssue struct {
+	Operation string
+	Location  string
+	Pointer   string
+	Message   string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s %s at \"%s\": %s", i.Operation, i.Location, i.Pointer, i.Message)
+}
+
+// lintExamples looks for declared examples which have drifted from their
+// schema, e.g. values that are no longer part of an enum. Serving these
+// breaks strictly-typed clients at runtime.
+func lintExamples(swagger *openapi3.Swagger) []LintIssue {
+	issues := make([]LintIssue, 0)
+
+	for path, item := range swagger.Paths {
+		for method, op := range item.Operations() {
+			operation := fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				for mediatype, mt := range op.RequestBody.Value.Content {
+					issues = append(issues, lintMediaType(operation, "request "+mediatype, mt)...)
+				}
+			}
+
+			for status, response := range op.Responses {
+				if response.Value == nil {
+					continue
+				}
+
+				for mediatype, mt := range response.Value.Content {
+					issues = append(issues, lintMediaType(operation, status+" "+mediatype, mt)...)
+				}
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].String() < issues[j].String()
+	})
+
+	return issues
+}
+
+// lintMediaType checks the media type's examples as well as any examples
+// declared within its schema.
+func lintMediaType(operation, location string, mt *openapi3.MediaType) []LintIssue {
+	if mt.Schema == nil || mt.Schema.Value == nil {
+		return nil
+	}
+
+	issues := make([]LintIssue, 0)
+	report := func(location string) func(pointer []string, message string) {
+		return func(pointer []string, message string) {
+			issues = append(issues, LintIssue{
+				Operation: operation,
+				Location:  location,
+				Pointer:   "/" + strings.Join(pointer, "/"),
+				Message:   message,
+			})
+		}
+	}
+
+	if mt.Example != nil {
+		lintEnums(mt.Schema.Value, mt.Example, nil, report(location))
+	}
+
+	names := make([]string, 0, len(mt.Examples))
+	for name := range mt.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ex := mt.Examples[name]; ex != nil && ex.Value != nil && ex.Value.Value != nil {
+			lintEnums(mt.Schema.Value, ex.Value.Value, nil, report(fmt.Sprintf("%s example '%s'", location, name)))
+		}
+	}
+
+	lintSchemaExamples(mt.Schema.Value, nil, make(map[*openapi3.Schema]bool), report(location+" schema"))
+
+	return issues
+}
+
+// lintSchemaExamples checks the `example` of a schema and its children, which
+// are used when generating responses.
+func lintSchemaExamples(schema *openapi3.Schema, pointer []string, seen map[*openapi3.Schema]bool, report func([]string, string)) {
+	if schema == nil || seen[schema] {
+		return
+	}
+	seen[schema] = true
+
+	if schema.Example != nil {
+		lintEnums(schema, schema.Example, pointer, report)
+	}
+
+	for _, ref := range schema.AllOf {
+		lintSchemaExamples(ref.Value, pointer, seen, report)
+	}
+
+	if schema.Items != nil {
+		lintSchemaExamples(schema.Items.Value, append(append([]string{}, pointer...), "items"), seen, report)
+	}
+
+	for name, prop := range schema.Properties {
+		lintSchemaExamples(prop.Value, append(append([]string{}, pointer...), "properties", name), seen, report)
+	}
+}
+
+// lintEnums reports values within an example which are not one of the values
+// allowed by the schema's enum.
+func lintEnums(schema *openapi3.Schema, value interface{}, pointer []string, report func([]string, string)) {
+	if schema == nil {
+		return
+	}
+
+	if len(schema.Enum) > 0 && !enumContains(schema.Enum, value) {
+		report(pointer, fmt.Sprintf("%v is not one of %v", value, schema.Enum))
+	}
+
+	// Every `allOf` schema must match, so each of their enums apply.
+	for _, ref := range schema.AllOf {
+		lintEnums(ref.Value, value, pointer, report)
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range v {
+				lintEnums(schema.Items.Value, item, append(append([]string{}, pointer...), fmt.Sprintf("%d", i)), report)
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			child := append(append([]string{}, pointer...), k)
+			if prop, ok := schema.Properties[k]; ok {
+				lintEnums(prop.Value, v[k], child, report)
+			} else if schema.AdditionalProperties != nil {
+				lintEnums(schema.AdditionalProperties.Value, v[k], child, report)
+			}
+		}
+	}
+}
+
+// enumContains returns whether the value is one of the enum values.
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, item := range enum {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lint loads an OpenAPI file and reports examples which don't match their
+// schema, exiting with an error if any are found.
+func lint(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	swagger, _, err := load(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	issues := lintExamples(swagger)
+	for _, issue := range issues {
+		fmt.Println("• " + issue.String())
+	}
+
+	if len(issues) > 0 {
+		fmt.Printf("❌ Found %d stale example value(s)\n", len(issues))
+		os.Exit(1)
+	}
+
+	fmt.Println("✅ All examples match their schema enums")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintExamples(t *testing.T) {
+	swagger, _, err := load(viper.New(), "file:///swagger.json", []byte(`{
+		"components": {
+			"schemas": {
+				"Status": {"type": "string", "enum": ["available", "pending"]},
+				"Pet": {
+					"type": "object",
+					"properties": {
+						"status": {"$ref": "#/components/schemas/Status"},
+						"tags": {
+							"type": "array",
+							"items": {"type": "string", "enum": ["dog", "cat"], "example": "bird"}
+						}
+					}
+				}
+			}
+		},
+		"paths": {
+			"/pets": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"schema": {
+										"type": "array",
+										"items": {"$ref": "#/components/schemas/Pet"}
+									},
+									"example": [
+										{"status": "available", "tags": ["dog"]},
+										{"status": "sold", "tags": ["cat", "fish"]}
+									]
+								}
+							}
+						}
+					}
+				},
+				"post": {
+					"requestBody": {
+						"content": {
+							"application/json": {
+								"schema": {"$ref": "#/components/schemas/Pet"},
+								"examples": {
+									"good": {"value": {"status": "pending"}},
+									"stale": {"value": {"status": "adopted"}}
+								}
+							}
+						}
+					},
+					"responses": {
+						"204": {"description": "ok"}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	issues := lintExamples(swagger)
+
+	messages := make([]string, len(issues))
+	for i, issue := range issues {
+		messages[i] = issue.String()
+	}
+
+	assert.Equal(t, []string{
+		`GET /pets 200 application/json at "/1/status": sold is not one of [available pending]`,
+		`GET /pets 200 application/json at "/1/tags/1": fish is not one of [dog cat]`,
+		`GET /pets 200 application/json schema at "/items/properties/tags/items": bird is not one of [dog cat]`,
+		`POST /pets request application/json example 'stale' at "/status": adopted is not one of [available pending]`,
+		`POST /pets request application/json schema at "/properties/tags/items": bird is not one of [dog cat]`,
+	}, messages)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/spf13/viper"
+)
+
+// Log verbosity levels set via `--quiet` and `-v`, `-vv`, etc.
+const (
+	logQuiet = iota - 1
+	logNormal
+	logVerbose
+	logDebug
+)
+
+// logLevel returns the configured log verbosity.
+func logLevel(config *viper.Viper) int {
+	if config.GetBool("quiet") {
+		return logQuiet
+	}
+
+	return logNormal + config.GetInt("verbose")
+}
+
+// logf logs a message when the configured verbosity is at least the given
+// level. Errors and warnings are always logged using `log.Printf` instead.
+func (s *OpenAPIServer) logf(level int, format string, args ...interface{}) {
+	if logLevel(s.settings()) >= level {
+		log.Printf(format, args...)
+	}
+}
+
+// requestLogger logs lines about a single request with structured fields
+// like `operation_id=listItems` appended, so log aggregators can filter them
+// per endpoint.
+type requestLogger struct {
+	s      *OpenAPIServer
+	fields string
+}
+
+// requestLogger returns a logger for a request. The operation ID and route
+// template are only known once a route has been found.
+func (s *OpenAPIServer) requestLogger(req *http.Request, route *openapi3filter.Route) *requestLogger {
+	fields := ""
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		fields += " " + key + "=" + value
+	}
+
+	add("request_id", req.Header.Get("X-Request-Id"))
+	if route != nil {
+		if route.Operation != nil {
+			add("operation_id", route.Operation.OperationID)
+		}
+		add("route", route.Path)
+	}
+
+	return &requestLogger{s: s, fields: fields}
+}
+
+// printf always logs a message, e.g. an error or warning.
+func (l *requestLogger) printf(format string, args ...interface{}) {
+	log.Printf(format+"%s", append(args, l.fields)...)
+}
+
+// logf logs a message when the configured verbosity is at least the given
+// level.
+func (l *requestLogger) logf(level int, format string, args ...interface{}) {
+	if logLevel(l.s.settings()) >= level {
+		l.printf(format, args...)
+	}
+}
+
+// exampleNameKey is the context key of where to record the name of the
+// example chosen for a response, if any, e.g. to log it.
+type exampleNameKey struct{}
+
+// withExampleName returns a context which records the name of the chosen
+// example in the given string.
+func withExampleName(ctx context.Context, name *string) context.Context {
+	return context.WithValue(ctx, exampleNameKey{}, name)
+}
+
+// recordExampleName records the name of the chosen example, if asked to.
+func recordExampleName(ctx context.Context, name string) {
+	if target, ok := ctx.Value(exampleNameKey{}).(*string); ok {
+		*target = name
+	}
+}
+
+// sortedHeaderNames returns the names of the headers in alphabetical order.
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevels(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items": {
+				"post": {
+					"operationId": "createItem",
+					"requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object"}}}},
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {"examples": {"first": {"value": {"id": 1}}}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		quiet    bool
+		verbose  int
+		body     string
+		logged   []string
+		unlogged []string
+	}{
+		{"Normal", false, 0, "{}", []string{"(createItem) => 200"}, []string{"Chose example", "Header"}},
+		{"Quiet", true, 0, "{}", nil, []string{"(createItem) => 200"}},
+		{"Quiet errors", true, 0, "", []string{"ERROR:"}, []string{"Validation detail"}},
+		{"Verbose", false, 1, "{}", []string{"Negotiated application/json for status 200", "Chose example first"}, []string{"Header"}},
+		{"Verbose errors", false, 1, "", []string{"ERROR:", "Validation detail"}, nil},
+		{"Debug", false, 2, "{}", []string{"Header Content-Type: application/json", "Chose example first"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			config := viper.New()
+			config.Set("validate-request", true)
+			config.Set("quiet", test.quiet)
+			config.Set("verbose", test.verbose)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req := httptest.NewRequest("POST", "/items", bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Content-Type", "application/json")
+			s.ServeHTTP(httptest.NewRecorder(), req)
+
+			for _, expected := range test.logged {
+				assert.Contains(t, buf.String(), expected)
+			}
+			for _, unexpected := range test.unlogged {
+				assert.NotContains(t, buf.String(), unexpected)
+			}
+		})
+	}
+}
+
+func TestRequestLogFields(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items/{id}": {
+				"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+				"get": {
+					"operationId": "getItem",
+					"responses": {"200": {"description": "ok", "content": {"application/json": {"example": {"id": 1}}}}}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name   string
+		path   string
+		id     string
+		logged []string
+	}{
+		{"Served", "/items/1", "abc", []string{`GET /items/1 (getItem) => 200 (application/json) request_id=abc operation_id=getItem route=/items/{id}`}},
+		{"Validation error", "/items/x", "", []string{`ERROR: GET /items/x => Parameter 'id' in path has an error`, `operation_id=getItem route=/items/{id}`}},
+		{"Quoted", "/items/1", "a b", []string{`request_id="a b" operation_id=getItem`}},
+		{"Unmatched", "/missing", "abc", []string{`ERROR: GET /missing => Path was not found request_id=abc`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			config := viper.New()
+			config.Set("validate-request", true)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req := httptest.NewRequest("GET", test.path, nil)
+			if test.id != "" {
+				req.Header.Set("X-Request-Id", test.id)
+			}
+			s.ServeHTTP(httptest.NewRecorder(), req)
+
+			for _, expected := range test.logged {
+				assert.Contains(t, buf.String(), expected)
+			}
+		})
+	}
+}
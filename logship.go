@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLog is a structured log entry describing a single request.
+type AccessLog struct {
+	Time        time.Time `json:"@timestamp"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	OperationID string    `json:"operation_id,omitempty"`
+	Status      int       `json:"status"`
+	DurationMS  float64   `json:"duration_ms"`
+}
+
+// accessLogWriter records the response status and matched operation of a
+// request so that it can be logged once the request has been served.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status      int
+	operationID string
+	timings     *requestTimings
+}
+
+// accessLogKey is the context key of the access log writer of a request, so
+// it is found even if middleware wrapped the response writer.
+type accessLogKey struct{}
+
+// accessLogFor returns the access log writer of a request, if any.
+func accessLogFor(req *http.Request) *accessLogWriter {
+	lw, _ := req.Context().Value(accessLogKey{}).(*accessLogWriter)
+	return lw
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush allows streamed responses to be flushed through the wrapper.
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack allows WebSocket connections to be upgraded through the wrapper.
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Response writer can't be hijacked")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// logShipper pushes access logs in batches to a log aggregation service via
+// HTTP, so mocks running in shared environments don't need a sidecar to
+// collect their logs. Supported formats are `loki` and `opensearch`.
+type logShipper struct {
+	url      string
+	format   string
+	interval time.Duration
+	client   *http.Client
+	entries  chan AccessLog
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newLogShipper creates a shipper and starts pushing logs in the background.
+func newLogShipper(url, format string, interval time.Duration) (*logShipper, error) {
+	if format == "" {
+		format = "loki"
+	}
+
+	if format != "loki" && format != "opensearch" {
+		return nil, fmt.Errorf("Unknown log push format '%s'", format)
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ls := &logShipper{
+		url:      url,
+		format:   format,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		entries:  make(chan AccessLog, 1000),
+		done:     make(chan struct{}),
+	}
+
+	go ls.run()
+
+	return ls, nil
+}
+
+// Log queues an entry to be pushed. Entries are dropped rather than blocking
+// the request if the aggregation service can't keep up.
+func (ls *logShipper) Log(entry AccessLog) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if ls.closed {
+		return
+	}
+
+	select {
+	case ls.entries <- entry:
+	default:
+		log.Printf("WARNING: Log push queue is full, dropping entry")
+	}
+}
+
+// Close pushes any queued entries and stops the shipper.
+func (ls *logShipper) Close() {
+	ls.mu.Lock()
+	if !ls.closed {
+		ls.closed = true
+		close(ls.entries)
+	}
+	ls.mu.Unlock()
+
+	<-ls.done
+}
+
+func (ls *logShipper) run() {
+	defer close(ls.done)
+
+	ticker := time.NewTicker(ls.interval)
+	defer ticker.Stop()
+
+	batch := make([]AccessLog, 0)
+	for {
+		select {
+		case entry, ok := <-ls.entries:
+			if !ok {
+				ls.push(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= 100 {
+				ls.push(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			ls.push(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// push sends a batch of entries, logging rather than retrying on failure.
+func (ls *logShipper) push(batch []AccessLog) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var body []byte
+	var contentType string
+	var err error
+
+	switch ls.format {
+	case "loki":
+		body, err = lokiPayload(batch)
+		contentType = "application/json"
+	case "opensearch":
+		body, err = openSearchPayload(batch)
+		contentType = "application/x-ndjson"
+	}
+
+	if err != nil {
+		log.Printf("ERROR: Unable to encode logs: %v", err)
+		return
+	}
+
+	resp, err := ls.client.Post(ls.url, contentType, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("ERROR: Unable to push logs: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("ERROR: Unable to push logs: %s", resp.Status)
+	}
+}
+
+// lokiPayload creates a Loki push API request body. Entries are grouped into
+// streams labeled by their operation and status.
+func lokiPayload(batch []AccessLog) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	streams := make([]*stream, 0)
+	byLabels := make(map[string]*stream)
+
+	for _, entry := range batch {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		key := entry.OperationID + " " + strconv.Itoa(entry.Status)
+		st, ok := byLabels[key]
+		if !ok {
+			st = &stream{
+				Stream: map[string]string{
+					"job":          "apisprout",
+					"operation_id": entry.OperationID,
+					"status":       strconv.Itoa(entry.Status),
+				},
+				Values: make([][2]string, 0),
+			}
+			byLabels[key] = st
+			streams = append(streams, st)
+		}
+
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), string(line)})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"streams": streams,
+	})
+}
+
+// openSearchPayload creates an OpenSearch (or Elasticsearch) bulk API request
+// body. The index is expected to be part of the push URL.
+func openSearchPayload(batch []AccessLog) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, entry := range batch {
+		doc, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteString("{\"index\":{}}\n")
+		buf.Write(doc)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogPush(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"operationId": "getTest",
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {"example": {"hello": "world"}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		format      string
+		contentType string
+		check       func(t *testing.T, body string)
+	}{
+		{
+			format:      "loki",
+			contentType: "application/json",
+			check: func(t *testing.T, body string) {
+				var payload struct {
+					Streams []struct {
+						Stream map[string]string `json:"stream"`
+						Values [][2]string       `json:"values"`
+					} `json:"streams"`
+				}
+				require.NoError(t, json.Unmarshal([]byte(body), &payload))
+				require.Len(t, payload.Streams, 2)
+
+				assert.Equal(t, "getTest", payload.Streams[0].Stream["operation_id"])
+				assert.Equal(t, "200", payload.Streams[0].Stream["status"])
+				require.Len(t, payload.Streams[0].Values, 2)
+				assert.Contains(t, payload.Streams[0].Values[0][1], `"request_id":"abc123"`)
+
+				assert.Equal(t, "", payload.Streams[1].Stream["operation_id"])
+				assert.Equal(t, "404", payload.Streams[1].Stream["status"])
+			},
+		},
+		{
+			format:      "opensearch",
+			contentType: "application/x-ndjson",
+			check: func(t *testing.T, body string) {
+				lines := strings.Split(strings.TrimSpace(body), "\n")
+				require.Len(t, lines, 6)
+
+				var entry AccessLog
+				assert.Equal(t, `{"index":{}}`, lines[0])
+				require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+				assert.Equal(t, "GET", entry.Method)
+				assert.Equal(t, "/test", entry.Path)
+				assert.Equal(t, "getTest", entry.OperationID)
+				assert.Equal(t, http.StatusOK, entry.Status)
+
+				require.NoError(t, json.Unmarshal([]byte(lines[5]), &entry))
+				assert.Equal(t, http.StatusNotFound, entry.Status)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var mu sync.Mutex
+			bodies := make([]string, 0)
+
+			collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, test.contentType, r.Header.Get("Content-Type"))
+				body, _ := ioutil.ReadAll(r.Body)
+				mu.Lock()
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer collector.Close()
+
+			config := viper.New()
+			config.Set("log-push-url", collector.URL)
+			config.Set("log-push-format", test.format)
+			config.Set("log-push-interval", time.Minute)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			for _, path := range []string{"/test", "/test", "/missing"} {
+				req, err := http.NewRequest("GET", path, nil)
+				require.NoError(t, err)
+				req.Header.Set("X-Request-Id", "abc123")
+				s.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			// Closing pushes the remaining batch.
+			s.logs.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Len(t, bodies, 1)
+			test.check(t, bodies[0])
+		})
+	}
+}
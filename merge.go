@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// pathItemMethods are the keys of a path item which describe operations.
+var pathItemMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// mergeDocuments combines several partial documents describing the same API
+// into one. Paths, operations and components are combined, while `servers`,
+// `tags` and `security` are concatenated without duplicates. Other top-level
+// fields like `info` are taken from the first document which has them.
+// Declaring the same operation more than once, or a component or path item
+// field differently, is reported as a conflict. The result is YAML if the
+// first document is a YAML file, otherwise JSON.
+func mergeDocuments(uris []string, docs [][]byte) ([]byte, error) {
+	merged := make(map[string]interface{})
+	// Which document each value came from, keyed by JSON pointer.
+	origins := make(map[string]string)
+	conflicts := make([]MergeConflict, 0)
+
+	// set adds a value to a map unless another document already declared
+	// something different there.
+	set := func(m map[string]interface{}, key string, value interface{}, pointer, uri string, always bool) {
+		existing, ok := m[key]
+		if !ok {
+			m[key] = value
+			origins[pointer] = uri
+			return
+		}
+
+		if always || !reflect.DeepEqual(existing, value) {
+			conflicts = append(conflicts, MergeConflict{Pointer: pointer, URIs: []string{origins[pointer], uri}})
+		}
+	}
+
+	for i, data := range docs {
+		uri := uris[i]
+
+		converted, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(converted, &doc); err != nil {
+			return nil, err
+		}
+
+		keys := make([]string, 0, len(doc))
+		for key := range doc {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := doc[key]
+
+			switch key {
+			case "paths":
+				paths := objectField(merged, key)
+				for path, item := range asObject(value) {
+					pointer := "/paths/" + escapePointer(path)
+					target := objectField(paths, path)
+					for field, v := range asObject(item) {
+						set(target, field, v, pointer+"/"+escapePointer(field), uri, pathItemMethods[field])
+					}
+				}
+			case "components":
+				components := objectField(merged, key)
+				for section, entries := range asObject(value) {
+					target := objectField(components, section)
+					for name, v := range asObject(entries) {
+						set(target, name, v, "/components/"+escapePointer(section)+"/"+escapePointer(name), uri, false)
+					}
+				}
+			case "servers", "security":
+				merged[key] = appendUnique(merged[key], value, func(a, b interface{}) bool {
+					return reflect.DeepEqual(a, b)
+				})
+			case "tags":
+				merged[key] = appendUnique(merged[key], value, func(a, b interface{}) bool {
+					return asObject(a)["name"] == asObject(b)["name"]
+				})
+			default:
+				if _, ok := merged[key]; !ok {
+					merged[key] = value
+				}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Slice(conflicts, func(i, j int) bool {
+			return conflicts[i].Pointer < conflicts[j].Pointer
+		})
+		return nil, &MergeError{Conflicts: conflicts}
+	}
+
+	if len(uris) > 0 {
+		switch strings.ToLower(filepath.Ext(uris[0])) {
+		case ".yaml", ".yml":
+			return yaml.Marshal(merged)
+		}
+	}
+
+	return json.Marshal(merged)
+}
+
+// asObject returns a value as a JSON object, or nil if it isn't one.
+func asObject(value interface{}) map[string]interface{} {
+	obj, _ := value.(map[string]interface{})
+	return obj
+}
+
+// objectField returns the object stored under a key, creating it if needed.
+func objectField(m map[string]interface{}, key string) map[string]interface{} {
+	obj := asObject(m[key])
+	if obj == nil {
+		obj = make(map[string]interface{})
+		m[key] = obj
+	}
+	return obj
+}
+
+// appendUnique appends the items of one JSON array to another, skipping
+// items which are already present.
+func appendUnique(existing, items interface{}, equal func(a, b interface{}) bool) []interface{} {
+	result, _ := existing.([]interface{})
+	list, _ := items.([]interface{})
+
+outer:
+	for _, item := range list {
+		for _, other := range result {
+			if equal(item, other) {
+				continue outer
+			}
+		}
+		result = append(result, item)
+	}
+
+	return result
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const usersFragment = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: "1.0"
+tags:
+  - name: users
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Page"
+components:
+  schemas:
+    Page:
+      type: object
+      properties:
+        total:
+          type: integer
+          example: 5
+`
+
+const paymentsFragment = `{
+	"openapi": "3.0.0",
+	"info": {"title": "Payments", "version": "2.0"},
+	"tags": [{"name": "users"}, {"name": "payments"}],
+	"paths": {
+		"/users": {
+			"post": {"responses": {"201": {"description": "created"}}}
+		},
+		"/payments": {
+			"get": {
+				"responses": {
+					"200": {
+						"description": "ok",
+						"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Page"}}}
+					}
+				}
+			}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Page": {"type": "object", "properties": {"total": {"type": "integer", "example": 5}}}
+		}
+	}
+}`
+
+func TestMergeDocuments(t *testing.T) {
+	data, err := mergeDocuments([]string{"users.yaml", "payments.json"}, [][]byte{[]byte(usersFragment), []byte(paymentsFragment)})
+	require.NoError(t, err)
+
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.Load("file:///users.yaml", data))
+
+	swagger := s.Swagger()
+	assert.Equal(t, "Shop", swagger.Info.Title)
+	assert.NotNil(t, swagger.Paths["/users"].Get)
+	assert.NotNil(t, swagger.Paths["/users"].Post)
+	assert.NotNil(t, swagger.Paths["/payments"].Get)
+
+	var raw map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &raw))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "users"},
+		map[string]interface{}{"name": "payments"},
+	}, raw["tags"])
+
+	for _, path := range []string{"/users", "/payments"} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"total": 5}`, resp.Body.String())
+	}
+}
+
+func TestMergeDocumentsConflicts(t *testing.T) {
+	const other = `{
+		"paths": {
+			"/users": {
+				"get": {"responses": {"204": {"description": "empty"}}}
+			}
+		},
+		"components": {
+			"schemas": {
+				"Page": {"type": "array"}
+			}
+		}
+	}`
+
+	_, err := mergeDocuments([]string{"users.yaml", "other.json"}, [][]byte{[]byte(usersFragment), []byte(other)})
+	require.IsType(t, &MergeError{}, err)
+	assert.Equal(t, []MergeConflict{
+		{Pointer: "/components/schemas/Page", URIs: []string{"users.yaml", "other.json"}},
+		{Pointer: "/paths/~1users/get", URIs: []string{"users.yaml", "other.json"}},
+	}, err.(*MergeError).Conflicts)
+	assert.Contains(t, err.Error(), "'/paths/~1users/get' is declared by users.yaml and other.json")
+}
+
+func TestLoadMerged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fragments")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a-users.yaml"), []byte(usersFragment), 0644))
+
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.LoadMerged([]string{dir}))
+	assert.Nil(t, s.Swagger().Paths["/payments"])
+
+	// Reloading picks up documents added since.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b-payments.json"), []byte(paymentsFragment), 0644))
+	require.NoError(t, s.Reload())
+	assert.NotNil(t, s.Swagger().Paths["/payments"])
+
+	err = s.LoadMerged([]string{filepath.Join(dir, "*.xml")})
+	assert.Error(t, err)
+}
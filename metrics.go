@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds in seconds of the request latency
+// histogram, the same as the Prometheus client defaults.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies a series of the request counter.
+type requestKey struct {
+	operation string
+	method    string
+	status    int
+}
+
+// histogram counts observations into cumulative buckets.
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// serverMetrics collects request and reload statistics of a server, exposed
+// in the Prometheus text format at `/__metrics`.
+type serverMetrics struct {
+	mu          sync.Mutex
+	requests    map[requestKey]uint64
+	durations   map[string]*histogram
+	validations map[string]uint64
+	reloads     map[string]uint64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests:    make(map[requestKey]uint64),
+		durations:   make(map[string]*histogram),
+		validations: make(map[string]uint64),
+		reloads:     make(map[string]uint64),
+	}
+}
+
+// observeRequest records a handled request. The operation is empty for
+// requests which didn't match one, e.g. a `404`.
+func (m *serverMetrics) observeRequest(operation, method string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{operation, method, status}]++
+
+	h := m.durations[operation]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(durationBuckets))}
+		m.durations[operation] = h
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// observeValidationFailure records a request which failed validation.
+func (m *serverMetrics) observeValidationFailure(operation string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validations[operation]++
+}
+
+// observeReload records a reload of the document and whether it worked.
+func (m *serverMetrics) observeReload(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reloads[result]++
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+func (m *serverMetrics) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf.WriteString("# HELP apisprout_requests_total Requests handled by operation, method and status code.\n")
+	buf.WriteString("# TYPE apisprout_requests_total counter\n")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		fmt.Fprintf(buf, "apisprout_requests_total{operation=%s,method=%s,status=\"%d\"} %d\n", quoteLabel(key.operation), quoteLabel(key.method), key.status, m.requests[key])
+	}
+
+	buf.WriteString("# HELP apisprout_request_duration_seconds Request latency by operation.\n")
+	buf.WriteString("# TYPE apisprout_request_duration_seconds histogram\n")
+	operations := make([]string, 0, len(m.durations))
+	for operation := range m.durations {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		h := m.durations[operation]
+		label := quoteLabel(operation)
+		for i, bound := range durationBuckets {
+			fmt.Fprintf(buf, "apisprout_request_duration_seconds_bucket{operation=%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(bound, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(buf, "apisprout_request_duration_seconds_bucket{operation=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(buf, "apisprout_request_duration_seconds_sum{operation=%s} %s\n", label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "apisprout_request_duration_seconds_count{operation=%s} %d\n", label, h.count)
+	}
+
+	buf.WriteString("# HELP apisprout_validation_failures_total Requests which failed validation by operation.\n")
+	buf.WriteString("# TYPE apisprout_validation_failures_total counter\n")
+	for _, operation := range counterKeys(m.validations) {
+		fmt.Fprintf(buf, "apisprout_validation_failures_total{operation=%s} %d\n", quoteLabel(operation), m.validations[operation])
+	}
+
+	buf.WriteString("# HELP apisprout_reloads_total Reloads of the document by result.\n")
+	buf.WriteString("# TYPE apisprout_reloads_total counter\n")
+	for _, result := range counterKeys(m.reloads) {
+		fmt.Fprintf(buf, "apisprout_reloads_total{result=%s} %d\n", quoteLabel(result), m.reloads[result])
+	}
+}
+
+// counterKeys returns the labels of a counter in order, so the output is
+// stable.
+func counterKeys(counter map[string]uint64) []string {
+	keys := make([]string, 0, len(counter))
+	for key := range counter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelEscaper escapes label values as required by the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel returns a quoted label value.
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+// metricsHandler serves the collected metrics to Prometheus.
+func (s *OpenAPIServer) metricsHandler(w http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+	s.metrics.write(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items": {
+				"get": {
+					"operationId": "listItems",
+					"parameters": [{"name": "limit", "in": "query", "schema": {"type": "integer"}}],
+					"responses": {"200": {"description": "ok", "content": {"text/plain": {"example": "items"}}}}
+				}
+			}
+		}
+	}`
+
+	f, err := ioutil.TempFile("", "metrics*.json")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(schema), 0644))
+
+	config := viper.New()
+	config.Set("validate-request", true)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load(f.Name(), []byte(schema)))
+	require.NoError(t, s.Reload())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, get("/items").Code)
+	assert.Equal(t, http.StatusOK, get("/items?limit=5").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/items?limit=abc").Code)
+	assert.Equal(t, http.StatusNotFound, get("/missing").Code)
+	assert.Equal(t, http.StatusOK, get("/__health").Code)
+
+	resp := get("/__metrics")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.True(t, strings.HasPrefix(resp.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+
+	body := resp.Body.String()
+	for _, line := range []string{
+		`apisprout_requests_total{operation="listItems",method="GET",status="200"} 2`,
+		`apisprout_requests_total{operation="listItems",method="GET",status="400"} 1`,
+		`apisprout_requests_total{operation="",method="GET",status="404"} 1`,
+		`apisprout_request_duration_seconds_bucket{operation="listItems",le="+Inf"} 3`,
+		`apisprout_request_duration_seconds_count{operation="listItems"} 3`,
+		`apisprout_validation_failures_total{operation="listItems"} 1`,
+		`apisprout_reloads_total{result="success"} 1`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+
+	// Admin routes like probes and the metrics endpoint aren't counted.
+	body = get("/__metrics").Body.String()
+	assert.NotContains(t, body, `status="200"} 3`)
+	assert.NotContains(t, body, `operation="",method="GET",status="200"`)
+}
+
+func TestQuoteLabel(t *testing.T) {
+	assert.Equal(t, `"a\\b\"c\nd"`, quoteLabel("a\\b\"c\nd"))
+}
@@ -0,0 +1,47 @@
+package main
+
+import "net/http"
+
+// Middleware wraps the handler of a mock server, e.g. to log requests, shim
+// authentication, rewrite headers or hook into tests.
+type Middleware func(http.Handler) http.Handler
+
+// ServerOption configures a mock server when it is created, see
+// `NewOpenAPIServer`.
+type ServerOption func(*OpenAPIServer)
+
+// WithMiddleware adds middleware to a new server, see `OpenAPIServer.Use`.
+func WithMiddleware(middleware ...Middleware) ServerOption {
+	return func(s *OpenAPIServer) {
+		s.Use(middleware...)
+	}
+}
+
+// Use adds middleware around the mock and admin routes. The first middleware
+// added is the outermost, so it sees requests first and responses last.
+// Requests are routed after the middleware ran, so paths may be rewritten.
+// Requests answered by middleware are still counted in metrics, the request
+// history and access logs.
+func (s *OpenAPIServer) Use(middleware ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.middleware = append(s.middleware, middleware...)
+
+	var handler http.Handler = s.mux
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		handler = s.middleware[i](handler)
+	}
+	s.handler = handler
+}
+
+// routeHandler returns the mux wrapped in any middleware.
+func (s *OpenAPIServer) routeHandler() http.Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.handler == nil {
+		return s.mux
+	}
+	return s.handler
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wrappedWriter hides the response writer it wraps, like many middleware do.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func TestMiddleware(t *testing.T) {
+	const schema = `{"paths": {
+		"/items": {"get": {"operationId": "listItems", "responses": {"200": {"description": "ok", "content": {"application/json": {"example": []}}}}}}
+	}}`
+
+	order := make([]string, 0)
+	named := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				order = append(order, name)
+				w.Header().Set("X-"+name, "true")
+				next.ServeHTTP(&wrappedWriter{w}, req)
+			})
+		}
+	}
+
+	config := viper.New()
+	config.Set("history-size", 10)
+
+	s := NewOpenAPIServer(config, WithMiddleware(named("First")))
+	require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+	s.Use(named("Second"), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			// Rewrite paths of an older version of the API.
+			req.URL.Path = strings.TrimPrefix(req.URL.Path, "/v1")
+			next.ServeHTTP(w, req)
+		})
+	})
+
+	serve := func(path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve("/v1/items", "Bearer abc")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "true", resp.Header().Get("X-First"))
+	assert.Equal(t, "true", resp.Header().Get("X-Second"))
+	assert.Equal(t, []string{"First", "Second"}, order)
+
+	resp = serve("/items", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// Requests are recorded with their operation even though the writer was
+	// wrapped, including those answered by middleware.
+	requests := s.Requests("")
+	require.Len(t, requests, 2)
+	assert.Equal(t, "listItems", requests[0].OperationID)
+	assert.Equal(t, http.StatusUnauthorized, requests[1].Status)
+}
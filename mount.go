@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gobwas/glob"
+	"github.com/spf13/viper"
+)
+
+// mountPrefixKey is the context key holding the path prefix a request was
+// received under when the server is mounted by a `MountServer`.
+type mountPrefixKey struct{}
+
+// mountPrefix returns the path prefix a request was received under, if any.
+func mountPrefix(ctx context.Context) string {
+	prefix, _ := ctx.Value(mountPrefixKey{}).(string)
+	return prefix
+}
+
+// Mount describes a document to serve under a path prefix.
+type Mount struct {
+	Prefix string
+	URI    string
+
+	// Merge lists the documents, directories or glob patterns to merge into
+	// one API, if any. The URI is then the first of the merged documents.
+	Merge []string
+}
+
+// parseMount parses a mount given as `/prefix=uri`.
+func parseMount(value string) (Mount, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Mount{}, fmt.Errorf("Invalid mount '%s', expected /prefix=file", value)
+	}
+
+	return Mount{Prefix: cleanPrefix(parts[0]), URI: parts[1]}, nil
+}
+
+// mountForFile returns a mount for a document using its file name without
+// the extension as the prefix, e.g. `specs/users.yaml` is served at `/users`.
+func mountForFile(uri string) Mount {
+	name := filepath.Base(uri)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	return Mount{Prefix: cleanPrefix(name), URI: uri}
+}
+
+// isDocumentFile returns true if a file name looks like an API description.
+func isDocumentFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// documentSource is a directory or glob pattern whose documents are each
+// mounted under their file name, including ones added while running.
+type documentSource struct {
+	Dir     string
+	Pattern string
+}
+
+// parseDocumentSource returns the source described by an argument if it is a
+// directory or a glob pattern like `specs/*.yaml`, otherwise nil.
+func parseDocumentSource(arg string) (*documentSource, error) {
+	if strings.ContainsAny(arg, "*?[") {
+		dir := filepath.Dir(arg)
+		if strings.ContainsAny(dir, "*?[") {
+			return nil, fmt.Errorf("Invalid pattern '%s', only file names may contain wildcards", arg)
+		}
+		if _, err := filepath.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern '%s': %v", arg, err)
+		}
+		return &documentSource{Dir: dir, Pattern: filepath.Clean(arg)}, nil
+	}
+
+	if info, err := os.Stat(arg); err == nil && info.IsDir() {
+		return &documentSource{Dir: filepath.Clean(arg)}, nil
+	}
+
+	return nil, nil
+}
+
+// Match returns true if a file belongs to the source.
+func (ds *documentSource) Match(path string) bool {
+	path = filepath.Clean(path)
+	if filepath.Dir(path) != ds.Dir {
+		return false
+	}
+
+	if ds.Pattern != "" {
+		ok, _ := filepath.Match(ds.Pattern, path)
+		return ok
+	}
+
+	return isDocumentFile(path)
+}
+
+// Files returns the documents currently in the source sorted by name.
+func (ds *documentSource) Files() ([]string, error) {
+	infos, err := ioutil.ReadDir(ds.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, info := range infos {
+		path := filepath.Join(ds.Dir, info.Name())
+		if !info.IsDir() && ds.Match(path) {
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// documentFiles expands the directories and glob patterns in a list of
+// documents into the files they currently contain, returning the files and
+// the directories and patterns found.
+func documentFiles(args []string) ([]string, []*documentSource, error) {
+	files := make([]string, 0, len(args))
+	sources := make([]*documentSource, 0)
+
+	for _, arg := range args {
+		source, err := parseDocumentSource(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if source == nil {
+			files = append(files, arg)
+			continue
+		}
+
+		found, err := source.Files()
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, found...)
+		sources = append(sources, source)
+	}
+
+	return files, sources, nil
+}
+
+// cleanPrefix normalizes a path prefix to start with a slash and not end
+// with one. The root prefix is an empty string.
+func cleanPrefix(prefix string) string {
+	return strings.TrimSuffix("/"+strings.Trim(strings.TrimSpace(prefix), "/"), "/")
+}
+
+// MountServer serves several mock servers from one process, each under its
+// own path prefix. Requests are passed to the server with the longest
+// matching prefix with the prefix removed from the path, so each document is
+// routed exactly as if it were served on its own.
+type MountServer struct {
+	mu      sync.RWMutex
+	servers map[string]*OpenAPIServer
+	order   []string
+	loading bool
+
+	// basePath is prepended to every prefix, e.g. `/mock/petstore` when
+	// several mocks share one host.
+	basePath string
+
+	// adminPrefix is the prefix of admin routes answered here when no
+	// server is mounted at the root, or empty if they are disabled.
+	adminPrefix string
+
+	// virtualHosts routes requests by matching their host against the
+	// servers of each document before falling back to path prefixes.
+	virtualHosts bool
+	hostMu       sync.Mutex
+	hosts        map[*OpenAPIServer]hostPatterns
+}
+
+// hostPatterns are the patterns matching the hosts of a document's servers.
+type hostPatterns struct {
+	swagger  *openapi3.Swagger
+	patterns []glob.Glob
+}
+
+// NewMountServer creates a new server without any mounted servers.
+func NewMountServer() *MountServer {
+	return &MountServer{
+		servers:     make(map[string]*OpenAPIServer),
+		adminPrefix: defaultAdminPrefix,
+	}
+}
+
+// Mount serves a mock server under a path prefix, replacing any server
+// already mounted there.
+func (m *MountServer) Mount(prefix string, s *OpenAPIServer) {
+	prefix = cleanPrefix(prefix)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.servers[prefix]; !ok {
+		m.order = append(m.order, prefix)
+		// Longest prefixes first so that nested mounts take precedence.
+		sort.Slice(m.order, func(i, j int) bool {
+			return len(m.order[i]) > len(m.order[j])
+		})
+	}
+	m.servers[prefix] = s
+}
+
+// Unmount stops serving the server mounted under a prefix.
+func (m *MountServer) Unmount(prefix string) {
+	prefix = cleanPrefix(prefix)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.servers[prefix]; !ok {
+		return
+	}
+	delete(m.servers, prefix)
+
+	for i, p := range m.order {
+		if p == prefix {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// SetLoading marks documents as still being loaded, e.g. while waiting for
+// a remote document to become available at startup. While loading,
+// `/__health` and requests without a mounted server respond with a `503`.
+func (m *MountServer) SetLoading(loading bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loading = loading
+}
+
+// SetBasePath serves everything, including the `__` admin endpoints, under
+// a base path. Requests outside of it are not found.
+func (m *MountServer) SetBasePath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.basePath = cleanPrefix(path)
+}
+
+// SetAdminPrefix moves the admin routes like `/__health` answered when no
+// server is mounted at the root, see `--admin-prefix`. An empty prefix
+// disables them.
+func (m *MountServer) SetAdminPrefix(prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adminPrefix = prefix
+}
+
+// SetVirtualHosts routes requests to the document with a server matching
+// their `Host` header, e.g. `https://{tenant}.mock.local` for wildcard DNS,
+// before falling back to path prefixes.
+func (m *MountServer) SetVirtualHosts(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.virtualHosts = enabled
+}
+
+// Server returns the server mounted under a prefix, or nil.
+func (m *MountServer) Server(prefix string) *OpenAPIServer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.servers[cleanPrefix(prefix)]
+}
+
+// Prefixes returns the mounted prefixes, longest first.
+func (m *MountServer) Prefixes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string{}, m.order...)
+}
+
+// match returns the server with the longest prefix matching a path. With
+// virtual hosts, servers for the request's host take precedence, which are
+// also matched without their prefix.
+func (m *MountServer) match(host, path string) (string, *OpenAPIServer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.virtualHosts && host != "" {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+
+		for _, prefix := range m.order {
+			s := m.servers[prefix]
+			if !m.matchesHost(s, host) {
+				continue
+			}
+			if !hasPathPrefix(path, prefix) {
+				prefix = ""
+			}
+			return prefix, s
+		}
+	}
+
+	for _, prefix := range m.order {
+		if hasPathPrefix(path, prefix) {
+			return prefix, m.servers[prefix]
+		}
+	}
+
+	return "", nil
+}
+
+// ServeHTTP passes the request to the server mounted under its path.
+func (m *MountServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.mu.RLock()
+	loading := m.loading
+	base := m.basePath
+	admin := m.adminPrefix
+	m.mu.RUnlock()
+
+	if base != "" {
+		if !hasPathPrefix(req.URL.Path, base) {
+			http.NotFound(w, req)
+			return
+		}
+		req = trimPathPrefix(req, base)
+	}
+
+	// The name of the admin route requested, if any.
+	route := ""
+	if admin != "" && strings.HasPrefix(req.URL.Path, admin) {
+		route = req.URL.Path[len(admin):]
+	}
+
+	prefix, s := m.match(req.Host, req.URL.Path)
+	if route == "live" && (loading || s == nil) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+		return
+	}
+
+	if route == "ready" && (loading || s == nil) {
+		writeReadiness(w, m.readiness())
+		return
+	}
+
+	if loading && (s == nil || route == "health") {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("loading"))
+		return
+	}
+
+	if s == nil {
+		switch route {
+		case "health":
+			w.WriteHeader(http.StatusOK)
+			return
+		case "reload":
+			if m.reloadAll(w, req) {
+				return
+			}
+		}
+		http.NotFound(w, req)
+		return
+	}
+
+	r := trimPathPrefix(req, prefix)
+	r = r.WithContext(context.WithValue(r.Context(), mountPrefixKey{}, base+prefix))
+
+	s.ServeHTTP(w, r)
+}
+
+// matchesHost returns true if one of the servers of a mounted document is
+// on the given host.
+func (m *MountServer) matchesHost(s *OpenAPIServer, host string) bool {
+	swagger := s.Swagger()
+	if swagger == nil {
+		return false
+	}
+
+	m.hostMu.Lock()
+	cached, ok := m.hosts[s]
+	if !ok || cached.swagger != swagger {
+		// The patterns are only updated when the document is reloaded.
+		if m.hosts == nil {
+			m.hosts = make(map[*OpenAPIServer]hostPatterns)
+		}
+		cached = hostPatterns{swagger: swagger, patterns: serverHosts(swagger)}
+		m.hosts[s] = cached
+	}
+	m.hostMu.Unlock()
+
+	return matchesAny(cached.patterns, host)
+}
+
+// hostVariable stands in for server variables while parsing server URLs.
+const hostVariable = "apisprout-variable"
+
+// serverVariablePattern matches variables like `{tenant}` in server URLs.
+var serverVariablePattern = regexp.MustCompile(`\{[^}]*\}`)
+
+// serverHosts returns patterns matching the hosts of a document's servers,
+// where variables like `{tenant}.mock.local` match any name.
+func serverHosts(swagger *openapi3.Swagger) []glob.Glob {
+	patterns := make([]glob.Glob, 0)
+
+	for _, server := range swagger.Servers {
+		u, err := url.Parse(serverVariablePattern.ReplaceAllString(server.URL, hostVariable))
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		host := strings.Replace(strings.ToLower(u.Hostname()), hostVariable, "*", -1)
+		if g, err := glob.Compile(host, '.'); err == nil {
+			patterns = append(patterns, g)
+		}
+	}
+
+	return patterns
+}
+
+// hasPathPrefix returns true if a path is the prefix or below it.
+func hasPathPrefix(path, prefix string) bool {
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// stripPrefixes removes the first matching `--strip-prefix` from request
+// paths before routing, e.g. `/api` prepended by a gateway. Requests without
+// one of the prefixes are routed unchanged.
+func stripPrefixes(config *viper.Viper, handler http.Handler) http.Handler {
+	prefixes := make([]string, 0)
+	for _, prefix := range config.GetStringSlice("strip-prefix") {
+		if prefix = cleanPrefix(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	if len(prefixes) == 0 {
+		return handler
+	}
+
+	// Longest prefixes first so that e.g. `/api/v1` wins over `/api`.
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, prefix := range prefixes {
+			if hasPathPrefix(req.URL.Path, prefix) {
+				req = trimPathPrefix(req, prefix)
+				break
+			}
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// trimPathPrefix returns a copy of the request with a prefix removed from
+// its path.
+func trimPathPrefix(req *http.Request, prefix string) *http.Request {
+	if prefix == "" {
+		return req
+	}
+
+	r := req.WithContext(req.Context())
+	u := *req.URL
+	u.Path = strings.TrimPrefix(u.Path, prefix)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+		if u.RawPath == "" {
+			u.RawPath = "/"
+		}
+	}
+	r.URL = &u
+
+	return r
+}
+
+// reloadAll reloads every mounted server, e.g. each version of an API, when
+// nothing is mounted at the root. It returns false if reloading isn't
+// allowed because the servers are read-only.
+func (m *MountServer) reloadAll(w http.ResponseWriter, req *http.Request) bool {
+	m.mu.RLock()
+	servers := make([]*OpenAPIServer, 0, len(m.order))
+	for _, prefix := range m.order {
+		servers = append(servers, m.servers[prefix])
+	}
+	m.mu.RUnlock()
+
+	if len(servers) == 0 || servers[0].settings().GetBool("read-only") {
+		return false
+	}
+
+	if !authorizeReload(servers[0].settings(), w, req) {
+		return true
+	}
+
+	failed := false
+	for _, s := range servers {
+		if err := s.Reload(); err != nil {
+			log.Printf("ERROR: %v", err)
+			failed = true
+		}
+	}
+
+	if failed {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("error while reloading"))
+		return true
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("reloaded"))
+	log.Printf("Reloaded %d documents", len(servers))
+	return true
+}
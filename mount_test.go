@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		flags  []string
+		merge  bool
+		mounts []Mount
+		err    string
+	}{
+		{
+			name:   "Single file",
+			args:   []string{"api.yaml"},
+			mounts: []Mount{{Prefix: "", URI: "api.yaml"}},
+		},
+		{
+			name:   "Several files",
+			args:   []string{"specs/payments.yaml", "specs/users.json"},
+			mounts: []Mount{{Prefix: "/payments", URI: "specs/payments.yaml"}, {Prefix: "/users", URI: "specs/users.json"}},
+		},
+		{
+			name:   "Mount flags",
+			flags:  []string{"/payments=payments.yaml", "users/=http://example.com/users.yaml"},
+			mounts: []Mount{{Prefix: "/payments", URI: "payments.yaml"}, {Prefix: "/users", URI: "http://example.com/users.yaml"}},
+		},
+		{
+			name:   "File and mount",
+			args:   []string{"api.yaml"},
+			flags:  []string{"/v2=v2.yaml"},
+			mounts: []Mount{{Prefix: "", URI: "api.yaml"}, {Prefix: "/v2", URI: "v2.yaml"}},
+		},
+		{
+			name:   "Merge",
+			args:   []string{"users.yaml", "payments.yaml"},
+			flags:  []string{"/v2=v2.yaml"},
+			merge:  true,
+			mounts: []Mount{{Prefix: "", URI: "users.yaml", Merge: []string{"users.yaml", "payments.yaml"}}, {Prefix: "/v2", URI: "v2.yaml"}},
+		},
+		{
+			name:   "Versions",
+			flags:  []string{"v1=old.yaml", "v2=new.yaml"},
+			mounts: []Mount{{Prefix: "/v1", URI: "old.yaml"}, {Prefix: "/v2", URI: "new.yaml"}},
+		},
+		{
+			name: "Nothing",
+			err:  "No API description given, pass a FILE or use --mount",
+		},
+		{
+			name:  "Invalid mount",
+			flags: []string{"/payments"},
+			err:   "Invalid mount '/payments', expected /prefix=file",
+		},
+		{
+			name: "Duplicate prefix",
+			args: []string{"a/users.yaml", "b/users.yaml"},
+			err:  "Both a/users.yaml and b/users.yaml are mounted at /users",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mounts, _, err := serverMounts(test.args, test.flags, test.merge)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.mounts, mounts)
+		})
+	}
+}
+
+func TestServerMountsSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "specs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"users.yaml", "payments.json", "notes.txt", "orders.yml"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested.yaml"), 0755))
+
+	tests := []struct {
+		name   string
+		args   []string
+		mounts []string
+	}{
+		{"Directory", []string{dir}, []string{"/orders", "/payments", "/users"}},
+		{"Glob", []string{filepath.Join(dir, "*.y*ml")}, []string{"/orders", "/users"}},
+		{"Empty glob", []string{filepath.Join(dir, "*.xml")}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mounts, sources, err := serverMounts(test.args, nil, false)
+			require.NoError(t, err)
+			require.Len(t, sources, 1)
+
+			prefixes := make([]string, 0, len(mounts))
+			for _, mount := range mounts {
+				prefixes = append(prefixes, mount.Prefix)
+				assert.True(t, sources[0].Match(mount.URI))
+			}
+			assert.Equal(t, test.mounts, prefixes)
+		})
+	}
+
+	source, err := parseDocumentSource(filepath.Join(dir, "*.yaml"))
+	require.NoError(t, err)
+	assert.True(t, source.Match(filepath.Join(dir, "new.yaml")))
+	assert.False(t, source.Match(filepath.Join(dir, "new.json")))
+	assert.False(t, source.Match(filepath.Join(dir, "sub", "new.yaml")))
+
+	_, err = parseDocumentSource("specs/*/openapi.yaml")
+	assert.Error(t, err)
+}
+
+func TestMountServer(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/items": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {"text/plain": {"example": "%s"}}
+						}
+					}
+				},
+				"post": {
+					"responses": {"201": {"description": "created"}}
+				}
+			}
+		}
+	}`
+
+	mounted := NewMountServer()
+	for _, name := range []string{"payments", "users", "users/admin"} {
+		s := NewOpenAPIServer(viper.New())
+		require.NoError(t, s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, name))))
+		mounted.Mount("/"+name, s)
+	}
+
+	assert.Equal(t, []string{"/users/admin", "/payments", "/users"}, mounted.Prefixes())
+	assert.NotNil(t, mounted.Server("users/"))
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		body     string
+		location string
+	}{
+		{"GET", "/payments/items", http.StatusOK, "payments", ""},
+		{"GET", "/users/items", http.StatusOK, "users", ""},
+		{"GET", "/users/admin/items", http.StatusOK, "users/admin", ""},
+		{"POST", "/users/items", http.StatusCreated, "", "/users/items/1"},
+		{"GET", "/items", http.StatusNotFound, "", ""},
+		{"GET", "/paymentsitems", http.StatusNotFound, "", ""},
+		{"GET", "/__health", http.StatusOK, "", ""},
+		{"GET", "/users/__health", http.StatusOK, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.path, nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			mounted.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.body != "" {
+				assert.Equal(t, test.body, resp.Body.String())
+			}
+			assert.Equal(t, test.location, resp.Header().Get("Location"))
+		})
+	}
+
+	mounted.Unmount("/payments")
+	assert.Nil(t, mounted.Server("/payments"))
+	assert.Equal(t, []string{"/users/admin", "/users"}, mounted.Prefixes())
+}
+
+func TestMountServerBasePath(t *testing.T) {
+	const schema = `{"paths": {"/items": {"get": {"responses": {"200": {"description": "ok", "content": {"text/plain": {"example": "%s"}}}}}, "post": {"responses": {"201": {"description": "created"}}}}}}`
+
+	mounted := NewMountServer()
+	mounted.SetBasePath("/mock/petstore/")
+	for _, prefix := range []string{"", "/v2"} {
+		s := NewOpenAPIServer(viper.New())
+		require.NoError(t, s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, "root"+prefix))))
+		mounted.Mount(prefix, s)
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		body     string
+		location string
+	}{
+		{"GET", "/mock/petstore/items", http.StatusOK, "root", ""},
+		{"GET", "/mock/petstore/v2/items", http.StatusOK, "root/v2", ""},
+		{"POST", "/mock/petstore/v2/items", http.StatusCreated, "", "/mock/petstore/v2/items/1"},
+		{"GET", "/mock/petstore/__health", http.StatusOK, "", ""},
+		{"GET", "/items", http.StatusNotFound, "", ""},
+		{"GET", "/__health", http.StatusNotFound, "", ""},
+		{"GET", "/mock/petstoreitems", http.StatusNotFound, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			mounted.ServeHTTP(resp, httptest.NewRequest(test.method, test.path, nil))
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.body != "" {
+				assert.Equal(t, test.body, resp.Body.String())
+			}
+			assert.Equal(t, test.location, resp.Header().Get("Location"))
+		})
+	}
+}
+
+func TestMountServerVirtualHosts(t *testing.T) {
+	const schema = `{
+		"servers": [{"url": "%s"}],
+		"paths": {"/items": {"get": {"responses": {"200": {"description": "ok", "content": {"text/plain": {"example": "%s"}}}}}}}
+	}`
+
+	mounted := NewMountServer()
+	mounted.SetVirtualHosts(true)
+	for _, mount := range []struct{ prefix, server string }{
+		{"/payments", "https://payments.mock.local/v1"},
+		{"/users", "https://{tenant}.users.mock.local"},
+		{"/other", "/relative"},
+	} {
+		s := NewOpenAPIServer(viper.New())
+		require.NoError(t, s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, mount.server, mount.prefix))))
+		mounted.Mount(mount.prefix, s)
+	}
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+		body   string
+	}{
+		{"payments.mock.local", "/items", http.StatusOK, "/payments"},
+		{"PAYMENTS.mock.local:8000", "/items", http.StatusOK, "/payments"},
+		{"payments.mock.local", "/payments/items", http.StatusOK, "/payments"},
+		{"acme.users.mock.local", "/items", http.StatusOK, "/users"},
+		{"users.mock.local", "/items", http.StatusNotFound, ""},
+		{"localhost", "/users/items", http.StatusOK, "/users"},
+		{"localhost", "/other/items", http.StatusOK, "/other"},
+		{"localhost", "/items", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.host+test.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.path, nil)
+			req.Host = test.host
+
+			resp := httptest.NewRecorder()
+			mounted.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.body != "" {
+				assert.Equal(t, test.body, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestStripPrefixes(t *testing.T) {
+	config := viper.New()
+	config.Set("strip-prefix", []string{"/api/", "/api/v1", ""})
+
+	handler := stripPrefixes(config, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.URL.Path))
+	}))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/api/items", "/items"},
+		{"/api/v1/items", "/items"},
+		{"/api", "/"},
+		{"/apiitems", "/apiitems"},
+		{"/items", "/items"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("GET", test.path, nil))
+			assert.Equal(t, test.expected, resp.Body.String())
+		})
+	}
+}
+
+func TestMountServerLoading(t *testing.T) {
+	mounted := NewMountServer()
+	mounted.SetLoading(true)
+
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.Load("file:///swagger.json", []byte(`{"paths": {}}`)))
+	mounted.Mount("/users", s)
+
+	for _, path := range []string{"/__health", "/payments/items"} {
+		resp := httptest.NewRecorder()
+		mounted.ServeHTTP(resp, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, "loading", resp.Body.String())
+	}
+
+	// Documents which are already loaded are served.
+	resp := httptest.NewRecorder()
+	mounted.ServeHTTP(resp, httptest.NewRequest("GET", "/users/__health", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	mounted.SetLoading(false)
+	resp = httptest.NewRecorder()
+	mounted.ServeHTTP(resp, httptest.NewRequest("GET", "/__health", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestMountServerReloadAll(t *testing.T) {
+	const schema = `{"paths": {"/items": {"get": {"responses": {"200": {"description": "ok", "content": {"text/plain": {"example": "%s"}}}}}}}}`
+
+	dir, err := ioutil.TempDir("", "versions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := viper.New()
+	config.Set("reload-token", "secret")
+
+	mounted := NewMountServer()
+	for _, version := range []string{"v1", "v2"} {
+		uri := filepath.Join(dir, version+".json")
+		require.NoError(t, ioutil.WriteFile(uri, []byte(fmt.Sprintf(schema, version)), 0644))
+
+		s := NewOpenAPIServer(config)
+		data, err := ioutil.ReadFile(uri)
+		require.NoError(t, err)
+		require.NoError(t, s.Load(uri, data))
+		mounted.Mount("/"+version, s)
+	}
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "v2.json"), []byte(fmt.Sprintf(schema, "v2 updated")), 0644))
+
+	resp := httptest.NewRecorder()
+	mounted.ServeHTTP(resp, httptest.NewRequest("POST", "/__reload", nil))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req := httptest.NewRequest("POST", "/__reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp = httptest.NewRecorder()
+	mounted.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	for version, body := range map[string]string{"v1": "v1", "v2": "v2 updated"} {
+		resp = httptest.NewRecorder()
+		mounted.ServeHTTP(resp, httptest.NewRequest("GET", "/"+version+"/items", nil))
+		assert.Equal(t, body, resp.Body.String())
+	}
+
+	config.Set("read-only", true)
+	resp = httptest.NewRecorder()
+	mounted.ServeHTTP(resp, httptest.NewRequest("POST", "/__reload", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// isMultipart returns true if the request sends a `multipart/form-data` body
+// which is declared for the operation.
+func isMultipart(req *http.Request, op *openapi3.Operation) bool {
+	if op.RequestBody == nil || op.RequestBody.Value == nil {
+		return false
+	}
+
+	mediatype, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediatype != "multipart/form-data" {
+		return false
+	}
+
+	return op.RequestBody.Value.Content.Get(mediatype) != nil
+}
+
+// validateMultipart checks a `multipart/form-data` request body. Each part
+// must satisfy the schema of its property, use one of the content types
+// declared by its encoding if any, and file parts (`format: binary`) must not
+// be larger than their `maxLength` in bytes. Required parts must be present.
+func validateMultipart(input *openapi3filter.RequestValidationInput, body *openapi3.RequestBody) error {
+	req := input.Request
+	mt := body.Content.Get("multipart/form-data")
+
+	bodyError := func(err error) error {
+		return &openapi3filter.RequestError{
+			Input:       input,
+			RequestBody: body,
+			Err:         err,
+		}
+	}
+
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return bodyError(err)
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return bodyError(err)
+	}
+	// Put the data back for anything else that needs to read the body.
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	var schema *openapi3.Schema
+	if mt.Schema != nil {
+		schema = mt.Schema.Value
+	}
+
+	value := make(map[string]interface{})
+	mr := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bodyError(err)
+		}
+
+		name := part.FormName()
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return bodyError(err)
+		}
+
+		if enc := mt.Encoding[name]; enc != nil && enc.ContentType != "" {
+			contentType := part.Header.Get("Content-Type")
+			if contentType == "" {
+				contentType = "text/plain"
+			}
+			parsed, _, _ := mime.ParseMediaType(contentType)
+			if !NewContentNegotiator(enc.ContentType).Match(parsed) {
+				return bodyError(&PartError{
+					Name:   name,
+					Reason: fmt.Sprintf("Content-Type '%s' is not one of '%s'", contentType, enc.ContentType),
+				})
+			}
+		}
+
+		var prop *openapi3.Schema
+		isArray := false
+		if schema != nil && schema.Properties[name] != nil {
+			prop = schema.Properties[name].Value
+			if prop != nil && prop.Type == "array" && prop.Items != nil {
+				prop = prop.Items.Value
+				isArray = true
+			}
+		}
+
+		if prop != nil && prop.Format == "binary" && prop.MaxLength != nil && uint64(len(content)) > *prop.MaxLength {
+			return bodyError(&PartError{
+				Name:   name,
+				Reason: fmt.Sprintf("File must not be larger than %d bytes", *prop.MaxLength),
+			})
+		}
+
+		decoded, err := decodePart(content, prop)
+		if err != nil {
+			return bodyError(&PartError{Name: name, Reason: err.Error()})
+		}
+
+		if isArray {
+			items, _ := value[name].([]interface{})
+			value[name] = append(items, decoded)
+		} else {
+			value[name] = decoded
+		}
+	}
+
+	if schema != nil {
+		if err := schema.VisitJSON(value); err != nil {
+			return bodyError(err)
+		}
+	}
+
+	return nil
+}
+
+// decodePart converts the data of a single part into a value which can be
+// checked against the part's schema. Values which can't be converted are
+// left as strings so that the schema reports a type mismatch.
+func decodePart(data []byte, schema *openapi3.Schema) (interface{}, error) {
+	if schema == nil {
+		return string(data), nil
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(string(data), 64); err == nil {
+			return f, nil
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(string(data)); err == nil {
+			return b, nil
+		}
+	case "object", "array":
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("Invalid JSON: %v", err)
+		}
+		return v, nil
+	}
+
+	return string(data), nil
+}
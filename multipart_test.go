@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const multipartSchema = `{
+	"paths": {
+		"/upload": {
+			"post": {
+				"requestBody": {
+					"content": {
+						"multipart/form-data": {
+							"schema": {
+								"type": "object",
+								"required": ["name", "file"],
+								"properties": {
+									"name": {"type": "string"},
+									"count": {"type": "integer", "maximum": 10},
+									"meta": {"type": "object", "required": ["id"]},
+									"file": {"type": "string", "format": "binary", "maxLength": 8}
+								}
+							},
+							"encoding": {
+								"file": {"contentType": "image/png, image/jpeg"}
+							}
+						}
+					}
+				},
+				"responses": {"204": {"description": "ok"}}
+			}
+		}
+	}
+}`
+
+type testPart struct {
+	name        string
+	contentType string
+	value       string
+}
+
+func TestMultipartValidation(t *testing.T) {
+	config := viper.New()
+	config.Set("validate-request", true)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(multipartSchema)))
+
+	file := testPart{"file", "image/png", "\x89PNG"}
+
+	tests := []struct {
+		name    string
+		parts   []testPart
+		pointer string
+	}{
+		{"Valid", []testPart{{"name", "", "test"}, file}, ""},
+		{"Valid with optional parts", []testPart{{"name", "", "test"}, {"count", "", "5"}, {"meta", "application/json", `{"id": 1}`}, file}, ""},
+		{"Missing required part", []testPart{{"name", "", "test"}}, "/"},
+		{"Invalid number", []testPart{{"name", "", "test"}, {"count", "", "50"}, file}, "/count"},
+		{"Invalid JSON part", []testPart{{"name", "", "test"}, {"meta", "application/json", `{}`}, file}, "/meta"},
+		{"Undeclared content type", []testPart{{"name", "", "test"}, {"file", "text/plain", "hello"}}, "/file"},
+		{"File too large", []testPart{{"name", "", "test"}, {"file", "image/png", "\x89PNG0123456789"}}, "/file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			mw := multipart.NewWriter(body)
+			for _, p := range test.parts {
+				h := textproto.MIMEHeader{}
+				h.Set("Content-Disposition", `form-data; name="`+p.name+`"`)
+				if p.contentType != "" {
+					h.Set("Content-Type", p.contentType)
+				}
+				w, err := mw.CreatePart(h)
+				require.NoError(t, err)
+				w.Write([]byte(p.value))
+			}
+			require.NoError(t, mw.Close())
+
+			req, err := http.NewRequest("POST", "/upload", body)
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			if test.pointer == "" {
+				assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+				return
+			}
+
+			require.Equal(t, http.StatusBadRequest, resp.Code)
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+			require.Len(t, problem.Violations, 1)
+			assert.Equal(t, "body", problem.Violations[0].In)
+			assert.Equal(t, test.pointer, problem.Violations[0].Pointer)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// ReloadEvent is sent to `--notify-url` whenever the document is reloaded,
+// so teams notice when someone pushes a broken document to a shared mock.
+// The `text` field makes it usable directly with Slack incoming webhooks.
+type ReloadEvent struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	URI     string    `json:"uri"`
+	Title   string    `json:"title,omitempty"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Text    string    `json:"text"`
+}
+
+// notifyClient sends reload notifications.
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// operationKeys returns the operations of a document like `GET /items`,
+// sorted so they can be compared.
+func operationKeys(swagger *openapi3.Swagger) []string {
+	keys := make([]string, 0)
+	if swagger == nil {
+		return keys
+	}
+
+	for path, item := range swagger.Paths {
+		for method := range item.Operations() {
+			keys = append(keys, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// diffOperations returns the operations only in the current document and
+// those only in the previous one.
+func diffOperations(previous, current *openapi3.Swagger) ([]string, []string) {
+	before := make(map[string]bool)
+	for _, key := range operationKeys(previous) {
+		before[key] = true
+	}
+
+	added := make([]string, 0)
+	for _, key := range operationKeys(current) {
+		if before[key] {
+			delete(before, key)
+		} else {
+			added = append(added, key)
+		}
+	}
+
+	removed := make([]string, 0, len(before))
+	for key := range before {
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+// reloadEvent describes the result of reloading a document.
+func reloadEvent(uri string, previous, current *openapi3.Swagger, err error) *ReloadEvent {
+	event := &ReloadEvent{
+		Event: "reload",
+		Time:  time.Now().UTC(),
+		URI:   uri,
+	}
+
+	if current != nil {
+		event.Title = current.Info.Title
+	}
+
+	if err != nil {
+		event.Event = "reload_failed"
+		event.Error = err.Error()
+		event.Text = fmt.Sprintf("Failed to reload %s: %v", uri, err)
+		return event
+	}
+
+	event.Added, event.Removed = diffOperations(previous, current)
+	event.Text = fmt.Sprintf("Reloaded %s with %d operations added and %d removed", uri, len(event.Added), len(event.Removed))
+
+	return event
+}
+
+// notifyReload posts a reload event to `--notify-url` in the background,
+// logging rather than retrying on failure.
+func (s *OpenAPIServer) notifyReload(event *ReloadEvent) {
+	url := s.settings().GetString("notify-url")
+	if url == "" {
+		return
+	}
+
+	body, _ := json.Marshal(event)
+
+	go func() {
+		resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("ERROR: Unable to send reload notification: %v", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			log.Printf("ERROR: Unable to send reload notification: %s", resp.Status)
+		}
+	}()
+}
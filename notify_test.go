@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyReload(t *testing.T) {
+	events := make(chan ReloadEvent, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ReloadEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+	}))
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "notify*.json")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+
+	before := `{"info": {"title": "Widget API"}, "paths": {
+		"/items": {"get": {"responses": {"200": {"description": "ok"}}}},
+		"/old": {"get": {"responses": {"200": {"description": "ok"}}}}
+	}}`
+	after := `{"info": {"title": "Widget API"}, "paths": {
+		"/items": {"get": {"responses": {"200": {"description": "ok"}}}, "post": {"responses": {"201": {"description": "ok"}}}}
+	}}`
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(before), 0644))
+
+	config := viper.New()
+	config.Set("notify-url", srv.URL)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load(f.Name(), []byte(before)))
+
+	receive := func() ReloadEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("No notification received")
+			return ReloadEvent{}
+		}
+	}
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(after), 0644))
+	require.NoError(t, s.Reload())
+
+	event := receive()
+	assert.Equal(t, "reload", event.Event)
+	assert.Equal(t, f.Name(), event.URI)
+	assert.Equal(t, "Widget API", event.Title)
+	assert.Equal(t, []string{"POST /items"}, event.Added)
+	assert.Equal(t, []string{"GET /old"}, event.Removed)
+	assert.Contains(t, event.Text, "1 operations added and 1 removed")
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"paths": `), 0644))
+	require.Error(t, s.Reload())
+
+	event = receive()
+	assert.Equal(t, "reload_failed", event.Event)
+	assert.NotEmpty(t, event.Error)
+	assert.Contains(t, event.Text, "Failed to reload")
+}
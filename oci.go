@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ociManifestTypes are the manifest media types accepted from registries.
+var ociManifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociReference is an artifact in a registry, given as
+// `oci://registry/repo:tag` or `oci://registry/repo@sha256:...`.
+type ociReference struct {
+	Registry   string
+	Repository string
+	Reference  string
+}
+
+// parseOCIReference parses an `oci://` URI. The tag defaults to `latest`.
+func parseOCIReference(uri string) (*ociReference, error) {
+	rest := strings.TrimPrefix(uri, "oci://")
+
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid OCI reference '%s', expected oci://registry/repo:tag", uri)
+	}
+
+	ref := &ociReference{Registry: parts[0], Repository: parts[1], Reference: "latest"}
+	if i := strings.Index(ref.Repository, "@"); i != -1 {
+		ref.Repository, ref.Reference = ref.Repository[:i], ref.Repository[i+1:]
+	} else if i := strings.LastIndex(ref.Repository, ":"); i != -1 {
+		ref.Repository, ref.Reference = ref.Repository[:i], ref.Repository[i+1:]
+	}
+
+	return ref, nil
+}
+
+// ociClient talks to a registry using the OCI distribution API, handling
+// bearer token challenges using the registry's credentials if any.
+type ociClient struct {
+	client   *http.Client
+	base     string
+	user     string
+	password string
+	token    string
+}
+
+// do sends a GET request, authenticating and retrying once if the registry
+// asks for a token.
+func (c *ociClient) do(path string, accept []string) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.user != "" {
+			req.SetBasicAuth(c.user, c.password)
+		}
+		return c.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("Registry %s requires authentication", c.base)
+	}
+
+	if err := c.authenticate(parseAuthChallenge(challenge[len("bearer "):])); err != nil {
+		return nil, err
+	}
+
+	return send()
+}
+
+// authenticate fetches a bearer token from the registry's token service.
+func (c *ociClient) authenticate(params map[string]string) error {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("Invalid token realm '%s'", params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to get registry token: %s", resp.Status)
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	c.token = result.Token
+	if c.token == "" {
+		c.token = result.AccessToken
+	}
+
+	return nil
+}
+
+// parseAuthChallenge parses the parameters of a `WWW-Authenticate` challenge
+// like `realm="https://auth.example.com/token",service="registry"`.
+func parseAuthChallenge(value string) map[string]string {
+	params := make(map[string]string)
+
+	for value != "" {
+		eq := strings.Index(value, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(value[:eq]))
+		value = strings.TrimSpace(value[eq+1:])
+
+		v := ""
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end == -1 {
+				end = len(value) - 1
+			}
+			v = value[1 : end+1]
+			value = value[end+2:]
+		} else {
+			end := strings.Index(value, ",")
+			if end == -1 {
+				end = len(value)
+			}
+			v = value[:end]
+			value = value[end:]
+		}
+		params[key] = v
+
+		value = strings.TrimLeft(value, ", ")
+	}
+
+	return params
+}
+
+// fetchOCI pulls an API description published as an OCI artifact. The layer
+// titled with a `.yaml`, `.yml` or `.json` file name, or with a YAML or JSON
+// media type, is used, falling back to the first layer. Credentials come from
+// the Docker configuration, including credential helpers.
+func fetchOCI(config *viper.Viper, uri string) ([]byte, error) {
+	ref, err := parseOCIReference(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := fetchClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "https"
+	if host, _, err := net.SplitHostPort(ref.Registry); (err == nil && isLocalHost(host)) || isLocalHost(ref.Registry) {
+		// Like Docker, local registries are assumed to not use TLS.
+		scheme = "http"
+	}
+
+	c := &ociClient{client: client, base: scheme + "://" + ref.Registry}
+	c.user, c.password, err = dockerCredentials(ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do("/v2/"+ref.Repository+"/manifests/"+ref.Reference, ociManifestTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to fetch manifest of %s: %s", uri, resp.Status)
+	}
+
+	var manifest struct {
+		Layers []struct {
+			MediaType   string            `json:"mediaType"`
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, err
+	}
+
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("Artifact %s has no layers", uri)
+	}
+
+	digest := manifest.Layers[0].Digest
+	for _, layer := range manifest.Layers {
+		mt := strings.ToLower(layer.MediaType)
+		if isDocumentFile(layer.Annotations["org.opencontainers.image.title"]) || strings.Contains(mt, "yaml") || strings.Contains(mt, "json") {
+			digest = layer.Digest
+			break
+		}
+	}
+
+	blob, err := c.do("/v2/"+ref.Repository+"/blobs/"+digest, []string{"*/*"})
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Body.Close()
+
+	if blob.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to fetch %s from %s: %s", digest, uri, blob.Status)
+	}
+
+	data, err := ioutil.ReadAll(blob.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(digest, "sha256:") {
+		sum := sha256.Sum256(data)
+		if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+			return nil, fmt.Errorf("Digest of %s from %s doesn't match", digest, uri)
+		}
+	}
+
+	return data, nil
+}
+
+// isLocalHost returns true for hosts which refer to this machine.
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// dockerCredentials returns the username and password for a registry from the
+// Docker configuration file, using a credential helper if one is configured.
+// Returns empty credentials if there are none.
+func dockerCredentials(registry string) (string, string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", "", nil
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", "", fmt.Errorf("Invalid Docker config: %v", err)
+	}
+
+	helper := config.CredHelpers[registry]
+	if helper == "" {
+		helper = config.CredsStore
+	}
+	if helper != "" {
+		return credentialHelper(helper, registry)
+	}
+
+	for _, key := range []string{registry, "https://" + registry, "http://" + registry} {
+		if auth, ok := config.Auths[key]; ok && auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("Invalid Docker credentials for %s: %v", registry, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return "", "", fmt.Errorf("Invalid Docker credentials for %s", registry)
+			}
+			return parts[0], parts[1], nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// credentialHelper gets the credentials for a registry from a Docker
+// credential helper like `docker-credential-ecr-login`.
+func credentialHelper(helper, registry string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers report missing credentials on stdout.
+		if strings.Contains(string(out), "credentials not found") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("docker-credential-%s failed: %v: %s", helper, err, strings.TrimSpace(stderr.String()+string(out)))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", err
+	}
+
+	return creds.Username, creds.Secret, nil
+}
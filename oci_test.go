@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		uri string
+		ref *ociReference
+	}{
+		{"oci://ghcr.io/acme/apis/users:v1", &ociReference{Registry: "ghcr.io", Repository: "acme/apis/users", Reference: "v1"}},
+		{"oci://localhost:5000/users", &ociReference{Registry: "localhost:5000", Repository: "users", Reference: "latest"}},
+		{"oci://ghcr.io/acme/users@sha256:abc", &ociReference{Registry: "ghcr.io", Repository: "acme/users", Reference: "sha256:abc"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			ref, err := parseOCIReference(test.uri)
+			require.NoError(t, err)
+			assert.Equal(t, test.ref, ref)
+		})
+	}
+
+	_, err := parseOCIReference("oci://ghcr.io")
+	assert.Error(t, err)
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:acme/users:pull",
+	}, parseAuthChallenge(`realm="https://auth.example.com/token",service="registry.example.com", scope="repository:acme/users:pull"`))
+
+	assert.Equal(t, map[string]string{"realm": "r", "error": "invalid_token"}, parseAuthChallenge(`realm=r,error=invalid_token`))
+}
+
+func TestFetchOCI(t *testing.T) {
+	doc := []byte(`{"paths": {}}`)
+	readme := []byte("# Users API")
+
+	digest := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			user, pass, _ := req.BasicAuth()
+			if user != "bot" || pass != "s3cret" || req.URL.Query().Get("scope") != "repository:acme/users:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token": "abc"}`))
+			return
+		}
+
+		if req.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+ts.URL+`/token",service="registry",scope="repository:acme/users:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.Path {
+		case "/v2/acme/users/manifests/v1":
+			assert.Contains(t, req.Header.Get("Accept"), "application/vnd.oci.image.manifest.v1+json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"schemaVersion": 2,
+				"layers": []map[string]interface{}{
+					{"mediaType": "text/markdown", "digest": digest(readme)},
+					{"mediaType": "application/octet-stream", "digest": digest(doc), "annotations": map[string]string{"org.opencontainers.image.title": "openapi.json"}},
+				},
+			})
+		case "/v2/acme/users/blobs/" + digest(doc):
+			w.Write(doc)
+		case "/v2/acme/users/blobs/" + digest(readme):
+			w.Write(readme)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	registry := strings.TrimPrefix(ts.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "docker")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dockerConfig, _ := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			registry: map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte("bot:s3cret"))},
+		},
+	})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "config.json"), dockerConfig, 0600))
+
+	old, ok := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	if ok {
+		defer os.Setenv("DOCKER_CONFIG", old)
+	} else {
+		defer os.Unsetenv("DOCKER_CONFIG")
+	}
+
+	data, err := fetch(viper.New(), "oci://"+registry+"/acme/users:v1")
+	require.NoError(t, err)
+	assert.Equal(t, doc, data)
+
+	_, err = fetch(viper.New(), "oci://"+registry+"/acme/users:v2")
+	assert.EqualError(t, err, "Unable to fetch manifest of oci://"+registry+"/acme/users:v2: 404 Not Found")
+}
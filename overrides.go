@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// ExampleOverride replaces the example served for an operation's response at
+// runtime, e.g. to tweak demo data without editing the API description.
+type ExampleOverride struct {
+	Operation string      `json:"operation"`
+	Status    string      `json:"status"`
+	MediaType string      `json:"mediaType"`
+	Example   interface{} `json:"example"`
+}
+
+func (o *ExampleOverride) key() string {
+	return fmt.Sprintf("%s %s %s", o.Operation, o.Status, o.MediaType)
+}
+
+// findOperation looks up an operation by its `operationId` or by method and
+// path, e.g. `GET /pets/{petId}`. Returns the operation along with its method
+// and path.
+func findOperation(swagger *openapi3.Swagger, id string) (*openapi3.Operation, string, string) {
+	if parts := strings.SplitN(id, " ", 2); len(parts) == 2 {
+		method := strings.ToUpper(parts[0])
+		if item := swagger.Paths.Find(parts[1]); item != nil {
+			if op := item.GetOperation(method); op != nil {
+				for path, i := range swagger.Paths {
+					if i == item {
+						return op, method, path
+					}
+				}
+			}
+		}
+	}
+
+	for path, item := range swagger.Paths {
+		for method, op := range item.Operations() {
+			if op.OperationID != "" && op.OperationID == id {
+				return op, strings.ToUpper(method), path
+			}
+		}
+	}
+
+	return nil, "", ""
+}
+
+// listOverrides returns the current example overrides in a stable order.
+func (s *OpenAPIServer) listOverrides() []*ExampleOverride {
+	s.mu.RLock()
+	overrides := make([]*ExampleOverride, 0, len(s.overrides))
+	for _, o := range s.overrides {
+		overrides = append(overrides, o)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].key() < overrides[j].key()
+	})
+
+	return overrides
+}
+
+// examples is an admin route to list, set and remove example overrides.
+// Overrides are identified by the `operation`, `status` and `type` query
+// parameters, with the status defaulting to the first success response and
+// the type to the first media type of that response. New examples are
+// validated against the response schema before being accepted.
+func (s *OpenAPIServer) examples(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.listOverrides())
+		return
+	}
+
+	if req.Method != http.MethodPut && req.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+
+	if req.Method == http.MethodDelete && query.Get("operation") == "" {
+		s.mu.Lock()
+		s.overrides = make(map[string]*ExampleOverride)
+		s.mu.Unlock()
+		s.recordEvent("overrides_cleared", nil, "Removed all example overrides")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	op, method, path := findOperation(s.Swagger(), query.Get("operation"))
+	if op == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Operation not found"))
+		return
+	}
+
+	status := query.Get("status")
+	if status == "" {
+		keys := sortedResponseKeys(op.Responses)
+		if len(keys) > 0 {
+			status = keys[0]
+		}
+	}
+
+	response := op.Responses[status]
+	if response == nil || response.Value == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Response not found"))
+		return
+	}
+
+	mediatype := query.Get("type")
+	if mediatype == "" {
+		types := make([]string, 0, len(response.Value.Content))
+		for mt := range response.Value.Content {
+			types = append(types, mt)
+		}
+		sort.Strings(types)
+		if len(types) > 0 {
+			mediatype = types[0]
+		}
+	}
+
+	content := response.Value.Content[mediatype]
+	if content == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Media type not found"))
+		return
+	}
+
+	override := &ExampleOverride{
+		Operation: method + " " + path,
+		Status:    status,
+		MediaType: mediatype,
+	}
+
+	if req.Method == http.MethodDelete {
+		s.mu.Lock()
+		delete(s.overrides, override.key())
+		s.mu.Unlock()
+		s.recordEvent("override_removed", map[string]interface{}{"override": override.key()}, "Removed example override for %s", override.key())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := json.Unmarshal(body, &override.Example); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Invalid JSON: %v", err)))
+		return
+	}
+
+	if content.Schema != nil && content.Schema.Value != nil {
+		if err := content.Schema.Value.VisitJSON(override.Example); err != nil {
+			reason := err.Error()
+			if e, ok := err.(*openapi3.SchemaError); ok {
+				reason = describeSchemaError(e, nil)
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(reason))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.overrides[override.key()] = override
+	s.mu.Unlock()
+
+	log.Printf("Overriding example for %s", override.key())
+	s.recordEvent("override_set", map[string]interface{}{"override": override.key()}, "Overrode example for %s", override.key())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(override)
+}
+
+// exampleOverride returns the overridden example for the response that was
+// selected for a route, if any.
+func (s *OpenAPIServer) exampleOverride(method, path string, op *openapi3.Operation, status int, mediatype string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.overrides) == 0 {
+		return nil, false
+	}
+
+	override := &ExampleOverride{
+		Operation: method + " " + path,
+		Status:    matchResponseKey(op.Responses, strconv.Itoa(status)),
+		MediaType: mediatype,
+	}
+
+	if o, ok := s.overrides[override.key()]; ok {
+		return o.Example, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExampleOverrides(t *testing.T) {
+	s := NewOpenAPIServer(viper.New())
+	err := s.Load("file:///swagger.json", []byte(`{
+		"paths": {
+			"/pets/{petId}": {
+				"get": {
+					"operationId": "getPet",
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"schema": {
+										"type": "object",
+										"required": ["name"],
+										"properties": {
+											"name": {"type": "string"}
+										}
+									},
+									"example": {"name": "Fido"}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do("GET", "/pets/1", "")
+	assert.JSONEq(t, `{"name": "Fido"}`, resp.Body.String())
+
+	// Invalid examples are rejected.
+	resp = do("PUT", "/__examples?operation=getPet", `{"name": 5}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = do("PUT", "/__examples?operation=getMissing", `{"name": "Rex"}`)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = do("PUT", "/__examples?operation=getPet", `{"name": "Rex"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = do("GET", "/pets/1", "")
+	assert.JSONEq(t, `{"name": "Rex"}`, resp.Body.String())
+
+	// Looking up by method and path sets the same override.
+	resp = do("PUT", "/__examples?operation=get+/pets/{id}&status=200&type=application/json", `{"name": "Spot"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = do("GET", "/__examples", "")
+	assert.JSONEq(t, `[{
+		"operation": "GET /pets/{petId}",
+		"status": "200",
+		"mediaType": "application/json",
+		"example": {"name": "Spot"}
+	}]`, resp.Body.String())
+
+	resp = do("DELETE", "/__examples?operation=getPet", "")
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	resp = do("GET", "/pets/1", "")
+	assert.JSONEq(t, `{"name": "Fido"}`, resp.Body.String())
+}
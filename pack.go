@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// packMagic marks the end of an executable with a packed mock appended to it.
+const packMagic = "\x00APISPROUT-PACK\x01"
+
+// packedMock is a document and commandline flags appended to a copy of the
+// executable by the `pack` command, so the mock can be run without any
+// arguments. It's followed by its length as a big-endian uint64 and the
+// `packMagic`.
+type packedMock struct {
+	Name     string   `json:"name"`
+	Document []byte   `json:"document"`
+	Args     []string `json:"args"`
+}
+
+// writePacked writes an executable with a packed mock appended to it.
+func writePacked(w io.Writer, exe []byte, packed *packedMock) error {
+	payload, err := json.Marshal(packed)
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8)
+	binary.BigEndian.PutUint64(trailer, uint64(len(payload)))
+
+	for _, part := range [][]byte{exe, payload, trailer, []byte(packMagic)} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readPacked returns the mock packed into an executable, or nil if there is
+// none, along with the size of the executable without it.
+func readPacked(r io.ReaderAt, size int64) (*packedMock, int64, error) {
+	end := int64(len(packMagic) + 8)
+	if size < end {
+		return nil, size, nil
+	}
+
+	trailer := make([]byte, end)
+	if _, err := r.ReadAt(trailer, size-end); err != nil {
+		return nil, 0, err
+	}
+
+	if string(trailer[8:]) != packMagic {
+		return nil, size, nil
+	}
+
+	length := int64(binary.BigEndian.Uint64(trailer[:8]))
+	if length > size-end {
+		return nil, 0, fmt.Errorf("Packed mock of %d bytes is larger than the executable", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := r.ReadAt(payload, size-end-length); err != nil {
+		return nil, 0, err
+	}
+
+	packed := &packedMock{}
+	if err := json.Unmarshal(payload, packed); err != nil {
+		return nil, 0, fmt.Errorf("Invalid packed mock: %v", err)
+	}
+
+	return packed, size - end - length, nil
+}
+
+// packedArgs returns the commandline to run a packed mock with, which is its
+// packed flags followed by any given when running it and its document. The
+// document is written to the user's cache directory and shared by runs of
+// the same mock, but only after checking that its content is unchanged.
+func packedArgs(packed *packedMock, args []string) ([]string, error) {
+	dir := defaultCacheDir()
+	if dir == "" {
+		// Without a cache directory each run gets its own copy.
+		tmp, err := ioutil.TempDir("", "apisprout-packed")
+		if err != nil {
+			return nil, err
+		}
+		dir = tmp
+	} else {
+		sum := sha256.Sum256(packed.Document)
+		dir = filepath.Join(dir, "packed", hex.EncodeToString(sum[:8]))
+	}
+	path := filepath.Join(dir, filepath.Base(packed.Name))
+
+	if existing, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(existing, packed.Document) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+
+		tmp, err := ioutil.TempFile(dir, "document")
+		if err != nil {
+			return nil, err
+		}
+		_, err = tmp.Write(packed.Document)
+		tmp.Close()
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, err
+		}
+	}
+
+	result := append([]string{args[0]}, packed.Args...)
+	result = append(result, args[1:]...)
+	return append(result, path), nil
+}
+
+// unpack replaces the commandline arguments with those of the mock packed
+// into the running executable, if any.
+func unpack() {
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	packed, _, err := readPacked(f, info.Size())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if packed == nil {
+		return
+	}
+
+	args, err := packedArgs(packed, os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Args = args
+}
+
+// pack writes a standalone executable which serves a bundled copy of a
+// document using the flags given after `--`, so it can be run without any
+// arguments, e.g. by testers.
+func pack(cmd *cobra.Command, args []string) {
+	uri, output := args[0], args[1]
+
+	flags := []string{}
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		if dash != 2 {
+			log.Fatal("Expected flags for the packed mock after --, e.g. pack openapi.yaml mock -- --validate-request")
+		}
+		flags = args[dash:]
+	}
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	doc, err := bundleDocument(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	document, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Make sure the result is usable before writing it.
+	if _, _, err := load(viper.GetViper(), "openapi.json", document); err != nil {
+		log.Fatalf("Unable to load bundled document: %v", err)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exe, err := ioutil.ReadFile(self)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Leave out any mock already packed into this executable.
+	_, size, err := readPacked(bytes.NewReader(exe), int64(len(exe)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writePacked(&buf, exe[:size], &packedMock{Name: "openapi.json", Document: document, Args: flags}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(output, buf.Bytes(), 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("📦 Packed %s into %s\n", uri, output)
+}
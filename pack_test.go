@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacked(t *testing.T) {
+	cache, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cache)
+
+	old, ok := os.LookupEnv("XDG_CACHE_HOME")
+	os.Setenv("XDG_CACHE_HOME", cache)
+	if ok {
+		defer os.Setenv("XDG_CACHE_HOME", old)
+	} else {
+		defer os.Unsetenv("XDG_CACHE_HOME")
+	}
+
+	exe := []byte("\x7fELF fake executable")
+
+	// Executables without a packed mock are left alone.
+	packed, size, err := readPacked(bytes.NewReader(exe), int64(len(exe)))
+	require.NoError(t, err)
+	assert.Nil(t, packed)
+	assert.Equal(t, int64(len(exe)), size)
+
+	var buf bytes.Buffer
+	require.NoError(t, writePacked(&buf, exe, &packedMock{
+		Name:     "openapi.json",
+		Document: []byte(`{"openapi": "3.0.0"}`),
+		Args:     []string{"--validate-request", "--port", "9000"},
+	}))
+
+	data := buf.Bytes()
+	packed, size, err = readPacked(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.NotNil(t, packed)
+	assert.Equal(t, exe, data[:size])
+	assert.Equal(t, "openapi.json", packed.Name)
+
+	args, err := packedArgs(packed, []string{"mock", "--port", "9001"})
+	require.NoError(t, err)
+	require.Len(t, args, 7)
+	assert.Equal(t, []string{"mock", "--validate-request", "--port", "9000", "--port", "9001"}, args[:6])
+
+	document, err := ioutil.ReadFile(args[6])
+	require.NoError(t, err)
+	assert.Equal(t, packed.Document, document)
+
+	// Modified copies are replaced.
+	require.NoError(t, ioutil.WriteFile(args[6], []byte(`{"openapi": "3.0.0", "paths": {"/evil": {}}}`), 0600))
+	args, err = packedArgs(packed, []string{"mock"})
+	require.NoError(t, err)
+	document, err = ioutil.ReadFile(args[len(args)-1])
+	require.NoError(t, err)
+	assert.Equal(t, packed.Document, document)
+
+	// Truncated mocks are reported.
+	_, _, err = readPacked(bytes.NewReader(data[len(exe)+5:]), int64(len(data)-len(exe)-5))
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// routeParameters returns the parameters of a route, including those shared
+// by all operations of the path. Operation parameters override path item
+// parameters with the same name and location.
+func routeParameters(route *openapi3filter.Route) []*openapi3.Parameter {
+	params := make([]*openapi3.Parameter, 0)
+	seen := make(map[string]bool)
+
+	lists := []openapi3.Parameters{route.Operation.Parameters}
+	if route.PathItem != nil {
+		lists = append(lists, route.PathItem.Parameters)
+	}
+
+	for _, list := range lists {
+		for _, ref := range list {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			key := ref.Value.In + " " + ref.Value.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			params = append(params, ref.Value)
+		}
+	}
+
+	return params
+}
+
+// styledPathParams returns the path parameters keyed the way the request
+// validator expects. Values of `label` and `matrix` style parameters are
+// looked up using the style's prefix, e.g. `.id` or `;id`, while the router
+// stores them using the plain name from the path template.
+func styledPathParams(route *openapi3filter.Route, pathParams map[string]string) map[string]string {
+	styled := make(map[string]string, len(pathParams))
+	for k, v := range pathParams {
+		styled[k] = v
+	}
+
+	for _, p := range routeParameters(route) {
+		if p.In != openapi3.ParameterInPath {
+			continue
+		}
+
+		value, ok := pathParams[p.Name]
+		if !ok {
+			continue
+		}
+
+		switch p.Style {
+		case "label":
+			styled["."+p.Name] = value
+		case "matrix":
+			styled[";"+p.Name] = value
+		}
+	}
+
+	return styled
+}
+
+// coerceValue converts a raw parameter value into a form the request
+// validator accepts for the schema's type, e.g. ` 42 ` becomes `42` and `yes`
+// becomes `true`. Values which can't be converted are returned unchanged so
+// that validation still reports them.
+func coerceValue(raw string, schema *openapi3.Schema) string {
+	if schema == nil {
+		return raw
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		trimmed := strings.TrimSpace(raw)
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			if schema.Type == "integer" && f == math.Trunc(f) {
+				return strconv.FormatFloat(f, 'f', -1, 64)
+			}
+			return trimmed
+		}
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(raw)) {
+		case "true", "t", "1", "yes", "y", "on":
+			return "true"
+		case "false", "f", "0", "no", "n", "off":
+			return "false"
+		}
+	}
+
+	return raw
+}
+
+// coerceParams returns copies of the query and path parameters of a request
+// with primitive values, and items of arrays of primitives, coerced to their
+// declared types using `coerceValue`.
+func coerceParams(route *openapi3filter.Route, query url.Values, pathParams map[string]string) (url.Values, map[string]string) {
+	coercedQuery := make(url.Values, len(query))
+	for k, v := range query {
+		coercedQuery[k] = append([]string{}, v...)
+	}
+
+	coercedPath := make(map[string]string, len(pathParams))
+	for k, v := range pathParams {
+		coercedPath[k] = v
+	}
+
+	for _, p := range routeParameters(route) {
+		if p.Schema == nil || p.Schema.Value == nil {
+			continue
+		}
+		schema := p.Schema.Value
+
+		switch p.In {
+		case openapi3.ParameterInQuery:
+			values, ok := coercedQuery[p.Name]
+			if !ok {
+				continue
+			}
+
+			if schema.Type == "array" && schema.Items != nil {
+				sep := ""
+				if p.Explode != nil && !*p.Explode {
+					switch p.Style {
+					case "spaceDelimited":
+						sep = " "
+					case "pipeDelimited":
+						sep = "|"
+					default:
+						sep = ","
+					}
+				}
+
+				for i, value := range values {
+					if sep == "" {
+						values[i] = coerceValue(value, schema.Items.Value)
+						continue
+					}
+					items := strings.Split(value, sep)
+					for j, item := range items {
+						items[j] = coerceValue(item, schema.Items.Value)
+					}
+					values[i] = strings.Join(items, sep)
+				}
+				continue
+			}
+
+			for i, value := range values {
+				values[i] = coerceValue(value, schema)
+			}
+		case openapi3.ParameterInPath:
+			if p.Style != "" && p.Style != "simple" {
+				continue
+			}
+
+			if value, ok := coercedPath[p.Name]; ok {
+				coercedPath[p.Name] = coerceValue(value, schema)
+			}
+		}
+	}
+
+	return coercedQuery, coercedPath
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const styleSchema = `{
+	"paths": {
+		"/deep": {
+			"get": {
+				"parameters": [
+					{"name": "filter", "in": "query", "style": "deepObject", "explode": true, "schema": {"type": "object", "properties": {"min": {"type": "integer", "maximum": 10}, "name": {"type": "string"}}}}
+				],
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/pipe": {
+			"get": {
+				"parameters": [
+					{"name": "ids", "in": "query", "style": "pipeDelimited", "explode": false, "schema": {"type": "array", "items": {"type": "integer", "maximum": 10}}}
+				],
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/space": {
+			"get": {
+				"parameters": [
+					{"name": "ids", "in": "query", "style": "spaceDelimited", "explode": false, "schema": {"type": "array", "items": {"type": "integer", "maximum": 10}}}
+				],
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/form": {
+			"get": {
+				"parameters": [
+					{"name": "point", "in": "query", "explode": false, "schema": {"type": "object", "properties": {"x": {"type": "integer", "maximum": 10}}}}
+				],
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/label/{id}": {
+			"get": {
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "style": "label", "schema": {"type": "integer", "maximum": 10}}
+				],
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/matrix/{id}": {
+			"parameters": [
+				{"name": "id", "in": "path", "required": true, "style": "matrix", "schema": {"type": "array", "items": {"type": "integer", "maximum": 10}}}
+			],
+			"get": {
+				"responses": {"204": {"description": "ok"}}
+			}
+		}
+	}
+}`
+
+func TestParameterStyles(t *testing.T) {
+	config := viper.New()
+	config.Set("validate-request", true)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(styleSchema)))
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/deep?filter[min]=5&filter[name]=a", http.StatusNoContent},
+		{"/deep?filter[min]=50", http.StatusBadRequest},
+		{"/pipe?ids=1|2|3", http.StatusNoContent},
+		{"/pipe?ids=1|20", http.StatusBadRequest},
+		{"/space?ids=1%202", http.StatusNoContent},
+		{"/space?ids=1%2020", http.StatusBadRequest},
+		{"/form?point=x,5", http.StatusNoContent},
+		{"/form?point=x,50", http.StatusBadRequest},
+		{"/label/.5", http.StatusNoContent},
+		{"/label/.50", http.StatusBadRequest},
+		{"/label/5", http.StatusBadRequest},
+		{"/matrix/;id=1,2", http.StatusNoContent},
+		{"/matrix/;id=1,20", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code, resp.Body.String())
+		})
+	}
+}
+
+const coerceSchema = `{
+	"paths": {
+		"/items/{id}": {
+			"get": {
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "maximum": 10}},
+					{"name": "active", "in": "query", "schema": {"type": "boolean"}},
+					{"name": "price", "in": "query", "schema": {"type": "number"}},
+					{"name": "ids", "in": "query", "explode": false, "schema": {"type": "array", "items": {"type": "integer"}}}
+				],
+				"responses": {"204": {"description": "ok"}}
+			}
+		}
+	}
+}`
+
+func TestCoerceParams(t *testing.T) {
+	tests := []struct {
+		path    string
+		strict  int
+		lenient int
+	}{
+		{"/items/5?active=true&price=1.5", http.StatusNoContent, http.StatusNoContent},
+		{"/items/5?active=yes", http.StatusBadRequest, http.StatusNoContent},
+		{"/items/5?active=Off", http.StatusBadRequest, http.StatusNoContent},
+		{"/items/5?active=maybe", http.StatusBadRequest, http.StatusBadRequest},
+		{"/items/5?price=%201.5%20", http.StatusBadRequest, http.StatusNoContent},
+		{"/items/5?ids=1,%202", http.StatusBadRequest, http.StatusNoContent},
+		{"/items/5?ids=1,a", http.StatusBadRequest, http.StatusBadRequest},
+		{"/items/%205", http.StatusBadRequest, http.StatusNoContent},
+		{"/items/%2050", http.StatusBadRequest, http.StatusBadRequest},
+		{"/items/5.5", http.StatusBadRequest, http.StatusBadRequest},
+	}
+
+	for _, coerce := range []bool{false, true} {
+		config := viper.New()
+		config.Set("validate-request", true)
+		config.Set("coerce-params", coerce)
+
+		s := NewOpenAPIServer(config)
+		require.NoError(t, s.Load("file:///swagger.json", []byte(coerceSchema)))
+
+		for _, test := range tests {
+			expected := test.strict
+			if coerce {
+				expected = test.lenient
+			}
+
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, expected, resp.Code, "%s (coerce: %v): %s", test.path, coerce, resp.Body.String())
+		}
+	}
+}
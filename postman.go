@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// postmanVariable matches `{{name}}` variables in Postman URLs.
+var postmanVariable = regexp.MustCompile(`^\{\{(.+)\}\}$`)
+
+// postmanCollection is the subset of a Postman collection (v2.0 and v2.1)
+// needed to build an OpenAPI document.
+type postmanCollection struct {
+	Info struct {
+		Name        string      `json:"name"`
+		Description interface{} `json:"description"`
+		Schema      string      `json:"schema"`
+	} `json:"info"`
+	Item []*postmanItem `json:"item"`
+}
+
+// postmanItem is either a folder of items or a single request with its saved
+// example responses.
+type postmanItem struct {
+	Name     string             `json:"name"`
+	Item     []*postmanItem     `json:"item"`
+	Request  *postmanRequest    `json:"request"`
+	Response []*postmanResponse `json:"response"`
+}
+
+type postmanRequest struct {
+	Method      string          `json:"method"`
+	URL         json.RawMessage `json:"url"`
+	Header      []postmanPair   `json:"header"`
+	Body        *postmanBody    `json:"body"`
+	Description interface{}     `json:"description"`
+}
+
+type postmanURL struct {
+	Raw      string        `json:"raw"`
+	Path     interface{}   `json:"path"`
+	Query    []postmanPair `json:"query"`
+	Variable []postmanPair `json:"variable"`
+}
+
+type postmanBody struct {
+	Mode       string        `json:"mode"`
+	Raw        string        `json:"raw"`
+	URLEncoded []postmanPair `json:"urlencoded"`
+	FormData   []postmanPair `json:"formdata"`
+	Options    struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+}
+
+type postmanResponse struct {
+	Name            string        `json:"name"`
+	Code            int           `json:"code"`
+	Header          []postmanPair `json:"header"`
+	Body            string        `json:"body"`
+	PreviewLanguage string        `json:"_postman_previewlanguage"`
+}
+
+type postmanPair struct {
+	Key         string      `json:"key"`
+	Value       string      `json:"value"`
+	Disabled    bool        `json:"disabled"`
+	Description interface{} `json:"description"`
+}
+
+// isPostmanCollection returns true if a document is a Postman collection
+// rather than an OpenAPI document.
+func isPostmanCollection(data []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return false
+	}
+
+	var doc struct {
+		Info struct {
+			Schema string `json:"schema"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+
+	return strings.Contains(doc.Info.Schema, "schema.getpostman.com")
+}
+
+// convertPostman builds an OpenAPI document from a Postman collection. Each
+// request becomes an operation, tagged with its top-level folder, and its
+// saved responses become the operation's response examples. Path segments
+// like `:id` or `{{id}}` become path parameters.
+func convertPostman(data []byte) ([]byte, error) {
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("Invalid Postman collection: %v", err)
+	}
+
+	title := collection.Info.Name
+	if title == "" {
+		title = "Postman collection"
+	}
+
+	info := map[string]interface{}{"title": title, "version": "1.0.0"}
+	if d := postmanDescription(collection.Info.Description); d != "" {
+		info["description"] = d
+	}
+
+	paths := make(map[string]map[string]interface{})
+
+	var walk func(items []*postmanItem, tag string) error
+	walk = func(items []*postmanItem, tag string) error {
+		for _, item := range items {
+			if item.Request == nil {
+				t := tag
+				if t == "" {
+					t = item.Name
+				}
+				if err := walk(item.Item, t); err != nil {
+					return err
+				}
+				continue
+			}
+
+			path, op, err := postmanOperation(item, tag)
+			if err != nil {
+				return fmt.Errorf("Unable to convert request '%s': %v", item.Name, err)
+			}
+
+			method := strings.ToLower(item.Request.Method)
+			if method == "" {
+				method = "get"
+			}
+
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+
+			if existing, ok := paths[path][method].(map[string]interface{}); ok {
+				// Keep the first request, but add any new responses.
+				responses := existing["responses"].(map[string]interface{})
+				for status, r := range op["responses"].(map[string]interface{}) {
+					if _, ok := responses[status]; !ok {
+						responses[status] = r
+					}
+				}
+				continue
+			}
+
+			paths[path][method] = op
+		}
+		return nil
+	}
+
+	if err := walk(collection.Item, ""); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"openapi": "3.0.0",
+		"info":    info,
+		"paths":   paths,
+	})
+}
+
+// postmanDescription returns a description which is either a string or an
+// object with `content`.
+func postmanDescription(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		s, _ := v["content"].(string)
+		return s
+	}
+	return ""
+}
+
+// postmanURLOf parses a request URL, which is either a raw string or an
+// object with its parts.
+func postmanURLOf(raw json.RawMessage) (*postmanURL, error) {
+	u := &postmanURL{}
+	if len(raw) == 0 {
+		return u, nil
+	}
+
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &u.Raw); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(raw, u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// postmanSegments returns the path segments of a request URL.
+func postmanSegments(u *postmanURL) []string {
+	switch p := u.Path.(type) {
+	case string:
+		return strings.Split(strings.Trim(p, "/"), "/")
+	case []interface{}:
+		segments := make([]string, 0, len(p))
+		for _, s := range p {
+			switch v := s.(type) {
+			case string:
+				segments = append(segments, v)
+			case map[string]interface{}:
+				value, _ := v["value"].(string)
+				segments = append(segments, value)
+			}
+		}
+		return segments
+	}
+
+	// Only a raw URL, possibly with a variable host like `{{baseUrl}}`.
+	raw := u.Raw
+	if i := strings.IndexAny(raw, "?#"); i != -1 {
+		raw = raw[:i]
+	}
+	if i := strings.Index(raw, "://"); i != -1 {
+		raw = raw[i+3:]
+	}
+	if i := strings.Index(raw, "/"); i != -1 {
+		raw = raw[i:]
+	} else {
+		raw = ""
+	}
+
+	return strings.Split(strings.Trim(raw, "/"), "/")
+}
+
+// postmanOperation converts a single request into an OpenAPI operation.
+func postmanOperation(item *postmanItem, tag string) (string, map[string]interface{}, error) {
+	req := item.Request
+
+	u, err := postmanURLOf(req.URL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	op := map[string]interface{}{"summary": item.Name}
+	if tag != "" {
+		op["tags"] = []string{tag}
+	}
+	if d := postmanDescription(req.Description); d != "" {
+		op["description"] = d
+	}
+
+	variables := make(map[string]string)
+	for _, v := range u.Variable {
+		variables[v.Key] = v.Value
+	}
+
+	params := make([]interface{}, 0)
+	segments := make([]string, 0)
+	for _, segment := range postmanSegments(u) {
+		if segment == "" {
+			continue
+		}
+
+		name := ""
+		if strings.HasPrefix(segment, ":") {
+			name = segment[1:]
+		} else if m := postmanVariable.FindStringSubmatch(segment); m != nil {
+			name = m[1]
+		}
+
+		if name == "" {
+			segments = append(segments, segment)
+			continue
+		}
+
+		segments = append(segments, "{"+name+"}")
+		schema := map[string]interface{}{"type": "string"}
+		if example := variables[name]; example != "" {
+			schema["example"] = example
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+
+	query := u.Query
+	if len(query) == 0 && strings.Contains(u.Raw, "?") {
+		values, _ := url.ParseQuery(u.Raw[strings.Index(u.Raw, "?")+1:])
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			query = append(query, postmanPair{Key: k, Value: values.Get(k)})
+		}
+	}
+
+	for _, q := range query {
+		if q.Key == "" {
+			continue
+		}
+		schema := map[string]interface{}{"type": "string"}
+		if q.Value != "" && !postmanVariable.MatchString(q.Value) {
+			schema["example"] = q.Value
+		}
+		param := map[string]interface{}{
+			"name":   q.Key,
+			"in":     "query",
+			"schema": schema,
+		}
+		if d := postmanDescription(q.Description); d != "" {
+			param["description"] = d
+		}
+		params = append(params, param)
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if body := postmanRequestBody(req); body != nil {
+		op["requestBody"] = body
+	}
+
+	responses := make(map[string]interface{})
+	for _, r := range item.Response {
+		postmanAddResponse(responses, r)
+	}
+	if len(responses) == 0 {
+		responses["200"] = map[string]interface{}{"description": "OK"}
+	}
+	op["responses"] = responses
+
+	return "/" + strings.Join(segments, "/"), op, nil
+}
+
+// postmanContentType returns the media type given in a list of headers.
+func postmanContentType(headers []postmanPair) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, "Content-Type") && !h.Disabled {
+			if mt, _, err := mime.ParseMediaType(h.Value); err == nil {
+				return mt
+			}
+		}
+	}
+	return ""
+}
+
+// postmanExample returns a body as a JSON value if it is JSON, otherwise as
+// a string.
+func postmanExample(body, mediatype string) interface{} {
+	if marshalJSONMatcher.MatchString(mediatype) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(body), &v); err == nil {
+			return v
+		}
+	}
+	return body
+}
+
+// postmanRequestBody converts the body of a request.
+func postmanRequestBody(req *postmanRequest) map[string]interface{} {
+	body := req.Body
+	if body == nil {
+		return nil
+	}
+
+	mediatype := postmanContentType(req.Header)
+	var example interface{}
+
+	switch body.Mode {
+	case "raw":
+		if body.Raw == "" {
+			return nil
+		}
+		if mediatype == "" {
+			switch body.Options.Raw.Language {
+			case "json":
+				mediatype = "application/json"
+			case "xml":
+				mediatype = "application/xml"
+			default:
+				mediatype = "text/plain"
+			}
+		}
+		example = postmanExample(body.Raw, mediatype)
+	case "urlencoded", "formdata":
+		pairs := body.URLEncoded
+		mediatype = "application/x-www-form-urlencoded"
+		if body.Mode == "formdata" {
+			pairs = body.FormData
+			mediatype = "multipart/form-data"
+		}
+		fields := make(map[string]interface{})
+		for _, p := range pairs {
+			if !p.Disabled {
+				fields[p.Key] = p.Value
+			}
+		}
+		example = fields
+	default:
+		return nil
+	}
+
+	return map[string]interface{}{
+		"content": map[string]interface{}{
+			mediatype: map[string]interface{}{"example": example},
+		},
+	}
+}
+
+// postmanAddResponse adds a saved response as an example. Several saved
+// responses with the same status become named examples.
+func postmanAddResponse(responses map[string]interface{}, r *postmanResponse) {
+	status := strconv.Itoa(r.Code)
+	if r.Code == 0 {
+		status = "200"
+	}
+
+	response, ok := responses[status].(map[string]interface{})
+	if !ok {
+		description := r.Name
+		if description == "" {
+			description = status
+		}
+		response = map[string]interface{}{"description": description}
+		responses[status] = response
+	}
+
+	headers, _ := response["headers"].(map[string]interface{})
+	for _, h := range r.Header {
+		switch strings.ToLower(h.Key) {
+		case "content-type", "content-length", "date", "connection", "transfer-encoding":
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]interface{})
+			response["headers"] = headers
+		}
+		if _, ok := headers[h.Key]; !ok {
+			headers[h.Key] = map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string", "example": h.Value},
+			}
+		}
+	}
+
+	if r.Body == "" {
+		return
+	}
+
+	mediatype := postmanContentType(r.Header)
+	if mediatype == "" {
+		switch r.PreviewLanguage {
+		case "json":
+			mediatype = "application/json"
+		case "xml":
+			mediatype = "application/xml"
+		case "html":
+			mediatype = "text/html"
+		default:
+			mediatype = "text/plain"
+		}
+	}
+
+	content, _ := response["content"].(map[string]interface{})
+	if content == nil {
+		content = make(map[string]interface{})
+		response["content"] = content
+	}
+
+	example := postmanExample(r.Body, mediatype)
+	name := r.Name
+	if name == "" {
+		name = status
+	}
+
+	mt, ok := content[mediatype].(map[string]interface{})
+	if !ok {
+		content[mediatype] = map[string]interface{}{
+			"examples": map[string]interface{}{
+				name: map[string]interface{}{"summary": name, "value": example},
+			},
+		}
+		return
+	}
+
+	examples := mt["examples"].(map[string]interface{})
+	if _, ok := examples[name]; ok {
+		name = fmt.Sprintf("%s %d", name, len(examples)+1)
+	}
+	examples[name] = map[string]interface{}{"summary": name, "value": example}
+}
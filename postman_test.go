@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const postmanCollectionDoc = `{
+	"info": {
+		"name": "Pets",
+		"schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+	},
+	"item": [
+		{
+			"name": "pets",
+			"item": [
+				{
+					"name": "Get a pet",
+					"request": {
+						"method": "GET",
+						"url": {
+							"raw": "{{baseUrl}}/pets/:id?fields=name",
+							"host": ["{{baseUrl}}"],
+							"path": ["pets", ":id"],
+							"query": [{"key": "fields", "value": "name"}],
+							"variable": [{"key": "id", "value": "1"}]
+						}
+					},
+					"response": [
+						{
+							"name": "Found",
+							"code": 200,
+							"header": [
+								{"key": "Content-Type", "value": "application/json"},
+								{"key": "X-Request-Id", "value": "abc"}
+							],
+							"body": "{\"id\": 1, \"name\": \"Fido\"}"
+						},
+						{
+							"name": "Missing",
+							"code": 404,
+							"_postman_previewlanguage": "json",
+							"body": "{\"error\": \"not found\"}"
+						}
+					]
+				},
+				{
+					"name": "Create a pet",
+					"request": {
+						"method": "POST",
+						"url": "https://example.com/pets",
+						"body": {
+							"mode": "raw",
+							"raw": "{\"name\": \"Fido\"}",
+							"options": {"raw": {"language": "json"}}
+						}
+					}
+				}
+			]
+		},
+		{
+			"name": "Owner pets",
+			"request": {
+				"method": "GET",
+				"url": "{{baseUrl}}/owners/{{ownerId}}/pets"
+			}
+		}
+	]
+}`
+
+func TestIsPostmanCollection(t *testing.T) {
+	assert.True(t, isPostmanCollection([]byte(postmanCollectionDoc)))
+	assert.False(t, isPostmanCollection([]byte(`{"openapi": "3.0.0"}`)))
+	assert.False(t, isPostmanCollection([]byte("openapi: 3.0.0")))
+}
+
+func TestConvertPostman(t *testing.T) {
+	swagger, _, err := load(viper.New(), "pets.postman_collection.json", []byte(postmanCollectionDoc))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Pets", swagger.Info.Title)
+
+	get := swagger.Paths["/pets/{id}"].Get
+	require.NotNil(t, get)
+	assert.Equal(t, "Get a pet", get.Summary)
+	assert.Equal(t, []string{"pets"}, get.Tags)
+	assert.NotNil(t, get.Parameters.GetByInAndName("path", "id"))
+	assert.NotNil(t, get.Parameters.GetByInAndName("query", "fields"))
+
+	ok := get.Responses["200"].Value
+	assert.Equal(t, "Found", ok.Description)
+	assert.NotNil(t, ok.Headers["X-Request-Id"])
+	assert.Equal(t, map[string]interface{}{"id": 1.0, "name": "Fido"}, ok.Content["application/json"].Examples["Found"].Value.Value)
+	assert.NotNil(t, get.Responses["404"].Value.Content["application/json"])
+
+	post := swagger.Paths["/pets"].Post
+	require.NotNil(t, post)
+	assert.NotNil(t, post.RequestBody.Value.Content["application/json"])
+	assert.NotNil(t, post.Responses["200"])
+
+	owner := swagger.Paths["/owners/{ownerId}/pets"].Get
+	require.NotNil(t, owner)
+	assert.Nil(t, owner.Tags)
+	assert.NotNil(t, owner.Parameters.GetByInAndName("path", "ownerId"))
+}
+
+func TestServePostman(t *testing.T) {
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.Load("pets.postman_collection.json", []byte(postmanCollectionDoc)))
+
+	req := httptest.NewRequest("GET", "/pets/5", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "abc", resp.Header.Get("X-Request-Id"))
+	assert.JSONEq(t, `{"id": 1, "name": "Fido"}`, string(body))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// applyProfiles applies the named profiles given via `--profile` from the
+// `profiles` section of the config file, in order. Each profile is a set of
+// settings like `validate-request: true` which take precedence over the rest
+// of the config file, while flags and environment variables still win.
+func applyProfiles(config *viper.Viper) error {
+	names := config.GetStringSlice("profile")
+	if len(names) == 0 {
+		return nil
+	}
+
+	profiles := config.GetStringMap("profiles")
+
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		settings, ok := profiles[strings.ToLower(name)]
+		if !ok {
+			available := make([]string, 0, len(profiles))
+			for key := range profiles {
+				available = append(available, key)
+			}
+			sort.Strings(available)
+			return fmt.Errorf("Unknown profile '%s', available profiles: %s", name, strings.Join(available, ", "))
+		}
+
+		obj, ok := asStringMap(settings)
+		if !ok {
+			return fmt.Errorf("Profile '%s' must be a map of settings", name)
+		}
+
+		if err := config.MergeConfigMap(obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// asStringMap returns a map decoded from YAML or JSON with string keys.
+func asStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[fmt.Sprint(key)] = item
+		}
+		return obj, true
+	}
+	return nil, false
+}
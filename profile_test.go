@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfiles(t *testing.T) {
+	const file = `
+validate-request: false
+no-example-status: 404
+profiles:
+  strict:
+    validate-request: true
+    validate-response: true
+  demo:
+    no-example-status: 501
+    cors-origins: [https://demo.example.com]
+`
+
+	tests := []struct {
+		name     string
+		profiles []string
+		flag     bool
+		expected map[string]interface{}
+		err      bool
+	}{
+		{"None", nil, false, map[string]interface{}{"validate-request": false, "no-example-status": 404}, false},
+		{"One", []string{"strict"}, false, map[string]interface{}{"validate-request": true, "validate-response": true, "no-example-status": 404}, false},
+		{"Several", []string{"strict", "Demo"}, false, map[string]interface{}{"validate-request": true, "no-example-status": 501, "cors-origins": []string{"https://demo.example.com"}}, false},
+		{"Flags win", []string{"demo"}, true, map[string]interface{}{"no-example-status": 418}, false},
+		{"Unknown", []string{"chaos"}, false, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.SetConfigType("yaml")
+			require.NoError(t, config.ReadConfig(bytes.NewReader([]byte(file))))
+			config.Set("profile", test.profiles)
+			if test.flag {
+				config.Set("no-example-status", 418)
+			}
+
+			err := applyProfiles(config)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			for key, value := range test.expected {
+				switch v := value.(type) {
+				case bool:
+					assert.Equal(t, v, config.GetBool(key), key)
+				case int:
+					assert.Equal(t, v, config.GetInt(key), key)
+				case []string:
+					assert.Equal(t, v, config.GetStringSlice(key), key)
+				}
+			}
+		})
+	}
+}
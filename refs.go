@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// checkRef returns an error if an external reference may not be resolved
+// because of `--no-external-refs` or `--ref-allow`. Without an allowlist every
+// reference is allowed.
+func checkRef(config *viper.Viper, location *url.URL) error {
+	if config.GetBool("no-external-refs") {
+		return fmt.Errorf("External references are disabled, unable to load '%s'", location)
+	}
+
+	allow := config.GetStringSlice("ref-allow")
+	if len(allow) == 0 {
+		return nil
+	}
+
+	for _, entry := range allow {
+		if refAllowedBy(strings.TrimSpace(entry), location) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("External reference '%s' is not allowed by --ref-allow", location)
+}
+
+// refAllowedBy returns true if an allowlist entry matches the location of a
+// reference. Entries are either URL prefixes like
+// `https://example.com/schemas/`, host names like `*.example.com`, or local
+// directories and files like `./specs`.
+func refAllowedBy(entry string, location *url.URL) bool {
+	if entry == "" {
+		return false
+	}
+
+	remote := location.Scheme != "" || location.Host != ""
+
+	switch {
+	case strings.Contains(entry, "://"):
+		return remote && strings.HasPrefix(location.String(), entry)
+	case strings.HasPrefix(entry, ".") || strings.ContainsAny(entry, `/\`):
+		if remote {
+			return false
+		}
+
+		dir, err := filepath.Abs(entry)
+		if err != nil {
+			return false
+		}
+		file, err := filepath.Abs(filepath.FromSlash(location.Path))
+		if err != nil {
+			return false
+		}
+
+		return file == dir || strings.HasPrefix(file, dir+string(filepath.Separator))
+	default:
+		if !remote {
+			return false
+		}
+
+		// Hosts may be given with or without a port.
+		for _, host := range []string{location.Host, location.Hostname()} {
+			if ok, _ := path.Match(entry, host); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefAllowedBy(t *testing.T) {
+	tests := []struct {
+		entry    string
+		location string
+		allowed  bool
+	}{
+		{"https://example.com/schemas/", "https://example.com/schemas/user.yaml", true},
+		{"https://example.com/schemas/", "https://example.com/other/user.yaml", false},
+		{"https://example.com/schemas/", "schemas/user.yaml", false},
+		{"example.com", "https://example.com/user.yaml", true},
+		{"example.com", "http://example.com:8080/user.yaml", true},
+		{"example.com:8080", "http://example.com:8080/user.yaml", true},
+		{"example.com", "https://evil.com/user.yaml", false},
+		{"*.example.com", "https://schemas.example.com/user.yaml", true},
+		{"*.example.com", "https://example.com.evil.com/user.yaml", false},
+		{"example.com", "example.com", false},
+		{"./specs", "specs/common/user.yaml", true},
+		{"./specs", "specs", true},
+		{"./specs", "specs-other/user.yaml", false},
+		{"./specs", "specs/../secrets.yaml", false},
+		{"./specs", "https://example.com/specs/user.yaml", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.entry+" "+test.location, func(t *testing.T) {
+			location, err := url.Parse(test.location)
+			require.NoError(t, err)
+			assert.Equal(t, test.allowed, refAllowedBy(test.entry, location))
+		})
+	}
+}
+
+func TestRefPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.json" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(`{"components": {"schemas": {"Item": {"type": "string"}}}}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "apisprout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	doc := func(path string) []byte {
+		return []byte(`{
+			"openapi": "3.0.0",
+			"info": {"title": "Refs", "version": "1.0"},
+			"paths": {},
+			"components": {"schemas": {"Item": {"$ref": "` + srv.URL + path + `#/components/schemas/Item"}}}
+		}`)
+	}
+
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		path   string
+		err    bool
+	}{
+		{"Allowed", map[string]interface{}{}, "/item.json", false},
+		{"Disabled", map[string]interface{}{"no-external-refs": true}, "/item.json", true},
+		{"Allowlisted", map[string]interface{}{"ref-allow": []string{srv.URL + "/"}}, "/item.json", false},
+		{"NotAllowlisted", map[string]interface{}{"ref-allow": []string{"schemas.example.com"}}, "/item.json", true},
+		{"Timeout", map[string]interface{}{"ref-timeout": 50 * time.Millisecond}, "/slow.json", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("cache-dir", filepath.Join(dir, test.name))
+			for k, v := range test.config {
+				config.Set(k, v)
+			}
+
+			_, _, err := load(config, "openapi.json", doc(test.path))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Registry fetches API descriptions published in an API registry by
+// reference, e.g. `owner/api/version`, instead of from exported files.
+type Registry interface {
+	Fetch(config *viper.Viper, ref string) ([]byte, error)
+}
+
+// RegistryFunc is a function which implements `Registry`.
+type RegistryFunc func(config *viper.Viper, ref string) ([]byte, error)
+
+// Fetch calls the function.
+func (f RegistryFunc) Fetch(config *viper.Viper, ref string) ([]byte, error) {
+	return f(config, ref)
+}
+
+var (
+	registriesMu sync.RWMutex
+	registries   = map[string]Registry{
+		"swaggerhub": RegistryFunc(fetchSwaggerHub),
+	}
+)
+
+// RegisterRegistry makes a registry available by name, so documents can be
+// loaded using `--registry name:ref` or a `name:ref` URI.
+func RegisterRegistry(name string, r Registry) {
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+	registries[name] = r
+}
+
+// registryFor returns the registry and reference of a `name:ref` URI, or nil
+// if it doesn't name a registered registry.
+func registryFor(uri string) (Registry, string) {
+	parts := strings.SplitN(uri, ":", 2)
+	if len(parts) != 2 {
+		return nil, ""
+	}
+
+	registriesMu.RLock()
+	defer registriesMu.RUnlock()
+
+	return registries[parts[0]], parts[1]
+}
+
+// fetchSwaggerHub fetches a definition from SwaggerHub given as
+// `owner/api/version`. Without a version, the API's default version is used.
+// Private APIs need an API key set via `--swaggerhub-api-key`.
+func fetchSwaggerHub(config *viper.Viper, ref string) ([]byte, error) {
+	parts := strings.Split(strings.Trim(ref, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid SwaggerHub reference '%s', expected owner/api/version", ref)
+	}
+
+	base := strings.TrimSuffix(config.GetString("swaggerhub-url"), "/")
+	if base == "" {
+		base = "https://api.swaggerhub.com"
+	}
+	base += "/apis/" + url.PathEscape(parts[0]) + "/" + url.PathEscape(parts[1])
+
+	client, err := fetchClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	get := func(uri string) ([]byte, error) {
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if key := config.GetString("swaggerhub-api-key"); key != "" {
+			req.Header.Set("Authorization", key)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+				return nil, fmt.Errorf("Unable to fetch %s from SwaggerHub: %s", ref, apiErr.Message)
+			}
+			return nil, fmt.Errorf("Unable to fetch %s from SwaggerHub: %s", ref, resp.Status)
+		}
+
+		return body, nil
+	}
+
+	version := ""
+	if len(parts) == 3 {
+		version = parts[2]
+	} else {
+		data, err := get(base + "/settings/default")
+		if err != nil {
+			return nil, err
+		}
+
+		var settings struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, err
+		}
+		version = settings.Version
+	}
+
+	return get(base + "/" + url.PathEscape(version) + "?resolved=true")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwaggerHubRegistry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"code": 403, "message": "Access denied"}`))
+			return
+		}
+
+		switch req.URL.Path {
+		case "/apis/acme/users/settings/default":
+			w.Write([]byte(`{"version": "2.0"}`))
+		case "/apis/acme/users/1.0", "/apis/acme/users/2.0":
+			assert.Equal(t, "true", req.URL.Query().Get("resolved"))
+			w.Write([]byte(`{"info": {"version": "` + req.URL.Path[len("/apis/acme/users/"):] + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": 404, "message": "Unknown API"}`))
+		}
+	}))
+	defer ts.Close()
+
+	config := viper.New()
+	config.Set("swaggerhub-url", ts.URL)
+	config.Set("swaggerhub-api-key", "key")
+
+	tests := []struct {
+		uri  string
+		body string
+		err  string
+	}{
+		{"swaggerhub:acme/users/1.0", `{"info": {"version": "1.0"}}`, ""},
+		{"swaggerhub:acme/users", `{"info": {"version": "2.0"}}`, ""},
+		{"swaggerhub:acme/orders/1.0", "", "Unable to fetch acme/orders/1.0 from SwaggerHub: Unknown API"},
+		{"swaggerhub:acme", "", "Invalid SwaggerHub reference 'acme', expected owner/api/version"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			data, err := fetch(config, test.uri)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.body, string(data))
+		})
+	}
+
+	config.Set("swaggerhub-api-key", "")
+	_, err := fetch(config, "swaggerhub:acme/users/1.0")
+	assert.EqualError(t, err, "Unable to fetch acme/users/1.0 from SwaggerHub: Access denied")
+}
+
+func TestRegisterRegistry(t *testing.T) {
+	RegisterRegistry("test", RegistryFunc(func(config *viper.Viper, ref string) ([]byte, error) {
+		return []byte(`{"ref": "` + ref + `"}`), nil
+	}))
+
+	data, err := fetch(viper.New(), "test:some/api")
+	require.NoError(t, err)
+	assert.Equal(t, `{"ref": "some/api"}`, string(data))
+	assert.True(t, isRemote("test:some/api"))
+	assert.False(t, isRemote("unknown:some/api"))
+}
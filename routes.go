@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// methodOrder is the order operations of a path are listed in.
+var methodOrder = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT"}
+
+// RouteInfo describes an operation the mock server will answer.
+type RouteInfo struct {
+	Method      string
+	Path        string
+	OperationID string
+	Statuses    []string
+	MediaTypes  []string
+
+	// Example is true if a response can be sent by default, otherwise the
+	// mock answers with `--no-example-status`, e.g. a `418`.
+	Example bool
+}
+
+// collectRoutes returns the routing table of a document sorted by path and
+// method.
+func collectRoutes(swagger *openapi3.Swagger) []RouteInfo {
+	routes := make([]RouteInfo, 0)
+
+	// Use a fixed seed so the results are stable between runs.
+	rnd := rand.New(rand.NewSource(1))
+
+	for path, item := range swagger.Paths {
+		for method, op := range item.Operations() {
+			route := RouteInfo{
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				OperationID: op.OperationID,
+				Statuses:    sortedResponseKeys(op.Responses),
+				MediaTypes:  make([]string, 0),
+			}
+
+			seen := make(map[string]bool)
+			for _, status := range route.Statuses {
+				response := op.Responses[status]
+				if response == nil || response.Value == nil {
+					continue
+				}
+				for mt := range response.Value.Content {
+					if !seen[mt] {
+						seen[mt] = true
+						route.MediaTypes = append(route.MediaTypes, mt)
+					}
+				}
+			}
+			sort.Strings(route.MediaTypes)
+
+			_, _, _, _, err := getExample(context.Background(), nil, map[string]string{}, op, rnd)
+			route.Example = err == nil
+
+			routes = append(routes, route)
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return methodIndex(routes[i].Method) < methodIndex(routes[j].Method)
+	})
+
+	return routes
+}
+
+// methodIndex returns the position of a method in `methodOrder`.
+func methodIndex(method string) int {
+	for i, m := range methodOrder {
+		if m == method {
+			return i
+		}
+	}
+	return len(methodOrder)
+}
+
+// routes loads an OpenAPI file and prints the operations the mock server
+// will answer, and which of them are missing an example.
+func routes(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	swagger, _, err := load(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tOPERATION\tSTATUS\tMEDIA TYPES\tEXAMPLE")
+	for _, route := range collectRoutes(swagger) {
+		id := route.OperationID
+		if id == "" {
+			id = "-"
+		}
+
+		mediaTypes := strings.Join(route.MediaTypes, ", ")
+		if mediaTypes == "" {
+			mediaTypes = "-"
+		}
+
+		example := "yes"
+		if !route.Example {
+			example = fmt.Sprintf("no (%d)", viper.GetInt("no-example-status"))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", route.Method, route.Path, id, strings.Join(route.Statuses, ", "), mediaTypes, example)
+	}
+	w.Flush()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectRoutes(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/pets": {
+				"post": {
+					"operationId": "createPet",
+					"responses": {
+						"400": {"description": "bad", "content": {"application/problem+json": {"example": {"title": "bad"}}}},
+						"201": {"description": "created", "content": {"application/json": {"example": {"id": 1}}}}
+					}
+				},
+				"get": {
+					"operationId": "listPets",
+					"responses": {
+						"200": {"description": "ok", "content": {"application/json": {"schema": {"type": "array", "items": {"type": "string"}}}}}
+					}
+				}
+			},
+			"/pets/{id}": {
+				"delete": {
+					"responses": {"204": {"description": "deleted"}}
+				},
+				"get": {
+					"operationId": "getPet",
+					"responses": {
+						"200": {"description": "ok", "content": {"image/png": {}}}
+					}
+				}
+			}
+		}
+	}`
+
+	swagger, _, err := load(viper.New(), "file:///swagger.json", []byte(schema))
+	require.NoError(t, err)
+
+	assert.Equal(t, []RouteInfo{
+		{Method: "GET", Path: "/pets", OperationID: "listPets", Statuses: []string{"200"}, MediaTypes: []string{"application/json"}, Example: true},
+		{Method: "POST", Path: "/pets", OperationID: "createPet", Statuses: []string{"201", "400"}, MediaTypes: []string{"application/json", "application/problem+json"}, Example: true},
+		{Method: "GET", Path: "/pets/{id}", OperationID: "getPet", Statuses: []string{"200"}, MediaTypes: []string{"image/png"}, Example: false},
+		{Method: "DELETE", Path: "/pets/{id}", Statuses: []string{"204"}, MediaTypes: []string{}, Example: true},
+	}, collectRoutes(swagger))
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// stsEndpointFormat is the URL of the STS service in a region.
+var stsEndpointFormat = "https://sts.%s.amazonaws.com/"
+
+// awsClient is used for STS requests. Unlike `fetchClient`, it ignores the
+// `--fetch-*` and `--upstream-*` settings, which only apply to documents.
+var awsClient = &http.Client{Timeout: 30 * time.Second}
+
+// awsMetadataClient is used for the container and instance metadata
+// endpoints, which are link-local and must not go through a proxy.
+var awsMetadataClient = &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{}}
+
+// awsCredentials are used to sign requests to AWS. Temporary credentials
+// have a session token and expire.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// awsCredentialsCache holds temporary credentials until shortly before they
+// expire, so polling doesn't fetch new ones every time.
+var awsCredentialsCache struct {
+	sync.Mutex
+	creds *awsCredentials
+}
+
+// fetchS3 downloads an object given as `s3://bucket/key`. Requests go to the
+// bucket's regional endpoint, or to `--s3-endpoint` using path-style URLs,
+// e.g. for MinIO or LocalStack.
+func fetchS3(config *viper.Viper, uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("Invalid S3 URI '%s', expected s3://bucket/key", uri)
+	}
+
+	region := config.GetString("s3-region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = awsProfileRegion(os.Getenv)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	client, err := fetchClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := cachedAWSCredentials(region)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/" + key
+	endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	if e := config.GetString("s3-endpoint"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/")
+		path = "/" + bucket + path
+	}
+
+	req, err := http.NewRequest("GET", endpoint+awsEscapePath(path), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signAWSRequest(req, creds, region, "s3", time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var s3Err struct {
+			Code    string
+			Message string
+		}
+		if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("Unable to fetch %s: %s: %s", uri, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("Unable to fetch %s: %s", uri, resp.Status)
+	}
+
+	return body, nil
+}
+
+// awsEscapePath escapes each segment of a path as required by AWS signatures,
+// leaving only unreserved characters as they are.
+func awsEscapePath(path string) string {
+	var buf strings.Builder
+	for _, b := range []byte(path) {
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' ||
+			('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') {
+			buf.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&buf, "%%%02X", b)
+	}
+	return buf.String()
+}
+
+// hmacSHA256 returns the HMAC of data using a key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signAWSRequest adds an AWS Signature Version 4 `Authorization` header to a
+// request without a body. All headers already set on the request are signed
+// along with the host.
+func signAWSRequest(req *http.Request, creds *awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	}
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, awsEscapePath(k)+"="+strings.Replace(awsEscapePath(v), "/", "%2F", -1))
+		}
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// cachedAWSCredentials returns cached temporary credentials if they are still
+// valid, otherwise resolves new ones.
+func cachedAWSCredentials(region string) (*awsCredentials, error) {
+	awsCredentialsCache.Lock()
+	defer awsCredentialsCache.Unlock()
+
+	if c := awsCredentialsCache.creds; c != nil && time.Now().Add(5*time.Minute).Before(c.Expires) {
+		return c, nil
+	}
+
+	creds, err := resolveAWSCredentials(region, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCredentialsCache.creds = nil
+	if !creds.Expires.IsZero() {
+		awsCredentialsCache.creds = creds
+	}
+
+	return creds, nil
+}
+
+// resolveAWSCredentials finds credentials the same way as the AWS SDKs, in
+// order from:
+//
+// - The `AWS_ACCESS_KEY_ID` and `AWS_SECRET_ACCESS_KEY` variables
+// - A web identity token, e.g. from an EKS service account
+// - The ECS container credentials endpoint
+// - The shared credentials and config files, using `AWS_PROFILE` if set
+// - The EC2 instance metadata service, unless a profile was given
+//
+// Profiles may use static keys or a `credential_process`.
+func resolveAWSCredentials(region string, getenv func(string) string) (*awsCredentials, error) {
+	if id := getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	if tokenFile, role := getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		return webIdentityCredentials(region, tokenFile, role, getenv("AWS_ROLE_SESSION_NAME"))
+	}
+
+	if relative, full := getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"), getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); relative != "" || full != "" {
+		if full == "" {
+			full = "http://169.254.170.2" + relative
+		}
+		return containerCredentials(full, getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"))
+	}
+
+	profile := getenv("AWS_PROFILE")
+	settings, paths, err := awsProfile(profile, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	if id := settings["aws_access_key_id"]; id != "" {
+		return &awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: settings["aws_secret_access_key"],
+			SessionToken:    settings["aws_session_token"],
+		}, nil
+	}
+
+	if command := settings["credential_process"]; command != "" {
+		return processCredentials(command)
+	}
+
+	if settings["sso_session"] != "" || settings["sso_start_url"] != "" {
+		return nil, fmt.Errorf("AWS SSO profiles are not supported, set credential_process = aws configure export-credentials --profile %s --format process", profileName(profile))
+	}
+
+	if profile != "" {
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("No AWS credentials found for profile '%s'", profile)
+		}
+		return nil, fmt.Errorf("No AWS credentials found for profile '%s' in %s", profile, strings.Join(paths, " or "))
+	}
+
+	if strings.EqualFold(getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, errors.New("No AWS credentials found")
+	}
+
+	endpoint := getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+
+	creds, err := instanceCredentials(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("No AWS credentials found: %v", err)
+	}
+
+	return creds, nil
+}
+
+// profileName returns the name of a profile, which is `default` if none was
+// given.
+func profileName(profile string) string {
+	if profile == "" {
+		return "default"
+	}
+	return profile
+}
+
+// awsProfile returns the settings of a profile from the shared config file
+// like `~/.aws/config` and the shared credentials file like
+// `~/.aws/credentials`, with the latter taking precedence. Files which don't
+// exist are skipped, the others are returned as paths.
+func awsProfile(profile string, getenv func(string) string) (map[string]string, []string, error) {
+	configPath, credsPath := getenv("AWS_CONFIG_FILE"), getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if configPath == "" || credsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		if configPath == "" {
+			configPath = filepath.Join(home, ".aws", "config")
+		}
+		if credsPath == "" {
+			credsPath = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+
+	name := profileName(profile)
+
+	// Only the config file prefixes the names of profiles other than the
+	// default one.
+	configSection := name
+	if name != "default" {
+		configSection = "profile " + name
+	}
+
+	settings := make(map[string]string)
+	paths := make([]string, 0, 2)
+	for _, file := range []struct{ path, section string }{
+		{configPath, configSection},
+		{credsPath, name},
+	} {
+		data, err := ioutil.ReadFile(file.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for k, v := range iniSection(data, file.section) {
+			settings[k] = v
+		}
+		paths = append(paths, file.path)
+	}
+
+	return settings, paths, nil
+}
+
+// iniSection reads the key/value pairs of one section of an INI file like
+// the shared AWS config and credentials files.
+func iniSection(data []byte, name string) map[string]string {
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if section != name || len(parts) != 2 {
+			continue
+		}
+
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return values
+}
+
+// awsProfileRegion returns the region of the current profile from the shared
+// config file, if any.
+func awsProfileRegion(getenv func(string) string) string {
+	settings, _, err := awsProfile(getenv("AWS_PROFILE"), getenv)
+	if err != nil {
+		return ""
+	}
+	return settings["region"]
+}
+
+// webIdentityCredentials exchanges a web identity token for temporary
+// credentials of a role using STS.
+func webIdentityCredentials(region, tokenFile, role, session string) (*awsCredentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if session == "" {
+		session = fmt.Sprintf("apisprout-%d", time.Now().Unix())
+	}
+
+	query := url.Values{}
+	query.Set("Action", "AssumeRoleWithWebIdentity")
+	query.Set("Version", "2011-06-15")
+	query.Set("RoleArn", role)
+	query.Set("RoleSessionName", session)
+	query.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	resp, err := awsClient.Get(fmt.Sprintf(stsEndpointFormat, region) + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to assume role %s: %s", role, resp.Status)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	c := result.Credentials
+	return &awsCredentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expires:         c.Expiration,
+	}, nil
+}
+
+// metadataCredentials is the JSON format of credentials returned by the ECS
+// container and EC2 instance metadata endpoints and by credential processes.
+type metadataCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+func (c *metadataCredentials) credentials() *awsCredentials {
+	token := c.Token
+	if token == "" {
+		token = c.SessionToken
+	}
+
+	return &awsCredentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    token,
+		Expires:         c.Expiration,
+	}
+}
+
+// containerCredentials fetches temporary credentials from the ECS container
+// credentials endpoint.
+func containerCredentials(uri, authorization string) (*awsCredentials, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := awsMetadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to get container credentials: %s", resp.Status)
+	}
+
+	var result metadataCredentials
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result.credentials(), nil
+}
+
+// instanceCredentials fetches temporary credentials of the instance's role
+// from the EC2 instance metadata service, using an IMDSv2 session token.
+func instanceCredentials(endpoint string) (*awsCredentials, error) {
+	req, err := http.NewRequest("PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+
+	token, err := instanceMetadata(req)
+	if err != nil {
+		return nil, err
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequest("GET", endpoint+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+		return instanceMetadata(req)
+	}
+
+	roles, err := get("")
+	if err != nil {
+		return nil, err
+	}
+
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, errors.New("No role is attached to the instance")
+	}
+
+	body, err := get(role)
+	if err != nil {
+		return nil, err
+	}
+
+	var result metadataCredentials
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return result.credentials(), nil
+}
+
+// instanceMetadata sends a request to the EC2 instance metadata service and
+// returns the response body.
+func instanceMetadata(req *http.Request) ([]byte, error) {
+	resp, err := awsMetadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to get instance metadata %s: %s", req.URL.Path, resp.Status)
+	}
+
+	return body, nil
+}
+
+// processCredentials runs the `credential_process` of a profile, which
+// prints credentials as JSON.
+func processCredentials(command string) (*awsCredentials, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", command)
+	}
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to run credential_process: %v", err)
+	}
+
+	var result struct {
+		Version int
+		metadataCredentials
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("Invalid credential_process output: %v", err)
+	}
+
+	if result.Version != 1 || result.AccessKeyID == "" {
+		return nil, errors.New("Invalid credential_process output, expected version 1 with an AccessKeyId")
+	}
+
+	return result.credentials(), nil
+}
@@ -0,0 +1,1233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	ghodss "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OpenAPIServer is a mock server for a single OpenAPI document. It is an
+// `http.Handler` which serves examples for the document's operations along
+// with a few administrative routes like `/__health` and `/__schema`. Each
+// server has its own configuration and state, so many can run side by side
+// in the same process, e.g. in parallel tests.
+type OpenAPIServer struct {
+	config  *viper.Viper
+	rr      *RefreshableRouter
+	rand    *rand.Rand
+	mux     *http.ServeMux
+	logs    *logShipper
+	metrics *serverMetrics
+	statsd  *statsdEmitter
+	history *requestHistory
+	hits    *operationHits
+	events  *eventLog
+	jwt     *jwtVerifier
+	basic   map[string]string
+
+	// csrf must be sent back by the admin dashboard's forms.
+	csrf string
+
+	// middleware added via `Use` and the mux wrapped in it.
+	middleware []Middleware
+	handler    http.Handler
+
+	// headers are added to every response, see `--response-header`.
+	headers http.Header
+
+	mu        sync.RWMutex
+	uri       string
+	merged    []string
+	data      []byte
+	swagger   *openapi3.Swagger
+	overrides map[string]*ExampleOverride
+
+	// loadedAt is when the document was last loaded and loadErr why the
+	// last reload failed, if it did, for `/__ready`.
+	loadedAt time.Time
+	loadErr  error
+
+	reloadMu  sync.Mutex
+	reloading *reloadCall
+
+	oidcMu sync.Mutex
+	oidc   map[string]*jwtVerifier
+}
+
+// reloadCall is an in-flight reload whose result is shared by everyone who
+// asked for a reload while it was running.
+type reloadCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewOpenAPIServer creates a new mock server using the given configuration.
+// If no configuration is passed, then the global configuration is used. Use
+// `Load` to set the API description document to serve. Options like
+// `WithMiddleware` customize the server further.
+func NewOpenAPIServer(config *viper.Viper, options ...ServerOption) *OpenAPIServer {
+	if config == nil {
+		config = viper.GetViper()
+	}
+	settings := currentConfig(config)
+
+	s := &OpenAPIServer{
+		config: config,
+		rr:     NewRefreshableRouter(),
+		rand:   rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())}),
+		mux:    http.NewServeMux(),
+		jwt:    newJWTVerifier(settings),
+		csrf:   newCSRFToken(),
+
+		metrics:   newServerMetrics(),
+		history:   newRequestHistory(settings.GetInt("history-size")),
+		hits:      newOperationHits(),
+		events:    &eventLog{},
+		overrides: make(map[string]*ExampleOverride),
+		oidc:      make(map[string]*jwtVerifier),
+	}
+
+	if !settings.GetBool("disable-admin") {
+		s.registerAdminRoutes()
+	}
+
+	// Register our custom HTTP handler that will use the router to find
+	// the appropriate OpenAPI operation and try to return an example.
+	s.mux.HandleFunc("/", s.mock)
+
+	if url := settings.GetString("log-push-url"); url != "" {
+		logs, err := newLogShipper(url, settings.GetString("log-push-format"), settings.GetDuration("log-push-interval"))
+		if err != nil {
+			log.Printf("ERROR: Unable to push logs: %v", err)
+		}
+		s.logs = logs
+	}
+
+	if addr := settings.GetString("statsd-addr"); addr != "" {
+		statsd, err := newStatsdEmitter(addr, settings.GetString("statsd-prefix"), settings.GetString("statsd-format"))
+		if err != nil {
+			log.Printf("ERROR: Unable to send StatsD metrics: %v", err)
+		}
+		s.statsd = statsd
+	}
+
+	basic, err := basicUsers(settings.GetString("basic-users"), settings.GetString("basic-htpasswd"))
+	if err != nil {
+		// Fail closed rather than accepting any credentials.
+		log.Printf("ERROR: Unable to load basic auth users, rejecting all basic auth: %v", err)
+		basic = map[string]string{}
+	}
+	s.basic = basic
+
+	s.headers = http.Header{}
+	for _, value := range getStringArray(settings, "response-header") {
+		name, v, err := parseHeader(value)
+		if err != nil {
+			log.Printf("ERROR: Invalid --response-header: %v", err)
+			continue
+		}
+		s.headers.Add(name, v)
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	s.recordEvent("startup", map[string]interface{}{"version": GitSummary}, "Started API Sprout %s", GitSummary)
+
+	return s
+}
+
+// registerAdminRoutes registers the admin routes under `--admin-prefix`.
+// Reloads check their own token, see `authorizeReload`.
+func (s *OpenAPIServer) registerAdminRoutes() {
+	handle := func(name string, handler http.HandlerFunc) {
+		s.mux.HandleFunc(adminPath(s.settings(), name), s.protectAdmin(handler))
+	}
+
+	// Probes stay available in read-only mode so the server can still be
+	// monitored, all other admin routes are disabled.
+	handle("health", s.health)
+	handle("live", s.live)
+	handle("ready", s.ready)
+
+	if s.settings().GetBool("read-only") {
+		return
+	}
+
+	s.mux.HandleFunc(adminPath(s.settings(), "reload"), s.reload)
+	handle("schema", s.schema)
+	handle("examples", s.examples)
+	handle("metrics", s.metricsHandler)
+	handle("requests", s.requests)
+	handle("coverage", s.coverage)
+	handle("config", s.configHandler)
+	handle("events", s.eventsHandler)
+	handle("admin", s.admin)
+	handle("docs", s.docs)
+	handle("docs/openapi.json", s.docsDocument)
+	handle("redoc", s.redoc)
+}
+
+// NewOpenAPIServerWithRouter creates a new mock server for a document using a
+// router built by the caller, e.g. with custom path rewrites or routes added
+// by hand. Since there is no source document, the server can't be reloaded
+// and `/__schema` is empty unless `Load` is used later.
+func NewOpenAPIServerWithRouter(config *viper.Viper, swagger *openapi3.Swagger, router *openapi3filter.Router, options ...ServerOption) *OpenAPIServer {
+	s := NewOpenAPIServer(config, options...)
+	s.swagger = swagger
+	s.rr.Set(router)
+
+	return s
+}
+
+// Load parses an OpenAPI document and creates the router used to serve it.
+// The URI is used to resolve relative references and to reload the document.
+func (s *OpenAPIServer) Load(uri string, data []byte) error {
+	swagger, router, err := load(s.settings(), uri, data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	first := s.loadedAt.IsZero()
+	s.uri = uri
+	s.merged = nil
+	s.data = data
+	s.swagger = swagger
+	s.loadedAt = time.Now()
+	s.loadErr = nil
+	s.rr.Set(router)
+	s.mu.Unlock()
+
+	if first {
+		s.recordEvent("load", map[string]interface{}{"uri": uri, "operations": len(operationKeys(swagger))}, "Loaded %s", uri)
+	}
+
+	return nil
+}
+
+// LoadMerged fetches several partial documents describing the same API,
+// merges them and loads the result. Directories and glob patterns merge every
+// document they contain and are expanded again on each reload. Relative
+// references are resolved from the location of the first document.
+func (s *OpenAPIServer) LoadMerged(uris []string) error {
+	uri, data, err := s.fetchMerged(uris)
+	if err != nil {
+		return err
+	}
+
+	return s.loadMerged(uris, uri, data)
+}
+
+// loadMerged loads an already merged document.
+func (s *OpenAPIServer) loadMerged(uris []string, uri string, data []byte) error {
+	if err := s.Load(uri, data); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.merged = uris
+	s.mu.Unlock()
+
+	return nil
+}
+
+// fetchMerged fetches and merges documents, returning the URI of the first
+// one and the merged document.
+func (s *OpenAPIServer) fetchMerged(uris []string) (string, []byte, error) {
+	files, _, err := documentFiles(uris)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("No documents to merge in %s", strings.Join(uris, ", "))
+	}
+
+	docs := make([][]byte, len(files))
+	for i, file := range files {
+		if docs[i], err = fetch(s.settings(), file); err != nil {
+			return "", nil, err
+		}
+	}
+
+	data, err := mergeDocuments(files, docs)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return files[0], data, nil
+}
+
+// Poll fetches the document at an interval and loads it whenever it has
+// changed, until the context is done. This is useful for documents loaded
+// from a URL or S3 bucket, which can't be watched for changes.
+func (s *OpenAPIServer) Poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.pollOnce(); err != nil {
+			log.Printf("ERROR: Unable to poll OpenAPI document: %s", err)
+		}
+	}
+}
+
+// pollOnce fetches the document and loads it if it has changed.
+func (s *OpenAPIServer) pollOnce() error {
+	s.mu.RLock()
+	uri, merged, current, previous := s.uri, s.merged, s.data, s.swagger
+	s.mu.RUnlock()
+
+	if uri == "-" {
+		return nil
+	}
+
+	var data []byte
+	var err error
+	if merged != nil {
+		uri, data, err = s.fetchMerged(merged)
+	} else {
+		data, err = fetch(s.settings(), uri)
+	}
+	if err != nil {
+		s.recordEvent("fetch_failed", map[string]interface{}{"uri": uri, "error": err.Error()}, "Unable to fetch %s: %v", uri, err)
+		return err
+	}
+
+	if bytes.Equal(data, current) {
+		return nil
+	}
+
+	if merged != nil {
+		err = s.loadMerged(merged, uri, data)
+	} else {
+		err = s.Load(uri, data)
+	}
+	s.reloaded(uri, previous, err)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reloaded changed document from %s", uri)
+	return nil
+}
+
+// reloaded records the result of reloading the document for `/__metrics`,
+// `/__ready` and `/__events`, and sends a notification to `--notify-url`.
+func (s *OpenAPIServer) reloaded(uri string, previous *openapi3.Swagger, err error) {
+	s.metrics.observeReload(err)
+	if err != nil {
+		s.setLoadError(err)
+	}
+
+	event := reloadEvent(uri, previous, s.Swagger(), err)
+	details := map[string]interface{}{"uri": uri}
+	if err != nil {
+		details["error"] = event.Error
+	} else {
+		details["added"] = event.Added
+		details["removed"] = event.Removed
+	}
+	s.recordEvent(event.Event, details, "%s", event.Text)
+
+	s.notifyReload(event)
+}
+
+// Swagger returns the currently loaded OpenAPI document.
+func (s *OpenAPIServer) Swagger() *openapi3.Swagger {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.swagger
+}
+
+// ServeHTTP serves an example response for the request.
+func (s *OpenAPIServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.setStaticHeaders(w, nil)
+
+	if s.settings().GetBool("dump") {
+		limit := s.settings().GetInt("dump-max-size")
+		request := dumpRequest(req, limit)
+		dw := &dumpWriter{ResponseWriter: w, limit: limit}
+		w = dw
+		defer func() {
+			log.Printf("Dump of %s %s\n--- Request ---\n%s--- Response ---\n%s", req.Method, req.URL.Path, request, dw)
+		}()
+	}
+
+	record := s.recordRequest(req)
+
+	start := time.Now()
+	lw := &accessLogWriter{ResponseWriter: w, timings: newRequestTimings(start)}
+	s.routeHandler().ServeHTTP(lw, req.WithContext(context.WithValue(req.Context(), accessLogKey{}, lw)))
+	lw.timings.mark("response")
+	s.warnSlow(req, lw.operationID, lw.timings)
+
+	status := lw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	record(lw.operationID, status)
+
+	duration := time.Since(start)
+	if !isAdminPath(s.settings(), req.URL.Path) {
+		s.metrics.observeRequest(lw.operationID, req.Method, status, duration)
+		if s.statsd != nil {
+			s.statsd.observeRequest(lw.operationID, req.Method, status, duration)
+		}
+	}
+
+	if s.logs == nil {
+		return
+	}
+
+	s.logs.Log(AccessLog{
+		Time:        start,
+		RequestID:   req.Header.Get("X-Request-Id"),
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		OperationID: lw.operationID,
+		Status:      status,
+		DurationMS:  float64(duration) / float64(time.Millisecond),
+	})
+}
+
+// setStaticHeaders sets the headers given via `--response-header` and, if an
+// operation is given, its `x-apisprout-headers` which take precedence.
+func (s *OpenAPIServer) setStaticHeaders(w http.ResponseWriter, op *openapi3.Operation) {
+	for name, values := range s.headers {
+		w.Header()[name] = append([]string{}, values...)
+	}
+
+	if op != nil {
+		for name, value := range extensionHeaders(op.ExtensionProps) {
+			w.Header().Set(name, value)
+		}
+	}
+}
+
+// Start serves the loaded document on the given address in the background
+// until the context is done. Use a port of zero, e.g. `127.0.0.1:0`, to pick
+// a random free port. Returns the address the server is listening on.
+func (s *OpenAPIServer) Start(ctx context.Context, addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	srv := s.httpServer(addr)
+	go srv.Serve(ln)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	return ln.Addr().String(), nil
+}
+
+// httpServer creates an HTTP server for this mock using the configured
+// connection settings.
+func (s *OpenAPIServer) httpServer(addr string) *http.Server {
+	return newHTTPServer(s.settings(), addr, s)
+}
+
+// newHTTPServer creates an HTTP server for a handler using the configured
+// connection settings.
+func newHTTPServer(config *viper.Viper, addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     limitConcurrency(config, stripPrefixes(config, handler)),
+		IdleTimeout: config.GetDuration("idle-timeout"),
+	}
+
+	if config.GetBool("disable-keep-alives") {
+		srv.SetKeepAlivesEnabled(false)
+	}
+
+	return srv
+}
+
+// StartTestServer loads a document and serves it on a random local port until
+// the context is done, returning the server's base URL. Each call creates an
+// isolated server with its own configuration, making it safe to use from
+// parallel tests. If no configuration is given, the defaults are used.
+func StartTestServer(ctx context.Context, config *viper.Viper, uri string, data []byte) (string, error) {
+	if config == nil {
+		config = viper.New()
+	}
+
+	s := NewOpenAPIServer(config)
+	if err := s.Load(uri, data); err != nil {
+		return "", err
+	}
+
+	addr, err := s.Start(ctx, "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	return "http://" + addr, nil
+}
+
+// Reload fetches the current document again and loads it. Reloads are
+// serialized, so concurrent callers wait for and share the result of the
+// reload already in progress rather than parsing the document many times.
+func (s *OpenAPIServer) Reload() error {
+	s.reloadMu.Lock()
+	if call := s.reloading; call != nil {
+		s.reloadMu.Unlock()
+		<-call.done
+		return call.err
+	}
+
+	call := &reloadCall{done: make(chan struct{})}
+	s.reloading = call
+	s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	uri, merged, previous := s.uri, s.merged, s.swagger
+	s.mu.RUnlock()
+
+	var err error
+	if uri == "-" {
+		err = errors.New("Unable to reload a document read from stdin")
+	} else if merged != nil {
+		err = s.LoadMerged(merged)
+	} else {
+		var data []byte
+		data, err = fetch(s.settings(), uri)
+		if err == nil {
+			err = s.Load(uri, data)
+		}
+	}
+	call.err = err
+	s.reloaded(uri, previous, err)
+
+	s.reloadMu.Lock()
+	s.reloading = nil
+	s.reloadMu.Unlock()
+	close(call.done)
+
+	return err
+}
+
+// reload fetches and loads the document again, either from its URL or from
+// the local file. If a reload token is configured, it must be sent as a
+// bearer token.
+func (s *OpenAPIServer) reload(w http.ResponseWriter, req *http.Request) {
+	s.mu.RLock()
+	uri, merged := s.uri, s.merged
+	s.mu.RUnlock()
+
+	if uri == "" && merged == nil {
+		s.mock(w, req)
+		return
+	}
+
+	if !authorizeReload(s.settings(), w, req) {
+		return
+	}
+
+	if err := s.Reload(); err != nil {
+		log.Printf("ERROR: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("error while reloading"))
+		return
+	}
+
+	w.WriteHeader(200)
+	w.Write([]byte("reloaded"))
+	log.Printf("Reloaded from %s", uri)
+}
+
+// authorizeReload checks the `--reload-token` or `--admin-token` of a reload
+// request, sending an error response and returning false if it's missing or
+// wrong.
+func authorizeReload(config *viper.Viper, w http.ResponseWriter, req *http.Request) bool {
+	return authorizeBearer(w, req, "reload", config.GetString("reload-token"), config.GetString("admin-token"))
+}
+
+// authorizeBearer checks that a request sends one of the given tokens as a
+// bearer token, ignoring empty ones, sending an error response and returning
+// false if it doesn't. Requests are authorized if no tokens are configured.
+func authorizeBearer(w http.ResponseWriter, req *http.Request, kind string, tokens ...string) bool {
+	auth := req.Header.Get("Authorization")
+	required := false
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		required = true
+
+		if strings.HasPrefix(auth, "Bearer ") && subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	if !required {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="apisprout"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte("invalid " + kind + " token"))
+	return false
+}
+
+// health is a health check route which returns 200.
+func (s *OpenAPIServer) health(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(200)
+	s.logf(logNormal, "Health check")
+}
+
+// schema returns the exact document given to us.
+func (s *OpenAPIServer) schema(w http.ResponseWriter, req *http.Request) {
+	if !s.settings().GetBool("disable-cors") && applyCORS(s.settings(), w, req) {
+		return
+	}
+
+	s.mu.RLock()
+	uri, data := s.uri, s.data
+	s.mu.RUnlock()
+
+	if isArchive(data) {
+		// Return the root document of a bundle rather than the archive.
+		root, content, err := openArchive(s.settings(), data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		uri, data = root, content
+	}
+
+	dataType := strings.Trim(strings.ToLower(filepath.Ext(uri)), ".")
+	if dataType == "yml" {
+		dataType = "yaml"
+	}
+	if dataType != "json" && dataType != "yaml" {
+		// Documents without an extension, e.g. read from stdin, are YAML
+		// unless they look like a JSON object.
+		dataType = "yaml"
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			dataType = "json"
+		}
+	}
+
+	format := schemaFormat(s.settings(), req)
+	if format == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("unknown format, use json, yaml or original"))
+		return
+	}
+
+	if format != "original" && format != dataType {
+		// Convert the document as loaded rather than the parsed one, which
+		// keeps extensions and unresolved references intact.
+		var err error
+		if format == "json" {
+			data, err = ghodss.YAMLToJSON(data)
+		} else {
+			data, err = ghodss.JSONToYAML(data)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		dataType = format
+	}
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", fmt.Sprintf("application/%v; charset=utf-8", dataType))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// schemaFormat returns the format `/__schema` is served in, either `json`,
+// `yaml` or `original` for the bytes as loaded. It's chosen by the `format`
+// query parameter, then by a JSON or YAML type in the `Accept` header and
+// finally by `--schema-format`. Returns an empty string for unknown formats.
+func schemaFormat(config *viper.Viper, req *http.Request) string {
+	format := strings.ToLower(req.URL.Query().Get("format"))
+
+	if format == "" {
+		for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+			mediatype := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+			if mediatype == "application/json" {
+				format = "json"
+				break
+			}
+			if mediatype == "application/yaml" || mediatype == "application/x-yaml" || mediatype == "text/yaml" {
+				format = "yaml"
+				break
+			}
+		}
+	}
+
+	if format == "" {
+		format = strings.ToLower(config.GetString("schema-format"))
+	}
+
+	switch format {
+	case "", "original":
+		return "original"
+	case "yml":
+		return "yaml"
+	case "json", "yaml":
+		return format
+	}
+
+	return ""
+}
+
+// mock finds the OpenAPI operation for a request and tries to return an
+// example response for it.
+func (s *OpenAPIServer) mock(w http.ResponseWriter, req *http.Request) {
+	if !s.settings().GetBool("disable-cors") && applyCORS(s.settings(), w, req) {
+		return
+	}
+
+	info := fmt.Sprintf("%s %v", req.Method, req.URL)
+	rl := s.requestLogger(req, nil)
+
+	if logLevel(s.settings()) >= logDebug {
+		for _, name := range sortedHeaderNames(req.Header) {
+			rl.logf(logDebug, "%s => Header %s: %s", info, name, strings.Join(req.Header[name], ", "))
+		}
+	}
+
+	// Set up the request, handling potential proxy headers
+	req.URL.Host = req.Host
+	fHost := req.Header.Get("X-Forwarded-Host")
+	if fHost != "" {
+		req.URL.Host = fHost
+	}
+
+	req.URL.Scheme = "http"
+	if req.Header.Get("X-Forwarded-Proto") == "https" ||
+		req.Header.Get("X-Forwarded-Scheme") == "https" ||
+		strings.Contains(req.Header.Get("Forwarded"), "proto=https") {
+		req.URL.Scheme = "https"
+	}
+
+	if s.settings().GetBool("validate-server") {
+		// Use the scheme/host in the log message since we are validating it.
+		info = fmt.Sprintf("%s %v", req.Method, req.URL)
+	}
+
+	if s.settings().GetBool("read-only") && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		rl.printf("ERROR: %s => Method not allowed in read-only mode", info)
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if limit := s.settings().GetInt64("max-body-size"); limit > 0 && req.Body != nil {
+		if req.ContentLength > limit {
+			rl.printf("ERROR: %s => Request body of %d bytes is too large", info, req.ContentLength)
+			writeProblem(w, bodyTooLarge(limit))
+			return
+		}
+
+		// The length may be unknown, e.g. for chunked requests, so read up to
+		// the limit to find out before anything else uses the body.
+		body, err := ioutil.ReadAll(io.LimitReader(req.Body, limit+1))
+		if err != nil {
+			rl.printf("ERROR: %s => Unable to read request body: %v", info, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > limit {
+			rl.printf("ERROR: %s => Request body is too large", info)
+			writeProblem(w, bodyTooLarge(limit))
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	router := s.rr.Get()
+	route, pathParams, err := router.FindRoute(req.Method, req.URL)
+	if err != nil && req.Method == http.MethodHead {
+		// Answer HEAD requests using the GET operation, if available, as
+		// described in RFC 7231 section 4.3.2.
+		route, pathParams, err = router.FindRoute(http.MethodGet, req.URL)
+	}
+	if err != nil {
+		rl.printf("ERROR: %s => %v", info, err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if lw := accessLogFor(req); lw != nil {
+		lw.operationID = route.Operation.OperationID
+	}
+	rl = s.requestLogger(req, route)
+	s.hits.Hit(route.Method, route.Path)
+	markPhase(req, "route")
+
+	if _, ok := route.Operation.Extensions[extAsyncAPIChannel]; ok && req.Method == http.MethodGet && (isWebSocketUpgrade(req) || isEventStream(req)) {
+		s.streamChannel(w, req, route, info, rl)
+		return
+	}
+
+	if s.settings().GetBool("strict-content-type") {
+		if problem := unsupportedMediaType(req, route.Operation); problem != nil {
+			rl.printf("ERROR: %s => %s", info, problem.Detail)
+			if types := requestMediaTypes(route.Operation); len(types) > 0 {
+				// Advertise the accepted types, see RFC 5789 for `Accept-Patch`.
+				switch req.Method {
+				case http.MethodPost:
+					w.Header().Set("Accept-Post", strings.Join(types, ", "))
+				case http.MethodPatch:
+					w.Header().Set("Accept-Patch", strings.Join(types, ", "))
+				}
+			}
+			writeProblem(w, problem)
+			return
+		}
+	}
+
+	// Set when the document's own error response should be served instead of
+	// a problem document for a validation failure.
+	errorStatus := ""
+
+	validateRequest := s.settings().GetBool("validate-request")
+	if validateRequest || s.settings().GetBool("validate-security") {
+		input := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			Route:      withoutSecurity(route),
+			PathParams: styledPathParams(route, pathParams),
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: s.authenticate,
+			},
+		}
+
+		if s.settings().GetBool("coerce-params") {
+			query, path := coerceParams(route, req.URL.Query(), pathParams)
+			input.QueryParams = query
+			input.PathParams = styledPathParams(route, path)
+		}
+
+		if validateRequest {
+			// The multipart decoder of the validator can't handle file parts,
+			// so multipart bodies are checked separately.
+			multipart := isMultipart(req, route.Operation)
+			input.Options.ExcludeRequestBody = multipart
+
+			err = openapi3filter.ValidateRequest(req.Context(), input)
+			if err == nil && multipart {
+				err = validateMultipart(input, route.Operation.RequestBody.Value)
+			}
+			if err == nil && s.settings().GetBool("reject-read-only") && route.Operation.RequestBody != nil && route.Operation.RequestBody.Value != nil {
+				err = validateReadOnly(input, route.Operation.RequestBody.Value)
+			}
+		}
+		if err == nil {
+			input.Route = route
+			err = validateSecurity(req.Context(), input, securityRequirements(route), s.authenticate)
+		}
+
+		if err != nil {
+			problem := validationProblem(err)
+			rl.printf("ERROR: %s => %s", info, problem.Detail)
+			s.metrics.observeValidationFailure(route.Operation.OperationID)
+			rl.logf(logVerbose, "%s => Validation detail: %v", info, err)
+			for _, challenge := range authChallenges(err) {
+				w.Header().Add("WWW-Authenticate", challenge)
+			}
+			if s.settings().GetBool("validation-error-examples") {
+				errorStatus = errorResponseStatus(route.Operation, problem.Status)
+			}
+			if errorStatus == "" {
+				writeProblem(w, problem)
+				return
+			}
+			w.Header().Set("X-Apisprout-Validation-Error", strings.Join(strings.Fields(problem.Detail), " "))
+		}
+		markPhase(req, "validation")
+	}
+
+	var negotiator *ContentNegotiator
+	if accept := req.Header.Get("Accept"); accept != "" {
+		negotiator = NewContentNegotiator(accept)
+		if accept != "*/*" {
+			info = fmt.Sprintf("%s (Accept %s)", info, accept)
+		}
+	}
+
+	prefer := parsePreferHeader(req.Header.Get("Prefer"))
+	if errorStatus != "" {
+		prefer["status"] = errorStatus
+	}
+	applyExtensionDefaults(route.Operation, prefer)
+
+	exampleName := ""
+	ctx := withExampleName(req.Context(), &exampleName)
+
+	status, mediatype, headers, example, err := getExample(ctx, negotiator, prefer, route.Operation, s.rand)
+	if req.Context().Err() != nil {
+		// The client went away, so there is nobody to send the example to.
+		rl.logf(logNormal, "%s => Cancelled: %v", info, req.Context().Err())
+		return
+	}
+	if err != nil && s.settings().GetBool("no-example-fallback") {
+		// Ignore the client's preferences and use whatever the document's
+		// schemas can generate, letting the client know why.
+		rl.logf(logNormal, "%s => Missing example, falling back to schema", info)
+		status, mediatype, headers, example, err = getExample(ctx, nil, map[string]string{}, route.Operation, s.rand)
+		if err == nil {
+			w.Header().Set("X-Apisprout-Fallback", "No example matches the request, generated from the first available response")
+		}
+	}
+	if err != nil {
+		rl.logf(logNormal, "%s => Missing example: %v", info, err)
+		s.noExample(w)
+		return
+	}
+
+	rl.logf(logVerbose, "%s => Negotiated %s for status %d", info, mediatype, status)
+	if exampleName != "" {
+		rl.logf(logVerbose, "%s => Chose example %s", info, exampleName)
+	}
+
+	if override, ok := s.exampleOverride(route.Method, route.Path, route.Operation, status, mediatype); ok {
+		rl.logf(logVerbose, "%s => Using example override", info)
+		example = override
+	}
+	markPhase(req, "generation")
+
+	if err := s.delay(req.Context(), route.Operation, status); err != nil {
+		rl.logf(logNormal, "%s => Cancelled: %v", info, err)
+		return
+	}
+	markPhase(req, "delay")
+
+	id := route.Operation.OperationID
+	if id == "" {
+		id = route.Operation.Summary
+	}
+
+	rl.logf(logNormal, "%s (%s) => %d (%s)", info, id, status, mediatype)
+
+	var encoded []byte
+	streaming := false
+
+	if isRawExample(example) {
+		encoded, _ = encodeExample(mediatype, example)
+	} else if s.settings().GetBool("stream") && req.Method != http.MethodHead && marshalJSONMatcher.MatchString(mediatype) {
+		// Large payloads get written incrementally below rather than being
+		// encoded into memory all at once.
+		streaming = true
+	} else {
+		encoded, err = encodeExample(mediatype, example)
+		if err == ErrCannotMarshal {
+			rl.printf("ERROR: %s => Cannot marshal as '%s'", info, mediatype)
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Unable to marshal response"))
+			return
+		}
+
+		if req.Context().Err() != nil {
+			rl.logf(logNormal, "%s => Cancelled: %v", info, req.Context().Err())
+			return
+		}
+	}
+	markPhase(req, "encoding")
+
+	for name, header := range headers {
+		if header.Value != nil {
+			if status == http.StatusCreated && strings.EqualFold(name, "Location") && !hasDeclaredExample(header.Value.Schema) {
+				// Generate a useful location below instead of a placeholder.
+				continue
+			}
+
+			if isRetryStatus(status) && strings.EqualFold(name, "Retry-After") && !hasDeclaredExample(header.Value.Schema) {
+				// Use the configured delay below instead of a placeholder.
+				continue
+			}
+
+			example := name
+
+			if header.Value.Schema != nil && header.Value.Schema.Value != nil {
+				if v, err := OpenAPIExampleContext(req.Context(), ModeResponse, header.Value.Schema.Value); err == nil {
+					switch vs := v.(type) {
+					case string:
+						example = vs
+					case int, float64, bool:
+						example = fmt.Sprint(vs)
+					default:
+						rl.printf("WARNING: %s => Could not convert example value '%v' of header %s to string", info, v, name)
+					}
+				}
+			}
+
+			w.Header().Set(name, example)
+		}
+	}
+
+	// Static headers win over examples from the document.
+	s.setStaticHeaders(w, route.Operation)
+
+	if status == http.StatusCreated && w.Header().Get("Location") == "" {
+		w.Header().Set("Location", mountPrefix(req.Context())+locationHeader(route, req, example))
+	}
+
+	if isRetryStatus(status) && w.Header().Get("Retry-After") == "" {
+		if retryAfter := retryAfterSeconds(s.settings()); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+	}
+
+	if mediatype != "" {
+		w.Header().Set("Content-Type", mediatype)
+	}
+
+	if s.settings().GetBool("validate-response") {
+		response := route.Operation.Responses[matchResponseKey(route.Operation.Responses, strconv.Itoa(status))]
+		if response != nil && response.Value != nil {
+			if violations := validateMockResponse(response.Value, mediatype, example, w.Header()); len(violations) > 0 {
+				for _, v := range violations {
+					rl.printf("WARNING: %s => Response %s %s%s doesn't match the document: %s", info, v.In, v.Name, v.Pointer, v.Message)
+				}
+
+				if s.settings().GetBool("validate-response-strict") {
+					problem := &Problem{
+						Type:       "about:blank",
+						Title:      http.StatusText(http.StatusInternalServerError),
+						Status:     http.StatusInternalServerError,
+						Detail:     fmt.Sprintf("The %d response doesn't match the document", status),
+						Violations: violations,
+					}
+					writeProblem(w, problem)
+					return
+				}
+			}
+		}
+	}
+
+	if streaming {
+		w.WriteHeader(status)
+
+		enc := newStreamEncoder(req.Context(), w, s.settings().GetInt("stream-chunk-size"), s.settings().GetDuration("stream-delay"))
+		if err := enc.Encode(example); err != nil {
+			rl.printf("ERROR: %s => Unable to stream response: %v", info, err)
+		}
+		return
+	}
+
+	if !s.settings().GetBool("disable-compression") && len(encoded) > 0 {
+		if encoding := negotiateEncoding(req.Header.Get("Accept-Encoding")); encoding != "" {
+			compressed, err := compress(encoding, encoded)
+			if err != nil {
+				rl.printf("ERROR: %s => Unable to compress response: %v", info, err)
+			} else {
+				encoded = compressed
+				w.Header().Set("Content-Encoding", encoding)
+			}
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(encoded)))
+	w.WriteHeader(status)
+
+	if req.Method != http.MethodHead {
+		w.Write(encoded)
+	}
+}
+
+// authenticate checks the request against a single security scheme, using
+// the configured API keys, basic auth users, bearer tokens and token
+// verification if any.
+func (s *OpenAPIServer) authenticate(c context.Context, input *openapi3filter.AuthenticationInput) error {
+	sec := input.SecurityScheme
+	if sec.Type == "apiKey" {
+		return authenticateAPIKey(input, s.apiKeys())
+	}
+
+	if sec.Type == "http" && strings.EqualFold(sec.Scheme, "basic") && s.basic != nil {
+		return authenticateBasic(input, s.basic)
+	}
+
+	if sec.Type == "http" && strings.EqualFold(sec.Scheme, "bearer") {
+		if tokens := s.settings().GetStringSlice("auth-token"); len(tokens) > 0 || s.jwt != nil {
+			return authenticateBearer(input, tokens, s.jwt)
+		}
+	}
+
+	if sec.Type == "openIdConnect" {
+		discovery := s.settings().GetString("oidc-discovery")
+		if discovery == "" {
+			discovery, _ = extensionString(sec.ExtensionProps, "openIdConnectUrl")
+		}
+		if discovery == "" {
+			return fmt.Errorf("Security scheme '%s' has no openIdConnectUrl", input.SecuritySchemeName)
+		}
+		return authenticateBearer(input, nil, s.oidcVerifier(discovery))
+	}
+
+	return authenticate(c, input)
+}
+
+// oidcVerifier returns the token verifier for an OpenID Connect discovery
+// document, creating it if needed so that keys are only fetched once.
+func (s *OpenAPIServer) oidcVerifier(discovery string) *jwtVerifier {
+	s.oidcMu.Lock()
+	defer s.oidcMu.Unlock()
+
+	v := s.oidc[discovery]
+	if v == nil {
+		v = newOIDCVerifier(s.settings(), discovery)
+		s.oidc[discovery] = v
+	}
+
+	return v
+}
+
+// apiKeys returns the configured valid API keys, which may be given as a list
+// in a config file or as a comma-separated string.
+func (s *OpenAPIServer) apiKeys() []string {
+	if raw, ok := s.settings().Get("api-keys").(string); ok {
+		keys := make([]string, 0)
+		for _, k := range strings.Split(raw, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		return keys
+	}
+
+	return s.settings().GetStringSlice("api-keys")
+}
+
+// isRawExample returns true if an example is sent as-is rather than being
+// marshaled, e.g. a plain text example.
+func isRawExample(example interface{}) bool {
+	switch example.(type) {
+	case string, []byte:
+		return true
+	}
+	return false
+}
+
+// encodeExample returns the body of a response with an example, marshaling
+// it for JSON and YAML media types.
+func encodeExample(mediatype string, example interface{}) ([]byte, error) {
+	switch v := example.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+
+	if marshalJSONMatcher.MatchString(mediatype) {
+		return json.MarshalIndent(example, "", "  ")
+	}
+
+	if marshalYAMLMatcher.MatchString(mediatype) {
+		return yaml.Marshal(example)
+	}
+
+	return nil, ErrCannotMarshal
+}
+
+// isRetryStatus returns true if clients are expected to retry a response
+// with the given status after waiting, as described by its `Retry-After`
+// header.
+func isRetryStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// delay waits for the time given by the `x-apisprout-delay` extension of the
+// response or its operation, returning early with an error if the request is
+// cancelled.
+func (s *OpenAPIServer) delay(ctx context.Context, op *openapi3.Operation, status int) error {
+	d, err := extensionDelay(op.ExtensionProps)
+	if response := op.Responses[matchResponseKey(op.Responses, strconv.Itoa(status))]; response != nil && response.Value != nil {
+		if _, ok := response.Value.Extensions[ExtDelay]; ok {
+			d, err = extensionDelay(response.Value.ExtensionProps)
+		}
+	}
+
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil
+	}
+
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// noExample writes the configured response used when no example can be
+// found for a request.
+func (s *OpenAPIServer) noExample(w http.ResponseWriter) {
+	status := s.settings().GetInt("no-example-status")
+	if status == 0 {
+		status = http.StatusTeapot
+	}
+
+	body := "No example available."
+	if s.settings().IsSet("no-example-body") {
+		body = s.settings().GetString("no-example-body")
+	}
+
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+// lockedSource is a random source which is safe for concurrent use, so each
+// server can have its own random number generator.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (ls *lockedSource) Int63() int64 {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.src.Int63()
+}
+
+func (ls *lockedSource) Seed(seed int64) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.src.Seed(seed)
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartTestServer(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"text/plain": {"example": "%d"}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	for i := 0; i < 10; i++ {
+		i := i
+		t.Run(fmt.Sprintf("Server %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			base, err := StartTestServer(ctx, nil, "file:///swagger.json", []byte(fmt.Sprintf(schema, i)))
+			require.NoError(t, err)
+
+			resp, err := http.Get(base + "/test")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, fmt.Sprintf("%d", i), string(body))
+		})
+	}
+}
+
+func TestStartTestServerShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	base, err := StartTestServer(ctx, nil, "file:///swagger.json", []byte(`{"paths": {}}`))
+	require.NoError(t, err)
+
+	resp, err := http.Get(base + "/__health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+
+	// The server shuts down in the background, so give it a moment.
+	for i := 0; i < 100; i++ {
+		if resp, err = http.Get(base + "/__health"); err != nil {
+			break
+		}
+		resp.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Error(t, err)
+}
+
+func TestMockCancelled(t *testing.T) {
+	s := NewOpenAPIServer(nil)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(`{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {"schema": {"type": "string"}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequest("GET", "/test", nil)
+	require.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req.WithContext(ctx))
+
+	// Nothing is written for clients which have gone away.
+	assert.Empty(t, resp.Body.String())
+}
+
+func TestKeepAlives(t *testing.T) {
+	config := viper.New()
+	config.Set("disable-keep-alives", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base, err := StartTestServer(ctx, config, "file:///swagger.json", []byte(`{"paths": {}}`))
+	require.NoError(t, err)
+
+	resp, err := http.Get(base + "/__health")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.True(t, resp.Close)
+}
+
+func TestNoExample(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {"example": {"hello": "world"}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		status   int
+		body     string
+		fallback bool
+	}{
+		{
+			name:   "Default",
+			status: http.StatusTeapot,
+			body:   "No example available.",
+		},
+		{
+			name: "Custom",
+			settings: map[string]interface{}{
+				"no-example-status": http.StatusNotImplemented,
+				"no-example-body":   "",
+			},
+			status: http.StatusNotImplemented,
+			body:   "",
+		},
+		{
+			name: "Fallback",
+			settings: map[string]interface{}{
+				"no-example-fallback": true,
+			},
+			status:   http.StatusOK,
+			body:     "{\n  \"hello\": \"world\"\n}",
+			fallback: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for k, v := range test.settings {
+				config.Set(k, v)
+			}
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req, err := http.NewRequest("GET", "/test", nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", "application/xml")
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			assert.Equal(t, test.body, resp.Body.String())
+			assert.Equal(t, test.fallback, resp.Header().Get("X-Apisprout-Fallback") != "")
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {"description": "ok"}
+					}
+				},
+				"post": {
+					"responses": {
+						"201": {"description": "created"}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/test", http.StatusOK},
+		{"HEAD", "/test", http.StatusOK},
+		{"POST", "/test", http.StatusMethodNotAllowed},
+		{"DELETE", "/test", http.StatusMethodNotAllowed},
+		{"GET", "/__schema", http.StatusNotFound},
+		{"GET", "/__reload", http.StatusNotFound},
+		{"GET", "/__health", http.StatusOK},
+		{"GET", "/__live", http.StatusOK},
+		{"GET", "/__ready", http.StatusOK},
+		{"GET", "/__examples", http.StatusNotFound},
+		{"GET", "/__metrics", http.StatusNotFound},
+		{"GET", "/__requests", http.StatusNotFound},
+		{"GET", "/__coverage", http.StatusNotFound},
+		{"GET", "/__config", http.StatusNotFound},
+		{"GET", "/__events", http.StatusNotFound},
+		{"GET", "/__admin", http.StatusNotFound},
+		{"GET", "/__docs", http.StatusNotFound},
+		{"GET", "/__redoc", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			config := viper.New()
+			config.Set("read-only", true)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req, err := http.NewRequest(test.method, test.path, nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.status == http.StatusMethodNotAllowed {
+				assert.Equal(t, "GET, HEAD", resp.Header().Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {"description": "ok"},
+						"429": {
+							"description": "too many requests",
+							"headers": {%s}
+						},
+						"503": {"description": "unavailable"}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name       string
+		headers    string
+		retryAfter interface{}
+		status     string
+		expected   string
+	}{
+		{
+			name:     "Default",
+			status:   "429",
+			expected: "1",
+		},
+		{
+			name:       "Configured",
+			retryAfter: 30,
+			status:     "503",
+			expected:   "30",
+		},
+		{
+			name:       "Disabled",
+			retryAfter: 0,
+			status:     "503",
+			expected:   "",
+		},
+		{
+			name:       "Declared",
+			headers:    `"Retry-After": {"schema": {"type": "integer", "example": 120}}`,
+			retryAfter: 30,
+			status:     "429",
+			expected:   "120",
+		},
+		{
+			name:       "Declared without example",
+			headers:    `"Retry-After": {"schema": {"type": "integer"}}`,
+			retryAfter: 30,
+			status:     "429",
+			expected:   "30",
+		},
+		{
+			name:     "Success",
+			status:   "200",
+			expected: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			if test.retryAfter != nil {
+				config.Set("retry-after", test.retryAfter)
+			}
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(fmt.Sprintf(schema, test.headers))))
+
+			req, err := http.NewRequest("GET", "/test", nil)
+			require.NoError(t, err)
+			req.Header.Set("Prefer", "status="+test.status)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, fmt.Sprintf("%d", resp.Code))
+			assert.Equal(t, test.expected, resp.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		w.Write([]byte(`{"paths": {}}`))
+	}))
+	defer remote.Close()
+
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.Load(remote.URL+"/openapi.json", []byte(`{"paths": {}}`)))
+
+	errs := make(chan error, 5)
+	go func() {
+		errs <- s.Reload()
+	}()
+	<-started
+
+	// These all join the reload which is already in progress.
+	for i := 0; i < 4; i++ {
+		go func() {
+			errs <- s.Reload()
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	mu.Lock()
+	assert.Equal(t, 1, fetches)
+	mu.Unlock()
+
+	// Once finished, the next reload fetches the document again.
+	assert.NoError(t, s.Reload())
+
+	mu.Lock()
+	assert.Equal(t, 2, fetches)
+	mu.Unlock()
+}
+
+func TestReloadWhileServing(t *testing.T) {
+	doc := []byte(`{"paths": {"/test": {"get": {"responses": {"204": {"description": "ok"}}}}}}`)
+
+	s := NewOpenAPIServer(viper.New())
+	require.NoError(t, s.Load("file:///swagger.json", doc))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, s.Load("file:///swagger.json", doc))
+		}
+	}()
+
+	for serving := true; serving; {
+		select {
+		case <-done:
+			serving = false
+		default:
+		}
+
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, httptest.NewRequest("GET", "/test", nil))
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+	}
+}
+
+func TestNewOpenAPIServerWithRouter(t *testing.T) {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(`{
+		"paths": {
+			"/pets": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {"example": ["Fido"]}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	// Serve the operation under a rewritten path.
+	rewritten := *swagger
+	rewritten.Paths = openapi3.Paths{"/v2/animals": swagger.Paths["/pets"]}
+	router := openapi3filter.NewRouter().WithSwagger(&rewritten)
+
+	s := NewOpenAPIServerWithRouter(viper.New(), swagger, router)
+	assert.Equal(t, swagger, s.Swagger())
+
+	for path, status := range map[string]int{"/v2/animals": http.StatusOK, "/pets": http.StatusNotFound} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+
+		assert.Equal(t, status, resp.Code, path)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"post": {
+					"requestBody": {
+						"required": true,
+						"content": {
+							"application/json": {
+								"schema": {"type": "object", "required": ["name"]}
+							}
+						}
+					},
+					"responses": {
+						"204": {"description": "ok"}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"Small", `{"name": "a"}`, false, http.StatusNoContent},
+		{"Small chunked", `{"name": "a"}`, true, http.StatusNoContent},
+		{"Small invalid", `{}`, false, http.StatusBadRequest},
+		{"Large", `{"name": "abcdefghijklmnopqrstuvwxyz"}`, false, http.StatusRequestEntityTooLarge},
+		{"Large chunked", `{"name": "abcdefghijklmnopqrstuvwxyz"}`, true, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("validate-request", true)
+			config.Set("max-body-size", 20)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req, err := http.NewRequest("POST", "/test", strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if test.chunked {
+				req.ContentLength = -1
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+		})
+	}
+}
+
+func TestReloadLocalFile(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {"text/plain": {"example": "%s"}}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	f, err := ioutil.TempFile("", "reload*.json")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(fmt.Sprintf(schema, "before")), 0644))
+
+	config := viper.New()
+	config.Set("reload-token", "secret")
+
+	s := NewOpenAPIServer(config)
+	data, err := fetch(config, f.Name())
+	require.NoError(t, err)
+	require.NoError(t, s.Load(f.Name(), data))
+
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(fmt.Sprintf(schema, "after")), 0644))
+
+	get := func(path, auth string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		resp := httptest.NewRecorder()
+		s.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := get("/__reload", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "before", get("/test", "").Body.String())
+
+	resp = get("/__reload", "Bearer wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = get("/__reload", "Bearer secret")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "after", get("/test", "").Body.String())
+}
+
+func TestSchemaFormat(t *testing.T) {
+	const yamlDoc = "# Comments are kept\npaths:\n  /test:\n    get:\n      responses:\n        '204':\n          description: ok\n"
+	const jsonDoc = `{"paths": {"/test": {"get": {"responses": {"204": {"description": "ok"}}}}}}`
+
+	tests := []struct {
+		name        string
+		uri         string
+		doc         string
+		flag        string
+		accept      string
+		query       string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"Original YAML", "openapi.yaml", yamlDoc, "", "", "", http.StatusOK, "application/yaml; charset=utf-8", yamlDoc},
+		{"Original JSON", "openapi.json", jsonDoc, "", "*/*", "", http.StatusOK, "application/json; charset=utf-8", jsonDoc},
+		{"Accept JSON", "openapi.yaml", yamlDoc, "", "application/json", "", http.StatusOK, "application/json; charset=utf-8", `{"paths":{"/test":{"get":{"responses":{"204":{"description":"ok"}}}}}}`},
+		{"Accept YAML", "openapi.json", jsonDoc, "", "text/html, application/yaml;q=0.9", "", http.StatusOK, "application/yaml; charset=utf-8", "paths:\n  /test:\n    get:\n      responses:\n        \"204\":\n          description: ok\n"},
+		{"Accept same", "openapi.yml", yamlDoc, "", "application/x-yaml", "", http.StatusOK, "application/yaml; charset=utf-8", yamlDoc},
+		{"Query", "openapi.yaml", yamlDoc, "", "application/yaml", "?format=json", http.StatusOK, "application/json; charset=utf-8", `{"paths":{"/test":{"get":{"responses":{"204":{"description":"ok"}}}}}}`},
+		{"Query original", "openapi.yaml", yamlDoc, "json", "application/json", "?format=original", http.StatusOK, "application/yaml; charset=utf-8", yamlDoc},
+		{"Flag", "openapi.yaml", yamlDoc, "json", "", "", http.StatusOK, "application/json; charset=utf-8", `{"paths":{"/test":{"get":{"responses":{"204":{"description":"ok"}}}}}}`},
+		{"Unknown", "openapi.yaml", yamlDoc, "", "", "?format=xml", http.StatusBadRequest, "text/plain; charset=utf-8", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("schema-format", test.flag)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load(test.uri, []byte(test.doc)))
+
+			req := httptest.NewRequest("GET", "/__schema"+test.query, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			assert.Equal(t, test.contentType, resp.Header().Get("Content-Type"))
+			if test.body != "" {
+				assert.Equal(t, test.body, resp.Body.String())
+			}
+		})
+	}
+}
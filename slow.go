@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestPhase is how long one step of handling a request took.
+type requestPhase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// requestTimings breaks down the time spent handling a request into phases
+// like routing, example generation and encoding, see `--warn-slow`.
+type requestTimings struct {
+	last   time.Time
+	phases []requestPhase
+}
+
+func newRequestTimings(start time.Time) *requestTimings {
+	return &requestTimings{last: start}
+}
+
+// mark ends the current phase, attributing the time since the previous one
+// ended to it.
+func (t *requestTimings) mark(name string) {
+	now := time.Now()
+	t.phases = append(t.phases, requestPhase{Name: name, Duration: now.Sub(t.last)})
+	t.last = now
+}
+
+// handling returns the total time spent, excluding delays configured on
+// purpose via `x-apisprout-delay`.
+func (t *requestTimings) handling() time.Duration {
+	var total time.Duration
+	for _, phase := range t.phases {
+		if phase.Name != "delay" {
+			total += phase.Duration
+		}
+	}
+	return total
+}
+
+// String describes the phases, e.g. `route 1ms, generation 620ms`.
+func (t *requestTimings) String() string {
+	parts := make([]string, 0, len(t.phases))
+	for _, phase := range t.phases {
+		parts = append(parts, fmt.Sprintf("%s %v", phase.Name, phase.Duration))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// markPhase ends a phase of handling the request, if it is being timed.
+func markPhase(req *http.Request, name string) {
+	if lw := accessLogFor(req); lw != nil && lw.timings != nil {
+		lw.timings.mark(name)
+	}
+}
+
+// warnSlow logs a warning with the timing breakdown if handling a request
+// took longer than `--warn-slow`, e.g. to find schemas whose examples are
+// expensive to generate.
+func (s *OpenAPIServer) warnSlow(req *http.Request, operationID string, timings *requestTimings) {
+	threshold := s.settings().GetDuration("warn-slow")
+	if threshold <= 0 || isAdminPath(s.settings(), req.URL.Path) {
+		return
+	}
+
+	if handling := timings.handling(); handling > threshold {
+		if operationID == "" {
+			operationID = "-"
+		}
+		log.Printf("WARNING: %s %s (%s) => Slow request took %v, over %v: %s", req.Method, req.URL.Path, operationID, handling, threshold, timings)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarnSlow(t *testing.T) {
+	const schema = `{"paths": {
+		"/items": {"get": {"operationId": "listItems", "responses": {"200": {"description": "ok", "content": {"application/json": {"example": []}}}}}},
+		"/slow": {"get": {"operationId": "getSlow", "x-apisprout-delay": "50ms", "responses": {"200": {"description": "ok", "content": {"application/json": {"example": {}}}}}}}
+	}}`
+
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		path      string
+		warning   string
+	}{
+		{"Disabled", 0, "/items", ""},
+		{"Slow", time.Nanosecond, "/items", "WARNING: GET /items (listItems) => Slow request took"},
+		{"Unmatched", time.Nanosecond, "/missing", "WARNING: GET /missing (-) => Slow request took"},
+		{"Admin routes", time.Nanosecond, "/__health", ""},
+		{"Delay excluded", 40 * time.Millisecond, "/slow", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			config := viper.New()
+			config.Set("warn-slow", test.threshold)
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+
+			if test.warning == "" {
+				assert.NotContains(t, buf.String(), "Slow request")
+			} else {
+				assert.Contains(t, buf.String(), test.warning)
+			}
+		})
+	}
+}
+
+func TestRequestTimings(t *testing.T) {
+	timings := &requestTimings{phases: []requestPhase{
+		{Name: "route", Duration: time.Millisecond},
+		{Name: "generation", Duration: 600 * time.Millisecond},
+		{Name: "delay", Duration: time.Second},
+		{Name: "encoding", Duration: 2 * time.Millisecond},
+	}}
+
+	assert.Equal(t, 603*time.Millisecond, timings.handling())
+	assert.Equal(t, "route 1ms, generation 600ms, delay 1s, encoding 2ms", timings.String())
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SpecStats describes how "mockable" an API description document is.
+type SpecStats struct {
+	Paths        int
+	Operations   int
+	Schemas      int
+	Responses    int
+	Examples     int
+	Generated    int
+	Missing      int
+	ExternalRefs []string
+	PayloadSizes map[string]int
+}
+
+// Coverage returns the percentage of responses with a body which have an
+// explicit example in the document.
+func (s *SpecStats) Coverage() float64 {
+	if s.Responses == 0 {
+		return 100.0
+	}
+
+	return float64(s.Examples) / float64(s.Responses) * 100.0
+}
+
+// collectStats walks the loaded document and gathers statistics about its
+// paths, operations and examples. The raw document is used to discover
+// external references, as those are resolved while loading.
+func collectStats(swagger *openapi3.Swagger, data []byte) (*SpecStats, error) {
+	stats := &SpecStats{
+		Paths:        len(swagger.Paths),
+		Schemas:      len(swagger.Components.Schemas),
+		PayloadSizes: make(map[string]int),
+	}
+
+	// Use a fixed seed so the estimates are stable between runs.
+	rnd := rand.New(rand.NewSource(1))
+
+	for path, item := range swagger.Paths {
+		for method, op := range item.Operations() {
+			stats.Operations++
+
+			for _, response := range op.Responses {
+				if response.Value == nil {
+					continue
+				}
+
+				for _, mt := range response.Value.Content {
+					stats.Responses++
+					if mt.Example != nil || len(mt.Examples) > 0 {
+						stats.Examples++
+					} else if mt.Schema != nil && mt.Schema.Value != nil {
+						if _, err := OpenAPIExample(ModeResponse, mt.Schema.Value); err == nil {
+							stats.Generated++
+						} else {
+							stats.Missing++
+						}
+					} else {
+						stats.Missing++
+					}
+				}
+			}
+
+			// Estimate the size of the payload that would be sent for a default
+			// request to this operation.
+			_, mediatype, _, example, err := getExample(context.Background(), nil, map[string]string{}, op, rnd)
+			if err != nil {
+				continue
+			}
+
+			size := 0
+			switch v := example.(type) {
+			case string:
+				size = len(v)
+			case []byte:
+				size = len(v)
+			default:
+				var encoded []byte
+				if marshalYAMLMatcher.MatchString(mediatype) {
+					encoded, err = yaml.Marshal(example)
+				} else {
+					encoded, err = json.MarshalIndent(example, "", "  ")
+				}
+				if err != nil {
+					continue
+				}
+				size = len(encoded)
+			}
+
+			stats.PayloadSizes[fmt.Sprintf("%s %s", strings.ToUpper(method), path)] = size
+		}
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	findExternalRefs(raw, seen)
+	for ref := range seen {
+		stats.ExternalRefs = append(stats.ExternalRefs, ref)
+	}
+	sort.Strings(stats.ExternalRefs)
+
+	return stats, nil
+}
+
+// findExternalRefs recursively looks for `$ref` values which point outside of
+// the current document.
+func findExternalRefs(value interface{}, seen map[string]bool) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			if ref, ok := item.(string); ok && k == "$ref" {
+				if !strings.HasPrefix(ref, "#") {
+					seen[ref] = true
+				}
+				continue
+			}
+			findExternalRefs(item, seen)
+		}
+	case []interface{}:
+		for _, item := range v {
+			findExternalRefs(item, seen)
+		}
+	}
+}
+
+// stats loads an OpenAPI file and prints statistics about it, to help gauge
+// how well it can be mocked.
+func stats(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	swagger, _, err := load(viper.GetViper(), uri, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := collectStats(swagger, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("📊 %s\n", swagger.Info.Title)
+	fmt.Printf("Paths:         %d\n", s.Paths)
+	fmt.Printf("Operations:    %d\n", s.Operations)
+	fmt.Printf("Schemas:       %d\n", s.Schemas)
+	fmt.Printf("Responses:     %d\n", s.Responses)
+	fmt.Printf("• Examples:    %d (%.1f%% coverage)\n", s.Examples, s.Coverage())
+	fmt.Printf("• Generated:   %d\n", s.Generated)
+	fmt.Printf("• Missing:     %d\n", s.Missing)
+	fmt.Printf("External refs: %d\n", len(s.ExternalRefs))
+	for _, ref := range s.ExternalRefs {
+		fmt.Println("• " + ref)
+	}
+
+	if len(s.PayloadSizes) > 0 {
+		ops := make([]string, 0, len(s.PayloadSizes))
+		total := 0
+		for op, size := range s.PayloadSizes {
+			ops = append(ops, op)
+			total += size
+		}
+		sort.Slice(ops, func(i, j int) bool {
+			if s.PayloadSizes[ops[i]] != s.PayloadSizes[ops[j]] {
+				return s.PayloadSizes[ops[i]] > s.PayloadSizes[ops[j]]
+			}
+			return ops[i] < ops[j]
+		})
+
+		fmt.Printf("Payload sizes: %d bytes average, %d bytes total\n", total/len(ops), total)
+		for i, op := range ops {
+			if i >= 5 {
+				break
+			}
+			fmt.Printf("• %s: %d bytes\n", op, s.PayloadSizes[op])
+		}
+	}
+}
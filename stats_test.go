@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectStats(t *testing.T) {
+	const schema = `{
+		"components": {
+			"schemas": {
+				"Pet": {"type": "object", "properties": {"name": {"type": "string"}}}
+			}
+		},
+		"paths": {
+			"/pets": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"schema": {"$ref": "#/components/schemas/Pet"}
+								}
+							}
+						}
+					}
+				},
+				"post": {
+					"responses": {
+						"201": {
+							"description": "created",
+							"content": {
+								"application/json": {"example": {"id": 1}}
+							}
+						},
+						"400": {
+							"description": "error",
+							"content": {
+								"application/json": {"schema": {}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	swagger, _, err := load(viper.GetViper(), "file:///swagger.json", []byte(schema))
+	require.NoError(t, err)
+
+	s, err := collectStats(swagger, []byte(schema))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, s.Paths)
+	assert.Equal(t, 2, s.Operations)
+	assert.Equal(t, 1, s.Schemas)
+	assert.Equal(t, 3, s.Responses)
+	assert.Equal(t, 1, s.Examples)
+	assert.Equal(t, 1, s.Generated)
+	assert.Equal(t, 1, s.Missing)
+	assert.InDelta(t, 33.3, s.Coverage(), 0.1)
+	assert.Empty(t, s.ExternalRefs)
+	assert.Equal(t, len("{\n  \"name\": \"string\"\n}"), s.PayloadSizes["GET /pets"])
+}
+
+func TestFindExternalRefs(t *testing.T) {
+	var raw interface{} = map[interface{}]interface{}{
+		"a": map[interface{}]interface{}{"$ref": "#/components/schemas/Local"},
+		"b": []interface{}{
+			map[interface{}]interface{}{"$ref": "other.yaml#/Pet"},
+			map[interface{}]interface{}{"$ref": "https://example.com/api.yaml"},
+		},
+	}
+
+	seen := make(map[string]bool)
+	findExternalRefs(raw, seen)
+
+	assert.Equal(t, map[string]bool{
+		"other.yaml#/Pet":              true,
+		"https://example.com/api.yaml": true,
+	}, seen)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// statsdUnsafe matches characters which can't be used in StatsD metric names
+// or Datadog tag values.
+var statsdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// statsdEmitter sends per-operation request counts and timings over UDP, as
+// a lighter alternative to `/__metrics` for teams not running Prometheus.
+// The `statsd` format puts the operation and status into the metric names,
+// e.g. `apisprout.requests.listItems.200`, while the `datadog` format sends
+// them as DogStatsD tags.
+type statsdEmitter struct {
+	conn   net.Conn
+	prefix string
+	format string
+}
+
+// newStatsdEmitter creates an emitter sending to a `host:port` address.
+func newStatsdEmitter(addr, prefix, format string) (*statsdEmitter, error) {
+	if format == "" {
+		format = "statsd"
+	}
+
+	if format != "statsd" && format != "datadog" {
+		return nil, fmt.Errorf("Unknown StatsD format '%s'", format)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsdEmitter{
+		conn:   conn,
+		prefix: prefix,
+		format: format,
+	}, nil
+}
+
+// observeRequest sends the count and timing of a handled request. Metrics
+// are dropped if they can't be sent, so requests are never slowed down.
+func (e *statsdEmitter) observeRequest(operation, method string, status int, duration time.Duration) {
+	if _, err := e.conn.Write(e.payload(operation, method, status, duration)); err != nil {
+		log.Printf("WARNING: Unable to send StatsD metrics: %v", err)
+	}
+}
+
+// payload returns the metrics for a request as a single packet.
+func (e *statsdEmitter) payload(operation, method string, status int, duration time.Duration) []byte {
+	if operation == "" {
+		operation = "unknown"
+	}
+	operation = statsdUnsafe.ReplaceAllString(operation, "_")
+	ms := strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 3, 64)
+
+	if e.format == "datadog" {
+		tags := fmt.Sprintf("|#operation:%s,method:%s,status:%d", operation, statsdUnsafe.ReplaceAllString(method, "_"), status)
+		return []byte(fmt.Sprintf("%srequests:1|c%s\n%sresponse_time:%s|ms%s", e.prefix, tags, e.prefix, ms, tags))
+	}
+
+	return []byte(fmt.Sprintf("%srequests.%s.%d:1|c\n%sresponse_time.%s:%s|ms", e.prefix, operation, status, e.prefix, operation, ms))
+}
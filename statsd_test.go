@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsdPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		operation string
+		expected  string
+	}{
+		{"statsd", "statsd", "listItems", "apisprout.requests.listItems.200:1|c\napisprout.response_time.listItems:12.500|ms"},
+		{"statsd-unsafe", "", "items.list:all", "apisprout.requests.items_list_all.200:1|c\napisprout.response_time.items_list_all:12.500|ms"},
+		{"statsd-unknown", "statsd", "", "apisprout.requests.unknown.200:1|c\napisprout.response_time.unknown:12.500|ms"},
+		{"datadog", "datadog", "listItems", "apisprout.requests:1|c|#operation:listItems,method:GET,status:200\napisprout.response_time:12.500|ms|#operation:listItems,method:GET,status:200"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := newStatsdEmitter("127.0.0.1:8125", "apisprout.", test.format)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, string(e.payload(test.operation, "GET", 200, 12500*time.Microsecond)))
+		})
+	}
+
+	_, err := newStatsdEmitter("127.0.0.1:8125", "", "graphite")
+	assert.Error(t, err)
+}
+
+func TestStatsdRequests(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	config := viper.New()
+	config.Set("statsd-addr", conn.LocalAddr().String())
+	config.Set("statsd-prefix", "mock.")
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(`{
+		"paths": {"/items": {"get": {"operationId": "listItems", "responses": {"204": {"description": "ok"}}}}}
+	}`)))
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf[:n]), "mock.requests.listItems.204:1|c\nmock.response_time.listItems:")
+}
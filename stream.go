@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// streamEncoder writes indented JSON incrementally, flushing the output
+// every time a chunk's worth of bytes has been written. The output is the same
+// as `json.MarshalIndent(v, "", "  ")` but large arrays and objects never need
+// to be fully encoded in memory, and clients receive data progressively.
+type streamEncoder struct {
+	ctx       context.Context
+	w         io.Writer
+	chunkSize int
+	delay     time.Duration
+	pending   int
+}
+
+// newStreamEncoder creates a new encoder which writes to `w`, flushing every
+// `chunkSize` bytes and optionally waiting for `delay` after each flush.
+func newStreamEncoder(ctx context.Context, w io.Writer, chunkSize int, delay time.Duration) *streamEncoder {
+	return &streamEncoder{
+		ctx:       ctx,
+		w:         w,
+		chunkSize: chunkSize,
+		delay:     delay,
+	}
+}
+
+// Encode writes the value as JSON and flushes any remaining output.
+func (e *streamEncoder) Encode(v interface{}) error {
+	if err := e.encode(v, ""); err != nil {
+		return err
+	}
+
+	return e.flush()
+}
+
+func (e *streamEncoder) encode(v interface{}, indent string) error {
+	switch value := v.(type) {
+	case []interface{}:
+		if len(value) == 0 {
+			return e.write([]byte("[]"))
+		}
+
+		if err := e.write([]byte("[\n")); err != nil {
+			return err
+		}
+
+		for i, item := range value {
+			if err := e.write([]byte(indent + "  ")); err != nil {
+				return err
+			}
+
+			if err := e.encode(item, indent+"  "); err != nil {
+				return err
+			}
+
+			if err := e.separator(i, len(value)); err != nil {
+				return err
+			}
+		}
+
+		return e.write([]byte(indent + "]"))
+	case map[string]interface{}:
+		if len(value) == 0 {
+			return e.write([]byte("{}"))
+		}
+
+		// Match the standard library, which sorts map keys.
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		if err := e.write([]byte("{\n")); err != nil {
+			return err
+		}
+
+		for i, k := range keys {
+			key, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+
+			if err := e.write([]byte(indent + "  " + string(key) + ": ")); err != nil {
+				return err
+			}
+
+			if err := e.encode(value[k], indent+"  "); err != nil {
+				return err
+			}
+
+			if err := e.separator(i, len(keys)); err != nil {
+				return err
+			}
+		}
+
+		return e.write([]byte(indent + "}"))
+	}
+
+	encoded, err := json.MarshalIndent(v, indent, "  ")
+	if err != nil {
+		return err
+	}
+
+	return e.write(encoded)
+}
+
+// separator writes the separator after the item at `index` of `count` items.
+func (e *streamEncoder) separator(index, count int) error {
+	if index < count-1 {
+		return e.write([]byte(",\n"))
+	}
+
+	return e.write([]byte("\n"))
+}
+
+// write sends data to the client, flushing once enough has been written.
+func (e *streamEncoder) write(data []byte) error {
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+
+	e.pending += len(data)
+	if e.chunkSize > 0 && e.pending >= e.chunkSize {
+		return e.flush()
+	}
+
+	return nil
+}
+
+// flush sends any buffered output to the client and then waits for the
+// configured delay, giving up if the client has gone away.
+func (e *streamEncoder) flush() error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	e.pending = 0
+
+	if e.delay > 0 {
+		select {
+		case <-time.After(e.delay):
+		case <-e.ctx.Done():
+			return e.ctx.Err()
+		}
+	}
+
+	return nil
+}
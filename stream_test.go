@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEncoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"Scalar", `"hello <world>"`},
+		{"Empty array", `[]`},
+		{"Empty object", `{}`},
+		{"Array", `[1, "two", true, null]`},
+		{"Nested", `{"b": [{"id": 1}, {"id": 2, "tags": []}], "a": {"c": {}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var value interface{}
+			require.NoError(t, json.Unmarshal([]byte(test.value), &value))
+
+			expected, err := json.MarshalIndent(value, "", "  ")
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			err = newStreamEncoder(context.Background(), w, 8, 0).Encode(value)
+			require.NoError(t, err)
+
+			assert.Equal(t, string(expected), w.Body.String())
+			assert.True(t, w.Flushed)
+		})
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	config := viper.New()
+	config.Set("stream", true)
+	config.Set("stream-chunk-size", 16)
+
+	s := NewOpenAPIServer(config)
+	err := s.Load("file:///swagger.json", []byte(`{
+		"paths": {
+			"/test": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"example": [{"id": 1}, {"id": 2}, {"id": 3}]
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/test", nil)
+	require.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Length"))
+	assert.JSONEq(t, `[{"id": 1}, {"id": 2}, {"id": 3}]`, resp.Body.String())
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Finding levels reported by the `validate` command.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// Finding is a single problem found while validating a document.
+type Finding struct {
+	Level     string
+	Operation string
+	Location  string
+	Pointer   string
+	Message   string
+}
+
+func (f Finding) String() string {
+	where := strings.TrimSpace(f.Operation + " " + f.Location)
+	if f.Pointer != "" {
+		where += " at \"" + f.Pointer + "\""
+	}
+
+	if where == "" {
+		return fmt.Sprintf("%s: %s", strings.ToUpper(f.Level), f.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", strings.ToUpper(f.Level), where, f.Message)
+}
+
+// validateDocument checks that the declared examples of a loaded document
+// match their schemas and that an example can be generated for every
+// response without one.
+func validateDocument(swagger *openapi3.Swagger) []Finding {
+	findings := make([]Finding, 0)
+
+	for path, item := range swagger.Paths {
+		for method, op := range item.Operations() {
+			operation := fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				for mediatype, mt := range op.RequestBody.Value.Content {
+					findings = append(findings, validateMediaType(operation, "request "+mediatype, ModeRequest, mt)...)
+				}
+			}
+
+			for status, response := range op.Responses {
+				if response.Value == nil {
+					continue
+				}
+
+				for mediatype, mt := range response.Value.Content {
+					findings = append(findings, validateMediaType(operation, status+" "+mediatype, ModeResponse, mt)...)
+				}
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Level != findings[j].Level {
+			return findings[i].Level == LevelError
+		}
+		return findings[i].String() < findings[j].String()
+	})
+
+	return findings
+}
+
+// validateMediaType checks the examples of a single media type.
+func validateMediaType(operation, location string, mode Mode, mt *openapi3.MediaType) []Finding {
+	findings := make([]Finding, 0)
+
+	if mt.Schema == nil || mt.Schema.Value == nil {
+		if mt.Example == nil && len(mt.Examples) == 0 {
+			findings = append(findings, Finding{
+				Level:     LevelWarning,
+				Operation: operation,
+				Location:  location,
+				Message:   "No example or schema",
+			})
+		}
+		return findings
+	}
+
+	check := func(location string, value interface{}) {
+		if err := mt.Schema.Value.VisitJSON(value); err != nil {
+			v := schemaViolation("body", "", err)
+			findings = append(findings, Finding{
+				Level:     LevelError,
+				Operation: operation,
+				Location:  location,
+				Pointer:   v.Pointer,
+				Message:   v.Message,
+			})
+		}
+	}
+
+	if mt.Example != nil {
+		check(location+" example", mt.Example)
+	}
+
+	names := make([]string, 0, len(mt.Examples))
+	for name := range mt.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ex := mt.Examples[name]; ex != nil && ex.Value != nil && ex.Value.Value != nil {
+			check(fmt.Sprintf("%s example '%s'", location, name), ex.Value.Value)
+		}
+	}
+
+	if mt.Example == nil && len(mt.Examples) == 0 {
+		if _, err := OpenAPIExampleContext(context.Background(), mode, mt.Schema.Value); err != nil {
+			finding := Finding{
+				Level:     LevelWarning,
+				Operation: operation,
+				Location:  location,
+				Message:   fmt.Sprintf("Unable to generate an example: %v", err),
+			}
+			if e, ok := err.(*ExampleGenerationError); ok {
+				finding.Pointer = e.Pointer
+				finding.Message = fmt.Sprintf("Unable to generate an example: %v", e.Err)
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
+
+// validate loads an OpenAPI file using the same loader as the mock server and
+// reports any problems with it, exiting with an error if any are found.
+func validate(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	data, err := fetch(viper.GetViper(), uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	swagger, _, err := load(viper.GetViper(), uri, data)
+	if err != nil {
+		fmt.Println(Finding{Level: LevelError, Message: err.Error()})
+		os.Exit(1)
+	}
+
+	findings := validateDocument(swagger)
+
+	errs := 0
+	for _, f := range findings {
+		if f.Level == LevelError {
+			errs++
+		}
+		fmt.Println(f)
+	}
+
+	fmt.Printf("%d error(s), %d warning(s)\n", errs, len(findings)-errs)
+
+	if errs > 0 {
+		os.Exit(1)
+	}
+}
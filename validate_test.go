@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDocument(t *testing.T) {
+	swagger, _, err := load(viper.New(), "file:///swagger.json", []byte(`{
+		"paths": {
+			"/pets": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"content": {
+								"application/json": {
+									"schema": {
+										"type": "array",
+										"items": {
+											"type": "object",
+											"properties": {"id": {"type": "integer"}}
+										}
+									},
+									"examples": {
+										"good": {"value": [{"id": 1}]},
+										"bad": {"value": [{"id": 1}, {"id": "two"}]}
+									}
+								}
+							}
+						},
+						"default": {
+							"description": "error",
+							"content": {
+								"application/json": {
+									"schema": {
+										"type": "object",
+										"properties": {"details": {}}
+									}
+								}
+							}
+						}
+					}
+				},
+				"post": {
+					"requestBody": {
+						"content": {
+							"text/plain": {}
+						}
+					},
+					"responses": {
+						"204": {"description": "ok"}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	findings := validateDocument(swagger)
+
+	messages := make([]string, len(findings))
+	for i, f := range findings {
+		messages[i] = f.String()
+	}
+
+	assert.Equal(t, []string{
+		`ERROR: GET /pets 200 application/json example 'bad' at "/1/id": Field must be set to string or not be present`,
+		`WARNING: GET /pets default application/json at "/details": Unable to generate an example: No example found`,
+		`WARNING: POST /pets request text/plain: No example or schema`,
+	}, messages)
+}
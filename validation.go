@@ -0,0 +1,641 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// describeValidationError returns a human-readable description of a request
+// validation error. When a value fails to match a composed schema (`oneOf`,
+// `anyOf` or `allOf`) the underlying validator only reports that the
+// combination failed, so each branch is re-checked to find the one which came
+// closest to matching and explain why it failed.
+func describeValidationError(err error) string {
+	reqErr, ok := err.(*openapi3filter.RequestError)
+	if !ok {
+		return err.Error()
+	}
+
+	schemaErr, ok := reqErr.Err.(*openapi3.SchemaError)
+	if !ok || !isComposedSchemaError(schemaErr) {
+		return err.Error()
+	}
+
+	reason := describeSchemaError(schemaErr, nil)
+	if reqErr.Reason != "" {
+		reason = reqErr.Reason + ": " + reason
+	}
+
+	if p := reqErr.Parameter; p != nil {
+		return fmt.Sprintf("Parameter '%s' in %s has an error: %s", p.Name, p.In, reason)
+	} else if reqErr.RequestBody != nil {
+		return fmt.Sprintf("Request body has an error: %s", reason)
+	}
+
+	return reason
+}
+
+// Problem is an RFC 7807 problem details document describing why a request
+// was rejected.
+type Problem struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation codes describe the kind of a validation failure. They are stable
+// and can be used to check for specific failures instead of matching on the
+// message.
+const (
+	// CodeInvalidValue means a value doesn't match its schema. The keyword
+	// and schema snippet describe what was expected.
+	CodeInvalidValue = "invalid_value"
+
+	// CodeMissing means a required parameter or body is missing.
+	CodeMissing = "missing"
+
+	// CodeInvalidRequest means the request couldn't be parsed or is otherwise
+	// invalid, e.g. it uses an undeclared body content type.
+	CodeInvalidRequest = "invalid_request"
+
+	// CodeSecurity means none of the security requirements were satisfied.
+	CodeSecurity = "security"
+
+	// CodeReadOnly means a read-only property was sent in a request body.
+	CodeReadOnly = "read_only"
+
+	// CodeInvalidPart means a part of a multipart body is invalid.
+	CodeInvalidPart = "invalid_part"
+
+	// CodeUnsupportedMediaType means the request body's content type isn't
+	// declared for the operation.
+	CodeUnsupportedMediaType = "unsupported_media_type"
+
+	// CodeBodyTooLarge means the request body is larger than allowed.
+	CodeBodyTooLarge = "body_too_large"
+)
+
+// Violation is a machine-readable description of a single validation failure.
+// `In` is where the failure was found, i.e. `body`, `security` or one of the
+// parameter locations like `query`. Body failures include a JSON pointer to
+// the invalid value while parameter failures include the parameter name.
+// Schema failures include the schema keyword which failed, like `maximum`,
+// along with the relevant part of the schema.
+type Violation struct {
+	Code    string                 `json:"code"`
+	In      string                 `json:"in"`
+	Name    string                 `json:"name,omitempty"`
+	Pointer string                 `json:"pointer,omitempty"`
+	Keyword string                 `json:"keyword,omitempty"`
+	Schema  map[string]interface{} `json:"schema,omitempty"`
+	Message string                 `json:"message"`
+}
+
+// writeProblem sends a problem details document as the response.
+func writeProblem(w http.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// bodyTooLarge creates a problem details document for a request body which
+// is larger than the configured limit.
+func bodyTooLarge(max int64) *Problem {
+	message := fmt.Sprintf("Request body must not be larger than %d bytes", max)
+
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusRequestEntityTooLarge),
+		Status: http.StatusRequestEntityTooLarge,
+		Detail: message,
+		Violations: []Violation{{
+			Code:    CodeBodyTooLarge,
+			In:      "body",
+			Message: message,
+		}},
+	}
+}
+
+// validationProblem creates a problem details document for a request
+// validation error.
+func validationProblem(err error) *Problem {
+	violation := Violation{
+		Code:    CodeInvalidRequest,
+		In:      "request",
+		Message: err.Error(),
+	}
+
+	var violations []Violation
+
+	switch e := err.(type) {
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			violation.In = e.Parameter.In
+			violation.Name = e.Parameter.Name
+		} else if e.RequestBody != nil {
+			violation.In = "body"
+		}
+
+		if _, ok := e.Err.(*openapi3.SchemaError); ok {
+			violation = schemaViolation(violation.In, violation.Name, e.Err)
+		} else if partErr, ok := e.Err.(*PartError); ok {
+			violation.Code = CodeInvalidPart
+			violation.Pointer = "/" + escapePointer(partErr.Name)
+			violation.Message = partErr.Reason
+		} else if roErr, ok := e.Err.(*ReadOnlyError); ok {
+			violations = make([]Violation, 0, len(roErr.Pointers))
+			for _, pointer := range roErr.Pointers {
+				violations = append(violations, Violation{
+					Code:    CodeReadOnly,
+					In:      "body",
+					Pointer: pointer,
+					Message: "Property is read-only",
+				})
+			}
+		} else if e.Err == openapi3filter.ErrInvalidRequired {
+			violation.Code = CodeMissing
+			violation.Message = e.Err.Error()
+		} else if e.Err != nil {
+			violation.Message = e.Err.Error()
+		} else if e.Reason != "" {
+			violation.Message = e.Reason
+		}
+	case *openapi3filter.SecurityRequirementsError:
+		violation.Code = CodeSecurity
+		violation.In = "security"
+	}
+
+	if violations == nil {
+		violations = []Violation{violation}
+	}
+
+	status := http.StatusBadRequest
+	if isUnauthorized(err) {
+		status = http.StatusUnauthorized
+	} else if isForbidden(err) {
+		status = http.StatusForbidden
+	}
+
+	return &Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     describeValidationError(err),
+		Violations: violations,
+	}
+}
+
+// validateReadOnly checks that a JSON request body doesn't contain values
+// for properties marked as `readOnly`, which are only allowed in responses.
+func validateReadOnly(input *openapi3filter.RequestValidationInput, body *openapi3.RequestBody) error {
+	req := input.Request
+	if req.Body == nil {
+		return nil
+	}
+
+	mediatype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if !marshalJSONMatcher.MatchString(mediatype) {
+		return nil
+	}
+
+	mt := body.Content.Get(mediatype)
+	if mt == nil || mt.Schema == nil || mt.Schema.Value == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		// Already reported by the request validator.
+		return nil
+	}
+
+	found := readOnlyPointers(mt.Schema.Value, value, "")
+	if len(found) == 0 {
+		return nil
+	}
+
+	// Composed schemas may report the same value more than once.
+	sort.Strings(found)
+	pointers := make([]string, 0, len(found))
+	for i, p := range found {
+		if i == 0 || p != found[i-1] {
+			pointers = append(pointers, p)
+		}
+	}
+
+	return &openapi3filter.RequestError{
+		Input:       input,
+		RequestBody: body,
+		Err:         &ReadOnlyError{Pointers: pointers},
+	}
+}
+
+// readOnlyPointers returns JSON pointers to the values within a request body
+// which the schema marks as `readOnly`.
+func readOnlyPointers(schema *openapi3.Schema, value interface{}, pointer string) []string {
+	pointers := make([]string, 0)
+
+	for _, refs := range [][]*openapi3.SchemaRef{schema.AllOf, schema.AnyOf, schema.OneOf} {
+		for _, ref := range refs {
+			if ref != nil && ref.Value != nil {
+				pointers = append(pointers, readOnlyPointers(ref.Value, value, pointer)...)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			prop := schema.Properties[key]
+			if prop == nil {
+				prop = schema.AdditionalProperties
+			}
+			if prop == nil || prop.Value == nil {
+				continue
+			}
+
+			p := pointer + "/" + escapePointer(key)
+			if prop.Value.ReadOnly {
+				pointers = append(pointers, p)
+				continue
+			}
+			pointers = append(pointers, readOnlyPointers(prop.Value, item, p)...)
+		}
+	case []interface{}:
+		if schema.Items != nil && schema.Items.Value != nil {
+			for i, item := range v {
+				p := pointer + "/" + strconv.Itoa(i)
+				if schema.Items.Value.ReadOnly {
+					pointers = append(pointers, p)
+					continue
+				}
+				pointers = append(pointers, readOnlyPointers(schema.Items.Value, item, p)...)
+			}
+		}
+	}
+
+	return pointers
+}
+
+// errorResponseStatus returns the status of the operation's own response to
+// use for a validation failure, if it declares one. A `422` response is also
+// used for `400` failures, since many APIs use it for invalid input.
+func errorResponseStatus(op *openapi3.Operation, status int) string {
+	candidates := []int{status}
+	if status == http.StatusBadRequest {
+		candidates = append(candidates, http.StatusUnprocessableEntity)
+	}
+
+	for _, c := range candidates {
+		if key := strconv.Itoa(c); op.Responses[key] != nil {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// requestMediaTypes returns the sorted media types declared for an
+// operation's request body, if any.
+func requestMediaTypes(op *openapi3.Operation) []string {
+	types := make([]string, 0)
+	if op.RequestBody != nil && op.RequestBody.Value != nil {
+		for mt := range op.RequestBody.Value.Content {
+			types = append(types, mt)
+		}
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// unsupportedMediaType returns a problem if a request sends a body using a
+// `Content-Type` which isn't declared for the operation's request body, or
+// nil if the request is acceptable. Declared types may contain wildcards,
+// e.g. `image/*`.
+func unsupportedMediaType(req *http.Request, op *openapi3.Operation) *Problem {
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" && req.ContentLength == 0 {
+		// No body was sent.
+		return nil
+	}
+
+	types := requestMediaTypes(op)
+	if len(types) > 0 && contentType != "" {
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err == nil && NewContentNegotiator(strings.Join(types, ",")).Match(parsed) {
+			return nil
+		}
+	}
+
+	message := "A request body is not allowed"
+	if len(types) > 0 {
+		message = fmt.Sprintf("Unsupported Content-Type '%s', expected one of: %s", contentType, strings.Join(types, ", "))
+	}
+
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusUnsupportedMediaType),
+		Status: http.StatusUnsupportedMediaType,
+		Detail: message,
+		Violations: []Violation{{
+			Code:    CodeUnsupportedMediaType,
+			In:      "header",
+			Name:    "Content-Type",
+			Message: message,
+		}},
+	}
+}
+
+// validateMockResponse checks a mocked response against the document, so that
+// examples which have drifted from their schemas can be found. Only JSON
+// bodies are checked. Returns a violation for each problem found.
+func validateMockResponse(response *openapi3.Response, mediatype string, example interface{}, header http.Header) []Violation {
+	violations := make([]Violation, 0)
+
+	if mt := response.Content[mediatype]; mt != nil && mt.Schema != nil && mt.Schema.Value != nil && marshalJSONMatcher.MatchString(mediatype) {
+		// Round-trip through JSON so the value has the same types a client
+		// would see, e.g. `float64` rather than `int`.
+		var encoded []byte
+		var err error
+		if str, ok := example.(string); ok {
+			encoded = []byte(str)
+		} else {
+			encoded, err = json.Marshal(example)
+		}
+
+		var value interface{}
+		if err == nil {
+			err = json.Unmarshal(encoded, &value)
+		}
+
+		if err == nil {
+			err = mt.Schema.Value.VisitJSON(value)
+		}
+
+		if err != nil {
+			violations = append(violations, schemaViolation("body", "", err))
+		}
+	}
+
+	names := make([]string, 0, len(response.Headers))
+	for name := range response.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		h := response.Headers[name]
+		if h.Value == nil || h.Value.Schema == nil || h.Value.Schema.Value == nil {
+			continue
+		}
+
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if err := h.Value.Schema.Value.VisitJSON(headerValue(h.Value.Schema.Value, value)); err != nil {
+			violations = append(violations, schemaViolation("header", name, err))
+		}
+	}
+
+	return violations
+}
+
+// headerValue converts a header string into the type expected by its schema
+// so it can be validated.
+func headerValue(schema *openapi3.Schema, value string) interface{} {
+	switch schema.Type {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// schemaViolation creates a violation from a schema validation error.
+func schemaViolation(in, name string, err error) Violation {
+	violation := Violation{
+		Code:    CodeInvalidRequest,
+		In:      in,
+		Name:    name,
+		Message: err.Error(),
+	}
+
+	if schemaErr, ok := err.(*openapi3.SchemaError); ok {
+		violation.Code = CodeInvalidValue
+		violation.Keyword = schemaErr.SchemaField
+		violation.Schema = schemaSnippet(schemaErr)
+		violation.Message = describeSchemaError(schemaErr, nil)
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			violation.Pointer = "/" + strings.Join(pointer, "/")
+			violation.Message = strings.TrimPrefix(violation.Message, fmt.Sprintf("Error at \"%s\": ", violation.Pointer))
+		} else if in == "body" {
+			violation.Pointer = "/"
+		}
+	}
+
+	return violation
+}
+
+// schemaSnippet returns the part of the schema which a value failed to match,
+// i.e. the failing keyword along with the expected type and format.
+func schemaSnippet(err *openapi3.SchemaError) map[string]interface{} {
+	if err.Schema == nil {
+		return nil
+	}
+
+	encoded, e := json.Marshal(err.Schema)
+	if e != nil {
+		return nil
+	}
+
+	var full map[string]interface{}
+	if e := json.Unmarshal(encoded, &full); e != nil {
+		return nil
+	}
+
+	keys := []string{"type", "format"}
+	if !isComposedSchemaError(err) {
+		// Composed schemas are described by the message instead, since their
+		// branches can be arbitrarily large.
+		keys = append(keys, err.SchemaField)
+	}
+
+	snippet := make(map[string]interface{})
+	for _, key := range keys {
+		if v, ok := full[key]; ok {
+			snippet[key] = v
+		}
+	}
+
+	if len(snippet) == 0 {
+		return nil
+	}
+
+	return snippet
+}
+
+// isComposedSchemaError returns true if the error is due to a composed schema
+// failing to match.
+func isComposedSchemaError(err *openapi3.SchemaError) bool {
+	switch err.SchemaField {
+	case "oneOf", "anyOf", "allOf":
+		return true
+	}
+
+	return false
+}
+
+// describeSchemaError describes a single schema error without dumping the
+// schema and value. The prefix is the JSON pointer of the value being checked
+// relative to the root of the document.
+func describeSchemaError(err *openapi3.SchemaError, prefix []string) string {
+	path := append(append([]string{}, prefix...), err.JSONPointer()...)
+
+	at := ""
+	if len(path) > 0 {
+		at = fmt.Sprintf("Error at \"/%s\": ", strings.Join(path, "/"))
+	}
+
+	if !isComposedSchemaError(err) {
+		if err.Reason != "" {
+			return at + err.Reason
+		}
+		return fmt.Sprintf("%sDoesn't match schema \"%s\"", at, err.SchemaField)
+	}
+
+	var branches []*openapi3.SchemaRef
+	switch err.SchemaField {
+	case "oneOf":
+		branches = err.Schema.OneOf
+	case "anyOf":
+		branches = err.Schema.AnyOf
+	case "allOf":
+		branches = err.Schema.AllOf
+	}
+
+	matched := make([]string, 0)
+	closest := ""
+	closestScore := -1
+	var closestErr error
+	for i, branch := range branches {
+		if branch.Value == nil {
+			continue
+		}
+
+		name := schemaBranchName(branch, i)
+		bErr := branch.Value.VisitJSON(err.Value)
+		if bErr == nil {
+			matched = append(matched, name)
+			continue
+		}
+
+		if err.SchemaField == "allOf" {
+			// The first failing branch is the reason it fails.
+			closest, closestErr = name, bErr
+			break
+		}
+
+		if score := branchScore(branch.Value, err.Value, bErr); score > closestScore {
+			closest, closestScore, closestErr = name, score, bErr
+		}
+	}
+
+	if err.SchemaField == "oneOf" && len(matched) > 1 {
+		return fmt.Sprintf("%sMatches more than one \"oneOf\" schema (%s) but must match exactly one", at, strings.Join(matched, ", "))
+	}
+
+	if closestErr == nil {
+		return fmt.Sprintf("%sDoesn't match schema \"%s\"", at, err.SchemaField)
+	}
+
+	because := closestErr.Error()
+	if e, ok := closestErr.(*openapi3.SchemaError); ok {
+		because = describeSchemaError(e, path)
+	}
+
+	if err.SchemaField == "allOf" {
+		return fmt.Sprintf("%sDoesn't match \"allOf\" schema %s: %s", at, closest, because)
+	}
+
+	return fmt.Sprintf("%sDoesn't match any \"%s\" schema, closest was %s: %s", at, err.SchemaField, closest, because)
+}
+
+// schemaBranchName returns a name for a branch of a composed schema, using
+// the referenced component name if available.
+func schemaBranchName(branch *openapi3.SchemaRef, index int) string {
+	if branch.Ref != "" {
+		return fmt.Sprintf("'%s'", branch.Ref[strings.LastIndex(branch.Ref, "/")+1:])
+	}
+
+	return fmt.Sprintf("#%d", index)
+}
+
+// branchScore estimates how close a value came to matching a schema. Errors
+// found deeper within the value mean more of it matched, and a branch of the
+// same basic type as the value is considered closer than one which isn't.
+func branchScore(schema *openapi3.Schema, value interface{}, err error) int {
+	score := 0
+	for err != nil {
+		e, ok := err.(*openapi3.SchemaError)
+		if !ok {
+			break
+		}
+		score += len(e.JSONPointer()) * 2
+		err = e.Origin
+	}
+
+	if schema.Type != "" && schema.Type == jsonType(value) {
+		score++
+	} else if schema.Type == "integer" && jsonType(value) == "number" {
+		score++
+	}
+
+	return score
+}
+
+// jsonType returns the JSON schema type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return ""
+}
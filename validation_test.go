@@ -0,0 +1,525 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const composedSchema = `{
+	"components": {
+		"schemas": {
+			"Cat": {
+				"type": "object",
+				"required": ["meow"],
+				"properties": {
+					"meow": {"type": "boolean"}
+				}
+			},
+			"Dog": {
+				"type": "object",
+				"required": ["bark"],
+				"properties": {
+					"bark": {"type": "boolean"},
+					"size": {"type": "integer"}
+				}
+			},
+			"Named": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string"}
+				}
+			}
+		}
+	},
+	"paths": {
+		"/one": {
+			"post": {
+				"requestBody": {
+					"content": {
+						"application/json": {
+							"schema": {
+								"type": "object",
+								"properties": {
+									"pet": {
+										"oneOf": [
+											{"$ref": "#/components/schemas/Cat"},
+											{"$ref": "#/components/schemas/Dog"}
+										]
+									}
+								}
+							}
+						}
+					}
+				},
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/all": {
+			"post": {
+				"requestBody": {
+					"content": {
+						"application/json": {
+							"schema": {
+								"allOf": [
+									{"$ref": "#/components/schemas/Dog"},
+									{"$ref": "#/components/schemas/Named"}
+								]
+							}
+						}
+					}
+				},
+				"responses": {"204": {"description": "ok"}}
+			}
+		}
+	}
+}`
+
+func TestDescribeValidationError(t *testing.T) {
+	config := viper.New()
+	config.Set("validate-request", true)
+
+	s := NewOpenAPIServer(config)
+	err := s.Load("file:///swagger.json", []byte(composedSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{
+			"Closest oneOf branch",
+			"/one",
+			`{"pet": {"bark": true, "size": "big"}}`,
+			`Error at "/pet": Doesn't match any "oneOf" schema, closest was 'Dog': Error at "/pet/size": Field must be set to string or not be present`,
+		},
+		{
+			"Multiple oneOf branches",
+			"/one",
+			`{"pet": {"bark": true, "meow": true}}`,
+			`Error at "/pet": Matches more than one "oneOf" schema ('Cat', 'Dog') but must match exactly one`,
+		},
+		{
+			"Failing allOf branch",
+			"/all",
+			`{"bark": true}`,
+			`Doesn't match "allOf" schema 'Named': Property 'name' is missing`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+			assert.Equal(t, "Request body has an error: doesn't match the schema: "+test.want, problem.Detail)
+		})
+	}
+}
+
+func TestValidationProblem(t *testing.T) {
+	s := NewOpenAPIServer(viper.New())
+	s.config.Set("validate-request", true)
+	err := s.Load("file:///swagger.json", []byte(`{
+		"paths": {
+			"/pets": {
+				"post": {
+					"parameters": [
+						{"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 10}}
+					],
+					"requestBody": {
+						"required": true,
+						"content": {
+							"application/json": {
+								"schema": {
+									"type": "object",
+									"properties": {
+										"tags": {"type": "array", "items": {"type": "string"}}
+									}
+								}
+							}
+						}
+					},
+					"responses": {
+						"204": {"description": "ok"}
+					}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		query     string
+		body      string
+		violation Violation
+	}{
+		{
+			name:  "Parameter",
+			query: "?limit=50",
+			body:  `{}`,
+			violation: Violation{
+				Code:    CodeInvalidValue,
+				In:      "query",
+				Name:    "limit",
+				Keyword: "maximum",
+				Schema:  map[string]interface{}{"type": "integer", "maximum": 10.0},
+				Message: "Number must be most 10",
+			},
+		},
+		{
+			name: "Body",
+			body: `{"tags": ["a", 5]}`,
+			violation: Violation{
+				Code:    CodeInvalidValue,
+				In:      "body",
+				Pointer: "/tags/1",
+				Keyword: "type",
+				Schema:  map[string]interface{}{"type": "string"},
+				Message: "Field must be set to number, integer or not be present",
+			},
+		},
+		{
+			name:  "Missing body",
+			query: "",
+			body:  "",
+			violation: Violation{
+				Code:    CodeMissing,
+				In:      "body",
+				Message: "must have a value",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/pets"+test.query, strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			assert.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+			assert.Equal(t, "about:blank", problem.Type)
+			assert.Equal(t, "Bad Request", problem.Title)
+			assert.Equal(t, http.StatusBadRequest, problem.Status)
+			assert.NotEmpty(t, problem.Detail)
+			assert.Equal(t, []Violation{test.violation}, problem.Violations)
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/pets": {
+				"get": {
+					"responses": {
+						"200": {
+							"description": "ok",
+							"headers": {
+								"X-Total": {"schema": {"type": "integer", "example": "many"}},
+								"X-Page": {"schema": {"type": "integer", "example": 2}}
+							},
+							"content": {
+								"application/json": {
+									"schema": {
+										"type": "array",
+										"items": {
+											"type": "object",
+											"properties": {"id": {"type": "integer"}}
+										}
+									},
+									"example": [{"id": 1}, {"id": "two"}]
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name   string
+		strict bool
+		status int
+	}{
+		{"Log", false, http.StatusOK},
+		{"Strict", true, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("validate-response", true)
+			config.Set("validate-response-strict", test.strict)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+			req, err := http.NewRequest("GET", "/pets", nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if !test.strict {
+				return
+			}
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+			assert.Equal(t, "The 200 response doesn't match the document", problem.Detail)
+			require.Len(t, problem.Violations, 2)
+
+			assert.Equal(t, "body", problem.Violations[0].In)
+			assert.Equal(t, "/1/id", problem.Violations[0].Pointer)
+
+			assert.Equal(t, "header", problem.Violations[1].In)
+			assert.Equal(t, "X-Total", problem.Violations[1].Name)
+		})
+	}
+}
+
+const contentTypeSchema = `{
+	"paths": {
+		"/upload": {
+			"post": {
+				"requestBody": {
+					"content": {
+						"application/json": {"schema": {"type": "object"}},
+						"image/*": {"schema": {"type": "string", "format": "binary"}}
+					}
+				},
+				"responses": {"204": {"description": "ok"}}
+			}
+		},
+		"/empty": {
+			"post": {"responses": {"204": {"description": "ok"}}}
+		}
+	}
+}`
+
+func TestStrictContentType(t *testing.T) {
+	config := viper.New()
+	config.Set("strict-content-type", true)
+
+	s := NewOpenAPIServer(config)
+	err := s.Load("file:///swagger.json", []byte(contentTypeSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"Declared", "/upload", "application/json", "{}", http.StatusNoContent},
+		{"Declared with params", "/upload", "application/json; charset=utf-8", "{}", http.StatusNoContent},
+		{"Wildcard", "/upload", "image/png", "png", http.StatusNoContent},
+		{"No body", "/upload", "", "", http.StatusNoContent},
+		{"Undeclared", "/upload", "text/plain", "hello", http.StatusUnsupportedMediaType},
+		{"Missing", "/upload", "", "{}", http.StatusUnsupportedMediaType},
+		{"Body not allowed", "/empty", "application/json", "{}", http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+			require.NoError(t, err)
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			if test.status == http.StatusUnsupportedMediaType && test.path == "/upload" {
+				assert.Equal(t, "application/json, image/*", resp.Header().Get("Accept-Post"))
+
+				var problem Problem
+				require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+				assert.Equal(t, "Content-Type", problem.Violations[0].Name)
+			}
+		})
+	}
+}
+
+const readOnlySchema = `{
+	"components": {
+		"schemas": {
+			"Pet": {
+				"type": "object",
+				"properties": {
+					"id": {"type": "integer", "readOnly": true},
+					"name": {"type": "string"},
+					"tags": {
+						"type": "array",
+						"items": {
+							"type": "object",
+							"properties": {
+								"id": {"type": "integer", "readOnly": true},
+								"label": {"type": "string"}
+							}
+						}
+					}
+				}
+			}
+		}
+	},
+	"paths": {
+		"/pets": {
+			"post": {
+				"requestBody": {
+					"content": {
+						"application/json": {
+							"schema": {"allOf": [{"$ref": "#/components/schemas/Pet"}, {"type": "object", "properties": {"owner": {"type": "string"}}}]}
+						}
+					}
+				},
+				"responses": {"204": {"description": "ok"}}
+			}
+		}
+	}
+}`
+
+func TestRejectReadOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		reject   bool
+		body     string
+		pointers []string
+	}{
+		{"Allowed by default", false, `{"id": 1, "name": "a"}`, nil},
+		{"No read-only values", true, `{"name": "a", "owner": "b", "tags": [{"label": "c"}]}`, nil},
+		{"Top level", true, `{"id": 1, "name": "a"}`, []string{"/id"}},
+		{"Nested", true, `{"name": "a", "tags": [{"label": "c"}, {"id": 2}]}`, []string{"/tags/1/id"}},
+		{"Multiple", true, `{"id": 1, "tags": [{"id": 2}]}`, []string{"/id", "/tags/0/id"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("validate-request", true)
+			config.Set("reject-read-only", test.reject)
+
+			s := NewOpenAPIServer(config)
+			require.NoError(t, s.Load("file:///swagger.json", []byte(readOnlySchema)))
+
+			req, err := http.NewRequest("POST", "/pets", strings.NewReader(test.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			if test.pointers == nil {
+				assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+				return
+			}
+
+			require.Equal(t, http.StatusBadRequest, resp.Code)
+
+			var problem Problem
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+
+			pointers := make([]string, 0)
+			for _, v := range problem.Violations {
+				pointers = append(pointers, v.Pointer)
+			}
+			assert.Equal(t, test.pointers, pointers)
+		})
+	}
+}
+
+func TestValidationErrorExamples(t *testing.T) {
+	const schema = `{
+		"paths": {
+			"/unprocessable": {
+				"get": {
+					"parameters": [
+						{"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 10}}
+					],
+					"responses": {
+						"200": {"description": "ok", "content": {"application/json": {"example": {"ok": true}}}},
+						"422": {
+							"description": "invalid",
+							"headers": {"X-Error-Code": {"schema": {"type": "string", "example": "E42"}}},
+							"content": {"application/json": {"example": {"error": "invalid input"}}}
+						}
+					}
+				}
+			},
+			"/undeclared": {
+				"get": {
+					"parameters": [
+						{"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 10}}
+					],
+					"responses": {
+						"200": {"description": "ok", "content": {"application/json": {"example": {"ok": true}}}}
+					}
+				}
+			}
+		}
+	}`
+
+	config := viper.New()
+	config.Set("validate-request", true)
+	config.Set("validation-error-examples", true)
+
+	s := NewOpenAPIServer(config)
+	require.NoError(t, s.Load("file:///swagger.json", []byte(schema)))
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"Valid", "/unprocessable?limit=5", http.StatusOK, "application/json", `{"ok":true}`},
+		{"Declared", "/unprocessable?limit=50", http.StatusUnprocessableEntity, "application/json", `{"error":"invalid input"}`},
+		{"Undeclared", "/undeclared?limit=50", http.StatusBadRequest, "application/problem+json", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.path, nil)
+			require.NoError(t, err)
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, req)
+
+			assert.Equal(t, test.status, resp.Code)
+			assert.Equal(t, test.contentType, resp.Header().Get("Content-Type"))
+			if test.body != "" {
+				assert.JSONEq(t, test.body, resp.Body.String())
+			}
+			if test.status == http.StatusUnprocessableEntity {
+				assert.Equal(t, "E42", resp.Header().Get("X-Error-Code"))
+				assert.Contains(t, resp.Header().Get("X-Apisprout-Validation-Error"), "Number must be most 10")
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// WebSocket opcodes, see RFC 6455 section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsGUID is appended to the client's key to compute the handshake response.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessageSize limits the size of messages read from clients.
+const wsMaxMessageSize = 1 << 20
+
+// errWSClosed is returned when reading from a connection the client closed.
+var errWSClosed = errors.New("WebSocket connection closed")
+
+// errWSUnmasked is returned when a client sends an unmasked frame, which
+// servers must reject, see RFC 6455 section 5.1.
+var errWSUnmasked = errors.New("WebSocket client frame is not masked")
+
+// WebSocket close status codes, see RFC 6455 section 7.4.1.
+var (
+	wsCloseNormal   = []byte{0x03, 0xE8}
+	wsCloseProtocol = []byte{0x03, 0xEA}
+)
+
+// wsConn is a minimal server side WebSocket connection which is enough to
+// push and receive text messages.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// isWebSocketUpgrade returns true if the request asks to switch to the
+// WebSocket protocol.
+func isWebSocketUpgrade(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket") && headerContainsToken(req.Header.Get("Connection"), "upgrade")
+}
+
+// headerContainsToken returns true if a comma separated header value
+// contains a token, ignoring case.
+func headerContainsToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsAccept returns the `Sec-WebSocket-Accept` value for a client's key.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the
+// underlying connection.
+func upgradeWebSocket(w http.ResponseWriter, req *http.Request) (*wsConn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != http.MethodGet || key == "" || req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("Unsupported WebSocket handshake")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return nil, errors.New("Response writer can't be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errWSClosed
+	}
+
+	return writeWSFrame(c.conn, wsText, data, false)
+}
+
+// Close sends a close frame, unless one was sent already, and closes the
+// connection.
+func (c *wsConn) Close() error {
+	c.sendClose(wsCloseNormal)
+
+	return c.conn.Close()
+}
+
+// sendClose sends a close frame with the given payload, once.
+func (c *wsConn) sendClose(payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		writeWSFrame(c.conn, wsClose, payload, false)
+		c.closed = true
+	}
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// along the way. It returns `errWSClosed` once the client closes the
+// connection. Unmasked frames close the connection with a protocol error.
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	var message []byte
+	opcode := -1
+
+	for {
+		fin, op, payload, err := readWSFrame(c.r, true)
+		if err == errWSUnmasked {
+			c.sendClose(wsCloseProtocol)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsClose:
+			c.sendClose(payload)
+			return 0, nil, errWSClosed
+		case wsPing:
+			c.mu.Lock()
+			err = writeWSFrame(c.conn, wsPong, payload, false)
+			c.mu.Unlock()
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsContinuation:
+			if opcode == -1 {
+				return 0, nil, errors.New("Unexpected continuation frame")
+			}
+		default:
+			opcode = op
+		}
+
+		message = append(message, payload...)
+		if len(message) > wsMaxMessageSize {
+			return 0, nil, fmt.Errorf("Message is larger than %d bytes", wsMaxMessageSize)
+		}
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// writeWSFrame writes a single unfragmented frame. Clients must mask their
+// frames while servers must not.
+func writeWSFrame(w io.Writer, opcode int, payload []byte, mask bool) error {
+	header := []byte{0x80 | byte(opcode), 0}
+
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = maskBit | byte(n)
+	case n <= 0xFFFF:
+		header[1] = maskBit | 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = maskBit | 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if mask {
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		header = append(header, key...)
+
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ key[i%4]
+		}
+		payload = masked
+	}
+
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readWSFrame reads a single frame, unmasking its payload if needed. Servers
+// must require masked frames, which clients must not expect.
+func readWSFrame(r *bufio.Reader, requireMask bool) (bool, int, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if requireMask && !masked {
+		return false, 0, nil, errWSUnmasked
+	}
+
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	if length > wsMaxMessageSize {
+		return false, 0, nil, fmt.Errorf("Frame is larger than %d bytes", wsMaxMessageSize)
+	}
+
+	var key []byte
+	if masked {
+		key = make([]byte, 4)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}